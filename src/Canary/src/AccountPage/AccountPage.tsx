@@ -0,0 +1,333 @@
+import React, { useEffect, useState } from 'react';
+import { Box, Button, TextField, Typography } from '@mui/material';
+import { useNavigate } from 'react-router-dom';
+import AppThemeProvider from '../assets/AppThemeProvider';
+import { useAuthGuard } from '../utils/authUtil';
+import {
+  changeEmail,
+  changePassword,
+  createPersonalToken,
+  deleteAccount,
+  disableTwoFactor,
+  enableTwoFactor,
+  listPersonalTokens,
+  PersonalToken,
+  PersonalTokenScope,
+  regenerateRecoveryCodes,
+  revokePersonalToken,
+  startTwoFactorEnrolment,
+  TwoFactorEnrolment,
+} from './accountHandlers';
+
+const errorMessage = (err: unknown) => (err instanceof Error ? err.message : 'Unknown error');
+
+const AccountPage: React.FC = () => {
+  useAuthGuard();
+  const navigate = useNavigate();
+
+  const [enrolment, setEnrolment] = useState<TwoFactorEnrolment | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
+  const [code, setCode] = useState('');
+  const [result, setResult] = useState<string | null>(null);
+  const [deletePassword, setDeletePassword] = useState('');
+  const [currentPassword, setCurrentPassword] = useState('');
+  const [newPassword, setNewPassword] = useState('');
+  const [newEmail, setNewEmail] = useState('');
+  const [tokens, setTokens] = useState<PersonalToken[]>([]);
+  const [tokenName, setTokenName] = useState('');
+  const [tokenScope, setTokenScope] = useState<PersonalTokenScope>('export');
+  const [newToken, setNewToken] = useState<string | null>(null);
+
+  useEffect(() => {
+    listPersonalTokens()
+      .then(setTokens)
+      .catch(() => setTokens([]));
+  }, []);
+
+  const run = async (action: () => Promise<void>) => {
+    setResult(null);
+    try {
+      await action();
+    } catch (err) {
+      setResult(errorMessage(err));
+    }
+    setCode('');
+  };
+
+  const handleStart = () =>
+    run(async () => {
+      setRecoveryCodes(null);
+      setEnrolment(await startTwoFactorEnrolment());
+    });
+
+  const handleEnable = () =>
+    run(async () => {
+      setRecoveryCodes(await enableTwoFactor(code));
+      setEnrolment(null);
+      setResult('Two-factor authentication is on. Store these recovery codes somewhere safe; each works once.');
+    });
+
+  const handleRegenerate = () =>
+    run(async () => {
+      setRecoveryCodes(await regenerateRecoveryCodes(code));
+      setResult('Your old recovery codes no longer work.');
+    });
+
+  const handleDisable = () =>
+    run(async () => {
+      await disableTwoFactor(code);
+      setRecoveryCodes(null);
+      setResult('Two-factor authentication is off.');
+    });
+
+  const handleChangePassword = () =>
+    run(async () => {
+      await changePassword(currentPassword, newPassword);
+      setCurrentPassword('');
+      setNewPassword('');
+      setResult('Password changed. Your other devices have been logged out.');
+    });
+
+  const handleChangeEmail = () =>
+    run(async () => {
+      await changeEmail(currentPassword, newEmail);
+      setCurrentPassword('');
+      setNewEmail('');
+      setResult('Email changed. Follow the link we sent to your new address to verify it.');
+    });
+
+  const handleCreateToken = () =>
+    run(async () => {
+      const created = await createPersonalToken(tokenName, [tokenScope]);
+      setNewToken(created.token);
+      setTokenName('');
+      setTokens(await listPersonalTokens());
+      setResult('Copy this token now; it will not be shown again.');
+    });
+
+  const handleRevokeToken = (tokenID: string) =>
+    run(async () => {
+      await revokePersonalToken(tokenID);
+      setTokens(await listPersonalTokens());
+    });
+
+  // the code field doubles as the two-factor code for users who have it on
+  const handleDelete = () =>
+    run(async () => {
+      if (!window.confirm('Delete your account and all of your projects? This cannot be undone.')) return;
+      await deleteAccount(deletePassword, code);
+      navigate('/login');
+    });
+
+  return (
+    <AppThemeProvider>
+      <Box
+        sx={{
+          minHeight: '100vh',
+          minWidth: '100vw',
+          background: 'linear-gradient(135deg, #f5f7fa 0%, #ffffff 60%)',
+          display: 'flex',
+          flexDirection: 'column',
+          alignItems: 'center',
+        }}
+      >
+        <Box
+          sx={{
+            width: '100%',
+            maxWidth: 560,
+            border: '1px solid #d1d5db',
+            borderRadius: 1,
+            bgcolor: '#ffffff',
+            display: 'flex',
+            flexDirection: 'column',
+            gap: 2,
+            p: { xs: 4, md: 5 },
+            boxShadow: '0 8px 32px 0 rgba(31, 38, 135, 0.37), 0 1.5px 8px 0 rgba(0,0,0,0.18)',
+            mt: { xs: 8, md: 12 },
+          }}
+        >
+          <Typography variant="h5" align="center" gutterBottom sx={{ fontWeight: 600, mb: 1, color: '#111827' }}>
+            Two-factor authentication
+          </Typography>
+          <Typography sx={{ color: '#374151' }}>
+            Protect your account with a code from an authenticator app as well as your password.
+          </Typography>
+
+          {enrolment && (
+            <Box sx={{ display: 'flex', flexDirection: 'column', gap: 1 }}>
+              <Typography sx={{ color: '#111827' }}>
+                Add this key to your authenticator app, or open the link on your phone, then enter the code it shows.
+              </Typography>
+              <Typography sx={{ fontFamily: 'monospace', wordBreak: 'break-all', color: '#111827' }}>{enrolment.secret}</Typography>
+              <Typography component="a" href={enrolment.uri} sx={{ wordBreak: 'break-all', fontSize: '0.85rem' }}>
+                {enrolment.uri}
+              </Typography>
+            </Box>
+          )}
+
+          {recoveryCodes && (
+            <Box sx={{ display: 'grid', gridTemplateColumns: 'repeat(2, 1fr)', gap: 1, fontFamily: 'monospace', color: '#111827' }}>
+              {recoveryCodes.map((c) => (
+                <Typography key={c} sx={{ fontFamily: 'monospace' }}>
+                  {c}
+                </Typography>
+              ))}
+            </Box>
+          )}
+
+          <TextField
+            label="Authentication code"
+            variant="outlined"
+            autoComplete="one-time-code"
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+            helperText={enrolment ? 'Code from your authenticator app' : 'Code from your authenticator app, or a recovery code'}
+            InputProps={{ sx: { color: '#000', bgcolor: '#fff' } }}
+            InputLabelProps={{ sx: { color: '#999', '&.Mui-focused': { color: '#000' } } }}
+          />
+
+          {result && <Typography sx={{ color: '#111827', fontWeight: 600, textAlign: 'center' }}>{result}</Typography>}
+
+          <Box sx={{ display: 'flex', flexWrap: 'wrap', justifyContent: 'center', gap: 2, mt: 1 }}>
+            {enrolment ? (
+              <Button variant="contained" sx={{ textTransform: 'none', fontWeight: 600 }} onClick={handleEnable} disabled={!code}>
+                Turn on
+              </Button>
+            ) : (
+              <>
+                <Button variant="contained" sx={{ textTransform: 'none', fontWeight: 600 }} onClick={handleStart}>
+                  Set up authenticator app
+                </Button>
+                <Button variant="outlined" sx={{ textTransform: 'none', fontWeight: 600 }} onClick={handleRegenerate} disabled={!code}>
+                  New recovery codes
+                </Button>
+                <Button variant="outlined" color="error" sx={{ textTransform: 'none', fontWeight: 600 }} onClick={handleDisable} disabled={!code}>
+                  Turn off
+                </Button>
+              </>
+            )}
+          </Box>
+          <Typography variant="h6" sx={{ fontWeight: 600, mt: 2, color: '#111827' }}>
+            Password and email
+          </Typography>
+          <TextField
+            label="Current password"
+            type="password"
+            variant="outlined"
+            autoComplete="current-password"
+            value={currentPassword}
+            onChange={(e) => setCurrentPassword(e.target.value)}
+            InputProps={{ sx: { color: '#000', bgcolor: '#fff' } }}
+            InputLabelProps={{ sx: { color: '#999', '&.Mui-focused': { color: '#000' } } }}
+          />
+          <TextField
+            label="New password"
+            type="password"
+            variant="outlined"
+            autoComplete="new-password"
+            value={newPassword}
+            onChange={(e) => setNewPassword(e.target.value)}
+            InputProps={{ sx: { color: '#000', bgcolor: '#fff' } }}
+            InputLabelProps={{ sx: { color: '#999', '&.Mui-focused': { color: '#000' } } }}
+          />
+          <TextField
+            label="New email"
+            type="email"
+            variant="outlined"
+            autoComplete="email"
+            value={newEmail}
+            onChange={(e) => setNewEmail(e.target.value)}
+            InputProps={{ sx: { color: '#000', bgcolor: '#fff' } }}
+            InputLabelProps={{ sx: { color: '#999', '&.Mui-focused': { color: '#000' } } }}
+          />
+          <Box sx={{ display: 'flex', flexWrap: 'wrap', justifyContent: 'center', gap: 2 }}>
+            <Button variant="outlined" sx={{ textTransform: 'none', fontWeight: 600 }} onClick={handleChangePassword} disabled={!currentPassword || !newPassword}>
+              Change password
+            </Button>
+            <Button variant="outlined" sx={{ textTransform: 'none', fontWeight: 600 }} onClick={handleChangeEmail} disabled={!currentPassword || !newEmail}>
+              Change email
+            </Button>
+          </Box>
+
+          <Typography variant="h6" sx={{ fontWeight: 600, mt: 2, color: '#111827' }}>
+            Personal access tokens
+          </Typography>
+          <Typography sx={{ color: '#374151' }}>
+            Tokens let scripts use the API as you. Read tokens can only view, export tokens can only download datasets, and
+            write tokens can do anything except manage your account.
+          </Typography>
+          {newToken && <Typography sx={{ fontFamily: 'monospace', wordBreak: 'break-all', color: '#111827' }}>{newToken}</Typography>}
+          {tokens.map((t) => (
+            <Box key={t.id} sx={{ display: 'flex', alignItems: 'center', justifyContent: 'space-between', gap: 2 }}>
+              <Typography sx={{ color: '#111827' }}>
+                {t.name} ({t.scopes.join(', ')}) · expires {new Date(t.expiresAt).toLocaleDateString()}
+              </Typography>
+              <Button variant="text" color="error" sx={{ textTransform: 'none' }} onClick={() => handleRevokeToken(t.id)}>
+                Revoke
+              </Button>
+            </Box>
+          ))}
+          <Box sx={{ display: 'flex', gap: 2 }}>
+            <TextField
+              label="Token name"
+              variant="outlined"
+              value={tokenName}
+              onChange={(e) => setTokenName(e.target.value)}
+              sx={{ flex: 1 }}
+              InputProps={{ sx: { color: '#000', bgcolor: '#fff' } }}
+              InputLabelProps={{ sx: { color: '#999', '&.Mui-focused': { color: '#000' } } }}
+            />
+            <TextField
+              select
+              label="Scope"
+              value={tokenScope}
+              onChange={(e) => setTokenScope(e.target.value as PersonalTokenScope)}
+              SelectProps={{ native: true }}
+              InputProps={{ sx: { color: '#000', bgcolor: '#fff' } }}
+              InputLabelProps={{ sx: { color: '#999', '&.Mui-focused': { color: '#000' } } }}
+            >
+              <option value="export">export</option>
+              <option value="read">read</option>
+              <option value="write">write</option>
+            </TextField>
+          </Box>
+          <Button variant="outlined" sx={{ alignSelf: 'center', textTransform: 'none', fontWeight: 600 }} onClick={handleCreateToken} disabled={!tokenName}>
+            Create token
+          </Button>
+
+          <Typography variant="h6" sx={{ fontWeight: 600, mt: 2, color: '#111827' }}>
+            Delete account
+          </Typography>
+          <Typography sx={{ color: '#374151' }}>
+            Deletes your account, your projects and everything in them, and ends your labelling sessions. Enter your password, and
+            your authentication code above if two-factor authentication is on.
+          </Typography>
+          <TextField
+            label="Password"
+            type="password"
+            variant="outlined"
+            autoComplete="current-password"
+            value={deletePassword}
+            onChange={(e) => setDeletePassword(e.target.value)}
+            InputProps={{ sx: { color: '#000', bgcolor: '#fff' } }}
+            InputLabelProps={{ sx: { color: '#999', '&.Mui-focused': { color: '#000' } } }}
+          />
+          <Button
+            variant="contained"
+            color="error"
+            sx={{ alignSelf: 'center', textTransform: 'none', fontWeight: 600 }}
+            onClick={handleDelete}
+            disabled={!deletePassword}
+          >
+            Delete account
+          </Button>
+          <Button variant="text" onClick={() => navigate('/home')} sx={{ alignSelf: 'center', textTransform: 'none', color: '#374151' }}>
+            Back to home
+          </Button>
+        </Box>
+      </Box>
+    </AppThemeProvider>
+  );
+};
+
+export default AccountPage;
@@ -0,0 +1,66 @@
+import { authServiceUrl, CallAPI } from '../utils/apis';
+import { clearAuthCookies } from '../utils/cookieUtils';
+
+export type TwoFactorEnrolment = { secret: string; uri: string };
+type RecoveryCodesResponse = { recoveryCodes: string[] };
+
+function postToAuthService<T>(endpoint: string, payload?: object) {
+  return CallAPI<T>(`${authServiceUrl()}${endpoint}`, { method: 'POST', json: payload ?? {} });
+}
+
+// Creates a new authenticator app secret. It is not needed to log in until confirmed with enableTwoFactor.
+export function startTwoFactorEnrolment() {
+  return postToAuthService<TwoFactorEnrolment>('/2fa/enroll');
+}
+
+// Turns on two-factor login with a code from the newly set up app and returns the recovery codes.
+export async function enableTwoFactor(code: string) {
+  const data = await postToAuthService<RecoveryCodesResponse>('/2fa/enable', { code });
+  return data.recoveryCodes;
+}
+
+export async function regenerateRecoveryCodes(code: string) {
+  const data = await postToAuthService<RecoveryCodesResponse>('/2fa/recovery-codes', { code });
+  return data.recoveryCodes;
+}
+
+export async function disableTwoFactor(code: string) {
+  await postToAuthService('/2fa/disable', { code });
+}
+
+// Sets a new password. The caller's other devices are logged out.
+export async function changePassword(currentPassword: string, newPassword: string) {
+  await postToAuthService('/password/change', { currentPassword, newPassword });
+}
+
+// Moves the account to a new email, which has to be verified with the link sent to it.
+export async function changeEmail(currentPassword: string, newEmail: string) {
+  await postToAuthService('/email/change', { currentPassword, newEmail });
+}
+
+export type PersonalTokenScope = 'read' | 'write' | 'export';
+export type PersonalToken = { id: string; name: string; scopes: PersonalTokenScope[]; createdAt: string; expiresAt: string; lastUsedAt: string };
+
+export async function listPersonalTokens() {
+  const data = await CallAPI<{ tokens: PersonalToken[] }>(`${authServiceUrl()}/tokens`);
+  return data.tokens;
+}
+
+// Creates a personal access token for scripts. The returned token is the only time it can be seen.
+export function createPersonalToken(name: string, scopes: PersonalTokenScope[], expiresInDays?: number) {
+  return postToAuthService<PersonalToken & { token: string }>('/tokens', { name, scopes, expiresInDays });
+}
+
+export async function revokePersonalToken(tokenID: string) {
+  await CallAPI(`${authServiceUrl()}/tokens/${tokenID}`, { method: 'DELETE', ignoreResponse: true });
+}
+
+export type DeletionOperation = { operationID: string; status: string };
+
+// Starts deleting the caller's account and everything they own. The deletion continues on the server, so the
+// local tokens are forgotten straight away.
+export async function deleteAccount(password: string, code?: string) {
+  const op = await CallAPI<DeletionOperation>(`${authServiceUrl()}/user`, { method: 'DELETE', json: { password, code: code || undefined } });
+  clearAuthCookies();
+  return op;
+}
@@ -1,7 +1,11 @@
 import React from 'react';
 import { Routes, Route, Navigate } from 'react-router-dom';
 import LoginPage from './LoginPage/LoginPage';
+import ResetPasswordPage from './LoginPage/ResetPasswordPage';
+import VerifyEmailPage from './LoginPage/VerifyEmailPage';
+import OIDCCallbackPage from './LoginPage/OIDCCallbackPage';
 import HomePage from './HomePage/HomePage';
+import AccountPage from './AccountPage/AccountPage';
 import ProjectPage from './ProjectPage/ProjectPage';
 import ProjectsPage from './ProjectsPage/ProjectsPage';
 import AnnotatePage from './AnnotatePage/AnnotatePage';
@@ -10,7 +14,11 @@ import { ImageHandlerProvider } from './AnnotatePage/imagehandlercontext';
 const AppRouter: React.FC = () => (
   <Routes>
     <Route path="/login" element={<LoginPage />} />
+    <Route path="/reset-password" element={<ResetPasswordPage />} />
+    <Route path="/verify-email" element={<VerifyEmailPage />} />
+    <Route path="/oidc/callback" element={<OIDCCallbackPage />} />
     <Route path="/home" element={<HomePage />} />
+    <Route path="/account" element={<AccountPage />} />
     <Route path="/projects" element={<ProjectsPage />} />
     <Route path="/projects/:projectID" element={<ProjectPage />} />
 
@@ -6,7 +6,7 @@ import GroupIcon from '@mui/icons-material/Group';
 import AppThemeProvider from '../assets/AppThemeProvider';
 import { useNavigate } from 'react-router-dom';
 
-import { handleProjectsPage } from './homeHandlers';
+import { handleLogout, handleProjectsPage, handleSettings } from './homeHandlers';
 import { clearCookie, setCookie } from '../utils/cookieUtils';
 import { useAuthGuard } from '../utils/authUtil';
 import { joinSession } from '../utils/interfaces/session';
@@ -56,10 +56,8 @@ const HomePage: React.FC = () => {
     setSessionPassword('');
   }
 
-  function handleLogoutAndRedirect() {
-    // Remove JWT token from cookies
-    clearCookie('auth_token');
-    clearCookie('user_id');
+  async function handleLogoutAndRedirect() {
+    await handleLogout();
     navigate('/login');
   }
 
@@ -224,7 +222,10 @@ const HomePage: React.FC = () => {
             </Button>
           </Paper>
         </Modal>
-        <Box sx={{ position: 'fixed', right: 32, bottom: 32 }}>
+        <Box sx={{ position: 'fixed', right: 32, bottom: 32, display: 'flex', gap: 2 }}>
+          <Button variant="outlined" sx={{ ...buttonSx, width: 'auto', px: 4, fontWeight: 800 }} onClick={() => handleSettings(navigate)}>
+            Account
+          </Button>
           <Button variant="contained" sx={{ ...buttonSx, width: 'auto', px: 4, fontWeight: 800 }} onClick={handleLogoutAndRedirect}>
             Log Out
           </Button>
@@ -1,3 +1,6 @@
+import { authServiceUrl, CallAPI } from '../utils/apis';
+import { clearAuthCookies } from '../utils/cookieUtils';
+
 // Use these handlers inside a React component and pass 'navigate' from useNavigate()
 // Handles logic for HomePage buttons
 export function handleProjectsPage(navigate: (path: string) => void) {
@@ -10,12 +13,17 @@ export function handleJoinSession() {
   // console.log('Join Session button clicked');
 }
 
-export function handleSettings() {
-  // TODO: Implement navigation or logic for Settings
-  // console.log('Settings button clicked');
+export function handleSettings(navigate: (path: string) => void) {
+  navigate('/account');
 }
 
-export function handleLogout() {
-  // TODO: Implement logout logic (e.g., clear cookies, redirect to login)
-  // console.log('Logout button clicked');
+// Ends the session on the server so its tokens stop working, then forgets them locally.
+// allDevices also ends every other session of the user.
+export async function handleLogout(allDevices = false) {
+  try {
+    await CallAPI(`${authServiceUrl()}/logout${allDevices ? '/all' : ''}`, { method: 'POST' });
+  } catch (err) {
+    console.error('Logout error:', err);
+  }
+  clearAuthCookies();
 }
@@ -2,11 +2,14 @@ import React, { useState } from 'react';
 import { Box, Button, TextField, Typography, IconButton, InputAdornment } from '@mui/material';
 import Visibility from '@mui/icons-material/Visibility';
 import VisibilityOff from '@mui/icons-material/VisibilityOff';
-import { handleLogin, handleRegister } from './authHandlers';
+import { handleForgotPassword, handleLogin, handleRegister, handleTwoFactorLogin, oidcLoginUrl } from './authHandlers';
 import AppThemeProvider from '../assets/AppThemeProvider';
-import { useNavigate } from 'react-router-dom';
+import { useLocation, useNavigate } from 'react-router-dom';
 import { useSkipLogin } from '../utils/authUtil';
 
+// the name of the single sign-on provider to offer, if the auth service has one
+const oidcProviderName = import.meta.env.VITE_OIDC_PROVIDER_NAME as string | undefined;
+
 interface LoginPageProps {
   onLoginSuccess?: () => void;
 }
@@ -14,22 +17,34 @@ interface LoginPageProps {
 const LoginPage: React.FC<LoginPageProps> = ({ onLoginSuccess }) => {
   useSkipLogin();
   const navigate = useNavigate();
+  const location = useLocation();
 
   const [email, setEmail] = useState('');
   const [password, setPassword] = useState('');
   const [showPassword, setShowPassword] = useState(false);
   const [result, setResult] = useState<string | null>(null);
+  // set once the password is accepted for a user with two-factor authentication, or by the single sign-on page
+  const [challengeToken, setChallengeToken] = useState<string | null>(
+    (location.state as { challengeToken?: string } | null)?.challengeToken ?? null,
+  );
+  const [code, setCode] = useState('');
+
+  const onLoginResult = (msg: string) => {
+    setResult(msg);
+    if (msg && msg.toLowerCase().includes('login successful')) {
+      if (onLoginSuccess) onLoginSuccess();
+      navigate('/home');
+    }
+  };
 
   const handleLoginClick = async () => {
     setResult(null);
     try {
-      await handleLogin(email, password, (msg: string) => {
-        setResult(msg);
-        if (msg && msg.toLowerCase().includes('login successful')) {
-          if (onLoginSuccess) onLoginSuccess();
-          navigate('/home');
-        }
-      });
+      if (challengeToken) {
+        await handleTwoFactorLogin(challengeToken, code, onLoginResult);
+      } else {
+        await handleLogin(email, password, onLoginResult, setChallengeToken);
+      }
     } catch {
       setResult('Login failed');
     }
@@ -44,7 +59,16 @@ const LoginPage: React.FC<LoginPageProps> = ({ onLoginSuccess }) => {
     }
   };
 
-  const resultIsSuccess = result ? /success|press login/i.test(result) : false;
+  const handleForgotPasswordClick = async () => {
+    setResult(null);
+    if (!email) {
+      setResult('Enter your email to reset your password');
+      return;
+    }
+    await handleForgotPassword(email, setResult);
+  };
+
+  const resultIsSuccess = result ? /success|press login|reset link|authenticator app/i.test(result) : false;
 
   return (
     <AppThemeProvider>
@@ -140,7 +164,10 @@ const LoginPage: React.FC<LoginPageProps> = ({ onLoginSuccess }) => {
             label="Email"
             autoComplete="off"
             fullWidth
-            onChange={(e) => setEmail(e.target.value)}
+            onChange={(e) => {
+              setEmail(e.target.value);
+              setChallengeToken(null);
+            }}
             variant="outlined"
             placeholder="example@email.com"
             InputProps={{
@@ -173,7 +200,10 @@ const LoginPage: React.FC<LoginPageProps> = ({ onLoginSuccess }) => {
             label="Password"
             variant="outlined"
             type={showPassword ? 'text' : 'password'}
-            onChange={(e) => setPassword(e.target.value)}
+            onChange={(e) => {
+              setPassword(e.target.value);
+              setChallengeToken(null);
+            }}
             fullWidth
             placeholder="••••••••"
             InputProps={{
@@ -209,6 +239,29 @@ const LoginPage: React.FC<LoginPageProps> = ({ onLoginSuccess }) => {
               },
             }}
           />
+          {challengeToken && (
+            <TextField
+              label="Authentication code"
+              variant="outlined"
+              autoComplete="one-time-code"
+              autoFocus
+              fullWidth
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              placeholder="123456"
+              InputProps={{ sx: { color: '#000', bgcolor: '#fff' } }}
+              InputLabelProps={{ sx: { color: '#999', '&.Mui-focused': { color: '#000' } } }}
+              sx={{
+                alignSelf: 'center',
+                maxWidth: 480,
+                '& .MuiOutlinedInput-root .MuiOutlinedInput-notchedOutline': { borderColor: '#999' },
+                '& .MuiOutlinedInput-root.Mui-focused .MuiOutlinedInput-notchedOutline': {
+                  borderColor: '#f7bd13',
+                  borderWidth: '2px',
+                },
+              }}
+            />
+          )}
           {result && (
             <Typography
               sx={{
@@ -256,6 +309,18 @@ const LoginPage: React.FC<LoginPageProps> = ({ onLoginSuccess }) => {
               Register
             </Button>
           </Box>
+          {oidcProviderName && (
+            <Button
+              variant="outlined"
+              href={oidcLoginUrl()}
+              sx={{ alignSelf: 'center', minWidth: 296, fontWeight: 600, textTransform: 'none' }}
+            >
+              Sign in with {oidcProviderName}
+            </Button>
+          )}
+          <Button variant="text" onClick={handleForgotPasswordClick} sx={{ alignSelf: 'center', textTransform: 'none', color: '#374151' }}>
+            Forgot password?
+          </Button>
         </Box>
       </Box>
     </AppThemeProvider>
@@ -0,0 +1,81 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { Box, Button, Typography } from '@mui/material';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import { handleOIDCLogin } from './authHandlers';
+import AppThemeProvider from '../assets/AppThemeProvider';
+
+const oidcErrors: Record<string, string> = {
+  denied: 'Sign in was cancelled.',
+  expired: 'Sign in took too long. Please try again.',
+  email_unverified: 'Your sign in provider has not verified your email address.',
+};
+
+// The auth service sends the browser here once the single sign-on provider is done, with a login code to exchange
+// for tokens or the reason it failed.
+const OIDCCallbackPage: React.FC = () => {
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const loginCode = searchParams.get('loginCode') ?? '';
+  const error = searchParams.get('error');
+  const [result, setResult] = useState<string | null>(
+    error ? (oidcErrors[error] ?? 'Sign in failed. Please try again.') : loginCode ? 'Signing you in...' : 'This sign in link is invalid.',
+  );
+  // login codes work once, so guard against the effect running twice in development
+  const submitted = useRef(false);
+
+  useEffect(() => {
+    if (!loginCode || error || submitted.current) return;
+    submitted.current = true;
+    void handleOIDCLogin(
+      loginCode,
+      (msg) => {
+        setResult(msg);
+        if (msg.toLowerCase().includes('login successful')) navigate('/home', { replace: true });
+      },
+      (challengeToken) => navigate('/login', { replace: true, state: { challengeToken } }),
+    );
+  }, [loginCode, error, navigate]);
+
+  return (
+    <AppThemeProvider>
+      <Box
+        sx={{
+          minHeight: '100vh',
+          minWidth: '100vw',
+          background: 'linear-gradient(135deg, #f5f7fa 0%, #ffffff 60%)',
+          display: 'flex',
+          flexDirection: 'column',
+          alignItems: 'center',
+        }}
+      >
+        <Box
+          sx={{
+            width: '100%',
+            maxWidth: 520,
+            border: '1px solid #d1d5db',
+            borderRadius: 1,
+            bgcolor: '#ffffff',
+            display: 'flex',
+            flexDirection: 'column',
+            gap: 2,
+            p: { xs: 4, md: 5 },
+            boxShadow: '0 8px 32px 0 rgba(31, 38, 135, 0.37), 0 1.5px 8px 0 rgba(0,0,0,0.18)',
+            mt: { xs: 8, md: 12 },
+          }}
+        >
+          <Typography variant="h5" align="center" gutterBottom sx={{ fontWeight: 600, mb: 1, color: '#111827' }}>
+            Single sign-on
+          </Typography>
+          {result && <Typography sx={{ color: '#111827', fontWeight: 600, textAlign: 'center' }}>{result}</Typography>}
+          <Box sx={{ display: 'flex', justifyContent: 'center', mt: 2 }}>
+            <Button variant="contained" sx={{ minWidth: 140, fontWeight: 600, textTransform: 'none' }} onClick={() => navigate('/login')}>
+              Back to login
+            </Button>
+          </Box>
+        </Box>
+      </Box>
+    </AppThemeProvider>
+  );
+};
+
+export default OIDCCallbackPage;
@@ -0,0 +1,87 @@
+import React, { useState } from 'react';
+import { Box, Button, TextField, Typography } from '@mui/material';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import { handleResetPassword } from './authHandlers';
+import AppThemeProvider from '../assets/AppThemeProvider';
+
+// Opened from the link in a password reset email; the token comes from the link's query string.
+const ResetPasswordPage: React.FC = () => {
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token') ?? '';
+
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [result, setResult] = useState<string | null>(null);
+
+  const resultIsSuccess = result ? /successful/i.test(result) : false;
+
+  const handleResetClick = async () => {
+    setResult(null);
+    if (password !== confirmPassword) {
+      setResult('Passwords do not match');
+      return;
+    }
+    await handleResetPassword(token, password, setResult);
+  };
+
+  return (
+    <AppThemeProvider>
+      <Box
+        sx={{
+          minHeight: '100vh',
+          minWidth: '100vw',
+          background: 'linear-gradient(135deg, #f5f7fa 0%, #ffffff 60%)',
+          display: 'flex',
+          flexDirection: 'column',
+          alignItems: 'center',
+        }}
+      >
+        <Box
+          component="form"
+          noValidate
+          sx={{
+            width: '100%',
+            maxWidth: 520,
+            border: '1px solid #d1d5db',
+            borderRadius: 1,
+            bgcolor: '#ffffff',
+            display: 'flex',
+            flexDirection: 'column',
+            gap: 2,
+            p: { xs: 4, md: 5 },
+            boxShadow: '0 8px 32px 0 rgba(31, 38, 135, 0.37), 0 1.5px 8px 0 rgba(0,0,0,0.18)',
+            mt: { xs: 8, md: 12 },
+          }}
+        >
+          <Typography variant="h5" align="center" gutterBottom sx={{ fontWeight: 600, mb: 1, color: '#111827' }}>
+            Reset password
+          </Typography>
+          {!token ? (
+            <Typography sx={{ color: '#b91c1c', textAlign: 'center' }}>This reset link is invalid. Request a new one from the login page.</Typography>
+          ) : (
+            <>
+              <TextField label="New password" type="password" fullWidth onChange={(e) => setPassword(e.target.value)} />
+              <TextField label="Confirm new password" type="password" fullWidth onChange={(e) => setConfirmPassword(e.target.value)} />
+            </>
+          )}
+          {result && (
+            <Typography sx={{ color: resultIsSuccess ? '#000000ff' : '#b91c1c', fontSize: '0.9rem', fontWeight: 600, textAlign: 'center' }}>{result}</Typography>
+          )}
+          <Box sx={{ display: 'flex', justifyContent: 'center', gap: 2, mt: 2 }}>
+            {token && !resultIsSuccess && (
+              <Button variant="contained" sx={{ minWidth: 140, fontWeight: 600, textTransform: 'none' }} onClick={handleResetClick}>
+                Reset password
+              </Button>
+            )}
+            <Button variant="contained" sx={{ minWidth: 140, fontWeight: 600, textTransform: 'none' }} onClick={() => navigate('/login')}>
+              Back to login
+            </Button>
+          </Box>
+        </Box>
+      </Box>
+    </AppThemeProvider>
+  );
+};
+
+export default ResetPasswordPage;
@@ -0,0 +1,66 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { Box, Button, Typography } from '@mui/material';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import { handleVerifyEmail } from './authHandlers';
+import AppThemeProvider from '../assets/AppThemeProvider';
+
+// Opened from the link in a verification email; the token is submitted as soon as the page loads.
+const VerifyEmailPage: React.FC = () => {
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token') ?? '';
+  const [result, setResult] = useState<string | null>(token ? 'Verifying your email...' : 'This verification link is invalid.');
+  // tokens work once, so guard against the effect running twice in development
+  const submitted = useRef(false);
+
+  useEffect(() => {
+    if (!token || submitted.current) return;
+    submitted.current = true;
+    void handleVerifyEmail(token, setResult);
+  }, [token]);
+
+  const resultIsSuccess = result ? /successfully/i.test(result) : false;
+
+  return (
+    <AppThemeProvider>
+      <Box
+        sx={{
+          minHeight: '100vh',
+          minWidth: '100vw',
+          background: 'linear-gradient(135deg, #f5f7fa 0%, #ffffff 60%)',
+          display: 'flex',
+          flexDirection: 'column',
+          alignItems: 'center',
+        }}
+      >
+        <Box
+          sx={{
+            width: '100%',
+            maxWidth: 520,
+            border: '1px solid #d1d5db',
+            borderRadius: 1,
+            bgcolor: '#ffffff',
+            display: 'flex',
+            flexDirection: 'column',
+            gap: 2,
+            p: { xs: 4, md: 5 },
+            boxShadow: '0 8px 32px 0 rgba(31, 38, 135, 0.37), 0 1.5px 8px 0 rgba(0,0,0,0.18)',
+            mt: { xs: 8, md: 12 },
+          }}
+        >
+          <Typography variant="h5" align="center" gutterBottom sx={{ fontWeight: 600, mb: 1, color: '#111827' }}>
+            Verify email
+          </Typography>
+          {result && <Typography sx={{ color: resultIsSuccess ? '#000000ff' : '#b91c1c', fontWeight: 600, textAlign: 'center' }}>{result}</Typography>}
+          <Box sx={{ display: 'flex', justifyContent: 'center', mt: 2 }}>
+            <Button variant="contained" sx={{ minWidth: 140, fontWeight: 600, textTransform: 'none' }} onClick={() => navigate('/home')}>
+              Continue
+            </Button>
+          </Box>
+        </Box>
+      </Box>
+    </AppThemeProvider>
+  );
+};
+
+export default VerifyEmailPage;
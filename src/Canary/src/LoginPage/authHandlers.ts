@@ -1,38 +1,91 @@
-import { setCookie } from '../utils/cookieUtils';
-import { authServiceUrl, CallAPI } from '../utils/apis';
+import { getRefreshTokenFromCookie, setCookie } from '../utils/cookieUtils';
+import { authServiceUrl, CallAPI, refreshAuthToken } from '../utils/apis';
 
-type AuthResponse = { token?: string; userID?: string; message?: string };
+type AuthResponse = {
+  token?: string;
+  refreshToken?: string;
+  userID?: string;
+  message?: string;
+  // set instead of the tokens when the user must also enter a two-factor code
+  twoFactorRequired?: boolean;
+  challengeToken?: string;
+};
 
 async function postToAuthService(endpoint: string, payload: object) {
   return CallAPI<AuthResponse>(`${authServiceUrl()}${endpoint}`, {
     method: 'POST',
     json: payload,
+    auth: false,
   });
 }
 
-export async function handleLogin(email: string, password: string, setResult?: (msg: string) => void) {
+function storeTokens(data: AuthResponse) {
+  if (!data || !data.token) throw new Error('No token received');
+  setCookie('auth_token', data.token);
+  if (data.refreshToken) setCookie('refresh_token', data.refreshToken);
+  if (data.userID) setCookie('user_id', data.userID);
+}
+
+// onTwoFactor is called with a challenge token when the user must finish logging in with handleTwoFactorLogin.
+export async function handleLogin(
+  email: string,
+  password: string,
+  setResult?: (msg: string) => void,
+  onTwoFactor?: (challengeToken: string) => void,
+) {
   try {
     const data = await postToAuthService('/login', { email, password });
-    if (data && data.token) {
-      setCookie('auth_token', data.token);
-      if (data.userID) setCookie('user_id', data.userID);
-      if (setResult) setResult('Login successful');
-      // console.log('Login success, token set in cookie');
-    } else {
-      if (setResult) setResult('Login failed: No token received');
-      throw new Error('No token received');
+    if (data?.twoFactorRequired && data.challengeToken) {
+      if (onTwoFactor) onTwoFactor(data.challengeToken);
+      if (setResult) setResult('Enter the code from your authenticator app, or a recovery code');
+      return;
     }
+    storeTokens(data);
+    if (setResult) setResult('Login successful');
   } catch (err) {
     if (setResult) setResult('Login failed: ' + (err instanceof Error ? err.message : 'Unknown error'));
     console.error('Login error:', err);
   }
 }
 
+// The auth service page that starts logging in with the single sign-on provider.
+export function oidcLoginUrl() {
+  return `${authServiceUrl()}/oidc/login`;
+}
+
+// Finishes a single sign-on login with the code the auth service sent the browser back with. Like handleLogin,
+// onTwoFactor is called if the user must also enter a two-factor code.
+export async function handleOIDCLogin(loginCode: string, setResult?: (msg: string) => void, onTwoFactor?: (challengeToken: string) => void) {
+  try {
+    const data = await postToAuthService('/oidc/token', { loginCode });
+    if (data?.twoFactorRequired && data.challengeToken) {
+      if (onTwoFactor) onTwoFactor(data.challengeToken);
+      return;
+    }
+    storeTokens(data);
+    if (setResult) setResult('Login successful');
+  } catch (err) {
+    if (setResult) setResult('Login failed: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    console.error('Single sign-on login error:', err);
+  }
+}
+
+export async function handleTwoFactorLogin(challengeToken: string, code: string, setResult?: (msg: string) => void) {
+  try {
+    const data = await postToAuthService('/login/2fa', { challengeToken, code });
+    storeTokens(data);
+    if (setResult) setResult('Login successful');
+  } catch (err) {
+    if (setResult) setResult('Login failed: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    console.error('Two-factor login error:', err);
+  }
+}
+
 export async function handleRegister(email: string, password: string, setResult?: (msg: string) => void) {
   try {
     const data = await postToAuthService('/register', { email, password });
     const baseMessage = data?.message ?? 'User registered';
-    const message = `${baseMessage}. Please press Login to sign in.`;
+    const message = `${baseMessage}. We have emailed you a link to verify your address. Please press Login to sign in.`;
     if (setResult) setResult(message);
     // console.log('Register success:', data);
   } catch (err) {
@@ -40,3 +93,35 @@ export async function handleRegister(email: string, password: string, setResult?
     console.error('Register error:', err);
   }
 }
+
+export async function handleForgotPassword(email: string, setResult?: (msg: string) => void) {
+  try {
+    const data = await postToAuthService('/password/forgot', { email });
+    if (setResult) setResult(data?.message ?? 'If the email has an account, a reset link has been sent');
+  } catch (err) {
+    if (setResult) setResult('Password reset failed: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    console.error('Forgot password error:', err);
+  }
+}
+
+export async function handleResetPassword(token: string, password: string, setResult?: (msg: string) => void) {
+  try {
+    await postToAuthService('/password/reset', { token, password });
+    if (setResult) setResult('Password reset successful. Please log in with your new password.');
+  } catch (err) {
+    if (setResult) setResult('Password reset failed: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    console.error('Reset password error:', err);
+  }
+}
+
+export async function handleVerifyEmail(token: string, setResult?: (msg: string) => void) {
+  try {
+    await postToAuthService('/email/verify', { token });
+    // pick up the verified flag straight away if this browser is logged in
+    if (getRefreshTokenFromCookie()) await refreshAuthToken();
+    if (setResult) setResult('Email verified successfully.');
+  } catch (err) {
+    if (setResult) setResult('Email verification failed: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    console.error('Verify email error:', err);
+  }
+}
@@ -0,0 +1,160 @@
+import React, { useCallback, useEffect, useState } from 'react';
+import Box from '@mui/material/Box';
+import Typography from '@mui/material/Typography';
+import TextField from '@mui/material/TextField';
+import Button from '@mui/material/Button';
+import type { ProjectRole } from '../../utils/interfaces/interfaces';
+import { getUserIDFromCookie } from '../../utils/cookieUtils';
+import {
+  atLeast,
+  createInvite,
+  listMembers,
+  listProjectInvites,
+  memberRoles,
+  outranks,
+  ProjectInvite,
+  ProjectMember,
+  removeMember,
+  revokeInvite,
+  updateMemberRole,
+} from './membersHandler';
+
+const errorMessage = (err: unknown) => (err instanceof Error ? err.message : 'Unknown error');
+
+const fieldInputProps = { sx: { color: '#000', bgcolor: '#fff' } };
+const fieldLabelProps = { sx: { color: '#999', '&.Mui-focused': { color: '#000' } } };
+
+type MembersPanelProps = {
+  projectID?: string;
+  // the logged in user's role in the project
+  role?: ProjectRole;
+};
+
+// Lists who the project is shared with. Admins and the owner can invite people and change or remove the members
+// below them; everyone else can leave.
+export function MembersPanel({ projectID, role }: MembersPanelProps) {
+  const [members, setMembers] = useState<ProjectMember[]>([]);
+  const [invites, setInvites] = useState<ProjectInvite[]>([]);
+  const [email, setEmail] = useState('');
+  const [inviteRole, setInviteRole] = useState<ProjectRole>('annotator');
+  const [result, setResult] = useState<string | null>(null);
+  const canManage = atLeast(role, 'admin');
+  const userID = getUserIDFromCookie();
+
+  const refresh = useCallback(async () => {
+    if (!projectID) return;
+    try {
+      setMembers(await listMembers(projectID));
+      setInvites(canManage ? await listProjectInvites(projectID) : []);
+    } catch (err) {
+      setResult(errorMessage(err));
+    }
+  }, [projectID, canManage]);
+
+  useEffect(() => {
+    refresh();
+  }, [refresh]);
+
+  const run = async (action: () => Promise<unknown>, message: string) => {
+    try {
+      await action();
+      setResult(message);
+      await refresh();
+    } catch (err) {
+      setResult(errorMessage(err));
+    }
+  };
+
+  if (!projectID) return null;
+
+  return (
+    <Box sx={{ display: 'flex', flexDirection: 'column', gap: 1.5, color: '#000', maxWidth: 900, width: '100%', alignSelf: 'center' }}>
+      <Typography variant="h6" sx={{ fontWeight: 700, textAlign: 'center' }}>
+        Members
+      </Typography>
+      {members.map((m) => (
+        <Box key={m.userID} sx={{ display: 'flex', alignItems: 'center', gap: 2 }}>
+          <Typography sx={{ flex: 1 }}>{m.email || m.userID}</Typography>
+          {m.role !== 'owner' && outranks(role, m.role) ? (
+            <TextField
+              select
+              size="small"
+              value={m.role}
+              onChange={(e) => run(() => updateMemberRole(projectID, m.userID, e.target.value as ProjectRole), 'Role changed')}
+              SelectProps={{ native: true }}
+              InputProps={fieldInputProps}
+            >
+              {memberRoles
+                .filter((r) => outranks(role, r))
+                .map((r) => (
+                  <option key={r} value={r}>
+                    {r}
+                  </option>
+                ))}
+            </TextField>
+          ) : (
+            <Typography sx={{ color: '#374151' }}>{m.role}</Typography>
+          )}
+          {m.role !== 'owner' && (m.userID === userID || outranks(role, m.role)) && (
+            <Button variant="text" color="error" sx={{ textTransform: 'none' }} onClick={() => run(() => removeMember(projectID, m.userID), m.userID === userID ? 'You have left the project' : 'Member removed')}>
+              {m.userID === userID ? 'Leave' : 'Remove'}
+            </Button>
+          )}
+        </Box>
+      ))}
+
+      {canManage && (
+        <>
+          {invites.map((inv) => (
+            <Box key={inv.inviteID} sx={{ display: 'flex', alignItems: 'center', gap: 2 }}>
+              <Typography sx={{ flex: 1, color: '#374151' }}>
+                {inv.email} (invited as {inv.role}, until {new Date(inv.expiresAt).toLocaleDateString()})
+              </Typography>
+              {outranks(role, inv.role) && (
+                <Button variant="text" color="error" sx={{ textTransform: 'none' }} onClick={() => run(() => revokeInvite(projectID, inv.inviteID), 'Invite revoked')}>
+                  Revoke
+                </Button>
+              )}
+            </Box>
+          ))}
+          <Typography sx={{ color: '#374151' }}>Invite someone by email. They accept the invite on their projects page once they have verified that email.</Typography>
+          <Box sx={{ display: 'flex', gap: 2 }}>
+            <TextField label="Email" type="email" size="small" value={email} onChange={(e) => setEmail(e.target.value)} sx={{ flex: 1 }} InputProps={fieldInputProps} InputLabelProps={fieldLabelProps} />
+            <TextField
+              select
+              label="Role"
+              size="small"
+              value={inviteRole}
+              onChange={(e) => setInviteRole(e.target.value as ProjectRole)}
+              SelectProps={{ native: true }}
+              InputProps={fieldInputProps}
+              InputLabelProps={fieldLabelProps}
+            >
+              {memberRoles
+                .filter((r) => outranks(role, r))
+                .map((r) => (
+                  <option key={r} value={r}>
+                    {r}
+                  </option>
+                ))}
+            </TextField>
+            <Button
+              variant="outlined"
+              sx={{ textTransform: 'none', fontWeight: 600 }}
+              disabled={!email}
+              onClick={() =>
+                run(async () => {
+                  await createInvite(projectID, email, inviteRole);
+                  setEmail('');
+                }, `Invited ${email}`)
+              }
+            >
+              Invite
+            </Button>
+          </Box>
+        </>
+      )}
+      {result && <Typography sx={{ color: '#374151', textAlign: 'center' }}>{result}</Typography>}
+    </Box>
+  );
+}
@@ -13,6 +13,7 @@ import type { Theme } from '@mui/material/styles';
 import { useSettingsTab } from './settingsTabHandler';
 import type { Project } from '../../utils/interfaces/interfaces';
 import { useAuthGuard } from '../../utils/authUtil';
+import { MembersPanel } from './MembersPanel';
 
 type ListPanelProps = {
   inputValue: string;
@@ -341,6 +342,8 @@ export function SettingsTab({ project: _project }: SettingsTabProps) {
           </Box>
         </Box>
       </Box>
+
+      <MembersPanel projectID={projectID} role={_project?.role} />
     </Box>
   );
 }
@@ -0,0 +1,55 @@
+import { CallAPI, projectServiceUrl } from '../../utils/apis';
+import type { ProjectRole } from '../../utils/interfaces/interfaces';
+
+export type ProjectMember = { projectID: string; userID: string; email: string; role: ProjectRole; addedAt: string };
+// an invite is to either a project or an organisation
+export type ProjectInvite = { inviteID: string; projectID?: string; projectName?: string; orgID?: string; orgName?: string; email: string; role: ProjectRole; expiresAt: string };
+
+// Roles that can be given to members, lowest first. Users can only give roles below their own.
+export const memberRoles: ProjectRole[] = ['viewer', 'annotator', 'reviewer', 'admin'];
+const roleRank: Record<ProjectRole, number> = { viewer: 1, annotator: 2, reviewer: 3, admin: 4, owner: 5 };
+
+export function outranks(role: ProjectRole | undefined, other: ProjectRole) {
+  return role !== undefined && roleRank[role] > roleRank[other];
+}
+
+export function atLeast(role: ProjectRole | undefined, min: ProjectRole) {
+  return role !== undefined && roleRank[role] >= roleRank[min];
+}
+
+export function listMembers(projectID: string) {
+  return CallAPI<ProjectMember[]>(`${projectServiceUrl()}/projects/${projectID}/members`);
+}
+
+export function updateMemberRole(projectID: string, userID: string, role: ProjectRole) {
+  return CallAPI<ProjectMember>(`${projectServiceUrl()}/projects/${projectID}/members/${userID}`, { method: 'PATCH', json: { role } });
+}
+
+export async function removeMember(projectID: string, userID: string) {
+  await CallAPI(`${projectServiceUrl()}/projects/${projectID}/members/${userID}`, { method: 'DELETE', ignoreResponse: true });
+}
+
+export function listProjectInvites(projectID: string) {
+  return CallAPI<ProjectInvite[]>(`${projectServiceUrl()}/projects/${projectID}/invites`);
+}
+
+export function createInvite(projectID: string, email: string, role: ProjectRole) {
+  return CallAPI<ProjectInvite>(`${projectServiceUrl()}/projects/${projectID}/invites`, { method: 'POST', json: { email, role } });
+}
+
+export async function revokeInvite(projectID: string, inviteID: string) {
+  await CallAPI(`${projectServiceUrl()}/projects/${projectID}/invites/${inviteID}`, { method: 'DELETE', ignoreResponse: true });
+}
+
+// Invites sent to the logged in user's email
+export function listMyInvites() {
+  return CallAPI<ProjectInvite[]>(`${projectServiceUrl()}/invites`);
+}
+
+export function acceptInvite(inviteID: string) {
+  return CallAPI<{ projectID?: string; orgID?: string; role: ProjectRole }>(`${projectServiceUrl()}/invites/${inviteID}/accept`, { method: 'POST' });
+}
+
+export async function declineInvite(inviteID: string) {
+  await CallAPI(`${projectServiceUrl()}/invites/${inviteID}/decline`, { method: 'POST', ignoreResponse: true });
+}
@@ -8,6 +8,7 @@ import { useNavigate } from 'react-router-dom';
 import { useAuthGuard } from '../utils/authUtil';
 import type { Project } from '../utils/interfaces/interfaces';
 import AppThemeProvider from '../assets/AppThemeProvider';
+import { acceptInvite, declineInvite, listMyInvites, ProjectInvite } from '../ProjectPage/Tabs/membersHandler';
 
 const ProjectsPage: React.FC = () => {
   // validate the user authentication, otherwise redirect to login
@@ -36,13 +37,33 @@ const ProjectsPage: React.FC = () => {
   const [menuAnchorEl, setMenuAnchorEl] = useState<null | HTMLElement>(null);
   const [menuProjectId, setMenuProjectId] = useState<string | null>(null);
 
+  // Invites to other users' projects, which can only be listed once the user's email is verified
+  const [invites, setInvites] = useState<ProjectInvite[]>([]);
+
   useEffect(() => {
     projectHandler
       .fetchProjects()
       .then((data) => setProjects(data))
       .catch((err) => console.error(err));
+    listMyInvites()
+      .then((data) => setInvites(data))
+      .catch(() => setInvites([]));
   }, []);
 
+  const handleInvite = async (inviteID: string, accept: boolean) => {
+    try {
+      if (accept) {
+        await acceptInvite(inviteID);
+        setProjects(await projectHandler.fetchProjects());
+      } else {
+        await declineInvite(inviteID);
+      }
+    } catch (err) {
+      console.error(err);
+    }
+    setInvites((prev) => prev.filter((inv) => inv.inviteID !== inviteID));
+  };
+
   useEffect(() => {
     let result = projectHandler.handleSearch(projects, search);
     result = projectHandler.handleSort(result, sortKey, sortDirection);
@@ -218,6 +239,24 @@ const ProjectsPage: React.FC = () => {
           </Toolbar>
         </AppBar>
         <Box sx={{ px: '10%', pt: { xs: 4, md: 6 }, pb: 3 }}>
+          {invites.length > 0 && (
+            <Paper sx={{ p: 2, mb: 4, border: '1.5px solid #bfbfbfff', boxShadow: 0, display: 'flex', flexDirection: 'column', gap: 1 }}>
+              <Typography sx={{ fontWeight: 700 }}>Invites</Typography>
+              {invites.map((inv) => (
+                <Box key={inv.inviteID} sx={{ display: 'flex', alignItems: 'center', gap: 2 }}>
+                  <Typography sx={{ flex: 1 }}>
+                    {inv.orgID ? `${inv.orgName} organisation` : inv.projectName} (invited as {inv.role})
+                  </Typography>
+                  <Button variant="contained" sx={{ textTransform: 'none', fontWeight: 600, color: '#000' }} onClick={() => handleInvite(inv.inviteID, true)}>
+                    Accept
+                  </Button>
+                  <Button variant="text" color="error" sx={{ textTransform: 'none' }} onClick={() => handleInvite(inv.inviteID, false)}>
+                    Decline
+                  </Button>
+                </Box>
+              ))}
+            </Paper>
+          )}
           <Box
             sx={{
               display: 'grid',
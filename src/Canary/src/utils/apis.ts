@@ -1,4 +1,4 @@
-import { getAuthTokenFromCookie } from './cookieUtils';
+import { getAuthTokenFromCookie, getRefreshTokenFromCookie, setCookie } from './cookieUtils';
 import { getCookie } from './cookieUtils';
 
 export function authServiceUrl() {
@@ -24,6 +24,34 @@ export interface CallAPIOptions extends RequestInit {
   ignoreResponse?: boolean;
 }
 
+// Access tokens are short-lived. refreshAuthToken exchanges the refresh token for a new pair; concurrent callers
+// share one request because each refresh token can only be used once.
+let refreshing: Promise<boolean> | null = null;
+
+export function refreshAuthToken(): Promise<boolean> {
+  if (!refreshing) {
+    refreshing = (async () => {
+      const refreshToken = getRefreshTokenFromCookie();
+      if (!refreshToken) return false;
+      const resp = await fetch(`${authServiceUrl()}/refresh_token`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', Accept: 'application/json' },
+        body: JSON.stringify({ refreshToken }),
+      });
+      if (!resp.ok) return false;
+      const data = (await resp.json()) as { token: string; refreshToken: string };
+      setCookie('auth_token', data.token);
+      setCookie('refresh_token', data.refreshToken);
+      return true;
+    })()
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+}
+
 export async function CallAPI<T = unknown>(url: string, options: CallAPIOptions = {}): Promise<T> {
   const { method = 'GET', json, parseJson = true, auth = true, ignoreResponse = false, headers: initHeaders, body: initBody, ...rest } = options;
 
@@ -50,7 +78,11 @@ export async function CallAPI<T = unknown>(url: string, options: CallAPIOptions
     headers.set('X-Session-Id', sessionID);
   }
 
-  const resp = await fetch(url, { method, headers, body, ...rest });
+  let resp = await fetch(url, { method, headers, body, ...rest });
+  if (resp.status === 401 && auth && (await refreshAuthToken())) {
+    headers.set('Authorization', `Bearer ${getAuthTokenFromCookie()}`);
+    resp = await fetch(url, { method, headers, body, ...rest });
+  }
   if (ignoreResponse) {
     if (!resp.ok) {
       // Don't attempt to read the body when ignoring
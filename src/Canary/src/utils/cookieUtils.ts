@@ -19,3 +19,13 @@ export function getUserIDFromCookie(): string {
 export function getAuthTokenFromCookie(): string {
   return getCookie('auth_token') || '';
 }
+
+export function getRefreshTokenFromCookie(): string {
+  return getCookie('refresh_token') || '';
+}
+
+export function clearAuthCookies() {
+  clearCookie('auth_token');
+  clearCookie('refresh_token');
+  clearCookie('user_id');
+}
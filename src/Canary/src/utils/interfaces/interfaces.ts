@@ -1,9 +1,15 @@
+export type ProjectRole = 'viewer' | 'annotator' | 'reviewer' | 'admin' | 'owner';
+
 export interface Project {
   projectID: string;
   projectName: string;
+  // a project is owned by either a user or an organisation
   userID: string;
+  orgID?: string;
   numberOfBatches: number;
   lastUpdated: string;
+  // what the logged in user can do in the project
+  role?: ProjectRole;
 }
 
 export interface Batch {
@@ -1,5 +1,4 @@
 import { CallAPI, websocketServiceUrl } from '../apis';
-import { getUserIDFromCookie } from '../cookieUtils';
 
 // Shape returned by the Go service for both create & join.
 export interface SessionTokenResponse {
@@ -29,12 +28,11 @@ export interface ActiveSessionResponse {
   lastUpdated: string;
 }
 
-export async function createSession(batchID: string, password?: string, userID: string = getUserIDFromCookie()): Promise<SessionCallResult> {
+export async function createSession(batchID: string, password?: string): Promise<SessionCallResult> {
   if (!batchID) return { ok: false, error: 'batchID is required' };
-  if (!userID) return { ok: false, error: 'userID is required (missing cookie?)' };
   const base = websocketServiceUrl();
   if (!base) return { ok: false, error: 'WebSocket service URL not configured' };
-  const url = `${base}/sessions/${encodeURIComponent(batchID)}?userID=${encodeURIComponent(userID)}`;
+  const url = `${base}/sessions/${encodeURIComponent(batchID)}`;
   try {
     const options: {
       method: 'POST';
@@ -56,12 +54,11 @@ export async function createSession(batchID: string, password?: string, userID:
 }
 
 /** Join an existing session as a member. */
-export async function joinSession(sessionID: string, password?: string, userID: string = getUserIDFromCookie()): Promise<SessionCallResult> {
+export async function joinSession(sessionID: string, password?: string): Promise<SessionCallResult> {
   if (!sessionID) return { ok: false, error: 'sessionID is required' };
-  if (!userID) return { ok: false, error: 'userID is required (missing cookie?)' };
   const base = websocketServiceUrl();
   if (!base) return { ok: false, error: 'WebSocket service URL not configured' };
-  const url = `${base}/sessions/${encodeURIComponent(sessionID)}/join?userID=${encodeURIComponent(userID)}`;
+  const url = `${base}/sessions/${encodeURIComponent(sessionID)}/join`;
   try {
     const payload = password !== undefined ? { password } : undefined;
     const data = await CallAPI<SessionTokenResponse>(url, payload ? { method: 'POST', json: payload } : { method: 'POST' });
@@ -75,12 +72,11 @@ export async function joinSession(sessionID: string, password?: string, userID:
   }
 }
 
-export async function endSession(sessionID: string, userID: string = getUserIDFromCookie()): Promise<SessionCallResult> {
+export async function endSession(sessionID: string): Promise<SessionCallResult> {
   if (!sessionID) return { ok: false, error: 'sessionID is required' };
-  if (!userID) return { ok: false, error: 'userID is required (missing cookie?)' };
   const base = websocketServiceUrl();
   if (!base) return { ok: false, error: 'WebSocket service URL not configured' };
-  const url = `${base}/sessions/${encodeURIComponent(sessionID)}?userID=${encodeURIComponent(userID)}`;
+  const url = `${base}/sessions/${encodeURIComponent(sessionID)}`;
   try {
     await CallAPI<void>(url, { method: 'DELETE', parseJson: false });
     return { ok: true, data: { sessionID, batchID: '', projectID: '', token: '', expiresIn: 0 } };
@@ -107,16 +103,13 @@ export async function fetchActiveSessionForBatch(batchID: string): Promise<Activ
   return sessions[0] ?? null;
 }
 
-export async function kickSessionMember(sessionID: string, memberID: string, userID: string = getUserIDFromCookie()): Promise<{ ok: true } | { ok: false; error: string }> {
+export async function kickSessionMember(sessionID: string, memberID: string): Promise<{ ok: true } | { ok: false; error: string }> {
   if (!sessionID || !memberID) {
     return { ok: false, error: 'sessionID and memberID are required' };
   }
-  if (!userID) {
-    return { ok: false, error: 'userID is required (missing cookie?)' };
-  }
   const base = websocketServiceUrl();
   if (!base) return { ok: false, error: 'WebSocket service URL not configured' };
-  const url = `${base}/sessions/${encodeURIComponent(sessionID)}/members/${encodeURIComponent(memberID)}?userID=${encodeURIComponent(userID)}`;
+  const url = `${base}/sessions/${encodeURIComponent(sessionID)}/members/${encodeURIComponent(memberID)}`;
   try {
     await CallAPI(url, { method: 'DELETE' });
     return { ok: true };
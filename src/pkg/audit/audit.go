@@ -0,0 +1,185 @@
+// Package audit keeps the security audit log: who did what to which resource, from which address, and whether
+// it worked. Every service appends to the same collection and nothing in the services updates or deletes an
+// event, so the log still tells what happened after the users and resources it names are gone.
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	fs "pkg/gcp/firestore"
+	"pkg/jwt"
+	"pkg/throttle"
+
+	"github.com/rs/zerolog/log"
+)
+
+const collectionID = "auditEvents"
+
+// Outcome is how an audited attempt ended.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	// OutcomeFailure is an attempt that failed on its merits, such as a login with the wrong password.
+	OutcomeFailure Outcome = "failure"
+	// OutcomeDenied is an attempt by someone who is not allowed to make it.
+	OutcomeDenied Outcome = "denied"
+)
+
+// Action is what an event records being done.
+type Action string
+
+const (
+	ActionRegister         Action = "user.register"
+	ActionLogin            Action = "user.login"
+	ActionLogout           Action = "user.logout"
+	ActionLogoutAll        Action = "user.logout_all"
+	ActionDeleteAccount    Action = "user.delete"
+	ActionChangePassword   Action = "user.password_change"
+	ActionResetPassword    Action = "user.password_reset"
+	ActionChangeEmail      Action = "user.email_change"
+	ActionEnableTwoFactor  Action = "user.2fa_enable"
+	ActionDisableTwoFactor Action = "user.2fa_disable"
+	ActionRecoveryCodes    Action = "user.2fa_recovery_codes"
+	ActionCreateToken      Action = "token.create"
+	ActionRevokeToken      Action = "token.revoke"
+
+	ActionCreateProject   Action = "project.create"
+	ActionUpdateProject   Action = "project.update"
+	ActionDeleteProject   Action = "project.delete"
+	ActionTransferProject Action = "project.transfer"
+	ActionUpdateMember    Action = "member.update"
+	ActionRemoveMember    Action = "member.remove"
+	ActionCreateBatch     Action = "batch.create"
+	ActionUpdateBatch     Action = "batch.update"
+	ActionDeleteBatch     Action = "batch.delete"
+	ActionExport          Action = "export"
+
+	ActionStopSession Action = "session.stop"
+	ActionKickMember  Action = "session.kick"
+)
+
+// The types of resource events are about.
+const (
+	ResourceUser    = "user"
+	ResourceToken   = "token"
+	ResourceProject = "project"
+	ResourceMember  = "member"
+	ResourceBatch   = "batch"
+	ResourceSession = "session"
+)
+
+// Event is one entry of the log.
+type Event struct {
+	ID   string    `firestore:"-" json:"eventID"`
+	Time time.Time `firestore:"time" json:"time"`
+	// Service is the name of the service that recorded the event
+	Service string `firestore:"service" json:"service"`
+	// ActorID is the user who acted. It is empty when they could not be told, such as for a login to an email
+	// with no account.
+	ActorID string `firestore:"actorID,omitempty" json:"actorID,omitempty"`
+	Action  Action `firestore:"action" json:"action"`
+	// ResourceType and ResourceID name what was acted on, such as a "batch" and its ID
+	ResourceType string `firestore:"resourceType,omitempty" json:"resourceType,omitempty"`
+	ResourceID   string `firestore:"resourceID,omitempty" json:"resourceID,omitempty"`
+	// ProjectID is set on events about a project or anything in it, so the project's owner can query them
+	ProjectID string `firestore:"projectID,omitempty" json:"projectID,omitempty"`
+	// IP is the address of the client that made the request
+	IP      string  `firestore:"ip,omitempty" json:"ip,omitempty"`
+	Outcome Outcome `firestore:"outcome" json:"outcome"`
+	// Details holds anything else worth keeping, such as why an attempt failed
+	Details map[string]string `firestore:"details,omitempty" json:"details,omitempty"`
+}
+
+// Config sets how events are recorded.
+type Config struct {
+	// TrustedProxyHops is how many proxies in front of the service append to X-Forwarded-For. It is read from the
+	// same variable as throttle.Config's, so the log and the throttle agree on who the client is.
+	TrustedProxyHops int `env:"TRUSTED_PROXY_HOPS" yaml:"trustedProxyHops" default:"0"`
+}
+
+func (c *Config) Validate() error {
+	if c.TrustedProxyHops < 0 {
+		return errors.New("TRUSTED_PROXY_HOPS must not be negative")
+	}
+	return nil
+}
+
+// Log appends events to the audit log and reads them back. It has no way to change or delete an event.
+type Log struct {
+	genericStore *fs.GenericStore
+	service      string
+	cfg          Config
+	now          func() time.Time
+}
+
+// NewLog returns a Log that records events as coming from service.
+func NewLog(client fs.FirestoreClientInterface, service string, cfg Config) *Log {
+	return &Log{genericStore: fs.NewGenericStore(client, collectionID), service: service, cfg: cfg, now: time.Now}
+}
+
+// Record appends e to the log, filling in its time and service. A failure to write it is logged rather than
+// returned: by the time an event is recorded the action has happened, and failing the request would not undo
+// it. The write is not cancelled with ctx, so a client hanging up does not lose the event.
+func (l *Log) Record(ctx context.Context, e Event) {
+	e.Time = l.now()
+	e.Service = l.service
+	if _, err := l.genericStore.CreateDoc(context.WithoutCancel(ctx), e); err != nil {
+		log.Error().Err(err).Str("action", string(e.Action)).Str("actorID", e.ActorID).Str("resourceID", e.ResourceID).
+			Str("outcome", string(e.Outcome)).Msg("Failed to record audit event")
+	}
+}
+
+// RecordRequest records e as made by r. The actor defaults to whoever r was authenticated as, and the IP is
+// the client's.
+func (l *Log) RecordRequest(r *http.Request, e Event) {
+	if e.ActorID == "" {
+		if p, ok := jwt.PrincipalFromContext(r.Context()); ok {
+			e.ActorID = p.UserID
+		}
+	}
+	e.IP = throttle.ClientIP(r, l.cfg.TrustedProxyHops)
+	l.Record(r.Context(), e)
+}
+
+// Filter selects the events of a project to query.
+type Filter struct {
+	ProjectID string
+	// ActorID, if set, keeps only the events of that user
+	ActorID string
+	// From and To bound the time of the events, both inclusive. A zero time leaves that end open.
+	From time.Time
+	To   time.Time
+}
+
+// Query returns up to pageSize of the events matching f, newest first, starting after pageToken (empty for the
+// first page). The returned token is empty when there are no further pages.
+func (l *Log) Query(ctx context.Context, f Filter, pageSize int, pageToken string) ([]Event, string, error) {
+	query := []fs.QueryParameter{{Path: "projectID", Op: "==", Value: f.ProjectID}}
+	if f.ActorID != "" {
+		query = append(query, fs.QueryParameter{Path: "actorID", Op: "==", Value: f.ActorID})
+	}
+	if !f.From.IsZero() {
+		query = append(query, fs.QueryParameter{Path: "time", Op: ">=", Value: f.From})
+	}
+	if !f.To.IsZero() {
+		query = append(query, fs.QueryParameter{Path: "time", Op: "<=", Value: f.To})
+	}
+	docs, next, err := l.genericStore.ReadPage(ctx, query, []fs.OrderBy{{Path: "time", Direction: fs.Desc}}, pageSize, pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+	events := make([]Event, 0, len(docs))
+	for _, doc := range docs {
+		var e Event
+		if err := doc.DataTo(&e); err != nil {
+			return nil, "", err
+		}
+		e.ID = doc.Ref.ID
+		events = append(events, e)
+	}
+	return events, next, nil
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	fs "pkg/gcp/firestore"
+	"pkg/jwt"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLog() (*Log, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLog(fs.NewMemoryClient(), "test-service", Config{TrustedProxyHops: 1})
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func actions(events []Event) []Action {
+	got := make([]Action, len(events))
+	for i, e := range events {
+		got[i] = e.Action
+	}
+	return got
+}
+
+func TestRecordRequestFillsActorAndIP(t *testing.T) {
+	l, now := testLog()
+	r := httptest.NewRequest("DELETE", "/projects/p1", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	r = r.WithContext(jwt.WithPrincipal(r.Context(), &jwt.Principal{UserID: "alice"}))
+
+	l.RecordRequest(r, Event{Action: ActionDeleteProject, ResourceType: "project", ResourceID: "p1", ProjectID: "p1", Outcome: OutcomeSuccess})
+
+	events, next, err := l.Query(context.Background(), Filter{ProjectID: "p1"}, 10, "")
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	require.Len(t, events, 1)
+	e := events[0]
+	assert.NotEmpty(t, e.ID)
+	assert.Equal(t, "alice", e.ActorID)
+	assert.Equal(t, "203.0.113.7", e.IP)
+	assert.Equal(t, "test-service", e.Service)
+	assert.True(t, now.Equal(e.Time))
+}
+
+func TestQueryFilters(t *testing.T) {
+	ctx := context.Background()
+	l, now := testLog()
+	start := *now
+	record := func(projectID, actorID string, action Action) {
+		l.Record(ctx, Event{ActorID: actorID, Action: action, ProjectID: projectID, Outcome: OutcomeSuccess})
+		*now = now.Add(time.Hour)
+	}
+	record("p1", "alice", ActionCreateProject)
+	record("p1", "bob", ActionCreateBatch)
+	record("p2", "alice", ActionCreateProject)
+	record("p1", "alice", ActionExport)
+	record("", "alice", ActionLogin)
+
+	events, _, err := l.Query(ctx, Filter{ProjectID: "p1"}, 10, "")
+	require.NoError(t, err)
+	assert.Equal(t, []Action{ActionExport, ActionCreateBatch, ActionCreateProject}, actions(events))
+
+	events, _, err = l.Query(ctx, Filter{ProjectID: "p1", ActorID: "alice"}, 10, "")
+	require.NoError(t, err)
+	assert.Equal(t, []Action{ActionExport, ActionCreateProject}, actions(events))
+
+	events, _, err = l.Query(ctx, Filter{ProjectID: "p1", From: start.Add(time.Hour), To: start.Add(2 * time.Hour)}, 10, "")
+	require.NoError(t, err)
+	assert.Equal(t, []Action{ActionCreateBatch}, actions(events))
+}
+
+func TestQueryPages(t *testing.T) {
+	ctx := context.Background()
+	l, now := testLog()
+	for range 3 {
+		l.Record(ctx, Event{ActorID: "alice", Action: ActionUpdateProject, ProjectID: "p1", Outcome: OutcomeSuccess})
+		*now = now.Add(time.Minute)
+	}
+
+	first, next, err := l.Query(ctx, Filter{ProjectID: "p1"}, 2, "")
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	require.NotEmpty(t, next)
+	second, next, err := l.Query(ctx, Filter{ProjectID: "p1"}, 2, next)
+	require.NoError(t, err)
+	require.Len(t, second, 1)
+	assert.Empty(t, next)
+	assert.True(t, second[0].Time.Before(first[1].Time))
+}
@@ -0,0 +1,232 @@
+// Package config loads a service's settings into a typed struct.
+//
+// Fields are described with struct tags:
+//
+//	env:"PORT"          environment variable the value is read from
+//	yaml:"port"         key in the YAML config file
+//	default:"8080"      value used when neither source sets the field
+//	required:"true"     Load fails if the field is still empty
+//	secret:"true"       the value is redacted by String and Log
+//
+// Values are applied in order of increasing precedence: defaults, the YAML file named by CONFIG_FILE, the
+// service's .env file and finally the process environment. Nested structs are walked, so services can compose
+// their config from the shared pieces in this package and in pkg/gcp.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FILE_ENV names a YAML file to read config from. Environment variables still override its values.
+	FILE_ENV string = "CONFIG_FILE"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Validator is implemented by config structs with rules beyond required fields, e.g. fields that are only
+// required when another is set. Validate is called on every nested struct after loading.
+type Validator interface {
+	Validate() error
+}
+
+type loadOptions struct {
+	file     string
+	dotEnv   []string
+	lookupFn func(string) (string, bool)
+}
+
+type Option func(*loadOptions)
+
+// WithFile reads the YAML file at path instead of the one named by CONFIG_FILE.
+func WithFile(path string) Option {
+	return func(o *loadOptions) {
+		o.file = path
+	}
+}
+
+// WithDotEnv loads the given .env files instead of ./.env. Missing files are ignored.
+func WithDotEnv(paths ...string) Option {
+	return func(o *loadOptions) {
+		o.dotEnv = paths
+	}
+}
+
+// WithLookup reads variables from lookup instead of the process environment, for tests.
+func WithLookup(lookup func(string) (string, bool)) Option {
+	return func(o *loadOptions) {
+		o.lookupFn = lookup
+		o.dotEnv = nil
+	}
+}
+
+func (o *loadOptions) lookup(name string) (string, bool) {
+	v, ok := o.lookupFn(name)
+	if !ok || v == "" {
+		return "", false
+	}
+	return v, true
+}
+
+// Load fills cfg, which must be a pointer to a struct, and validates it. Every missing required field and
+// invalid value is reported in the returned error, not just the first.
+func Load(cfg any, opts ...Option) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load needs a pointer to a struct, got %T", cfg)
+	}
+
+	o := &loadOptions{dotEnv: []string{".env"}, lookupFn: os.LookupEnv}
+	for _, opt := range opts {
+		opt(o)
+	}
+	for _, path := range o.dotEnv {
+		// .env values never override variables already set in the environment
+		_ = godotenv.Load(path)
+	}
+	if o.file == "" {
+		o.file, _ = o.lookup(FILE_ENV)
+	}
+
+	var errs []error
+	walk(v.Elem(), "", func(f field) {
+		if def, ok := f.tag.Lookup("default"); ok {
+			if err := setValue(f.value, def); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid default %q: %w", f.name, def, err))
+			}
+		}
+	})
+	if o.file != "" {
+		data, err := os.ReadFile(o.file)
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("config: failed to parse %s: %w", o.file, err)
+		}
+	}
+	walk(v.Elem(), "", func(f field) {
+		env := f.tag.Get("env")
+		if env == "" {
+			return
+		}
+		raw, ok := o.lookup(env)
+		if !ok {
+			return
+		}
+		if err := setValue(f.value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q: %w", env, raw, err))
+		}
+	})
+	walk(v.Elem(), "", func(f field) {
+		if f.tag.Get("required") == "true" && f.value.IsZero() {
+			errs = append(errs, fmt.Errorf("%s is required", f.name))
+		}
+	})
+	errs = append(errs, validate(v)...)
+	return errors.Join(errs...)
+}
+
+// field is a settable leaf of a config struct. name is its env variable, or its dotted Go path if it has none.
+type field struct {
+	name  string
+	tag   reflect.StructTag
+	value reflect.Value
+}
+
+func walk(v reflect.Value, path string, fn func(field)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		name := sf.Name
+		if path != "" {
+			name = path + "." + sf.Name
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType && sf.Tag.Get("env") == "" {
+			walk(fv, name, fn)
+			continue
+		}
+		if env := sf.Tag.Get("env"); env != "" {
+			name = env
+		}
+		fn(field{name: name, tag: sf.Tag, value: fv})
+	}
+}
+
+// validate calls Validate on v and every nested struct that implements Validator, innermost first.
+func validate(v reflect.Value) []error {
+	var errs []error
+	elem := v.Elem()
+	for i := 0; i < elem.NumField(); i++ {
+		fv := elem.Field(i)
+		if elem.Type().Field(i).IsExported() && fv.Kind() == reflect.Struct && fv.CanAddr() {
+			errs = append(errs, validate(fv.Addr())...)
+		}
+	}
+	if validator, ok := v.Interface().(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDB struct {
+	Host     string `env:"DB_HOST" yaml:"host" required:"true"`
+	Password string `env:"DB_PASSWORD" yaml:"password" secret:"true"`
+}
+
+type testConfig struct {
+	Server  Server        `yaml:"server"`
+	Timeout time.Duration `env:"TIMEOUT" yaml:"timeout" default:"30s"`
+	Workers int           `env:"WORKERS" yaml:"workers" default:"4"`
+	Debug   bool          `env:"DEBUG" yaml:"debug"`
+	Origins []string      `env:"ORIGINS" yaml:"origins"`
+	DB      testDB        `yaml:"db"`
+}
+
+func (c *testConfig) Validate() error {
+	if c.Workers > 10 {
+		return errors.New("at most 10 workers")
+	}
+	return nil
+}
+
+func lookupFrom(env map[string]string) Option {
+	return WithLookup(func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("server:\n  port: \"8000\"\nworkers: 6\ndb:\n  host: yaml-host\n  password: hunter2\n"), 0o600))
+
+	var cfg testConfig
+	err := Load(&cfg, WithFile(path), lookupFrom(map[string]string{
+		"PORT":    "9000",
+		"DEBUG":   "true",
+		"ORIGINS": "a.com, b.com",
+		"WORKERS": "",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "9000", cfg.Server.Port, "env overrides yaml")
+	assert.Equal(t, 6, cfg.Workers, "yaml overrides defaults and empty env values are ignored")
+	assert.Equal(t, 30*time.Second, cfg.Timeout)
+	assert.Equal(t, "*", cfg.Server.CORS.AllowOrigin)
+	assert.True(t, cfg.Debug)
+	assert.Equal(t, []string{"a.com", "b.com"}, cfg.Origins)
+	assert.Equal(t, "yaml-host", cfg.DB.Host)
+
+	printed := String(&cfg)
+	assert.Contains(t, printed, "DB_PASSWORD="+Redacted+"\n")
+	assert.NotContains(t, printed, "hunter2")
+	assert.Contains(t, printed, "ORIGINS=a.com b.com\n")
+}
+
+func TestLoadValidation(t *testing.T) {
+	var cfg testConfig
+	err := Load(&cfg, lookupFrom(map[string]string{"WORKERS": "11", "TIMEOUT": "soon"}))
+	require.Error(t, err)
+	// every problem is reported at once
+	assert.Contains(t, err.Error(), "PORT is required")
+	assert.Contains(t, err.Error(), "DB_HOST is required")
+	assert.Contains(t, err.Error(), `TIMEOUT: invalid value "soon"`)
+	assert.Contains(t, err.Error(), "at most 10 workers")
+}
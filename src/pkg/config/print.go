@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Redacted replaces the value of secret fields that are set.
+const Redacted = "<redacted>"
+
+// Values returns the effective value of every field in cfg as name/value pairs, in field order, with secret
+// fields redacted. Names are env variables where a field has one.
+func Values(cfg any) [][2]string {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	var values [][2]string
+	walk(v, "", func(f field) {
+		value := fmt.Sprint(f.value.Interface())
+		if f.value.Kind() == reflect.Slice {
+			value = strings.Trim(value, "[]")
+		}
+		if f.tag.Get("secret") == "true" && !f.value.IsZero() {
+			value = Redacted
+		}
+		values = append(values, [2]string{f.name, value})
+	})
+	return values
+}
+
+// String formats cfg as NAME=value lines with secrets redacted.
+func String(cfg any) string {
+	var b strings.Builder
+	for _, kv := range Values(cfg) {
+		fmt.Fprintf(&b, "%s=%s\n", kv[0], kv[1])
+	}
+	return b.String()
+}
+
+// Log logs the effective config at info level with secrets redacted, so startup logs show what a service
+// is actually running with.
+func Log(cfg any) {
+	event := log.Info()
+	for _, kv := range Values(cfg) {
+		event = event.Str(kv[0], kv[1])
+	}
+	event.Msg("Configuration loaded")
+}
@@ -0,0 +1,15 @@
+package config
+
+// Server holds the HTTP settings shared by every service.
+type Server struct {
+	Port string `env:"PORT" yaml:"port" required:"true"`
+	CORS CORS   `yaml:"cors"`
+}
+
+// CORS holds the values of the Access-Control-Allow-* response headers.
+type CORS struct {
+	AllowOrigin      string `env:"CORS_ALLOW_ORIGIN" yaml:"allowOrigin" default:"*"`
+	AllowMethods     string `env:"CORS_ALLOW_METHODS" yaml:"allowMethods" default:"GET,POST,PUT,PATCH,DELETE,OPTIONS"`
+	AllowHeaders     string `env:"CORS_ALLOW_HEADERS" yaml:"allowHeaders" default:"*"`
+	AllowCredentials string `env:"CORS_ALLOW_CREDENTIALS" yaml:"allowCredentials" default:"false"`
+}
@@ -2,21 +2,71 @@ package bucket
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
 
 	"cloud.google.com/go/storage"
-	"github.com/joho/godotenv"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iterator"
 )
 
 const (
 	BUCKETNAME_ENV string = "BUCKET_NAME"
+	BACKEND_ENV    string = "BUCKET_BACKEND"
+	LOCALDIR_ENV   string = "BUCKET_LOCAL_DIR"
+	LOCALURL_ENV   string = "BUCKET_LOCAL_URL"
+	URLSECRET_ENV  string = "BUCKET_URL_SECRET"
+	// UPLOADWORKERS_ENV sets how many objects are uploaded concurrently by CreateObjectsBatch
+	UPLOADWORKERS_ENV string = "BUCKET_UPLOAD_WORKERS"
+	// SIGNEDURLEXPIRY_ENV sets how long signed URLs last by default, as a Go duration such as "4h"
+	SIGNEDURLEXPIRY_ENV string = "BUCKET_SIGNED_URL_EXPIRY"
+	// SIGNERKEY_ENV holds the service account key JSON used to sign GCS URLs
+	SIGNERKEY_ENV string = "BUCKET_JSON_KEY"
+	// SIGNERSA_ENV is the service account email URLs are signed as. The key's own email is used if empty.
+	SIGNERSA_ENV string = "BUCKET_SIGNER_SA"
+)
+
+const (
+	// GCSBackend stores objects in Google Cloud Storage (the default).
+	GCSBackend string = "gcs"
+	// LocalBackend stores objects on local disk and serves them through signed URLs, for local development and CI.
+	LocalBackend string = "local"
 )
 
 type BucketClientConfig struct {
-	BucketName string
+	BucketName string `env:"BUCKET_NAME" yaml:"name"`
+	// Backend is either GCSBackend or LocalBackend. Empty means GCSBackend.
+	Backend string `env:"BUCKET_BACKEND" yaml:"backend"`
+
+	// The following are only used by LocalBackend
+	// LocalDir is the directory objects are stored under.
+	LocalDir string `env:"BUCKET_LOCAL_DIR" yaml:"localDir"`
+	// LocalURL is the base URL of the service serving LocalObjectRoute, e.g. http://localhost:3004
+	LocalURL string `env:"BUCKET_LOCAL_URL" yaml:"localURL"`
+	// URLSecret is the HMAC key used to sign URLs. A random key is used if empty.
+	URLSecret string `env:"BUCKET_URL_SECRET" yaml:"urlSecret" secret:"true"`
+
+	// The following are only used by GCSBackend
+	// SignerKey is the service account key JSON used to sign URLs. Services that load it from Secret Manager after
+	// the client is created leave it empty and call SetSignerKey.
+	SignerKey string `env:"BUCKET_JSON_KEY" yaml:"signerKey" secret:"true"`
+	// SignerSA is the service account email URLs are signed as. The key's own email is used if empty.
+	SignerSA string `env:"BUCKET_SIGNER_SA" yaml:"signerSA"`
 }
 
+// ErrNoSignerKey is returned when a GCS URL is signed before the client has a signing key.
+var ErrNoSignerKey = errors.New("no service account key to sign URLs with")
+
 func NewBucketClient(ctx context.Context, cfg BucketClientConfig) (*BucketClient, error) {
-	_ = godotenv.Load()
+	signer := &urlSigner{accessID: cfg.SignerSA}
+	if cfg.SignerKey != "" {
+		if err := signer.setKey(cfg.SignerKey); err != nil {
+			return nil, err
+		}
+	}
 
 	client, err := storage.NewClient(ctx)
 	if err != nil {
@@ -28,19 +78,95 @@ func NewBucketClient(ctx context.Context, cfg BucketClientConfig) (*BucketClient
 	return &BucketClient{
 		Client: client,
 		Handle: bucketHandle,
+		signer: signer,
 	}, nil
 }
 
+// SetSignerKey replaces the service account key JSON URLs are signed with, e.g. once it has been loaded from
+// Secret Manager or after it is rotated. The key is parsed here, once, rather than for every URL.
+func (bc *BucketClient) SetSignerKey(keyJSON string) error {
+	return bc.signer.setKey(keyJSON)
+}
+
 func (bc *BucketClient) BucketName() string {
 	return bc.Handle.BucketName()
 }
 
-func (bc *BucketClient) Object(objectName string) *storage.ObjectHandle {
-	return bc.Handle.Object(objectName)
+func (bc *BucketClient) NewWriter(ctx context.Context, objectName string) io.WriteCloser {
+	return bc.Handle.Object(objectName).NewWriter(ctx)
+}
+
+func (bc *BucketClient) NewReader(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	return bc.Handle.Object(objectName).NewReader(ctx)
+}
+
+func (bc *BucketClient) Delete(ctx context.Context, objectName string) error {
+	return bc.Handle.Object(objectName).Delete(ctx)
+}
+
+func (bc *BucketClient) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	it := bc.Handle.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		objAttrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, objAttrs.Name)
+	}
+	return names, nil
 }
 
-func (bc *BucketClient) Objects(ctx context.Context, q *storage.Query) *storage.ObjectIterator {
-	return bc.Handle.Objects(ctx, q)
+// SignedURL signs a V4 URL with the client's service account key, as SignerSA if it is set.
+func (bc *BucketClient) SignedURL(ctx context.Context, objectName string, expires time.Time) (string, error) {
+	accessID, privateKey, err := bc.signer.credentials()
+	if err != nil {
+		return "", err
+	}
+
+	return storage.SignedURL(bc.BucketName(), objectName, &storage.SignedURLOptions{
+		Scheme:         storage.SigningSchemeV4,
+		Method:         "GET",
+		GoogleAccessID: accessID,
+		PrivateKey:     privateKey,
+		Expires:        expires,
+	})
+}
+
+// signerKey is a parsed service account key.
+type signerKey struct {
+	email      string
+	privateKey []byte
+}
+
+// urlSigner holds the key URLs are signed with. It is swapped whole, so signing never waits on a refresh.
+type urlSigner struct {
+	key      atomic.Pointer[signerKey]
+	accessID string
+}
+
+func (s *urlSigner) setKey(keyJSON string) error {
+	conf, err := google.JWTConfigFromJSON([]byte(keyJSON))
+	if err != nil {
+		return fmt.Errorf("failed to parse service account key JSON: %w", err)
+	}
+	s.key.Store(&signerKey{email: conf.Email, privateKey: conf.PrivateKey})
+	return nil
+}
+
+func (s *urlSigner) credentials() (accessID string, privateKey []byte, err error) {
+	key := s.key.Load()
+	if key == nil {
+		return "", nil, ErrNoSignerKey
+	}
+	accessID = s.accessID
+	if accessID == "" {
+		accessID = key.email
+	}
+	return accessID, key.privateKey, nil
 }
 
 // Close closes the Firestore client connection.
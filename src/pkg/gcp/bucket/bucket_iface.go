@@ -2,18 +2,31 @@ package bucket
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"cloud.google.com/go/storage"
 )
 
+// BucketClientInterface defines the object store used by GenericBucket.
+// It is implemented by BucketClient (Google Cloud Storage) and LocalBucketClient (local disk).
 type BucketClientInterface interface {
 	BucketName() string
-	Object(string) *storage.ObjectHandle
-	Objects(ctx context.Context, q *storage.Query) *storage.ObjectIterator
+	// NewWriter returns a writer for objectName. The object is only visible once the writer is closed.
+	NewWriter(ctx context.Context, objectName string) io.WriteCloser
+	// NewReader opens objectName for reading.
+	NewReader(ctx context.Context, objectName string) (io.ReadCloser, error)
+	// Delete removes objectName.
+	Delete(ctx context.Context, objectName string) error
+	// List returns the names of every object starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// SignedURL returns a URL that allows anyone holding it to GET objectName until expires.
+	SignedURL(ctx context.Context, objectName string, expires time.Time) (string, error)
 	Close() error
 }
 
 type BucketClient struct {
 	Client *storage.Client
 	Handle *storage.BucketHandle
+	signer *urlSigner
 }
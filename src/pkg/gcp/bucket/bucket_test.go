@@ -0,0 +1,56 @@
+package bucket
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serviceAccountKey returns the JSON of a new service account key for email.
+func serviceAccountKey(t *testing.T, email string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyJSON, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": email,
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    "https://oauth2.googleapis.com/token",
+	})
+	require.NoError(t, err)
+	return string(keyJSON)
+}
+
+func TestURLSigner(t *testing.T) {
+	var s urlSigner
+	_, _, err := s.credentials()
+	assert.ErrorIs(t, err, ErrNoSignerKey)
+
+	require.NoError(t, s.setKey(serviceAccountKey(t, "first@example.iam.gserviceaccount.com")))
+	accessID, first, err := s.credentials()
+	require.NoError(t, err)
+	assert.Equal(t, "first@example.iam.gserviceaccount.com", accessID)
+	assert.NotEmpty(t, first)
+
+	// a rotated key replaces the old one, and a key that does not parse leaves it in place
+	require.NoError(t, s.setKey(serviceAccountKey(t, "second@example.iam.gserviceaccount.com")))
+	assert.Error(t, s.setKey("not a key"))
+	accessID, second, err := s.credentials()
+	require.NoError(t, err)
+	assert.Equal(t, "second@example.iam.gserviceaccount.com", accessID)
+	assert.NotEqual(t, first, second)
+
+	// URLs are signed as the configured service account when there is one
+	s.accessID = "signer@example.iam.gserviceaccount.com"
+	accessID, _, err = s.credentials()
+	require.NoError(t, err)
+	assert.Equal(t, "signer@example.iam.gserviceaccount.com", accessID)
+}
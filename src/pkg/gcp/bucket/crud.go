@@ -2,14 +2,11 @@ package bucket
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"sync"
 	"time"
-
-	"cloud.google.com/go/storage"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/iterator"
 )
 
 type ObjectList []ObjectData
@@ -19,8 +16,6 @@ type ObjectData struct {
 	ImageData ImageData
 }
 
-var signedURLDuration = 60 * time.Minute
-
 type ObjectMap map[string]ImageData
 
 type ImageData struct {
@@ -29,24 +24,53 @@ type ImageData struct {
 	URL          string
 	ObjectReader io.Reader
 }
+
+// DefaultUploadWorkers is the number of objects CreateObjectsBatch uploads at once unless WithUploadWorkers is used.
+const DefaultUploadWorkers = 8
+
+// ErrUploadAborted is the result of objects that were never uploaded because another object in the batch failed.
+var ErrUploadAborted = errors.New("upload aborted after another object failed")
+
 type GenericBucket struct {
-	bucket BucketClientInterface
+	bucket          BucketClientInterface
+	uploadWorkers   int
+	signedURLExpiry time.Duration
+	signedURLs      *signedURLCache
+}
+
+type GenericBucketOption func(*GenericBucket)
+
+// WithUploadWorkers sets how many objects CreateObjectsBatch uploads concurrently. Values below 1 are ignored.
+func WithUploadWorkers(n int) GenericBucketOption {
+	return func(b *GenericBucket) {
+		if n > 0 {
+			b.uploadWorkers = n
+		}
+	}
 }
 
-func NewGenericBucket(bucket BucketClientInterface) *GenericBucket {
-	return &GenericBucket{
-		bucket: bucket,
+func NewGenericBucket(bucket BucketClientInterface, opts ...GenericBucketOption) *GenericBucket {
+	b := &GenericBucket{
+		bucket:          bucket,
+		uploadWorkers:   DefaultUploadWorkers,
+		signedURLExpiry: DefaultSignedURLExpiry,
+		signedURLs:      newSignedURLCache(),
+	}
+	for _, opt := range opts {
+		opt(b)
 	}
+	return b
 }
 
 // CreateObject uploads a single object and returns its URL.
 func (b *GenericBucket) CreateObject(ctx context.Context, objectName string, data io.Reader) error {
-	wc := b.bucket.Object(objectName).NewWriter(ctx)
+	// cancelling the writer's context before Close discards a partially written object
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wc := b.bucket.NewWriter(writeCtx, objectName)
 	if _, err := io.Copy(wc, data); err != nil {
-		err := wc.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close bucket writer: %w", err)
-		}
+		cancel()
+		_ = wc.Close()
 		return fmt.Errorf("failed to write object: %w", err)
 	}
 	if err := wc.Close(); err != nil {
@@ -59,15 +83,99 @@ func (b *GenericBucket) CreateObject(ctx context.Context, objectName string, dat
 	return nil
 }
 
-// CreateObjectsBatch uploads multiple objects and returns their URLs.
+// ObjectResult is the outcome of one object in CreateObjectsBatch.
+type ObjectResult struct {
+	ObjectName string
+	// Err is why the object was not uploaded, or nil if it was.
+	Err error
+	// RolledBack is true when the object was uploaded but deleted again because another object failed.
+	RolledBack bool
+	// RollbackErr is set when that delete failed, leaving the object orphaned in the bucket.
+	RollbackErr error
+}
+
+// BatchUploadError is returned by CreateObjectsBatch when any object failed to upload.
+// Results holds the outcome of every object in the order they were given.
+type BatchUploadError struct {
+	Results []ObjectResult
+}
+
+func (e *BatchUploadError) Error() string {
+	failed := 0
+	var first error
+	for _, r := range e.Results {
+		if r.Err != nil && !errors.Is(r.Err, ErrUploadAborted) {
+			failed++
+			if first == nil {
+				first = fmt.Errorf("%s: %w", r.ObjectName, r.Err)
+			}
+		}
+	}
+	return fmt.Sprintf("failed to upload %d of %d objects, first error: %v", failed, len(e.Results), first)
+}
+
+// CreateObjectsBatch uploads objects concurrently using the configured number of workers. It is all-or-nothing:
+// if any object fails, the remaining uploads are stopped, the objects already written are deleted and a
+// *BatchUploadError reporting every object is returned.
 func (b *GenericBucket) CreateObjectsBatch(ctx context.Context, objects ObjectList) (ObjectList, error) {
-	objectDatas := make([]ObjectData, len(objects))
+	results := make([]ObjectResult, len(objects))
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(b.uploadWorkers, len(objects)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i].ObjectName = objects[i].ImageName
+				if uploadCtx.Err() != nil {
+					results[i].Err = ErrUploadAborted
+					continue
+				}
+				err := b.CreateObject(uploadCtx, objects[i].ImageName, objects[i].ImageData.ObjectReader)
+				switch {
+				case err == nil:
+				case uploadCtx.Err() != nil && ctx.Err() == nil:
+					// cut short because another object failed first
+					results[i].Err = ErrUploadAborted
+				default:
+					results[i].Err = err
+					// stop the other workers as the batch will be rolled back anyway
+					cancel()
+				}
+			}
+		}()
+	}
+	for i := range objects {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-	for i := range len(objects) {
-		err := b.CreateObject(ctx, objects[i].ImageName, objects[i].ImageData.ObjectReader)
-		if err != nil {
-			return nil, fmt.Errorf("failed to upload %s: %w", objects[i].ImageName, err)
+	failed := false
+	for _, r := range results {
+		if r.Err != nil {
+			failed = true
+			break
+		}
+	}
+	if failed {
+		// roll back even if the request was cancelled so nothing is left without metadata pointing at it
+		rollbackCtx := context.WithoutCancel(ctx)
+		for i := range results {
+			if results[i].Err != nil {
+				continue
+			}
+			results[i].RolledBack = true
+			results[i].RollbackErr = b.DeleteObject(rollbackCtx, results[i].ObjectName)
 		}
+		return nil, &BatchUploadError{Results: results}
+	}
+
+	objectDatas := make([]ObjectData, len(objects))
+	for i := range objects {
 		objectDatas[i] = ObjectData{
 			ImageName: objects[i].ImageName,
 			ImageData: ImageData{
@@ -76,12 +184,22 @@ func (b *GenericBucket) CreateObjectsBatch(ctx context.Context, objects ObjectLi
 			},
 		}
 	}
-
 	return objectDatas, nil
 }
 
+// DeleteObjects deletes every object in objectNames and returns the first error after attempting all of them.
+func (b *GenericBucket) DeleteObjects(ctx context.Context, objectNames []string) error {
+	var firstErr error
+	for _, name := range objectNames {
+		if err := b.DeleteObject(ctx, name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 func (b *GenericBucket) DeleteObject(ctx context.Context, objectName string) error {
-	err := b.bucket.Object(objectName).Delete(ctx)
+	err := b.bucket.Delete(ctx, objectName)
 	if err != nil {
 		return fmt.Errorf("failed to delete object %s: %w", objectName, err)
 	}
@@ -89,24 +207,20 @@ func (b *GenericBucket) DeleteObject(ctx context.Context, objectName string) err
 }
 
 func (b *GenericBucket) DeleteObjectsByPrefix(ctx context.Context, prefix string) error {
-	it := b.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
-	for {
-		objAttrs, err := it.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("failed to list objects: %w", err)
-		}
-		if err := b.DeleteObject(ctx, objAttrs.Name); err != nil {
-			return fmt.Errorf("failed to delete object %s: %w", objAttrs.Name, err)
+	names, err := b.bucket.List(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+	for _, name := range names {
+		if err := b.DeleteObject(ctx, name); err != nil {
+			return fmt.Errorf("failed to delete object %s: %w", name, err)
 		}
 	}
 	return nil
 }
 
 func (b *GenericBucket) GetObject(ctx context.Context, objectName string) ([]byte, error) {
-	rc, err := b.bucket.Object(objectName).NewReader(ctx)
+	rc, err := b.bucket.NewReader(ctx, objectName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create reader for object %s: %w", objectName, err)
 	}
@@ -124,29 +238,9 @@ func (b *GenericBucket) GetObject(ctx context.Context, objectName string) ([]byt
 }
 
 func (b *GenericBucket) StreamObject(ctx context.Context, objectName string) (io.ReadCloser, error) {
-	rc, err := b.bucket.Object(objectName).NewReader(ctx)
+	rc, err := b.bucket.NewReader(ctx, objectName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create reader for object %s: %w", objectName, err)
 	}
 	return rc, nil
 }
-
-func (b *GenericBucket) GetSignedURL(ctx context.Context, objectName string) (string, error) {
-	keyJSON := os.Getenv("BUCKET_JSON_KEY")
-	conf, err := google.JWTConfigFromJSON([]byte(keyJSON))
-	if err != nil {
-		return "", fmt.Errorf("failed to parse service account key JSON: %w", err)
-	}
-
-	url, err := storage.SignedURL(b.bucket.BucketName(), objectName, &storage.SignedURLOptions{
-		Scheme:         storage.SigningSchemeV4,
-		Method:         "GET",
-		GoogleAccessID: os.Getenv("BUCKET_SIGNER_SA"),
-		PrivateKey:     conf.PrivateKey,
-		Expires:        time.Now().Add(signedURLDuration),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to generate signed URL for object %s: %w", objectName, err)
-	}
-	return url, nil
-}
@@ -0,0 +1,55 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateObjectsBatchRollback(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewLocalBucketClient(BucketClientConfig{BucketName: "test", LocalDir: t.TempDir(), URLSecret: "secret"})
+	require.NoError(t, err)
+	b := NewGenericBucket(client, WithUploadWorkers(3))
+
+	objects := make(ObjectList, 10)
+	for i := range objects {
+		objects[i] = ObjectData{ImageName: fmt.Sprintf("batch/%d.png", i), ImageData: ImageData{ObjectReader: strings.NewReader("data")}}
+	}
+	uploaded, err := b.CreateObjectsBatch(ctx, objects)
+	require.NoError(t, err)
+	assert.Len(t, uploaded, len(objects))
+	require.NoError(t, b.DeleteObjectsByPrefix(ctx, "batch"))
+
+	readErr := errors.New("read failed")
+	objects[4].ImageData.ObjectReader = iotest.ErrReader(readErr)
+	objects = append(objects, ObjectData{ImageName: "batch/more.png", ImageData: ImageData{ObjectReader: strings.NewReader("data")}})
+	for i := range objects {
+		if i != 4 {
+			objects[i].ImageData.ObjectReader = strings.NewReader("data")
+		}
+	}
+	_, err = b.CreateObjectsBatch(ctx, objects)
+
+	var batchErr *BatchUploadError
+	require.ErrorAs(t, err, &batchErr)
+	require.Len(t, batchErr.Results, len(objects))
+	assert.ErrorIs(t, batchErr.Results[4].Err, readErr)
+	for i, r := range batchErr.Results {
+		assert.Equal(t, objects[i].ImageName, r.ObjectName)
+		assert.NoError(t, r.RollbackErr)
+		if i != 4 {
+			assert.True(t, r.RolledBack || errors.Is(r.Err, ErrUploadAborted), r.ObjectName)
+		}
+	}
+
+	names, err := client.List(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
@@ -0,0 +1,268 @@
+package bucket
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// LocalObjectPath is the path prefix LocalBucketClient serves objects under.
+// The service handing out signed URLs must route it to the client, e.g.
+// r.PathPrefix(bucket.LocalObjectPath).Handler(localBucketClient)
+const LocalObjectPath = "/bucket/"
+
+const tempFilePrefix = ".upload-"
+
+var (
+	ErrInvalidObjectName = errors.New("invalid object name")
+	ErrInvalidSignature  = errors.New("invalid or expired signature")
+)
+
+// LocalBucketClient stores objects as files under a directory and implements BucketClientInterface.
+// Signed URLs are HMAC-SHA256 signatures over the object name and expiry, verified by ServeHTTP.
+type LocalBucketClient struct {
+	name    string
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocalBucketClient(cfg BucketClientConfig) (*LocalBucketClient, error) {
+	root := cfg.LocalDir
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "canary-bucket", cfg.BucketName)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create bucket directory %s: %w", root, err)
+	}
+
+	secret := []byte(cfg.URLSecret)
+	if len(secret) == 0 {
+		// URLs will stop verifying after a restart, which is acceptable for local development
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		log.Warn().Msgf("%s not set, signed bucket URLs will only be valid until the service restarts", URLSECRET_ENV)
+	}
+
+	return &LocalBucketClient{
+		name:    cfg.BucketName,
+		root:    root,
+		baseURL: strings.TrimRight(cfg.LocalURL, "/"),
+		secret:  secret,
+	}, nil
+}
+
+func (lc *LocalBucketClient) BucketName() string {
+	return lc.name
+}
+
+// objectPath maps an object name onto a file under the root, rejecting names that would escape it.
+func (lc *LocalBucketClient) objectPath(objectName string) (string, error) {
+	if objectName == "" || strings.HasPrefix(objectName, "/") || path.Clean(objectName) != objectName ||
+		objectName == ".." || strings.HasPrefix(objectName, "../") || strings.Contains(objectName, "\\") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidObjectName, objectName)
+	}
+	if strings.HasPrefix(path.Base(objectName), tempFilePrefix) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidObjectName, objectName)
+	}
+	return filepath.Join(lc.root, filepath.FromSlash(objectName)), nil
+}
+
+func (lc *LocalBucketClient) NewWriter(ctx context.Context, objectName string) io.WriteCloser {
+	target, err := lc.objectPath(objectName)
+	if err != nil {
+		return &localWriter{err: err}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return &localWriter{err: err}
+	}
+	// write to a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(target), tempFilePrefix+"*")
+	if err != nil {
+		return &localWriter{err: err}
+	}
+	return &localWriter{ctx: ctx, target: target, tmp: tmp}
+}
+
+type localWriter struct {
+	ctx    context.Context
+	target string
+	tmp    *os.File
+	err    error
+}
+
+func (w *localWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if err := w.ctx.Err(); err != nil {
+		w.err = err
+		return 0, err
+	}
+	n, err := w.tmp.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *localWriter) Close() error {
+	if w.tmp == nil {
+		return w.err
+	}
+	closeErr := w.tmp.Close()
+	if w.err == nil {
+		w.err = closeErr
+	}
+	// like the GCS writer, a cancelled context discards the object instead of saving it
+	if w.err == nil {
+		w.err = w.ctx.Err()
+	}
+	if w.err != nil {
+		_ = os.Remove(w.tmp.Name())
+		return w.err
+	}
+	return os.Rename(w.tmp.Name(), w.target)
+}
+
+func (lc *LocalBucketClient) NewReader(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	p, err := lc.objectPath(objectName)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, storage.ErrObjectNotExist
+	}
+	return f, err
+}
+
+func (lc *LocalBucketClient) Delete(ctx context.Context, objectName string) error {
+	p, err := lc.objectPath(objectName)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return storage.ErrObjectNotExist
+	}
+	return err
+}
+
+func (lc *LocalBucketClient) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(lc.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(lc.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (lc *LocalBucketClient) sign(objectName string, expires int64) string {
+	mac := hmac.New(sha256.New, lc.secret)
+	mac.Write([]byte(objectName + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURL returns a URL under LocalURL that ServeHTTP will honour until expires.
+func (lc *LocalBucketClient) SignedURL(ctx context.Context, objectName string, expires time.Time) (string, error) {
+	if _, err := lc.objectPath(objectName); err != nil {
+		return "", err
+	}
+	segments := strings.Split(objectName, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	exp := expires.Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(exp, 10)},
+		"signature": {lc.sign(objectName, exp)},
+	}
+	return lc.baseURL + LocalObjectPath + strings.Join(segments, "/") + "?" + query.Encode(), nil
+}
+
+// VerifySignedURL checks the expires and signature query parameters issued by SignedURL for objectName.
+func (lc *LocalBucketClient) VerifySignedURL(objectName, expires, signature string) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return ErrInvalidSignature
+	}
+	want := lc.sign(objectName, exp)
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ServeHTTP serves objects requested through URLs from SignedURL.
+func (lc *LocalBucketClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	objectName := strings.TrimPrefix(r.URL.Path, LocalObjectPath)
+	query := r.URL.Query()
+	if err := lc.VerifySignedURL(objectName, query.Get("expires"), query.Get("signature")); err != nil {
+		http.Error(w, "Invalid or expired URL", http.StatusForbidden)
+		log.Error().Err(err).Str("object", objectName).Msg("Rejected local bucket request")
+		return
+	}
+
+	p, err := lc.objectPath(objectName)
+	if err != nil {
+		http.Error(w, "Invalid object name", http.StatusBadRequest)
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.Error(w, "Object not found", http.StatusNotFound)
+		log.Error().Err(err).Str("object", objectName).Msg("Failed to open local bucket object")
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Object not found", http.StatusNotFound)
+		return
+	}
+	http.ServeContent(w, r, path.Base(objectName), info.ModTime(), f)
+}
+
+// Close is a no-op; it exists to satisfy BucketClientInterface.
+func (lc *LocalBucketClient) Close() error {
+	return nil
+}
@@ -0,0 +1,59 @@
+package bucket
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBucketSignedURL(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewLocalBucketClient(BucketClientConfig{BucketName: "test", LocalDir: t.TempDir(), URLSecret: "secret"})
+	require.NoError(t, err)
+	b := NewGenericBucket(client)
+
+	require.NoError(t, b.CreateObject(ctx, "batch/image one.png", strings.NewReader("data")))
+	data, err := b.GetObject(ctx, "batch/image one.png")
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	server := httptest.NewServer(client)
+	defer server.Close()
+	client.baseURL = server.URL
+
+	signed, err := b.GetSignedURL(ctx, "batch/image one.png")
+	require.NoError(t, err)
+	resp, err := http.Get(signed)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "data", string(body))
+
+	resp, err = http.Get(strings.Replace(signed, "signature=", "signature=0", 1))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	expired, err := client.SignedURL(ctx, "batch/image one.png", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	resp, err = http.Get(expired)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	_, err = client.NewReader(ctx, "../escape")
+	assert.ErrorIs(t, err, ErrInvalidObjectName)
+
+	require.NoError(t, b.DeleteObjectsByPrefix(ctx, "batch"))
+	names, err := client.List(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
@@ -0,0 +1,135 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSignedURLExpiry is how long signed URLs last unless WithSignedURLExpiry or a per-call expiry is used.
+	DefaultSignedURLExpiry = 60 * time.Minute
+	// MaxSignedURLExpiry is the longest lifetime Cloud Storage allows for a V4 signed URL.
+	MaxSignedURLExpiry = 7 * 24 * time.Hour
+
+	// a cached URL is replaced once less than this fraction of its lifetime remains
+	signedURLRefreshFraction = 4
+	maxCachedSignedURLs      = 50000
+)
+
+// timeNow is replaced in tests.
+var timeNow = time.Now
+
+// WithSignedURLExpiry sets the default lifetime of URLs returned by GetSignedURL.
+// Values outside (0, MaxSignedURLExpiry] are ignored.
+func WithSignedURLExpiry(expiry time.Duration) GenericBucketOption {
+	return func(b *GenericBucket) {
+		if expiry > 0 && expiry <= MaxSignedURLExpiry {
+			b.signedURLExpiry = expiry
+		}
+	}
+}
+
+// GenericBucketConfig sets how a GenericBucket uploads objects and signs URLs.
+type GenericBucketConfig struct {
+	// UploadWorkers is how many objects CreateObjectsBatch uploads at once.
+	UploadWorkers int `env:"BUCKET_UPLOAD_WORKERS" yaml:"uploadWorkers" default:"8"`
+	// SignedURLExpiry is how long URLs returned by GetSignedURL last.
+	SignedURLExpiry time.Duration `env:"BUCKET_SIGNED_URL_EXPIRY" yaml:"signedURLExpiry" default:"60m"`
+}
+
+func (c *GenericBucketConfig) Validate() error {
+	if c.UploadWorkers < 1 {
+		return fmt.Errorf("%s must be at least 1", UPLOADWORKERS_ENV)
+	}
+	if c.SignedURLExpiry <= 0 || c.SignedURLExpiry > MaxSignedURLExpiry {
+		return fmt.Errorf("%s must be positive and at most %s", SIGNEDURLEXPIRY_ENV, MaxSignedURLExpiry)
+	}
+	return nil
+}
+
+// Options returns the GenericBucket options c sets.
+func (c GenericBucketConfig) Options() []GenericBucketOption {
+	return []GenericBucketOption{WithUploadWorkers(c.UploadWorkers), WithSignedURLExpiry(c.SignedURLExpiry)}
+}
+
+type signedURLKey struct {
+	objectName string
+	expiry     time.Duration
+}
+
+type signedURLEntry struct {
+	url       string
+	refreshAt time.Time
+}
+
+// signedURLCache keeps signed URLs until shortly before they expire, so listing the same images again does not
+// sign every URL again. Every URL it returns has at least a quarter of its requested lifetime left.
+type signedURLCache struct {
+	mu      sync.Mutex
+	entries map[signedURLKey]signedURLEntry
+}
+
+func newSignedURLCache() *signedURLCache {
+	return &signedURLCache{entries: make(map[signedURLKey]signedURLEntry)}
+}
+
+func (c *signedURLCache) get(key signedURLKey, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !now.Before(entry.refreshAt) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.url, true
+}
+
+func (c *signedURLCache) put(key signedURLKey, url string, signedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCachedSignedURLs {
+		for k, e := range c.entries {
+			if !signedAt.Before(e.refreshAt) {
+				delete(c.entries, k)
+			}
+		}
+		// still full of live URLs: start again rather than grow without bound
+		if len(c.entries) >= maxCachedSignedURLs {
+			c.entries = make(map[signedURLKey]signedURLEntry)
+		}
+	}
+	c.entries[key] = signedURLEntry{
+		url:       url,
+		refreshAt: signedAt.Add(key.expiry - key.expiry/signedURLRefreshFraction),
+	}
+}
+
+// GetSignedURL returns a URL for objectName that lasts the bucket's configured expiry.
+func (b *GenericBucket) GetSignedURL(ctx context.Context, objectName string) (string, error) {
+	return b.GetSignedURLWithExpiry(ctx, objectName, b.signedURLExpiry)
+}
+
+// GetSignedURLWithExpiry returns a URL for objectName that lasts expiry, reusing a cached URL while at least a
+// quarter of its lifetime remains.
+func (b *GenericBucket) GetSignedURLWithExpiry(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
+	if expiry <= 0 || expiry > MaxSignedURLExpiry {
+		return "", fmt.Errorf("signed URL expiry %s must be positive and at most %s", expiry, MaxSignedURLExpiry)
+	}
+	key := signedURLKey{objectName: objectName, expiry: expiry}
+	now := timeNow()
+	if url, ok := b.signedURLs.get(key, now); ok {
+		return url, nil
+	}
+
+	url, err := b.bucket.SignedURL(ctx, objectName, now.Add(expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signed URL for object %s: %w", objectName, err)
+	}
+	b.signedURLs.put(key, url, now)
+	return url, nil
+}
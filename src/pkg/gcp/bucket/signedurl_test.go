@@ -0,0 +1,45 @@
+package bucket
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedURLCache(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewLocalBucketClient(BucketClientConfig{BucketName: "test", LocalDir: t.TempDir(), URLSecret: "secret"})
+	require.NoError(t, err)
+	b := NewGenericBucket(client, WithSignedURLExpiry(4*time.Hour))
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	first, err := b.GetSignedURL(ctx, "a.png")
+	require.NoError(t, err)
+	assert.Contains(t, first, "expires="+strconv.FormatInt(now.Add(4*time.Hour).Unix(), 10))
+
+	// reused while more than a quarter of the lifetime remains
+	now = now.Add(2 * time.Hour)
+	cached, err := b.GetSignedURL(ctx, "a.png")
+	require.NoError(t, err)
+	assert.Equal(t, first, cached)
+
+	// a different expiry is signed separately
+	short, err := b.GetSignedURLWithExpiry(ctx, "a.png", time.Minute)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, short)
+
+	now = now.Add(time.Hour + time.Second)
+	refreshed, err := b.GetSignedURL(ctx, "a.png")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, refreshed)
+
+	_, err = b.GetSignedURLWithExpiry(ctx, "a.png", 8*24*time.Hour)
+	assert.Error(t, err)
+}
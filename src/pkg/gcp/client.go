@@ -2,16 +2,16 @@ package gcp
 
 import (
 	"context"
-	"os"
+	"errors"
+	"fmt"
 	"reflect"
 
 	"github.com/rs/zerolog/log"
 
+	"pkg/config"
 	"pkg/gcp/bucket"
 	fs "pkg/gcp/firestore"
 	"pkg/gcp/gsm"
-
-	"github.com/joho/godotenv"
 )
 
 const (
@@ -23,12 +23,40 @@ const (
 // ClientOptions should be populated by each service so they specify which clients they intend on using
 // This avoids creating clients which are never used
 type ClientOptions struct {
-	UseFirestore bool
-	UseGSM       bool
-	UseBucket    bool
+	UseFirestore bool `env:"USE_FIRESTORE" yaml:"useFirestore"`
+	UseGSM       bool `env:"USE_GSM" yaml:"useGSM"`
+	UseBucket    bool `env:"USE_BUCKET" yaml:"useBucket"`
 
-	FirestoreConfig fs.FireStoreClientConfig
-	BucketConfig    bucket.BucketClientConfig
+	FirestoreConfig fs.FireStoreClientConfig  `yaml:"firestore"`
+	BucketConfig    bucket.BucketClientConfig `yaml:"bucket"`
+}
+
+// Validate checks the settings of each client that is enabled.
+func (c *ClientOptions) Validate() error {
+	var errs []error
+	if c.UseFirestore {
+		switch c.FirestoreConfig.Backend {
+		case "", fs.FirestoreBackend:
+			if c.FirestoreConfig.ProjectID == "" {
+				errs = append(errs, fmt.Errorf("%s is required when %s is true", fs.PROJECTID_ENV, USE_FIRESTORE_ENV))
+			}
+		case fs.MemoryBackend:
+		default:
+			errs = append(errs, fmt.Errorf("unknown %s %q", fs.BACKEND_ENV, c.FirestoreConfig.Backend))
+		}
+	}
+	if c.UseBucket {
+		switch c.BucketConfig.Backend {
+		case "", bucket.GCSBackend:
+			if c.BucketConfig.BucketName == "" {
+				errs = append(errs, fmt.Errorf("%s is required when %s is true", bucket.BUCKETNAME_ENV, USE_BUCKET_ENV))
+			}
+		case bucket.LocalBackend:
+		default:
+			errs = append(errs, fmt.Errorf("unknown %s %q", bucket.BACKEND_ENV, c.BucketConfig.Backend))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // Clients holds all external service clients.
@@ -38,39 +66,33 @@ type Clients struct {
 	Bucket    bucket.BucketClientInterface
 }
 
-func getEnvBool(envName string) bool {
-	return os.Getenv(envName) == "true"
-}
-func (c *ClientOptions) LoadClientOptions() {
-	_ = godotenv.Load()
-	c.UseFirestore = getEnvBool(USE_FIRESTORE_ENV)
-	if c.UseFirestore {
-		c.FirestoreConfig.ProjectID = os.Getenv(fs.PROJECTID_ENV)
-		c.FirestoreConfig.DatabaseID = os.Getenv(fs.DATABSEID_ENV)
-	}
-
-	c.UseGSM = getEnvBool(USE_GSM_ENV)
-
-	c.UseBucket = getEnvBool(USE_BUCKET_ENV)
-	if c.UseBucket {
-		c.BucketConfig.BucketName = os.Getenv(bucket.BUCKETNAME_ENV)
-	}
+// LoadClientOptions loads and validates the client options on their own. Services that load a full config
+// with pkg/config get them as part of it instead.
+func (c *ClientOptions) LoadClientOptions() error {
+	return config.Load(c)
 }
 
 // InitialiseClients creates and returns all required service clients.
 func InitialiseClients(ctx context.Context, opts ClientOptions) (*Clients, error) {
-	var firestoreClient *fs.FirestoreClient
-	var gsmClient *gsm.GSMClient
-	var bucketClient *bucket.BucketClient
+	var firestoreClient fs.FirestoreClientInterface
+	var gsmClient gsm.GSMClientInterface
+	var bucketClient bucket.BucketClientInterface
 	var err error
 
 	if opts.UseFirestore {
-
-		firestoreClient, err = fs.NewFirestoreClient(ctx, opts.FirestoreConfig)
-		if err != nil {
-			return nil, err
+		switch opts.FirestoreConfig.Backend {
+		case fs.MemoryBackend:
+			firestoreClient = fs.NewMemoryClient()
+			log.Info().Msg("In-memory Firestore Client Initialised")
+		case "", fs.FirestoreBackend:
+			firestoreClient, err = fs.NewFirestoreClient(ctx, opts.FirestoreConfig)
+			if err != nil {
+				return nil, err
+			}
+			log.Info().Msg("Firestore Client Initialised")
+		default:
+			return nil, fmt.Errorf("unknown %s %q", fs.BACKEND_ENV, opts.FirestoreConfig.Backend)
 		}
-		log.Info().Msg("Firestore Client Initialised")
 	}
 
 	if opts.UseGSM {
@@ -82,11 +104,22 @@ func InitialiseClients(ctx context.Context, opts ClientOptions) (*Clients, error
 	}
 
 	if opts.UseBucket {
-		bucketClient, err = bucket.NewBucketClient(ctx, opts.BucketConfig)
-		if err != nil {
-			return nil, err
+		switch opts.BucketConfig.Backend {
+		case bucket.LocalBackend:
+			bucketClient, err = bucket.NewLocalBucketClient(opts.BucketConfig)
+			if err != nil {
+				return nil, err
+			}
+			log.Info().Msg("Local Bucket Client Initialised")
+		case "", bucket.GCSBackend:
+			bucketClient, err = bucket.NewBucketClient(ctx, opts.BucketConfig)
+			if err != nil {
+				return nil, err
+			}
+			log.Info().Msg("Bucket Client Initialised")
+		default:
+			return nil, fmt.Errorf("unknown %s %q", bucket.BACKEND_ENV, opts.BucketConfig.Backend)
 		}
-		log.Info().Msg("Bucket Client Initialised")
 	}
 
 	return &Clients{
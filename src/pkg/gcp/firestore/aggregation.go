@@ -0,0 +1,52 @@
+package firestore
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Aggregation string
+
+var (
+	Count   Aggregation = "count"
+	Sum     Aggregation = "sum"
+	Average Aggregation = "avg"
+)
+
+// AggregationField is one aggregation computed by GetAggregations. Path is the numeric field to
+// aggregate and is ignored for Count. Alias is the key of the value in the AggregationResult.
+type AggregationField struct {
+	Alias       string
+	Aggregation Aggregation
+	Path        string
+}
+
+// AggregationResult maps each AggregationField alias to its value. Sum and Average only include
+// numeric values; Average is missing from the result when no document has a numeric value at Path.
+type AggregationResult map[string]float64
+
+func validateAggregations(fields []AggregationField) error {
+	if len(fields) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one aggregation is required")
+	}
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if f.Alias == "" {
+			return status.Error(codes.InvalidArgument, "aggregation alias is required")
+		}
+		if seen[f.Alias] {
+			return status.Errorf(codes.InvalidArgument, "duplicate aggregation alias: %s", f.Alias)
+		}
+		seen[f.Alias] = true
+		switch f.Aggregation {
+		case Count:
+		case Sum, Average:
+			if f.Path == "" {
+				return status.Errorf(codes.InvalidArgument, "aggregation %s requires a path", f.Alias)
+			}
+		default:
+			return status.Errorf(codes.InvalidArgument, "unsupported aggregation: %s", f.Aggregation)
+		}
+	}
+	return nil
+}
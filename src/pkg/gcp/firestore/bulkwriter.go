@@ -0,0 +1,194 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+)
+
+// BulkWriter queues writes to any collection and sends them in batches when End is called.
+// Writes are not atomic: each document succeeds or fails on its own and failures are reported per document.
+type BulkWriter interface {
+	// Set and Update queue a write. A document can only be written once per BulkWriter, so a second write to it
+	// returns ErrDuplicateWrite.
+	Set(collectionID, docID string, data interface{}) error
+	Update(collectionID, docID string, updates []Update) error
+	// Delete queues a delete. Deleting the same document twice is only queued once.
+	Delete(collectionID, docID string) error
+	// End sends all queued writes, waits for them to finish and returns BulkWriteErrors if any failed.
+	// The writer cannot be used afterwards.
+	End() error
+}
+
+// BulkWriteError is the failure of a single document write in a BulkWriter.
+type BulkWriteError struct {
+	CollectionID string
+	DocID        string
+	Err          error
+}
+
+func (e BulkWriteError) Error() string {
+	return fmt.Sprintf("%s/%s: %v", e.CollectionID, e.DocID, e.Err)
+}
+
+func (e BulkWriteError) Unwrap() error { return e.Err }
+
+// BulkWriteErrors is returned by BulkWriter.End when one or more writes failed.
+type BulkWriteErrors []BulkWriteError
+
+func (e BulkWriteErrors) Error() string {
+	if len(e) == 1 {
+		return "bulk write failed: " + e[0].Error()
+	}
+	return fmt.Sprintf("%d bulk writes failed, first: %s", len(e), e[0].Error())
+}
+
+type docKey struct {
+	collectionID string
+	docID        string
+}
+
+// queuedDocs records the documents a BulkWriter has a write for, and whether that write is a delete.
+type queuedDocs map[docKey]bool
+
+// add reports whether a write to key should be queued. A delete of a document that is already being deleted is
+// skipped, and any other second write to it is ErrDuplicateWrite: Cloud Firestore rejects it, and would not apply
+// the two in order if it did not.
+func (q queuedDocs) add(key docKey, isDelete bool) (bool, error) {
+	if queuedDelete, ok := q[key]; ok {
+		if queuedDelete && isDelete {
+			return false, nil
+		}
+		return false, BulkWriteError{CollectionID: key.collectionID, DocID: key.docID, Err: ErrDuplicateWrite}
+	}
+	q[key] = isDelete
+	return true, nil
+}
+
+type firestoreBulkJob struct {
+	key docKey
+	job *firestore.BulkWriterJob
+}
+
+type firestoreBulkWriter struct {
+	client *firestore.Client
+	writer *firestore.BulkWriter
+	jobs   []firestoreBulkJob
+	queued queuedDocs
+}
+
+// NewBulkWriter returns a BulkWriter backed by a Cloud Firestore BulkWriter.
+func (fc *FirestoreClient) NewBulkWriter(ctx context.Context) BulkWriter {
+	return &firestoreBulkWriter{
+		client: fc.client,
+		writer: fc.client.BulkWriter(ctx),
+		queued: make(queuedDocs),
+	}
+}
+
+// queue queues the write made by write unless the document already has one.
+func (w *firestoreBulkWriter) queue(collectionID, docID string, isDelete bool, write func(doc *firestore.DocumentRef) (*firestore.BulkWriterJob, error)) error {
+	key := docKey{collectionID, docID}
+	ok, err := w.queued.add(key, isDelete)
+	if !ok {
+		return err
+	}
+	job, err := write(w.client.Collection(collectionID).Doc(docID))
+	if err != nil {
+		return BulkWriteError{CollectionID: collectionID, DocID: docID, Err: err}
+	}
+	w.jobs = append(w.jobs, firestoreBulkJob{key: key, job: job})
+	return nil
+}
+
+func (w *firestoreBulkWriter) Set(collectionID, docID string, data interface{}) error {
+	return w.queue(collectionID, docID, false, func(doc *firestore.DocumentRef) (*firestore.BulkWriterJob, error) {
+		return w.writer.Set(doc, data)
+	})
+}
+
+func (w *firestoreBulkWriter) Update(collectionID, docID string, updates []Update) error {
+	return w.queue(collectionID, docID, false, func(doc *firestore.DocumentRef) (*firestore.BulkWriterJob, error) {
+		return w.writer.Update(doc, toFirestoreUpdates(updates))
+	})
+}
+
+func (w *firestoreBulkWriter) Delete(collectionID, docID string) error {
+	return w.queue(collectionID, docID, true, func(doc *firestore.DocumentRef) (*firestore.BulkWriterJob, error) {
+		return w.writer.Delete(doc)
+	})
+}
+
+func (w *firestoreBulkWriter) End() error {
+	w.writer.End()
+	var errs BulkWriteErrors
+	for _, j := range w.jobs {
+		if _, err := j.job.Results(); err != nil {
+			errs = append(errs, BulkWriteError{CollectionID: j.key.collectionID, DocID: j.key.docID, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+type memoryBulkWrite struct {
+	key   docKey
+	apply func(ctx context.Context, c CollectionInterface) error
+}
+
+type memoryBulkWriter struct {
+	ctx    context.Context
+	client *MemoryClient
+	writes []memoryBulkWrite
+	queued queuedDocs
+}
+
+// NewBulkWriter returns a BulkWriter that applies its writes to the in-memory collections on End.
+func (mc *MemoryClient) NewBulkWriter(ctx context.Context) BulkWriter {
+	return &memoryBulkWriter{ctx: ctx, client: mc, queued: make(queuedDocs)}
+}
+
+// queue queues apply unless the document already has a write, following the same rules as Cloud Firestore.
+func (w *memoryBulkWriter) queue(collectionID, docID string, isDelete bool, apply func(ctx context.Context, c CollectionInterface) error) error {
+	key := docKey{collectionID, docID}
+	ok, err := w.queued.add(key, isDelete)
+	if ok {
+		w.writes = append(w.writes, memoryBulkWrite{key: key, apply: apply})
+	}
+	return err
+}
+
+func (w *memoryBulkWriter) Set(collectionID, docID string, data interface{}) error {
+	return w.queue(collectionID, docID, false, func(ctx context.Context, c CollectionInterface) error {
+		return c.SetAll(ctx, []string{docID}, []interface{}{data})
+	})
+}
+
+func (w *memoryBulkWriter) Update(collectionID, docID string, updates []Update) error {
+	return w.queue(collectionID, docID, false, func(ctx context.Context, c CollectionInterface) error {
+		return c.Update(ctx, docID, updates)
+	})
+}
+
+func (w *memoryBulkWriter) Delete(collectionID, docID string) error {
+	return w.queue(collectionID, docID, true, func(ctx context.Context, c CollectionInterface) error {
+		return c.Delete(ctx, docID)
+	})
+}
+
+func (w *memoryBulkWriter) End() error {
+	var errs BulkWriteErrors
+	for _, write := range w.writes {
+		if err := write.apply(w.ctx, w.client.Collection(write.key.collectionID)); err != nil {
+			errs = append(errs, BulkWriteError{CollectionID: write.key.collectionID, DocID: write.key.docID, Err: err})
+		}
+	}
+	w.writes = nil
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
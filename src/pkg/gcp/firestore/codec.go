@@ -0,0 +1,525 @@
+package firestore
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// This file converts Go values to and from the plain representation used by the in-memory backend.
+// Values are normalised to: nil, bool, int64, float64, string, []byte, time.Time,
+// []interface{} and map[string]interface{}, honouring `firestore:"name,omitempty"` struct tags.
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func encodeValue(v interface{}) (interface{}, error) {
+	return encodeReflect(reflect.ValueOf(v))
+}
+
+// encodeDoc encodes a document value, which must encode to a map.
+func encodeDoc(v interface{}) (map[string]interface{}, error) {
+	enc, err := encodeValue(v)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := enc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("firestore: document data must be a struct or map, got %T", v)
+	}
+	return m, nil
+}
+
+func encodeReflect(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return encodeReflect(v.Elem())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return bytes.Clone(v.Bytes()), nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range v.Len() {
+			elem, err := encodeReflect(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = elem
+		}
+		return out, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("firestore: map key type must be string, got %s", v.Type().Key())
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := encodeReflect(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			out[iter.Key().String()] = elem
+		}
+		return out, nil
+	case reflect.Struct:
+		out := make(map[string]interface{})
+		if err := encodeStruct(v, out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("firestore: cannot encode value of type %s", v.Type())
+	}
+}
+
+func encodeStruct(v reflect.Value, out map[string]interface{}) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, omitEmpty, skip := parseFieldTag(field)
+		if skip {
+			continue
+		}
+		fv := v.Field(i)
+		// anonymous structs without an explicit name are flattened into the parent
+		if field.Anonymous && field.Tag.Get("firestore") == "" && indirectType(field.Type).Kind() == reflect.Struct {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if err := encodeStruct(fv, out); err != nil {
+				return err
+			}
+			continue
+		}
+		if omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		enc, err := encodeReflect(fv)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		out[name] = enc
+	}
+	return nil
+}
+
+// parseFieldTag returns the stored name of a struct field and whether it should be omitted when empty or skipped.
+func parseFieldTag(field reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	if !field.IsExported() {
+		return "", false, true
+	}
+	tag := field.Tag.Get("firestore")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, false
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		return v.IsZero()
+	}
+	return false
+}
+
+// decodeValue stores src (a value produced by encodeValue) into the value pointed to by dst.
+func decodeValue(src interface{}, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("firestore: DataTo requires a non-nil pointer, got %T", dst)
+	}
+	return decodeReflect(src, rv.Elem())
+}
+
+func decodeReflect(src interface{}, dst reflect.Value) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Type() == timeType {
+		t, ok := src.(time.Time)
+		if !ok {
+			return typeMismatch(src, dst)
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeReflect(src, dst.Elem())
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return typeMismatch(src, dst)
+		}
+		dst.Set(reflect.ValueOf(cloneValue(src)))
+		return nil
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return typeMismatch(src, dst)
+		}
+		dst.SetBool(b)
+	case reflect.String:
+		s, ok := src.(string)
+		if !ok {
+			return typeMismatch(src, dst)
+		}
+		dst.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch n := src.(type) {
+		case int64:
+			dst.SetInt(n)
+		case float64:
+			dst.SetInt(int64(n))
+		default:
+			return typeMismatch(src, dst)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch n := src.(type) {
+		case int64:
+			dst.SetUint(uint64(n))
+		case float64:
+			dst.SetUint(uint64(n))
+		default:
+			return typeMismatch(src, dst)
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := src.(type) {
+		case int64:
+			dst.SetFloat(float64(n))
+		case float64:
+			dst.SetFloat(n)
+		default:
+			return typeMismatch(src, dst)
+		}
+	case reflect.Slice:
+		if b, ok := src.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes(bytes.Clone(b))
+			return nil
+		}
+		arr, ok := src.([]interface{})
+		if !ok {
+			return typeMismatch(src, dst)
+		}
+		out := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, elem := range arr {
+			if err := decodeReflect(elem, out.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(out)
+	case reflect.Array:
+		arr, ok := src.([]interface{})
+		if !ok {
+			return typeMismatch(src, dst)
+		}
+		for i := 0; i < dst.Len() && i < len(arr); i++ {
+			if err := decodeReflect(arr[i], dst.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := src.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return typeMismatch(src, dst)
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(m)))
+		}
+		for k, v := range m {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeReflect(v, elem); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+	case reflect.Struct:
+		m, ok := src.(map[string]interface{})
+		if !ok {
+			return typeMismatch(src, dst)
+		}
+		return decodeStruct(m, dst)
+	default:
+		return typeMismatch(src, dst)
+	}
+	return nil
+}
+
+func decodeStruct(m map[string]interface{}, dst reflect.Value) error {
+	t := dst.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, skip := parseFieldTag(field)
+		if skip {
+			continue
+		}
+		fv := dst.Field(i)
+		if field.Anonymous && field.Tag.Get("firestore") == "" && indirectType(field.Type).Kind() == reflect.Struct {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(field.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := decodeStruct(m, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		// fields that are not stored are left untouched, matching Cloud Firestore
+		v, ok := m[name]
+		if !ok {
+			continue
+		}
+		if err := decodeReflect(v, fv); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func typeMismatch(src interface{}, dst reflect.Value) error {
+	return fmt.Errorf("firestore: cannot set type %s to %T", dst.Type(), src)
+}
+
+// cloneValue deep copies an encoded value so callers cannot mutate stored documents.
+func cloneValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return cloneMap(t)
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, elem := range t {
+			out[i] = cloneValue(elem)
+		}
+		return out
+	case []byte:
+		return bytes.Clone(t)
+	default:
+		return v
+	}
+}
+
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+// getPath looks up a dot separated field path in an encoded document.
+func getPath(data map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	var cur interface{} = data
+	for _, p := range parts {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[p]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// setPath sets a dot separated field path in an encoded document, creating intermediate maps as needed.
+func setPath(data map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	cur := data
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			cur[p] = next
+		}
+		cur = next
+	}
+	cur[parts[len(parts)-1]] = value
+}
+
+// deletePath removes a dot separated field path from an encoded document, if it is there.
+func deletePath(data map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	cur := data
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]interface{})
+		if !ok {
+			return
+		}
+		cur = next
+	}
+	delete(cur, parts[len(parts)-1])
+}
+
+// typeOrder ranks encoded values the same way Cloud Firestore orders mixed types.
+func typeOrder(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case int64, float64:
+		return 2
+	case time.Time:
+		return 3
+	case string:
+		return 4
+	case []byte:
+		return 5
+	case []interface{}:
+		return 6
+	case map[string]interface{}:
+		return 7
+	default:
+		return 8
+	}
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// compareValues returns -1, 0 or 1 comparing two encoded values.
+func compareValues(a, b interface{}) int {
+	ta, tb := typeOrder(a), typeOrder(b)
+	if ta != tb {
+		if ta < tb {
+			return -1
+		}
+		return 1
+	}
+	switch av := a.(type) {
+	case nil:
+		return 0
+	case bool:
+		bv := b.(bool)
+		switch {
+		case av == bv:
+			return 0
+		case !av:
+			return -1
+		default:
+			return 1
+		}
+	case int64, float64:
+		if ai, ok := a.(int64); ok {
+			if bi, ok := b.(int64); ok {
+				return cmpOrdered(ai, bi)
+			}
+		}
+		return cmpOrdered(toFloat(a), toFloat(b))
+	case time.Time:
+		return av.Compare(b.(time.Time))
+	case string:
+		return strings.Compare(av, b.(string))
+	case []byte:
+		return bytes.Compare(av, b.([]byte))
+	case []interface{}:
+		bv := b.([]interface{})
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c := compareValues(av[i], bv[i]); c != 0 {
+				return c
+			}
+		}
+		return cmpOrdered(len(av), len(bv))
+	case map[string]interface{}:
+		if reflect.DeepEqual(av, b) {
+			return 0
+		}
+		return strings.Compare(fmt.Sprint(av), fmt.Sprint(b))
+	}
+	return 0
+}
+
+func cmpOrdered[T int | int64 | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func equalValues(a, b interface{}) bool {
+	return compareValues(a, b) == 0
+}
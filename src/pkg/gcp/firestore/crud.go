@@ -2,10 +2,10 @@ package firestore
 
 import (
 	"context"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
 
-	"cloud.google.com/go/firestore"
-	"cloud.google.com/go/firestore/apiv1/firestorepb"
-	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -16,28 +16,24 @@ type QueryParameter struct {
 	Value interface{}
 }
 
-type Aggregation string
-
-var Count Aggregation = "count"
+// MaxInQueryValues is the largest number of values Cloud Firestore accepts in a single `in` filter.
+const MaxInQueryValues = 30
 
 type GenericStore struct {
-	client     FirestoreClientInterface
-	collection *firestore.CollectionRef
+	client       FirestoreClientInterface
+	collectionID string
+	collection   CollectionInterface
 }
 
 func NewGenericStore(client FirestoreClientInterface, collectionID string) *GenericStore {
-	return &GenericStore{client: client, collection: client.GetCollection(collectionID)}
+	return &GenericStore{client: client, collectionID: collectionID, collection: client.Collection(collectionID)}
 }
 
 // Client exposes the underlying Firestore client interface for advanced operations.
 func (s *GenericStore) Client() FirestoreClientInterface { return s.client }
 
 func (s *GenericStore) CreateDoc(ctx context.Context, data interface{}) (string, error) {
-	docRef, _, err := s.collection.Add(ctx, data)
-	if err != nil {
-		return "", err
-	}
-	return docRef.ID, nil
+	return s.collection.Add(ctx, data)
 }
 
 func (s *GenericStore) CreateDocsBatch(ctx context.Context, docs []interface{}, ids []string) ([]string, error) {
@@ -50,89 +46,191 @@ func (s *GenericStore) CreateDocsBatch(ctx context.Context, docs []interface{},
 	if len(ids) == 0 {
 		ids = make([]string, len(docs))
 		for i := range docs {
-			ids[i] = s.collection.NewDoc().ID
+			ids[i] = s.collection.NewDocID()
 		}
 	}
 
-	bulkWriter := s.client.BulkWriter(ctx)
-	errChan := make(chan error, len(docs))
-
-	for i, data := range docs {
-		docRef := s.collection.Doc(ids[i]) // use provided or generated ID
-		_, err := bulkWriter.Set(docRef, data)
-		if err != nil {
-			errChan <- err
-		}
+	if err := s.collection.SetAll(ctx, ids, docs); err != nil {
+		return nil, err
 	}
+	return ids, nil
+}
 
-	// Finalize writes
-	bulkWriter.End()
+// ReadCollection returns every document matching query. Options may add ordering, a start-after cursor and a limit.
+func (s *GenericStore) ReadCollection(ctx context.Context, query []QueryParameter, opts ...QueryOption) ([]*DocumentSnapshot, error) {
+	q := Query{Filters: query}
+	for _, opt := range opts {
+		opt(&q)
+	}
+	return s.collection.Query(ctx, q)
+}
 
-	// Check for errors
-	close(errChan)
-	for err := range errChan {
+// ReadCollectionIn returns the documents matching query whose path field equals any of values.
+// values is split into chunks of MaxInQueryValues, so the number of reads grows with len(values)/MaxInQueryValues.
+func (s *GenericStore) ReadCollectionIn(ctx context.Context, query []QueryParameter, path string, values []string) ([]*DocumentSnapshot, error) {
+	var docs []*DocumentSnapshot
+	for start := 0; start < len(values); start += MaxInQueryValues {
+		end := min(start+MaxInQueryValues, len(values))
+		chunkQuery := append(append([]QueryParameter{}, query...), QueryParameter{Path: path, Op: "in", Value: values[start:end]})
+		chunk, err := s.collection.Query(ctx, Query{Filters: chunkQuery})
 		if err != nil {
 			return nil, err
 		}
+		docs = append(docs, chunk...)
 	}
-
-	return ids, nil
+	return docs, nil
 }
 
-func (s *GenericStore) ReadCollection(ctx context.Context, query []QueryParameter) ([]*firestore.DocumentSnapshot, error) {
-	result := s.collection.Query
-
-	for _, q := range query {
-		result = result.Where(q.Path, q.Op, q.Value)
+// BulkDeleteDocs queues deletes of docIDs on bw. Nothing is deleted until bw.End is called.
+func (s *GenericStore) BulkDeleteDocs(bw BulkWriter, docIDs []string) error {
+	for _, id := range docIDs {
+		if err := bw.Delete(s.collectionID, id); err != nil {
+			return err
+		}
 	}
-	iter := result.Documents(ctx)
-	defer iter.Stop()
-	docs, err := iter.GetAll()
+	return nil
+}
+
+// BulkDeleteDocsByQueryIn queues deletes on bw for every document ReadCollectionIn would return.
+func (s *GenericStore) BulkDeleteDocsByQueryIn(ctx context.Context, bw BulkWriter, query []QueryParameter, path string, values []string) error {
+	docs, err := s.ReadCollectionIn(ctx, query, path, values)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	return docs, nil
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.Ref.ID
+	}
+	return s.BulkDeleteDocs(bw, ids)
 }
 
-func (s *GenericStore) GetAggregationWithQuery(ctx context.Context, query []QueryParameter, aggregation Aggregation) (int64, error) {
-	result := s.collection.Query
+// ReadPage returns up to pageSize documents matching query in orderBy order, starting after pageToken
+// (empty for the first page). The returned token is empty when there are no further pages.
+func (s *GenericStore) ReadPage(ctx context.Context, query []QueryParameter, orderBy []OrderBy, pageSize int, pageToken string) ([]*DocumentSnapshot, string, error) {
+	if pageSize <= 0 {
+		return nil, "", status.Error(codes.InvalidArgument, "page size must be positive")
+	}
+	q := Query{Filters: query, OrderBy: orderBy, Limit: pageSize + 1}
+	if pageToken != "" {
+		cursor, err := decodePageToken(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		q.StartAfter = cursor
+	}
 
-	for _, q := range query {
-		result = result.Where(q.Path, q.Op, q.Value)
+	docs, err := s.collection.Query(ctx, q)
+	if err != nil {
+		return nil, "", err
+	}
+	// one extra document is fetched to find out whether another page exists
+	if len(docs) <= pageSize {
+		return docs, "", nil
+	}
+	docs = docs[:pageSize]
+	// the token holds the last document's position rather than its ID, so deleting it does not end the paging
+	next, err := encodePageToken(cursorAfter(docs[pageSize-1], orderBy))
+	if err != nil {
+		return nil, "", err
 	}
+	return docs, next, nil
+}
 
-	var aggregationQuery *firestore.AggregationQuery
-	switch aggregation {
-	case Count:
-		aggregationQuery = result.NewAggregationQuery().WithCount(string(aggregation))
-	default:
+// GetAggregationWithQuery returns the number of documents matching query. Count is the only aggregation that
+// needs no field path; use GetAggregations for sums and averages.
+func (s *GenericStore) GetAggregationWithQuery(ctx context.Context, query []QueryParameter, aggregation Aggregation) (int64, error) {
+	if aggregation != Count {
 		return 0, status.Errorf(codes.InvalidArgument, "unsupported aggregation: %s", aggregation)
 	}
-
-	aggResult, err := aggregationQuery.Get(ctx)
+	alias := string(Count)
+	result, err := s.GetAggregations(ctx, query, []AggregationField{{Alias: alias, Aggregation: Count}})
 	if err != nil {
 		return 0, err
 	}
+	return int64(result[alias]), nil
+}
+
+// GetAggregations computes every field over the documents matching query in a single aggregation query,
+// without downloading the documents. An `in` filter with more than MaxInQueryValues string values is split into
+// several queries whose counts and sums are added together; averages cannot be combined that way and are rejected.
+func (s *GenericStore) GetAggregations(ctx context.Context, query []QueryParameter, fields []AggregationField) (AggregationResult, error) {
+	if err := validateAggregations(fields); err != nil {
+		return nil, err
+	}
+
+	inIndex := -1
+	var values []string
+	for i, qp := range query {
+		if v, ok := qp.Value.([]string); ok && qp.Op == "in" && len(v) > MaxInQueryValues {
+			inIndex, values = i, v
+			break
+		}
+	}
+	if inIndex == -1 {
+		return s.collection.Aggregate(ctx, Query{Filters: query}, fields)
+	}
+	for _, f := range fields {
+		if f.Aggregation == Average {
+			return nil, status.Errorf(codes.InvalidArgument, "aggregation %s: average cannot be combined across more than %d in values", f.Alias, MaxInQueryValues)
+		}
+	}
 
-	count, ok := aggResult[string(aggregation)]
-	if !ok {
-		return 0, status.Errorf(codes.Internal, "aggregation result missing count value")
+	total := make(AggregationResult, len(fields))
+	for start := 0; start < len(values); start += MaxInQueryValues {
+		end := min(start+MaxInQueryValues, len(values))
+		chunkQuery := append([]QueryParameter{}, query...)
+		chunkQuery[inIndex].Value = values[start:end]
+		result, err := s.collection.Aggregate(ctx, Query{Filters: chunkQuery}, fields)
+		if err != nil {
+			return nil, err
+		}
+		for alias, v := range result {
+			total[alias] += v
+		}
 	}
-	countValue := count.(*firestorepb.Value)
-	return countValue.GetIntegerValue(), nil
+	return total, nil
 }
 
-func (s *GenericStore) GetDoc(ctx context.Context, docID string) (*firestore.DocumentSnapshot, error) {
-	docSnap, err := s.collection.Doc(docID).Get(ctx)
-	if status.Code(err) == codes.NotFound {
-		return nil, ErrNotFound
+// maxConcurrentGroupAggregations bounds the aggregation queries GetGroupedAggregations runs at once.
+const maxConcurrentGroupAggregations = 8
+
+// GetGroupedAggregations computes fields separately for each of groups, over the documents matching query whose
+// groupPath equals the group. Firestore has no GROUP BY, so this runs one aggregation query per group.
+// Groups without matching documents are still present in the result.
+func (s *GenericStore) GetGroupedAggregations(ctx context.Context, query []QueryParameter, groupPath string, groups []string, fields []AggregationField) (map[string]AggregationResult, error) {
+	if err := validateAggregations(fields); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]AggregationResult, len(groups))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentGroupAggregations)
+	for _, group := range groups {
+		groupQuery := append(append([]QueryParameter{}, query...), QueryParameter{Path: groupPath, Op: "==", Value: group})
+		g.Go(func() error {
+			result, err := s.GetAggregations(gctx, groupQuery, fields)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			results[group] = result
+			mu.Unlock()
+			return nil
+		})
 	}
-	return docSnap, err
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *GenericStore) GetDoc(ctx context.Context, docID string) (*DocumentSnapshot, error) {
+	return s.collection.Get(ctx, docID)
 }
 
 // GetDocByQuery returns a single document matching the query. Returns ErrNotFound if none, or error if not unique.
-func (s *GenericStore) GetDocByQuery(ctx context.Context, query []QueryParameter) (*firestore.DocumentSnapshot, error) {
+func (s *GenericStore) GetDocByQuery(ctx context.Context, query []QueryParameter) (*DocumentSnapshot, error) {
 	docs, err := s.ReadCollection(ctx, query)
 	if err != nil {
 		return nil, err
@@ -147,11 +245,7 @@ func (s *GenericStore) GetDocByQuery(ctx context.Context, query []QueryParameter
 }
 
 func (s *GenericStore) DeleteDoc(ctx context.Context, docID string) error {
-	_, err := s.collection.Doc(docID).Delete(ctx)
-	if status.Code(err) == codes.NotFound {
-		return ErrNotFound
-	}
-	return err
+	return s.collection.Delete(ctx, docID)
 }
 
 func (s *GenericStore) DeleteDocByQuery(ctx context.Context, query []QueryParameter) error {
@@ -165,8 +259,7 @@ func (s *GenericStore) DeleteDocByQuery(ctx context.Context, query []QueryParame
 	if len(docs) > 1 {
 		return status.Error(codes.FailedPrecondition, "query did not resolve to a unique document for delete")
 	}
-	_, err = docs[0].Ref.Delete(ctx)
-	return err
+	return s.collection.Delete(ctx, docs[0].Ref.ID)
 }
 
 func (s *GenericStore) DeleteDocsByQuery(ctx context.Context, query []QueryParameter) error {
@@ -178,76 +271,34 @@ func (s *GenericStore) DeleteDocsByQuery(ctx context.Context, query []QueryParam
 		return ErrNotFound
 	}
 
-	bulkWriter := s.client.BulkWriter(ctx)
-	for _, doc := range docs {
-		_, err := bulkWriter.Delete(doc.Ref)
-		if err != nil {
-			bulkWriter.End()
-			return err
-		}
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.Ref.ID
 	}
-	bulkWriter.End()
-	return nil
+	return s.collection.DeleteAll(ctx, ids)
 }
 
-func (s *GenericStore) UpdateDoc(ctx context.Context, docID string, updateParams []firestore.Update) error {
-	// Convert updateParameters into firestore.Update
-	// this struct is not even be needed but I like it
-
-	_, err := s.collection.Doc(docID).Update(ctx, updateParams)
-	if status.Code(err) == codes.NotFound {
-		return ErrNotFound
-	}
-	return err
+func (s *GenericStore) UpdateDoc(ctx context.Context, docID string, updateParams []Update) error {
+	return s.collection.Update(ctx, docID, updateParams)
 }
 
 // WatchCollection listens for realtime updates matching the provided query and invokes onSnapshot
 // with the current set of matching documents each time a snapshot is received. It returns a stop
 // function to end the watch.
-func (s *GenericStore) WatchCollection(ctx context.Context, query []QueryParameter, onSnapshot func([]*firestore.DocumentSnapshot)) (func(), error) {
-	// Create a child context we can cancel independently
-	watchCtx, cancel := context.WithCancel(ctx)
-
-	q := s.collection.Query
-	for _, qp := range query {
-		q = q.Where(qp.Path, qp.Op, qp.Value)
-	}
-	iter := q.Snapshots(watchCtx)
-
-	go func() {
-		defer iter.Stop()
-		for {
-			snap, err := iter.Next()
-			if err == iterator.Done {
-				return
-			}
-			if err != nil {
-				// On error, stop the watch; callers can restart if needed.
-				return
-			}
-			var docs []*firestore.DocumentSnapshot
-			for {
-				doc, err := snap.Documents.Next()
-				if err == iterator.Done {
-					break
-				}
-				if err != nil {
-					return
-				}
-				docs = append(docs, doc)
-			}
-			onSnapshot(docs)
-		}
-	}()
+func (s *GenericStore) WatchCollection(ctx context.Context, query []QueryParameter, onSnapshot func([]*DocumentSnapshot)) (func(), error) {
+	return s.collection.Watch(ctx, Query{Filters: query}, onSnapshot)
+}
 
-	stop := func() { cancel() }
-	return stop, nil
+// RunTransaction runs fn as a single atomic unit of reads and writes on the collection, so checks such as
+// uniqueness cannot race with concurrent writers. fn may be retried and must only read and write through tx.
+func (s *GenericStore) RunTransaction(ctx context.Context, fn func(tx Transaction) error) error {
+	return s.collection.RunTransaction(ctx, fn)
 }
 
 func (s *GenericStore) GenerateNIDs(n int) ([]string, error) {
 	ids := make([]string, n)
 	for i := 0; i < n; i++ {
-		ids[i] = s.collection.NewDoc().ID
+		ids[i] = s.collection.NewDocID()
 	}
 	return ids, nil
 }
@@ -0,0 +1,98 @@
+package firestore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Cursor is a position in the order of a query: the values a document has for the query's OrderBy fields, and
+// its ID to break ties. The document does not have to still exist for the cursor to be used.
+type Cursor struct {
+	Values []interface{}
+	DocID  string
+}
+
+// cursorAfter returns the position of doc in the order given by orderBy.
+func cursorAfter(doc *DocumentSnapshot, orderBy []OrderBy) *Cursor {
+	return &Cursor{Values: orderValues(doc.Data(), orderBy), DocID: doc.Ref.ID}
+}
+
+// tokenValue is a single cursor value in a page token. JSON alone would lose the difference between integers,
+// floats and times, so each value records its type by which field is set.
+type tokenValue struct {
+	Null   bool       `json:"n,omitempty"`
+	Bool   *bool      `json:"b,omitempty"`
+	Int    *int64     `json:"i,omitempty"`
+	Float  *float64   `json:"f,omitempty"`
+	Time   *time.Time `json:"t,omitempty"`
+	String *string    `json:"s,omitempty"`
+}
+
+type pageToken struct {
+	Values []tokenValue `json:"v"`
+	DocID  string       `json:"id"`
+}
+
+// encodePageToken returns the page token for cursor. Only the types Firestore can order scalars by are supported.
+func encodePageToken(cursor *Cursor) (string, error) {
+	token := pageToken{Values: make([]tokenValue, len(cursor.Values)), DocID: cursor.DocID}
+	for i, v := range cursor.Values {
+		switch v := v.(type) {
+		case nil:
+			token.Values[i].Null = true
+		case bool:
+			token.Values[i].Bool = &v
+		case int64:
+			token.Values[i].Int = &v
+		case float64:
+			token.Values[i].Float = &v
+		case time.Time:
+			token.Values[i].Time = &v
+		case string:
+			token.Values[i].String = &v
+		default:
+			return "", status.Errorf(codes.InvalidArgument, "cannot page by a field of type %T", v)
+		}
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodePageToken returns the cursor in token, or ErrInvalidPageToken if it is not one encodePageToken made.
+func decodePageToken(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	var decoded pageToken
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.DocID == "" {
+		return nil, ErrInvalidPageToken
+	}
+	cursor := &Cursor{Values: make([]interface{}, len(decoded.Values)), DocID: decoded.DocID}
+	for i, v := range decoded.Values {
+		switch {
+		case v.Null:
+			cursor.Values[i] = nil
+		case v.Bool != nil:
+			cursor.Values[i] = *v.Bool
+		case v.Int != nil:
+			cursor.Values[i] = *v.Int
+		case v.Float != nil:
+			cursor.Values[i] = *v.Float
+		case v.Time != nil:
+			cursor.Values[i] = *v.Time
+		case v.String != nil:
+			cursor.Values[i] = *v.String
+		default:
+			return nil, ErrInvalidPageToken
+		}
+	}
+	return cursor, nil
+}
@@ -0,0 +1,133 @@
+package firestore
+
+import (
+	"cloud.google.com/go/firestore"
+)
+
+// DocumentRef identifies a stored document.
+type DocumentRef struct {
+	ID string
+}
+
+// DocumentSnapshot is a backend independent view of a document returned by a CollectionInterface.
+type DocumentSnapshot struct {
+	Ref *DocumentRef
+
+	// exactly one of these is set depending on the backend that produced the snapshot
+	snap *firestore.DocumentSnapshot
+	data map[string]interface{}
+}
+
+func newFirestoreSnapshot(snap *firestore.DocumentSnapshot) *DocumentSnapshot {
+	return &DocumentSnapshot{Ref: &DocumentRef{ID: snap.Ref.ID}, snap: snap}
+}
+
+func newMemorySnapshot(id string, data map[string]interface{}) *DocumentSnapshot {
+	return &DocumentSnapshot{Ref: &DocumentRef{ID: id}, data: data}
+}
+
+// DataTo populates v (a pointer to a struct or map) with the document's fields,
+// following the same `firestore` struct tag rules as the Cloud Firestore client.
+func (d *DocumentSnapshot) DataTo(v interface{}) error {
+	if d.snap != nil {
+		return d.snap.DataTo(v)
+	}
+	return decodeValue(d.data, v)
+}
+
+// Data returns the document's fields as a map.
+func (d *DocumentSnapshot) Data() map[string]interface{} {
+	if d.snap != nil {
+		return d.snap.Data()
+	}
+	return cloneMap(d.data)
+}
+
+// Update describes a change to a single (dot separated) field path.
+// Value may be a plain value, one of the transforms ArrayUnion, ArrayRemove or Increment, or Delete.
+type Update struct {
+	Path  string
+	Value interface{}
+}
+
+type arrayUnion struct{ elems []interface{} }
+
+type arrayRemove struct{ elems []interface{} }
+
+type increment struct{ n interface{} }
+
+type deleteField struct{}
+
+// ArrayUnion adds elems to an array field, skipping any that are already present.
+func ArrayUnion(elems ...interface{}) interface{} { return arrayUnion{elems: elems} }
+
+// ArrayRemove removes every occurrence of elems from an array field.
+func ArrayRemove(elems ...interface{}) interface{} { return arrayRemove{elems: elems} }
+
+// Increment adds n (an integer or float) to a numeric field.
+func Increment(n interface{}) interface{} { return increment{n: n} }
+
+// Delete removes a field from the document, rather than setting it to a zero value or null.
+var Delete interface{} = deleteField{}
+
+// Query describes which documents a read should return.
+type Query struct {
+	Filters []QueryParameter
+	OrderBy []OrderBy
+	// StartAfter, when set, only returns documents ordered after it. It must have a value for each OrderBy.
+	StartAfter *Cursor
+	// Limit caps the number of documents returned. Zero means no limit.
+	Limit int
+}
+
+type Direction int
+
+const (
+	Asc Direction = iota
+	Desc
+)
+
+// OrderBy sorts query results by a field. Documents without the field are excluded, as in Cloud Firestore.
+// Ties are always broken by document ID.
+type OrderBy struct {
+	Path      string
+	Direction Direction
+}
+
+// QueryOption adds ordering, cursors or limits to a ReadCollection call.
+type QueryOption func(*Query)
+
+// WithOrderBy sorts results by path in the given direction. It may be passed more than once.
+func WithOrderBy(path string, direction Direction) QueryOption {
+	return func(q *Query) { q.OrderBy = append(q.OrderBy, OrderBy{Path: path, Direction: direction}) }
+}
+
+// WithStartAfter only returns documents ordered after cursor.
+func WithStartAfter(cursor *Cursor) QueryOption {
+	return func(q *Query) { q.StartAfter = cursor }
+}
+
+// WithLimit returns at most n documents.
+func WithLimit(n int) QueryOption {
+	return func(q *Query) { q.Limit = n }
+}
+
+// toFirestoreUpdates converts backend independent updates into Cloud Firestore updates.
+func toFirestoreUpdates(updates []Update) []firestore.Update {
+	out := make([]firestore.Update, 0, len(updates))
+	for _, u := range updates {
+		value := u.Value
+		switch t := u.Value.(type) {
+		case arrayUnion:
+			value = firestore.ArrayUnion(t.elems...)
+		case arrayRemove:
+			value = firestore.ArrayRemove(t.elems...)
+		case increment:
+			value = firestore.Increment(t.n)
+		case deleteField:
+			value = firestore.Delete
+		}
+		out = append(out, firestore.Update{Path: u.Path, Value: value})
+	}
+	return out
+}
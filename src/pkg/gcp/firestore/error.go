@@ -10,3 +10,9 @@ var ErrNotFound = status.Error(codes.NotFound, "document not found")
 
 // ErrAlreadyExists is returned when a document already exists.
 var ErrAlreadyExists = status.Error(codes.AlreadyExists, "document already exists")
+
+// ErrInvalidPageToken is returned when a page token is malformed or was made for a different ordering.
+var ErrInvalidPageToken = status.Error(codes.InvalidArgument, "invalid page token")
+
+// ErrDuplicateWrite is returned by a BulkWriter given a second write to a document it already has a write for.
+var ErrDuplicateWrite = status.Error(codes.InvalidArgument, "document already written in this bulk write")
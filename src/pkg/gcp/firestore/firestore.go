@@ -4,22 +4,34 @@ import (
 	"context"
 
 	"cloud.google.com/go/firestore"
-	"github.com/joho/godotenv"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
 	PROJECTID_ENV string = "FIRESTORE_PROJECTID"
 	DATABSEID_ENV string = "FIRESTORE_DATABASEID"
+	BACKEND_ENV   string = "FIRESTORE_BACKEND"
+)
+
+const (
+	// FirestoreBackend stores documents in Cloud Firestore (the default).
+	FirestoreBackend string = "firestore"
+	// MemoryBackend stores documents in process memory, for local development and tests.
+	MemoryBackend string = "memory"
 )
 
 type FireStoreClientConfig struct {
-	ProjectID  string
-	DatabaseID string
+	ProjectID  string `env:"FIRESTORE_PROJECTID" yaml:"projectID"`
+	DatabaseID string `env:"FIRESTORE_DATABASEID" yaml:"databaseID"`
+	// Backend is either FirestoreBackend or MemoryBackend. Empty means FirestoreBackend.
+	Backend string `env:"FIRESTORE_BACKEND" yaml:"backend"`
 }
 
 // NewFirestoreClient initializes and returns a FirestoreClient using a specific database ID.
 func NewFirestoreClient(ctx context.Context, cfg FireStoreClientConfig) (*FirestoreClient, error) {
-	_ = godotenv.Load()
 
 	client, err := firestore.NewClientWithDatabase(ctx, cfg.ProjectID, cfg.DatabaseID)
 	if err != nil {
@@ -32,16 +44,270 @@ func NewFirestoreClient(ctx context.Context, cfg FireStoreClientConfig) (*Firest
 	}, nil
 }
 
-func (fc *FirestoreClient) BulkWriter(ctx context.Context) *firestore.BulkWriter {
-	return fc.client.BulkWriter(ctx)
-}
-
-// GetUsersCollection returns a reference to the "users" collection.
-func (fc *FirestoreClient) GetCollection(path string) *firestore.CollectionRef {
-	return fc.client.Collection(path)
+// Collection returns the collection with the given path.
+func (fc *FirestoreClient) Collection(path string) CollectionInterface {
+	return &firestoreCollection{client: fc.client, ref: fc.client.Collection(path)}
 }
 
 // Close closes the Firestore client connection.
 func (fc *FirestoreClient) Close() error {
 	return fc.client.Close()
 }
+
+type firestoreCollection struct {
+	client *firestore.Client
+	ref    *firestore.CollectionRef
+}
+
+func (c *firestoreCollection) query(q Query) firestore.Query {
+	result := c.ref.Query
+	for _, p := range q.Filters {
+		result = result.Where(p.Path, p.Op, p.Value)
+	}
+	for _, o := range q.OrderBy {
+		direction := firestore.Asc
+		if o.Direction == Desc {
+			direction = firestore.Desc
+		}
+		result = result.OrderBy(o.Path, direction)
+	}
+	if q.Limit > 0 {
+		result = result.Limit(q.Limit)
+	}
+	return result
+}
+
+func (c *firestoreCollection) NewDocID() string {
+	return c.ref.NewDoc().ID
+}
+
+func (c *firestoreCollection) Add(ctx context.Context, data interface{}) (string, error) {
+	docRef, _, err := c.ref.Add(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	return docRef.ID, nil
+}
+
+func (c *firestoreCollection) SetAll(ctx context.Context, ids []string, docs []interface{}) error {
+	bulkWriter := c.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(docs))
+	for i, data := range docs {
+		job, err := bulkWriter.Set(c.ref.Doc(ids[i]), data)
+		if err != nil {
+			bulkWriter.End()
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+	// Finalize writes
+	bulkWriter.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *firestoreCollection) Get(ctx context.Context, docID string) (*DocumentSnapshot, error) {
+	docSnap, err := c.ref.Doc(docID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newFirestoreSnapshot(docSnap), nil
+}
+
+func (c *firestoreCollection) Query(ctx context.Context, q Query) ([]*DocumentSnapshot, error) {
+	query := c.query(q)
+	if q.StartAfter != nil {
+		if len(q.StartAfter.Values) != len(q.OrderBy) {
+			return nil, ErrInvalidPageToken
+		}
+		// the implicit order by document ID has to be made explicit to start after a document ID
+		direction := firestore.Asc
+		if n := len(q.OrderBy); n > 0 && q.OrderBy[n-1].Direction == Desc {
+			direction = firestore.Desc
+		}
+		values := append(append([]interface{}{}, q.StartAfter.Values...), q.StartAfter.DocID)
+		query = query.OrderBy(firestore.DocumentID, direction).StartAfter(values...)
+	}
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+	snaps, err := iter.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]*DocumentSnapshot, len(snaps))
+	for i, snap := range snaps {
+		docs[i] = newFirestoreSnapshot(snap)
+	}
+	return docs, nil
+}
+
+func (c *firestoreCollection) Aggregate(ctx context.Context, q Query, fields []AggregationField) (AggregationResult, error) {
+	query := c.query(q)
+	aggQuery := query.NewAggregationQuery()
+	for _, f := range fields {
+		switch f.Aggregation {
+		case Count:
+			aggQuery = aggQuery.WithCount(f.Alias)
+		case Sum:
+			aggQuery = aggQuery.WithSum(f.Path, f.Alias)
+		case Average:
+			aggQuery = aggQuery.WithAvg(f.Path, f.Alias)
+		}
+	}
+	aggResult, err := aggQuery.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(AggregationResult, len(fields))
+	for _, f := range fields {
+		v, ok := aggResult[f.Alias]
+		if !ok {
+			return nil, status.Errorf(codes.Internal, "aggregation result missing %s value", f.Alias)
+		}
+		value := v.(*firestorepb.Value)
+		switch value.GetValueType().(type) {
+		case *firestorepb.Value_IntegerValue:
+			result[f.Alias] = float64(value.GetIntegerValue())
+		case *firestorepb.Value_DoubleValue:
+			result[f.Alias] = value.GetDoubleValue()
+		}
+		// a null average means no document had a numeric value and is left out of the result
+	}
+	return result, nil
+}
+
+func (c *firestoreCollection) Update(ctx context.Context, docID string, updates []Update) error {
+	_, err := c.ref.Doc(docID).Update(ctx, toFirestoreUpdates(updates))
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (c *firestoreCollection) Delete(ctx context.Context, docID string) error {
+	_, err := c.ref.Doc(docID).Delete(ctx)
+	return err
+}
+
+func (c *firestoreCollection) DeleteAll(ctx context.Context, ids []string) error {
+	bulkWriter := c.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(ids))
+	for _, id := range ids {
+		job, err := bulkWriter.Delete(c.ref.Doc(id))
+		if err != nil {
+			bulkWriter.End()
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+	bulkWriter.End()
+
+	var errs BulkWriteErrors
+	for i, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			errs = append(errs, BulkWriteError{CollectionID: c.ref.ID, DocID: ids[i], Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *firestoreCollection) Watch(ctx context.Context, q Query, onSnapshot func([]*DocumentSnapshot)) (func(), error) {
+	// Create a child context we can cancel independently
+	watchCtx, cancel := context.WithCancel(ctx)
+	iter := c.query(q).Snapshots(watchCtx)
+
+	go func() {
+		defer iter.Stop()
+		for {
+			snap, err := iter.Next()
+			if err == iterator.Done {
+				return
+			}
+			if err != nil {
+				// On error, stop the watch; callers can restart if needed.
+				return
+			}
+			var docs []*DocumentSnapshot
+			for {
+				doc, err := snap.Documents.Next()
+				if err == iterator.Done {
+					break
+				}
+				if err != nil {
+					return
+				}
+				docs = append(docs, newFirestoreSnapshot(doc))
+			}
+			onSnapshot(docs)
+		}
+	}()
+
+	stop := func() { cancel() }
+	return stop, nil
+}
+
+func (c *firestoreCollection) RunTransaction(ctx context.Context, fn func(tx Transaction) error) error {
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		return fn(&firestoreTransaction{tx: tx, c: c})
+	})
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+type firestoreTransaction struct {
+	tx *firestore.Transaction
+	c  *firestoreCollection
+}
+
+func (t *firestoreTransaction) GetDoc(docID string) (*DocumentSnapshot, error) {
+	docSnap, err := t.tx.Get(t.c.ref.Doc(docID))
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newFirestoreSnapshot(docSnap), nil
+}
+
+func (t *firestoreTransaction) ReadCollection(query []QueryParameter) ([]*DocumentSnapshot, error) {
+	snaps, err := t.tx.Documents(t.c.query(Query{Filters: query})).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]*DocumentSnapshot, len(snaps))
+	for i, snap := range snaps {
+		docs[i] = newFirestoreSnapshot(snap)
+	}
+	return docs, nil
+}
+
+func (t *firestoreTransaction) CreateDoc(data interface{}) (string, error) {
+	ref := t.c.ref.NewDoc()
+	if err := t.tx.Create(ref, data); err != nil {
+		return "", err
+	}
+	return ref.ID, nil
+}
+
+func (t *firestoreTransaction) UpdateDoc(docID string, updates []Update) error {
+	return t.tx.Update(t.c.ref.Doc(docID), toFirestoreUpdates(updates))
+}
+
+func (t *firestoreTransaction) DeleteDoc(docID string) error {
+	return t.tx.Delete(t.c.ref.Doc(docID))
+}
@@ -6,13 +6,54 @@ import (
 	"cloud.google.com/go/firestore"
 )
 
-// FirestoreClientInterface defines methods for Firestore operations.
+// FirestoreClientInterface defines the document store used by GenericStore.
+// It is implemented by FirestoreClient (Cloud Firestore) and MemoryClient (in-process).
 type FirestoreClientInterface interface {
-	BulkWriter(ctx context.Context) *firestore.BulkWriter
-	GetCollection(path string) *firestore.CollectionRef
+	Collection(path string) CollectionInterface
+	// NewBulkWriter returns a writer that batches writes across collections.
+	NewBulkWriter(ctx context.Context) BulkWriter
 	Close() error
 }
 
+// CollectionInterface defines the operations GenericStore needs on a single collection.
+type CollectionInterface interface {
+	// NewDocID returns a new unique document ID without writing anything.
+	NewDocID() string
+	// Add creates a document with a generated ID and returns that ID.
+	Add(ctx context.Context, data interface{}) (string, error)
+	// SetAll writes docs[i] under ids[i], overwriting any existing documents.
+	SetAll(ctx context.Context, ids []string, docs []interface{}) error
+	// Get returns a single document, or ErrNotFound.
+	Get(ctx context.Context, docID string) (*DocumentSnapshot, error)
+	// Query returns all documents matching q.
+	Query(ctx context.Context, q Query) ([]*DocumentSnapshot, error)
+	// Aggregate computes fields over the documents matching q without fetching them.
+	Aggregate(ctx context.Context, q Query, fields []AggregationField) (AggregationResult, error)
+	// Update applies updates to an existing document, or returns ErrNotFound.
+	Update(ctx context.Context, docID string, updates []Update) error
+	// Delete removes a document. Deleting a missing document is not an error.
+	Delete(ctx context.Context, docID string) error
+	// DeleteAll removes every document in ids and returns BulkWriteErrors for the ones it could not remove.
+	DeleteAll(ctx context.Context, ids []string) error
+	// Watch invokes onSnapshot with the full result set of q every time it changes
+	// until the returned stop function is called or ctx is cancelled.
+	Watch(ctx context.Context, q Query, onSnapshot func([]*DocumentSnapshot)) (func(), error)
+	// RunTransaction runs fn atomically against the collection. fn may be retried, so it must not have side
+	// effects other than through tx. All reads must happen before any writes.
+	RunTransaction(ctx context.Context, fn func(tx Transaction) error) error
+}
+
+// Transaction is the view of a collection passed to a RunTransaction callback.
+// Writes are only applied if the callback returns nil.
+type Transaction interface {
+	GetDoc(docID string) (*DocumentSnapshot, error)
+	ReadCollection(query []QueryParameter) ([]*DocumentSnapshot, error)
+	// CreateDoc creates a document with a generated ID and returns that ID.
+	CreateDoc(data interface{}) (string, error)
+	UpdateDoc(docID string, updates []Update) error
+	DeleteDoc(docID string) error
+}
+
 // FirestoreClient wraps the Firestore client and implements FirestoreClientInterface.
 type FirestoreClient struct {
 	client *firestore.Client
@@ -0,0 +1,589 @@
+package firestore
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MemoryClient is an in-process document store implementing FirestoreClientInterface.
+// It mirrors the Cloud Firestore semantics the services rely on, so they can run locally and in tests
+// without a GCP project. Data is lost when the process exits.
+type MemoryClient struct {
+	mu          sync.Mutex
+	collections map[string]*memoryCollection
+}
+
+// NewMemoryClient returns an empty MemoryClient.
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{collections: make(map[string]*memoryCollection)}
+}
+
+// Collection returns the collection with the given path, creating it if it does not exist yet.
+func (mc *MemoryClient) Collection(path string) CollectionInterface {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	c, ok := mc.collections[path]
+	if !ok {
+		c = &memoryCollection{
+			docs:     make(map[string]map[string]interface{}),
+			watchers: make(map[int]chan struct{}),
+		}
+		mc.collections[path] = c
+	}
+	return c
+}
+
+// Close is a no-op; it exists to satisfy FirestoreClientInterface.
+func (mc *MemoryClient) Close() error {
+	return nil
+}
+
+type memoryCollection struct {
+	mu          sync.RWMutex
+	docs        map[string]map[string]interface{}
+	watchers    map[int]chan struct{}
+	nextWatcher int
+}
+
+const docIDAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+func (c *memoryCollection) NewDocID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = docIDAlphabet[int(b[i])%len(docIDAlphabet)]
+	}
+	return string(b)
+}
+
+func (c *memoryCollection) Add(ctx context.Context, data interface{}) (string, error) {
+	doc, err := encodeDoc(data)
+	if err != nil {
+		return "", err
+	}
+	id := c.NewDocID()
+
+	c.mu.Lock()
+	c.docs[id] = doc
+	c.mu.Unlock()
+	c.notify()
+	return id, nil
+}
+
+func (c *memoryCollection) SetAll(ctx context.Context, ids []string, docs []interface{}) error {
+	if len(ids) != len(docs) {
+		return status.Error(codes.InvalidArgument, "number of ids and documents does not match")
+	}
+	encoded := make([]map[string]interface{}, len(docs))
+	for i, data := range docs {
+		doc, err := encodeDoc(data)
+		if err != nil {
+			return err
+		}
+		encoded[i] = doc
+	}
+
+	c.mu.Lock()
+	for i, id := range ids {
+		c.docs[id] = encoded[i]
+	}
+	c.mu.Unlock()
+	c.notify()
+	return nil
+}
+
+func (c *memoryCollection) Get(ctx context.Context, docID string) (*DocumentSnapshot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	doc, ok := c.docs[docID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return newMemorySnapshot(docID, cloneMap(doc)), nil
+}
+
+func (c *memoryCollection) Query(ctx context.Context, q Query) ([]*DocumentSnapshot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.queryLocked(q)
+}
+
+// queryLocked returns the documents matching q, ordered by q.OrderBy and then by ID as Cloud Firestore does.
+// c.mu must be held.
+func (c *memoryCollection) queryLocked(q Query) ([]*DocumentSnapshot, error) {
+	filters, err := encodeFilters(q.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(c.docs))
+	for id, doc := range c.docs {
+		if matchesAll(doc, filters) && hasOrderFields(doc, q.OrderBy) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return c.compareDocs(ids[i], ids[j], q.OrderBy) < 0
+	})
+
+	if q.StartAfter != nil {
+		if len(q.StartAfter.Values) != len(q.OrderBy) {
+			return nil, ErrInvalidPageToken
+		}
+		start := sort.Search(len(ids), func(i int) bool {
+			return compareOrder(orderValues(c.docs[ids[i]], q.OrderBy), ids[i], q.StartAfter.Values, q.StartAfter.DocID, q.OrderBy) > 0
+		})
+		ids = ids[start:]
+	}
+	if q.Limit > 0 && len(ids) > q.Limit {
+		ids = ids[:q.Limit]
+	}
+
+	docs := make([]*DocumentSnapshot, len(ids))
+	for i, id := range ids {
+		docs[i] = newMemorySnapshot(id, cloneMap(c.docs[id]))
+	}
+	return docs, nil
+}
+
+func hasOrderFields(doc map[string]interface{}, orderBy []OrderBy) bool {
+	for _, o := range orderBy {
+		if _, ok := getPath(doc, o.Path); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compareDocs orders two stored documents by orderBy.
+func (c *memoryCollection) compareDocs(a, b string, orderBy []OrderBy) int {
+	return compareOrder(orderValues(c.docs[a], orderBy), a, orderValues(c.docs[b], orderBy), b, orderBy)
+}
+
+func orderValues(doc map[string]interface{}, orderBy []OrderBy) []interface{} {
+	values := make([]interface{}, len(orderBy))
+	for i, o := range orderBy {
+		values[i], _ = getPath(doc, o.Path)
+	}
+	return values
+}
+
+// compareOrder orders two positions given by their orderBy values and document IDs, breaking ties by ID in the
+// direction of the last ordering.
+func compareOrder(aValues []interface{}, aID string, bValues []interface{}, bID string, orderBy []OrderBy) int {
+	direction := Asc
+	for i, o := range orderBy {
+		cmp := compareValues(aValues[i], bValues[i])
+		if o.Direction == Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+		direction = o.Direction
+	}
+	cmp := cmpOrdered(aID, bID)
+	if direction == Desc {
+		cmp = -cmp
+	}
+	return cmp
+}
+
+func (c *memoryCollection) Aggregate(ctx context.Context, q Query, fields []AggregationField) (AggregationResult, error) {
+	docs, err := c.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	result := make(AggregationResult, len(fields))
+	for _, f := range fields {
+		if f.Aggregation == Count {
+			result[f.Alias] = float64(len(docs))
+			continue
+		}
+		var sum float64
+		var n int
+		for _, doc := range docs {
+			v, _ := getPath(doc.Data(), f.Path)
+			switch v.(type) {
+			case int64, float64:
+				sum += toFloat(v)
+				n++
+			}
+		}
+		switch {
+		case f.Aggregation == Sum:
+			result[f.Alias] = sum
+		case n > 0:
+			result[f.Alias] = sum / float64(n)
+		}
+	}
+	return result, nil
+}
+
+func (c *memoryCollection) Update(ctx context.Context, docID string, updates []Update) error {
+	c.mu.Lock()
+	doc, ok := c.docs[docID]
+	if !ok {
+		c.mu.Unlock()
+		return ErrNotFound
+	}
+	updated := cloneMap(doc)
+	for _, u := range updates {
+		if err := applyUpdate(updated, u); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	c.docs[docID] = updated
+	c.mu.Unlock()
+	c.notify()
+	return nil
+}
+
+func (c *memoryCollection) Delete(ctx context.Context, docID string) error {
+	c.mu.Lock()
+	delete(c.docs, docID)
+	c.mu.Unlock()
+	c.notify()
+	return nil
+}
+
+func (c *memoryCollection) DeleteAll(ctx context.Context, ids []string) error {
+	c.mu.Lock()
+	for _, id := range ids {
+		delete(c.docs, id)
+	}
+	c.mu.Unlock()
+	c.notify()
+	return nil
+}
+
+func (c *memoryCollection) Watch(ctx context.Context, q Query, onSnapshot func([]*DocumentSnapshot)) (func(), error) {
+	if _, err := encodeFilters(q.Filters); err != nil {
+		return nil, err
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	changed := make(chan struct{}, 1)
+	// queue the initial snapshot
+	changed <- struct{}{}
+
+	c.mu.Lock()
+	id := c.nextWatcher
+	c.nextWatcher++
+	c.watchers[id] = changed
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.watchers, id)
+			c.mu.Unlock()
+		}()
+
+		var last []*DocumentSnapshot
+		first := true
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-changed:
+			}
+			docs, err := c.Query(watchCtx, q)
+			if err != nil {
+				return
+			}
+			// only report result sets that actually changed, like a Firestore listener
+			if !first && reflect.DeepEqual(docs, last) {
+				continue
+			}
+			first = false
+			last = docs
+			onSnapshot(docs)
+		}
+	}()
+
+	return cancel, nil
+}
+
+// RunTransaction holds the collection lock for the whole of fn, so transactions are serialised with each other
+// and with every other read and write on the collection. fn must therefore only use tx to access this collection.
+func (c *memoryCollection) RunTransaction(ctx context.Context, fn func(tx Transaction) error) error {
+	c.mu.Lock()
+	tx := &memoryTransaction{c: c}
+	err := fn(tx)
+	if err == nil {
+		err = tx.commitLocked()
+	}
+	c.mu.Unlock()
+
+	if err == nil && len(tx.writes) > 0 {
+		c.notify()
+	}
+	return err
+}
+
+type memoryTransaction struct {
+	c      *memoryCollection
+	writes []func(docs map[string]map[string]interface{}) error
+}
+
+var errReadAfterWrite = status.Error(codes.InvalidArgument, "transaction reads must happen before writes")
+
+func (t *memoryTransaction) GetDoc(docID string) (*DocumentSnapshot, error) {
+	if len(t.writes) > 0 {
+		return nil, errReadAfterWrite
+	}
+	doc, ok := t.c.docs[docID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return newMemorySnapshot(docID, cloneMap(doc)), nil
+}
+
+func (t *memoryTransaction) ReadCollection(query []QueryParameter) ([]*DocumentSnapshot, error) {
+	if len(t.writes) > 0 {
+		return nil, errReadAfterWrite
+	}
+	return t.c.queryLocked(Query{Filters: query})
+}
+
+func (t *memoryTransaction) CreateDoc(data interface{}) (string, error) {
+	doc, err := encodeDoc(data)
+	if err != nil {
+		return "", err
+	}
+	id := t.c.NewDocID()
+	t.writes = append(t.writes, func(docs map[string]map[string]interface{}) error {
+		if _, exists := docs[id]; exists {
+			return ErrAlreadyExists
+		}
+		docs[id] = doc
+		return nil
+	})
+	return id, nil
+}
+
+func (t *memoryTransaction) UpdateDoc(docID string, updates []Update) error {
+	t.writes = append(t.writes, func(docs map[string]map[string]interface{}) error {
+		doc, ok := docs[docID]
+		if !ok {
+			return ErrNotFound
+		}
+		updated := cloneMap(doc)
+		for _, u := range updates {
+			if err := applyUpdate(updated, u); err != nil {
+				return err
+			}
+		}
+		docs[docID] = updated
+		return nil
+	})
+	return nil
+}
+
+func (t *memoryTransaction) DeleteDoc(docID string) error {
+	t.writes = append(t.writes, func(docs map[string]map[string]interface{}) error {
+		delete(docs, docID)
+		return nil
+	})
+	return nil
+}
+
+// commitLocked applies the buffered writes all-or-nothing. c.mu must be held.
+func (t *memoryTransaction) commitLocked() error {
+	if len(t.writes) == 0 {
+		return nil
+	}
+	staged := make(map[string]map[string]interface{}, len(t.c.docs))
+	for id, doc := range t.c.docs {
+		staged[id] = doc
+	}
+	for _, write := range t.writes {
+		if err := write(staged); err != nil {
+			return err
+		}
+	}
+	t.c.docs = staged
+	return nil
+}
+
+// notify wakes every watcher on the collection so it can re-run its query.
+func (c *memoryCollection) notify() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, ch := range c.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// a re-query is already pending
+		}
+	}
+}
+
+func encodeFilters(query []QueryParameter) ([]QueryParameter, error) {
+	out := make([]QueryParameter, len(query))
+	for i, q := range query {
+		switch q.Op {
+		case "==", "!=", "<", "<=", ">", ">=", "in", "not-in", "array-contains", "array-contains-any":
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported query operator: %q", q.Op)
+		}
+		value, err := encodeValue(q.Value)
+		if err != nil {
+			return nil, err
+		}
+		if _, isArray := value.([]interface{}); !isArray {
+			switch q.Op {
+			case "in", "not-in", "array-contains-any":
+				return nil, status.Errorf(codes.InvalidArgument, "operator %q requires an array value", q.Op)
+			}
+		}
+		out[i] = QueryParameter{Path: q.Path, Op: q.Op, Value: value}
+	}
+	return out, nil
+}
+
+func matchesAll(doc map[string]interface{}, filters []QueryParameter) bool {
+	for _, f := range filters {
+		if !matches(doc, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether doc satisfies a single encoded filter. Documents missing the field never match.
+func matches(doc map[string]interface{}, f QueryParameter) bool {
+	field, ok := getPath(doc, f.Path)
+	if !ok {
+		return false
+	}
+
+	switch f.Op {
+	case "==":
+		return equalValues(field, f.Value)
+	case "!=":
+		return field != nil && !equalValues(field, f.Value)
+	case "<", "<=", ">", ">=":
+		// range filters only match values of the same type
+		if typeOrder(field) != typeOrder(f.Value) {
+			return false
+		}
+		c := compareValues(field, f.Value)
+		switch f.Op {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		default:
+			return c >= 0
+		}
+	case "in":
+		return containsValue(f.Value.([]interface{}), field)
+	case "not-in":
+		return field != nil && !containsValue(f.Value.([]interface{}), field)
+	case "array-contains":
+		arr, ok := field.([]interface{})
+		return ok && containsValue(arr, f.Value)
+	case "array-contains-any":
+		arr, ok := field.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, v := range f.Value.([]interface{}) {
+			if containsValue(arr, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsValue(arr []interface{}, v interface{}) bool {
+	for _, elem := range arr {
+		if equalValues(elem, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyUpdate applies a single update, including transforms, to an encoded document.
+func applyUpdate(doc map[string]interface{}, u Update) error {
+	if u.Path == "" {
+		return status.Error(codes.InvalidArgument, "update path must not be empty")
+	}
+	current, _ := getPath(doc, u.Path)
+
+	switch t := u.Value.(type) {
+	case arrayUnion:
+		arr, _ := current.([]interface{})
+		arr = append([]interface{}{}, arr...)
+		for _, e := range t.elems {
+			enc, err := encodeValue(e)
+			if err != nil {
+				return err
+			}
+			if !containsValue(arr, enc) {
+				arr = append(arr, enc)
+			}
+		}
+		setPath(doc, u.Path, arr)
+	case arrayRemove:
+		arr, _ := current.([]interface{})
+		remove := make([]interface{}, 0, len(t.elems))
+		for _, e := range t.elems {
+			enc, err := encodeValue(e)
+			if err != nil {
+				return err
+			}
+			remove = append(remove, enc)
+		}
+		kept := make([]interface{}, 0, len(arr))
+		for _, elem := range arr {
+			if !containsValue(remove, elem) {
+				kept = append(kept, elem)
+			}
+		}
+		setPath(doc, u.Path, kept)
+	case increment:
+		n, err := encodeValue(t.n)
+		if err != nil {
+			return err
+		}
+		if typeOrder(n) != typeOrder(int64(0)) {
+			return status.Errorf(codes.InvalidArgument, "increment requires a numeric value, got %T", t.n)
+		}
+		if typeOrder(current) != typeOrder(int64(0)) {
+			// non-numeric or missing fields are replaced by the increment itself
+			setPath(doc, u.Path, n)
+			return nil
+		}
+		ci, curIsInt := current.(int64)
+		ni, nIsInt := n.(int64)
+		if curIsInt && nIsInt {
+			setPath(doc, u.Path, ci+ni)
+		} else {
+			setPath(doc, u.Path, toFloat(current)+toFloat(n))
+		}
+	case deleteField:
+		deletePath(doc, u.Path)
+	default:
+		enc, err := encodeValue(u.Value)
+		if err != nil {
+			return fmt.Errorf("update %s: %w", u.Path, err)
+		}
+		setPath(doc, u.Path, enc)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDoc struct {
+	ID      string    `firestore:"id,omitempty"`
+	Name    string    `firestore:"name"`
+	Count   int64     `firestore:"count"`
+	Tags    []string  `firestore:"tags"`
+	Created time.Time `firestore:"created"`
+}
+
+func TestMemoryGenericStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewGenericStore(NewMemoryClient(), "docs")
+
+	now := time.Now()
+	id, err := store.CreateDoc(ctx, testDoc{Name: "a", Count: 1, Tags: []string{"x"}, Created: now})
+	require.NoError(t, err)
+	_, err = store.CreateDocsBatch(ctx, []interface{}{testDoc{Name: "b", Count: 5}, testDoc{Name: "c", Count: 10}}, nil)
+	require.NoError(t, err)
+
+	doc, err := store.GetDoc(ctx, id)
+	require.NoError(t, err)
+	var got testDoc
+	require.NoError(t, doc.DataTo(&got))
+	assert.Equal(t, "a", got.Name)
+	assert.True(t, now.Equal(got.Created))
+
+	docs, err := store.ReadCollection(ctx, []QueryParameter{{Path: "count", Op: ">=", Value: 5}})
+	require.NoError(t, err)
+	assert.Len(t, docs, 2)
+
+	count, err := store.GetAggregationWithQuery(ctx, []QueryParameter{{Path: "name", Op: "in", Value: []string{"a", "c"}}}, Count)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	require.NoError(t, store.UpdateDoc(ctx, id, []Update{
+		{Path: "count", Value: Increment(2)},
+		{Path: "tags", Value: ArrayUnion("x", "y")},
+	}))
+	doc, err = store.GetDocByQuery(ctx, []QueryParameter{{Path: "tags", Op: "array-contains", Value: "y"}})
+	require.NoError(t, err)
+	require.NoError(t, doc.DataTo(&got))
+	assert.Equal(t, int64(3), got.Count)
+	assert.Equal(t, []string{"x", "y"}, got.Tags)
+
+	// a deleted field is gone rather than null, so ordering by it skips the document
+	require.NoError(t, store.UpdateDoc(ctx, id, []Update{{Path: "name", Value: Delete}}))
+	doc, err = store.GetDoc(ctx, id)
+	require.NoError(t, err)
+	_, ok := doc.Data()["name"]
+	assert.False(t, ok)
+	docs, err = store.ReadCollection(ctx, nil, WithOrderBy("name", Asc))
+	require.NoError(t, err)
+	assert.Len(t, docs, 2)
+
+	assert.ErrorIs(t, store.UpdateDoc(ctx, "missing", []Update{{Path: "name", Value: "z"}}), ErrNotFound)
+
+	require.NoError(t, store.DeleteDocsByQuery(ctx, []QueryParameter{{Path: "count", Op: ">", Value: 4}}))
+	_, err = store.GetDocByQuery(ctx, []QueryParameter{{Path: "name", Op: "==", Value: "b"}})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// deleting a document that is already gone succeeds, as it does in Firestore
+	require.NoError(t, store.DeleteDoc(ctx, id))
+	_, err = store.GetDoc(ctx, id)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, store.DeleteDoc(ctx, id))
+	assert.NoError(t, store.DeleteDoc(ctx, "missing"))
+}
+
+func TestMemoryWatchCollection(t *testing.T) {
+	ctx := context.Background()
+	store := NewGenericStore(NewMemoryClient(), "docs")
+
+	snapshots := make(chan int, 10)
+	stop, err := store.WatchCollection(ctx, []QueryParameter{{Path: "name", Op: "==", Value: "watched"}}, func(docs []*DocumentSnapshot) {
+		snapshots <- len(docs)
+	})
+	require.NoError(t, err)
+	defer stop()
+
+	assert.Equal(t, 0, <-snapshots)
+	_, err = store.CreateDoc(ctx, testDoc{Name: "watched"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, <-snapshots)
+}
+
+func TestMemoryReadPage(t *testing.T) {
+	ctx := context.Background()
+	store := NewGenericStore(NewMemoryClient(), "docs")
+	for _, name := range []string{"d", "b", "a", "c", "e"} {
+		_, err := store.CreateDoc(ctx, testDoc{Name: name})
+		require.NoError(t, err)
+	}
+
+	orderBy := []OrderBy{{Path: "name", Direction: Asc}}
+	var names []string
+	pageToken := ""
+	for {
+		docs, next, err := store.ReadPage(ctx, nil, orderBy, 2, pageToken)
+		require.NoError(t, err)
+		for _, doc := range docs {
+			names = append(names, doc.Data()["name"].(string))
+		}
+		if next == "" {
+			break
+		}
+		pageToken = next
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, names)
+
+	// deleting the last document of a page does not break the token for the next one
+	docs, next, err := store.ReadPage(ctx, nil, orderBy, 2, "")
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteDoc(ctx, docs[1].Ref.ID))
+	docs, _, err = store.ReadPage(ctx, nil, orderBy, 2, next)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "c", docs[0].Data()["name"])
+
+	// integers and times keep their types in the token
+	byCount := []OrderBy{{Path: "count", Direction: Desc}, {Path: "created", Direction: Asc}}
+	now := time.Now()
+	for i := range 3 {
+		_, err := store.CreateDoc(ctx, testDoc{Name: "counted", Count: 10, Created: now.Add(time.Duration(i) * time.Second)})
+		require.NoError(t, err)
+	}
+	docs, next, err = store.ReadPage(ctx, nil, byCount, 1, "")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	docs, _, err = store.ReadPage(ctx, nil, byCount, 1, next)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.True(t, now.Add(time.Second).Equal(docs[0].Data()["created"].(time.Time)))
+
+	_, _, err = store.ReadPage(ctx, nil, orderBy, 2, "bm90LWEtZG9j")
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+	_, _, err = store.ReadPage(ctx, nil, orderBy, 2, next)
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+}
+
+func TestMemoryTransactionUniqueness(t *testing.T) {
+	ctx := context.Background()
+	store := NewGenericStore(NewMemoryClient(), "labels")
+
+	createUnique := func() error {
+		return store.RunTransaction(ctx, func(tx Transaction) error {
+			docs, err := tx.ReadCollection([]QueryParameter{{Path: "name", Op: "==", Value: "label"}})
+			if err != nil {
+				return err
+			}
+			if len(docs) > 0 {
+				return ErrAlreadyExists
+			}
+			_, err = tx.CreateDoc(testDoc{Name: "label"})
+			return err
+		})
+	}
+
+	const workers = 20
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- createUnique()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+		} else {
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+		}
+	}
+	assert.Equal(t, 1, created)
+
+	// a failed transaction must not apply any of its writes
+	err := store.RunTransaction(ctx, func(tx Transaction) error {
+		if _, err := tx.CreateDoc(testDoc{Name: "other"}); err != nil {
+			return err
+		}
+		return tx.UpdateDoc("missing", []Update{{Path: "name", Value: "x"}})
+	})
+	assert.ErrorIs(t, err, ErrNotFound)
+	count, err := store.GetAggregationWithQuery(ctx, nil, Count)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMemoryBulkDeleteIn(t *testing.T) {
+	ctx := context.Background()
+	client := NewMemoryClient()
+	store := NewGenericStore(client, "docs")
+
+	var names []string
+	for i := range 2*MaxInQueryValues + 5 {
+		name := fmt.Sprintf("doc-%d", i)
+		names = append(names, name)
+		_, err := store.CreateDoc(ctx, testDoc{Name: name})
+		require.NoError(t, err)
+	}
+	_, err := store.CreateDoc(ctx, testDoc{Name: "kept"})
+	require.NoError(t, err)
+
+	docs, err := store.ReadCollectionIn(ctx, nil, "name", names)
+	require.NoError(t, err)
+	assert.Len(t, docs, len(names))
+
+	bw := client.NewBulkWriter(ctx)
+	require.NoError(t, store.BulkDeleteDocsByQueryIn(ctx, bw, nil, "name", names))
+	require.NoError(t, bw.Update("docs", "missing", []Update{{Path: "name", Value: "x"}}))
+	// a document is written once: a repeat delete is dropped and any other repeat write is refused
+	require.NoError(t, bw.Delete("docs", docs[0].Ref.ID))
+	assert.ErrorIs(t, bw.Update("docs", "missing", []Update{{Path: "name", Value: "y"}}), ErrDuplicateWrite)
+	assert.ErrorIs(t, bw.Set("docs", docs[0].Ref.ID, testDoc{Name: "back"}), ErrDuplicateWrite)
+	err = bw.End()
+
+	var bulkErrs BulkWriteErrors
+	require.ErrorAs(t, err, &bulkErrs)
+	require.Len(t, bulkErrs, 1)
+	assert.Equal(t, "missing", bulkErrs[0].DocID)
+	assert.ErrorIs(t, bulkErrs[0], ErrNotFound)
+
+	count, err := store.GetAggregationWithQuery(ctx, nil, Count)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMemoryAggregations(t *testing.T) {
+	ctx := context.Background()
+	store := NewGenericStore(NewMemoryClient(), "docs")
+
+	var names []string
+	for i := range MaxInQueryValues + 10 {
+		name := fmt.Sprintf("doc-%d", i)
+		names = append(names, name)
+		_, err := store.CreateDoc(ctx, testDoc{Name: name, Count: int64(i)})
+		require.NoError(t, err)
+	}
+
+	fields := []AggregationField{
+		{Alias: "n", Aggregation: Count},
+		{Alias: "total", Aggregation: Sum, Path: "count"},
+		{Alias: "mean", Aggregation: Average, Path: "count"},
+	}
+	result, err := store.GetAggregations(ctx, []QueryParameter{{Path: "count", Op: "<", Value: 4}}, fields)
+	require.NoError(t, err)
+	assert.Equal(t, AggregationResult{"n": 4, "total": 6, "mean": 1.5}, result)
+
+	result, err = store.GetAggregations(ctx, []QueryParameter{{Path: "name", Op: "==", Value: "none"}}, fields)
+	require.NoError(t, err)
+	assert.Equal(t, AggregationResult{"n": 0, "total": 0}, result)
+
+	// more in values than one query allows are split and added back together
+	result, err = store.GetAggregations(ctx, []QueryParameter{{Path: "name", Op: "in", Value: names}}, fields[:2])
+	require.NoError(t, err)
+	assert.Equal(t, AggregationResult{"n": 40, "total": 780}, result)
+	_, err = store.GetAggregations(ctx, []QueryParameter{{Path: "name", Op: "in", Value: names}}, fields)
+	assert.Error(t, err)
+
+	grouped, err := store.GetGroupedAggregations(ctx, []QueryParameter{{Path: "count", Op: ">=", Value: 30}}, "name", []string{"doc-1", "doc-31", "none"}, fields[:2])
+	require.NoError(t, err)
+	assert.Equal(t, map[string]AggregationResult{"doc-1": {"n": 0, "total": 0}, "doc-31": {"n": 1, "total": 31}, "none": {"n": 0, "total": 0}}, grouped)
+}
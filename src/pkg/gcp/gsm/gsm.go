@@ -6,12 +6,10 @@ import (
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
-	"github.com/joho/godotenv"
 )
 
 // NewGSMClient initializes and returns a GSMClient.
 func NewGSMClient(ctx context.Context) (*GSMClient, error) {
-	_ = godotenv.Load()
 	client, err := secretmanager.NewClient(ctx)
 	if err != nil {
 		return nil, err
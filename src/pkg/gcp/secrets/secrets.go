@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pkg/gcp/gsm"
+)
+
+const (
+	PROVIDER_ENV string = "SECRETS_PROVIDER"
+	DIR_ENV      string = "SECRETS_DIR"
+)
+
+const (
+	// EnvProvider reads each secret from the environment variable with the secret's name.
+	EnvProvider string = "env"
+	// FileProvider reads each secret from the file with the secret's name in SECRETS_DIR, e.g. mounted secret volumes.
+	FileProvider string = "file"
+	// GSMProvider reads the latest version of each secret from Google Secret Manager.
+	GSMProvider string = "gsm"
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// Provider returns the current value of a named secret. Implementations read the source on every call,
+// so callers that cache a secret can pick up a rotated value by calling GetSecret again.
+type Provider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// Config selects the provider secrets are read from.
+type Config struct {
+	// Provider is EnvProvider, FileProvider or GSMProvider. When it is empty, Secret Manager is used if GSM
+	// is enabled and the environment otherwise.
+	Provider string `env:"SECRETS_PROVIDER" yaml:"provider"`
+	// Dir is the directory read by FileProvider.
+	Dir string `env:"SECRETS_DIR" yaml:"dir"`
+	// ProjectID is the GCP project read by GSMProvider.
+	ProjectID string `env:"GCP_PROJECT_ID" yaml:"projectID"`
+}
+
+func (c *Config) Validate() error {
+	switch c.Provider {
+	case "", EnvProvider, GSMProvider:
+		return nil
+	case FileProvider:
+		if c.Dir == "" {
+			return fmt.Errorf("%s must be set when %s is %q", DIR_ENV, PROVIDER_ENV, FileProvider)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown %s %q", PROVIDER_ENV, c.Provider)
+	}
+}
+
+// NewProvider returns the provider selected by cfg. gsmClient may be nil if GSM is disabled.
+func NewProvider(cfg Config, gsmClient gsm.GSMClientInterface) (Provider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	provider := cfg.Provider
+	if provider == "" {
+		provider = EnvProvider
+		if gsmClient != nil {
+			provider = GSMProvider
+		}
+	}
+	switch provider {
+	case FileProvider:
+		return NewFileProvider(cfg.Dir), nil
+	case GSMProvider:
+		if gsmClient == nil {
+			return nil, fmt.Errorf("%s is %q but GSM is disabled; set USE_GSM=true", PROVIDER_ENV, GSMProvider)
+		}
+		return NewGSMProvider(gsmClient, cfg.ProjectID), nil
+	default:
+		return NewEnvProvider(), nil
+	}
+}
+
+// Static is a Provider serving fixed values, for secrets that are set directly in config and for tests.
+type Static map[string]string
+
+func (s Static) GetSecret(ctx context.Context, name string) (string, error) {
+	value, ok := s[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return value, nil
+}
+
+type envProvider struct{}
+
+func NewEnvProvider() Provider {
+	return envProvider{}
+}
+
+func (envProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", fmt.Errorf("%w: environment variable %s is not set", ErrSecretNotFound, name)
+	}
+	return value, nil
+}
+
+type fileProvider struct {
+	dir string
+}
+
+func NewFileProvider(dir string) Provider {
+	return fileProvider{dir: dir}
+}
+
+func (p fileProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || name == ".." {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(p.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, filepath.Join(p.dir, name))
+	}
+	if err != nil {
+		return "", err
+	}
+	// editors and secret mounts commonly add a trailing newline
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+type gsmProvider struct {
+	client    gsm.GSMClientInterface
+	projectID string
+}
+
+func NewGSMProvider(client gsm.GSMClientInterface, projectID string) Provider {
+	return gsmProvider{client: client, projectID: projectID}
+}
+
+func (p gsmProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	return p.client.GetSecret(ctx, p.projectID, name)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"net/http"
+	"pkg/audit"
 	"pkg/gcp"
 )
 
@@ -10,8 +11,10 @@ type Handler struct {
 	Ctx     context.Context
 	Clients *gcp.Clients
 	AuthMw  func(http.Handler) http.Handler
+	// Audit records security events, such as logins and deletions, in the audit log shared by the services
+	Audit *audit.Log
 }
 
-func NewHandler(ctx context.Context, clients *gcp.Clients, authMW func(http.Handler) http.Handler) *Handler {
-	return &Handler{Ctx: ctx, Clients: clients, AuthMw: authMW}
+func NewHandler(ctx context.Context, clients *gcp.Clients, authMW func(http.Handler) http.Handler, auditLog *audit.Log) *Handler {
+	return &Handler{Ctx: ctx, Clients: clients, AuthMw: authMW, Audit: auditLog}
 }
@@ -0,0 +1,263 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	JWKSPath           = "/.well-known/jwks.json"
+	jwksCacheMaxAge    = 5 * time.Minute
+	jwksFetchTimeout   = 10 * time.Second
+	maxJWKSBytes       = 1 << 20
+	defaultJWKSRefresh = time.Hour
+)
+
+// JWK is a public key in JSON Web Key form (RFC 7517). Only RSA and Ed25519 keys are published; HS256 secrets
+// never leave the services that share them.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use,omitempty"`
+	// N and E are the RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the Ed25519 curve name and public key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public half of k, or false if k is an HS256 key, which has no public half.
+func (k Key) JWK() (JWK, bool) {
+	switch pub := k.verification.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			ID:        k.ID,
+			Algorithm: AlgRS256,
+			Use:       "sig",
+			N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			ID:        k.ID,
+			Algorithm: AlgEdDSA,
+			Use:       "sig",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// key turns j back into a Key that can verify tokens but not sign them.
+func (j JWK) key() (Key, error) {
+	k := Key{ID: j.ID, Algorithm: j.Algorithm}
+	switch j.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return Key{}, fmt.Errorf("JWK %q: invalid n: %w", j.ID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return Key{}, fmt.Errorf("JWK %q: invalid e: %w", j.ID, err)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < minRSABits {
+			return Key{}, fmt.Errorf("JWK %q: RSA keys must be at least %d bits", j.ID, minRSABits)
+		}
+		if k.Algorithm == "" {
+			k.Algorithm = AlgRS256
+		}
+		k.verification = pub
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return Key{}, fmt.Errorf("JWK %q: unsupported curve %q", j.ID, j.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return Key{}, fmt.Errorf("JWK %q: invalid x", j.ID)
+		}
+		if k.Algorithm == "" {
+			k.Algorithm = AlgEdDSA
+		}
+		k.verification = ed25519.PublicKey(x)
+	default:
+		return Key{}, fmt.Errorf("JWK %q: unsupported kty %q", j.ID, j.KeyType)
+	}
+	if (j.KeyType == "RSA" && k.Algorithm != AlgRS256) || (j.KeyType == "OKP" && k.Algorithm != AlgEdDSA) {
+		return Key{}, fmt.Errorf("JWK %q: alg %q does not match kty %q", j.ID, k.Algorithm, j.KeyType)
+	}
+	return k, nil
+}
+
+// JWKSHandler serves the public keys of this service's KeyStore so other services can verify its tokens
+// without holding a secret. It is registered at JWKSPath by the auth service.
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := currentKeys()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read JWT keys for JWKS")
+		http.Error(w, "Failed to read keys", http.StatusInternalServerError)
+		return
+	}
+	writeJWKS(w, keys)
+}
+
+func writeJWKS(w http.ResponseWriter, keys []Key) {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range keys {
+		if jwk, ok := k.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksCacheMaxAge.Seconds())))
+	json.NewEncoder(w).Encode(set)
+}
+
+// JWKSCache holds the public keys fetched from a JWKS URL. Keys are fetched again once they are older than the
+// refresh interval, or when a token names a kid that is not in the cache, so a newly rotated key is picked up
+// without waiting. If a fetch fails the previous keys are kept.
+type JWKSCache struct {
+	url      string
+	client   *http.Client
+	interval time.Duration
+
+	mu          sync.RWMutex
+	keys        []Key
+	fetchedAt   time.Time
+	lastAttempt time.Time
+
+	// fetchMu makes concurrent lookups share one fetch
+	fetchMu sync.Mutex
+}
+
+func NewJWKSCache(url string, interval time.Duration) *JWKSCache {
+	if interval <= 0 {
+		interval = defaultJWKSRefresh
+	}
+	return &JWKSCache{
+		url:      url,
+		client:   &http.Client{Timeout: jwksFetchTimeout},
+		interval: interval,
+	}
+}
+
+// Refresh fetches the keys from the JWKS URL.
+func (c *JWKSCache) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	c.lastAttempt = time.Now()
+	c.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+	keys := make([]Key, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		k, err := jwk.key()
+		if err != nil {
+			// one key we cannot use should not stop the others from verifying
+			log.Warn().Err(err).Msg("Skipping JWK")
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// lookup returns the key with kid, fetching the keys first if they are stale or kid is unknown. Fetches for
+// unknown kids happen at most every minUnknownKidGap, so tokens with made-up kids cannot flood the auth service.
+func (c *JWKSCache) lookup(ctx context.Context, kid string) (Key, bool) {
+	c.mu.RLock()
+	k, found := findKey(c.keys, kid)
+	stale := time.Since(c.fetchedAt) > c.interval
+	c.mu.RUnlock()
+	if found && !stale {
+		return k, true
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	c.mu.RLock()
+	// another lookup may have fetched while this one waited
+	k, found = findKey(c.keys, kid)
+	stale = time.Since(c.fetchedAt) > c.interval
+	recent := time.Since(c.lastAttempt) < minUnknownKidGap
+	c.mu.RUnlock()
+	if (found && !stale) || recent {
+		return k, found
+	}
+
+	if err := c.Refresh(ctx); err != nil {
+		log.Error().Err(err).Str("url", c.url).Str("kid", kid).Msg("Failed to refresh JWKS; keeping previous keys")
+		return k, found
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return findKey(c.keys, kid)
+}
+
+// Verify checks tokenString against the keys of c alone and decodes it into claims. It is for tokens issued by
+// someone other than the auth service, such as the ID tokens of an OpenID Connect provider, so opts should
+// check their issuer and audience. A token without a kid is accepted if the JWKS has a single key.
+func (c *JWKSCache) Verify(ctx context.Context, tokenString string, claims jwtlib.Claims, opts ...jwtlib.ParserOption) error {
+	opts = append([]jwtlib.ParserOption{jwtlib.WithValidMethods([]string{AlgRS256, AlgEdDSA})}, opts...)
+	_, err := jwtlib.NewParser(opts...).ParseWithClaims(tokenString, claims, func(token *jwtlib.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		k, ok := c.lookup(ctx, kid)
+		if !ok && kid == "" {
+			c.mu.RLock()
+			if len(c.keys) == 1 {
+				k, ok = c.keys[0], true
+			}
+			c.mu.RUnlock()
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q: %w", kid, jwtlib.ErrTokenUnverifiable)
+		}
+		if token.Method.Alg() != k.Algorithm {
+			return nil, fmt.Errorf("kid %q is an %s key but the token uses %s: %w", kid, k.Algorithm, token.Method.Alg(), jwtlib.ErrTokenSignatureInvalid)
+		}
+		return k.verification, nil
+	})
+	return err
+}
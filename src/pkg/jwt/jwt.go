@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"os"
 	"pkg/gcp"
 	"strings"
 	"time"
@@ -21,7 +20,30 @@ func GetAuthTokenString(r *http.Request) (string, error) {
 	return strings.TrimPrefix(authHeader, "Bearer "), nil
 }
 
+// TokenConfig sets how long the tokens issued at login last.
+type TokenConfig struct {
+	// AccessTokenTTL is kept short because an access token is only checked against its session every
+	// sessionStatusTTL; clients renew it with their refresh token.
+	AccessTokenTTL  time.Duration `env:"JWT_ACCESS_TOKEN_TTL" yaml:"accessTokenTTL" default:"15m"`
+	RefreshTokenTTL time.Duration `env:"JWT_REFRESH_TOKEN_TTL" yaml:"refreshTokenTTL" default:"720h"`
+}
+
+// AccessClaims are the claims of the access tokens issued at login.
+type AccessClaims struct {
+	UserID    string `json:"userID"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid"`
+	// EmailVerified is read again from the user on every refresh, so verifying takes effect with the next token
+	EmailVerified bool `json:"emailVerified"`
+	jwtlib.RegisteredClaims
+}
+
+// AuthMiddleware rejects requests without a valid access token whose session is still active, or a valid
+// personal access token whose scopes allow the request, and stores who the request is from as a Principal in
+// its context.
 func AuthMiddleware(clients *gcp.Clients) func(http.Handler) http.Handler {
+	sessions := NewSessionStore(clients.Firestore)
+	personalTokens := NewPersonalTokenStore(clients.Firestore)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			tokenString, err := GetAuthTokenString(r)
@@ -29,110 +51,92 @@ func AuthMiddleware(clients *gcp.Clients) func(http.Handler) http.Handler {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
+			if strings.HasPrefix(tokenString, PersonalTokenPrefix) {
+				servePersonalToken(w, r, personalTokens, tokenString, next)
+				return
+			}
 
-			secret := os.Getenv("JWT_SECRET")
-			if secret == "" {
+			claims := &AccessClaims{}
+			token, err := Parse(tokenString, claims)
+			if errors.Is(err, ErrNoSigningKey) {
 				http.Error(w, "Could not retrieve JWT secret", http.StatusInternalServerError)
 				return
 			}
-
-			token, err := jwtlib.Parse(tokenString, func(token *jwtlib.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwtlib.SigningMethodHMAC); !ok {
-					return nil, jwtlib.ErrSignatureInvalid
-				}
-				return []byte(secret), nil
-			})
-			if err != nil || !token.Valid {
+			if err != nil || !token.Valid || claims.UserID == "" {
 				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 				return
 			}
+			// tokens issued before sessions existed have no sid and can no longer be revoked, so are refused
+			if claims.SessionID == "" {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			revoked, err := sessions.IsRevoked(r.Context(), claims.SessionID)
+			if err != nil {
+				http.Error(w, "Could not verify session", http.StatusInternalServerError)
+				log.Error().Err(err).Str("sessionID", claims.SessionID).Msg("Failed to check session")
+				return
+			}
+			if revoked {
+				http.Error(w, "Session has been logged out", http.StatusUnauthorized)
+				return
+			}
 
-			// Optionally, set claims in context for downstream handlers
-			type contextKey string
-			const jwtClaimsKey contextKey = "jwtClaims"
-			ctx := context.WithValue(r.Context(), jwtClaimsKey, token.Claims)
+			ctx := WithPrincipal(r.Context(), &Principal{
+				UserID:        claims.UserID,
+				Email:         claims.Email,
+				Scopes:        []string{ScopeAll},
+				TokenID:       claims.SessionID,
+				EmailVerified: claims.EmailVerified,
+			})
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// JWT and validation helpers
-func GenerateJWT(ctx context.Context, clients *gcp.Clients, userID string, email string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Error().Msg("JWT_SECRET environment variable not set for JWT generation")
-		return "", errors.New("JWT_SECRET ENVIRONMENT VARIABLE NOT SET")
-	}
-	claims := jwtlib.MapClaims{
-		"userID": userID,
-		"email":  email,
-		"exp":    time.Now().Add(720 * time.Hour).Unix(),
-		"iat":    time.Now().Unix(),
+// servePersonalToken authenticates r with the personal access token tokenString and passes it to next if the
+// token's scopes allow it. Only users with a verified email can create tokens, so their requests count as
+// verified; the email is left for handlers to look up, as it may have changed since.
+func servePersonalToken(w http.ResponseWriter, r *http.Request, store *PersonalTokenStore, tokenString string, next http.Handler) {
+	t, err := store.Authenticate(r.Context(), tokenString)
+	if errors.Is(err, ErrInvalidPersonalToken) {
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
 	}
-	token := jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(secret))
 	if err != nil {
-		log.Error().Err(err).Str("userID", userID).Msg("Failed to sign JWT")
-		return "", err
+		http.Error(w, "Could not verify token", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to check personal access token")
+		return
 	}
-	log.Info().Str("userID", userID).Msg("JWT generated successfully")
-	return signed, nil
-}
-
-func GetJWTClaims(tokenString string) (jwtlib.MapClaims, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Error().Msg("JWT_SECRET environment variable not set")
-		return nil, jwtlib.ErrTokenMalformed
+	if !allowsRequest(t.Scopes, r) {
+		http.Error(w, "Token does not have the scope for this request", http.StatusForbidden)
+		log.Info().Str("userID", t.UserID).Str("tokenID", t.ID).Str("path", r.URL.Path).Msg("Refused request outside personal access token's scopes")
+		return
 	}
-	token, err := jwtlib.Parse(tokenString, func(token *jwtlib.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwtlib.SigningMethodHMAC); !ok {
-			log.Error().Msg("Unexpected signing method in JWT token")
-			return nil, jwtlib.ErrTokenSignatureInvalid
-		}
-		return []byte(secret), nil
+	ctx := WithPrincipal(r.Context(), &Principal{
+		UserID:        t.UserID,
+		Scopes:        t.Scopes,
+		TokenID:       t.ID,
+		EmailVerified: true,
 	})
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to parse JWT token")
-		return nil, err
-	}
-	if claims, ok := token.Claims.(jwtlib.MapClaims); ok && token.Valid {
-		log.Info().Msg("JWT token claims extracted successfully")
-		return claims, nil
-	}
-	log.Error().Msg("JWT token expired or invalid claims")
-	return nil, jwtlib.ErrTokenExpired
+	next.ServeHTTP(w, r.WithContext(ctx))
 }
 
-func GetUserIDFromJWT(r *http.Request) (string, error) {
-	tokenString, err := GetAuthTokenString(r)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to get JWT token from request")
-		return "", err
+// JWT and validation helpers
+
+// GenerateJWT issues an access token with claims that lasts ttl. claims.SessionID must name the session the
+// token belongs to.
+func GenerateJWT(ctx context.Context, claims AccessClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwtlib.RegisteredClaims{
+		ExpiresAt: jwtlib.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwtlib.NewNumericDate(now),
 	}
-	claims, err := GetJWTClaims(tokenString)
+	signed, err := Sign(claims)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get JWT claims")
+		log.Error().Err(err).Str("userID", claims.UserID).Msg("Failed to sign JWT")
 		return "", err
 	}
-	claimUserID, ok := claims["userID"].(string)
-	if !ok {
-		log.Error().Msg("Failed to parse userID from JWT claims")
-		return "", errors.New("invalid token claims")
-	}
-	return claimUserID, nil
-}
-
-func ValidateJWT(r *http.Request, userID string) error {
-	claimUserID, err := GetUserIDFromJWT(r)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to get userID from JWT")
-		return err
-	}
-	if claimUserID != userID {
-		log.Error().Msg("UserID in token does not match provided userID")
-		return errors.New("userID mismatch in token")
-	}
-	log.Info().Msg("JWT token claims validated and token is valid")
-	return nil
+	log.Info().Str("userID", claims.UserID).Msg("JWT generated successfully")
+	return signed, nil
 }
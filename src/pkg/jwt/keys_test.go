@@ -0,0 +1,172 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pkg/gcp/secrets"
+
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	provider := secrets.Static{"jwt": `{"keys":[{"kid":"old","secret":"old-secret"}]}`}
+	ks, err := NewKeyStore(ctx, provider, "jwt", 0)
+	require.NoError(t, err)
+	SetKeyStore(ks)
+	t.Cleanup(func() { SetKeyStore(nil) })
+
+	claims := func() jwtlib.MapClaims {
+		return jwtlib.MapClaims{"userID": "u1", "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	oldToken, err := Sign(claims())
+	require.NoError(t, err)
+
+	// a token from before keys had IDs
+	legacy, err := jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, claims()).SignedString([]byte("old-secret"))
+	require.NoError(t, err)
+
+	provider["jwt"] = `{"keys":[{"kid":"old","secret":"old-secret"},{"kid":"new","secret":"new-secret"}]}`
+	require.NoError(t, ks.Refresh(ctx))
+
+	newToken, err := Sign(claims())
+	require.NoError(t, err)
+	parsed, err := Parse(newToken, jwtlib.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", parsed.Header["kid"])
+
+	for _, token := range []string{oldToken, legacy} {
+		_, err = Parse(token, jwtlib.MapClaims{})
+		assert.NoError(t, err)
+	}
+
+	// once the old key is removed its tokens are rejected
+	provider["jwt"] = `{"keys":[{"kid":"new","secret":"new-secret"}]}`
+	require.NoError(t, ks.Refresh(ctx))
+	_, err = Parse(oldToken, jwtlib.MapClaims{})
+	assert.Error(t, err)
+	_, err = Parse(newToken, jwtlib.MapClaims{})
+	assert.NoError(t, err)
+}
+
+func TestParseKeysPlainSecret(t *testing.T) {
+	keys, err := ParseKeys("plain-secret")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "plain-secret", keys[0].Secret)
+	assert.NotEmpty(t, keys[0].ID)
+
+	_, err = ParseKeys(`{"keys":[{"kid":"a","secret":"x"},{"kid":"a","secret":"y"}]}`)
+	assert.Error(t, err)
+	_, err = ParseKeys("")
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+}
+
+func ed25519KeyJSON(t *testing.T, kid string) string {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	key, err := json.Marshal(Key{ID: kid, Algorithm: AlgEdDSA, PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))})
+	require.NoError(t, err)
+	return string(key)
+}
+
+func TestJWKSVerification(t *testing.T) {
+	ctx := context.Background()
+	// the auth service holds the private keys
+	provider := secrets.Static{"jwt": `{"keys":[` + ed25519KeyJSON(t, "a") + `]}`}
+	ks, err := NewKeyStore(ctx, provider, "jwt", 0)
+	require.NoError(t, err)
+	SetKeyStore(ks)
+	t.Cleanup(func() { SetKeyStore(nil); SetJWKS(nil) })
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		writeJWKS(w, ks.Keys())
+	}))
+	defer server.Close()
+
+	claims := jwtlib.MapClaims{"userID": "u1", "exp": time.Now().Add(time.Hour).Unix()}
+	tokenA, err := Sign(claims)
+	require.NoError(t, err)
+
+	// another service only has the JWKS
+	jwks := NewJWKSCache(server.URL, time.Hour)
+	require.NoError(t, jwks.Refresh(ctx))
+	verify := func(token string) error {
+		SetKeyStore(nil)
+		SetJWKS(jwks)
+		defer func() { SetJWKS(nil); SetKeyStore(ks) }()
+		_, err := Parse(token, jwtlib.MapClaims{})
+		return err
+	}
+	require.NoError(t, verify(tokenA))
+
+	// a key added after the JWKS was fetched is picked up on first use
+	provider["jwt"] = `{"keys":[` + ed25519KeyJSON(t, "a") + `,` + ed25519KeyJSON(t, "b") + `]}`
+	require.NoError(t, ks.Refresh(ctx))
+	tokenB, err := Sign(claims)
+	require.NoError(t, err)
+	jwks.lastAttempt = time.Time{}
+	assert.NoError(t, verify(tokenB))
+	assert.Equal(t, 2, fetches)
+
+	// unknown kids do not cause another fetch straight away
+	forged := jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, claims)
+	forged.Header["kid"] = "c"
+	forgedToken, err := forged.SignedString([]byte("guess"))
+	require.NoError(t, err)
+	assert.Error(t, verify(forgedToken))
+	assert.Equal(t, 2, fetches)
+
+	// the public key cannot be used as an HMAC secret
+	jwk, ok := ks.Keys()[1].JWK()
+	require.True(t, ok)
+	public, err := json.Marshal(jwk)
+	require.NoError(t, err)
+	confused := jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, claims)
+	confused.Header["kid"] = "b"
+	confusedToken, err := confused.SignedString(public)
+	require.NoError(t, err)
+	assert.ErrorIs(t, verify(confusedToken), jwtlib.ErrTokenSignatureInvalid)
+
+	// a service verifying with a JWKS cannot sign
+	SetKeyStore(nil)
+	SetJWKS(jwks)
+	_, err = Sign(claims)
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+}
+
+func TestRequireAsymmetric(t *testing.T) {
+	ctx := context.Background()
+	cfg := KeyConfig{SecretName: "jwt", RequireAsymmetric: true}
+	provider := secrets.Static{"jwt": "shared-secret"}
+	_, err := NewKeyStoreFromConfig(ctx, provider, cfg)
+	assert.ErrorIs(t, err, ErrSymmetricSigningKey)
+
+	// the shared secret can stay behind the new key while the tokens it signed expire
+	provider["jwt"] = `{"keys":[{"kid":"old","secret":"shared-secret"},` + ed25519KeyJSON(t, "new") + `]}`
+	ks, err := NewKeyStoreFromConfig(ctx, provider, cfg)
+	require.NoError(t, err)
+
+	// a refresh back to a shared secret is refused and the previous keys are kept
+	provider["jwt"] = `{"keys":[` + ed25519KeyJSON(t, "new") + `,{"kid":"newer","secret":"shared-secret"}]}`
+	assert.ErrorIs(t, ks.Refresh(ctx), ErrSymmetricSigningKey)
+	keys := ks.Keys()
+	require.Len(t, keys, 2)
+	assert.Equal(t, "new", keys[1].ID)
+}
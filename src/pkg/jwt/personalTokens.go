@@ -0,0 +1,221 @@
+package jwt
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	fs "pkg/gcp/firestore"
+)
+
+const (
+	personalTokenCollectionID = "personalAccessTokens"
+	// PersonalTokenPrefix starts every personal access token, so AuthMiddleware can tell them from access tokens
+	// and secret scanners can find leaked ones.
+	PersonalTokenPrefix = "canary_pat_"
+	// lastUsedResolution is how stale a token's LastUsedAt may get, so a busy script does not write on every request
+	lastUsedResolution = time.Minute
+)
+
+// Scopes that personal access tokens can be limited to. Tokens from logging in have ScopeAll.
+const (
+	// ScopeRead allows GET and HEAD requests.
+	ScopeRead = "read"
+	// ScopeWrite allows every request, except managing the account itself.
+	ScopeWrite = "write"
+	// ScopeExport allows only the routes wrapped in AllowScope(ScopeExport, ...), such as the dataset exports.
+	ScopeExport = "export"
+)
+
+// PersonalTokenScopes are the scopes a personal access token may be given.
+var PersonalTokenScopes = []string{ScopeRead, ScopeWrite, ScopeExport}
+
+var ErrInvalidPersonalToken = errors.New("invalid, expired or revoked personal access token")
+
+// PersonalToken is a long-lived token a user creates for scripts. Only a hash of it is stored.
+type PersonalToken struct {
+	ID         string    `firestore:"-" json:"id"`
+	UserID     string    `firestore:"userID" json:"-"`
+	Name       string    `firestore:"name" json:"name"`
+	Scopes     []string  `firestore:"scopes" json:"scopes"`
+	TokenHash  string    `firestore:"tokenHash" json:"-"`
+	CreatedAt  time.Time `firestore:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time `firestore:"expiresAt" json:"expiresAt"`
+	LastUsedAt time.Time `firestore:"lastUsedAt" json:"lastUsedAt"`
+	Revoked    bool      `firestore:"revoked" json:"revoked"`
+}
+
+type PersonalTokenStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewPersonalTokenStore(client fs.FirestoreClientInterface) *PersonalTokenStore {
+	return &PersonalTokenStore{genericStore: fs.NewGenericStore(client, personalTokenCollectionID)}
+}
+
+func decodePersonalToken(doc *fs.DocumentSnapshot) (*PersonalToken, error) {
+	var t PersonalToken
+	if err := doc.DataTo(&t); err != nil {
+		return nil, err
+	}
+	t.ID = doc.Ref.ID
+	return &t, nil
+}
+
+// CreateToken issues a token for userID limited to scopes that lasts ttl. It returns the stored token and
+// the token itself, which is not kept and cannot be shown again.
+func (s *PersonalTokenStore) CreateToken(ctx context.Context, userID, name string, scopes []string, ttl time.Duration) (*PersonalToken, string, error) {
+	secret, hash, err := newRefreshSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	t := &PersonalToken{
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	id, err := s.genericStore.CreateDoc(ctx, t)
+	if err != nil {
+		return nil, "", err
+	}
+	t.ID = id
+	return t, PersonalTokenPrefix + id + "." + secret, nil
+}
+
+// ListTokens returns the tokens of userID that have not been revoked, including expired ones.
+func (s *PersonalTokenStore) ListTokens(ctx context.Context, userID string) ([]*PersonalToken, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "userID", Op: "==", Value: userID},
+		{Path: "revoked", Op: "==", Value: false},
+	})
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*PersonalToken, 0, len(docs))
+	for _, doc := range docs {
+		t, err := decodePersonalToken(doc)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// RevokeToken stops the token tokenID of userID from working. It returns fs.ErrNotFound if userID has no
+// such token or it is already revoked.
+func (s *PersonalTokenStore) RevokeToken(ctx context.Context, userID, tokenID string) error {
+	doc, err := s.genericStore.GetDoc(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	t, err := decodePersonalToken(doc)
+	if err != nil {
+		return err
+	}
+	if t.UserID != userID || t.Revoked {
+		return fs.ErrNotFound
+	}
+	return s.genericStore.UpdateDoc(ctx, tokenID, []fs.Update{{Path: "revoked", Value: true}})
+}
+
+// RevokeUserTokens revokes every token of userID and returns how many there were.
+func (s *PersonalTokenStore) RevokeUserTokens(ctx context.Context, userID string) (int, error) {
+	tokens, err := s.ListTokens(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	for i, t := range tokens {
+		if err := s.genericStore.UpdateDoc(ctx, t.ID, []fs.Update{{Path: "revoked", Value: true}}); err != nil {
+			return i, err
+		}
+	}
+	return len(tokens), nil
+}
+
+// Authenticate returns the token that token is, and records that it was used. It returns
+// ErrInvalidPersonalToken if token is malformed, wrong, expired or revoked.
+func (s *PersonalTokenStore) Authenticate(ctx context.Context, token string) (*PersonalToken, error) {
+	tokenID, secret, ok := strings.Cut(strings.TrimPrefix(token, PersonalTokenPrefix), ".")
+	if !ok || tokenID == "" || secret == "" {
+		return nil, ErrInvalidPersonalToken
+	}
+	doc, err := s.genericStore.GetDoc(ctx, tokenID)
+	if errors.Is(err, fs.ErrNotFound) {
+		return nil, ErrInvalidPersonalToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	t, err := decodePersonalToken(doc)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if t.Revoked || now.After(t.ExpiresAt) ||
+		subtle.ConstantTimeCompare([]byte(hashRefreshSecret(secret)), []byte(t.TokenHash)) != 1 {
+		return nil, ErrInvalidPersonalToken
+	}
+	if now.Sub(t.LastUsedAt) > lastUsedResolution {
+		if err := s.genericStore.UpdateDoc(ctx, tokenID, []fs.Update{{Path: "lastUsedAt", Value: now}}); err != nil {
+			return nil, err
+		}
+		t.LastUsedAt = now
+	}
+	return t, nil
+}
+
+// allowsRequest reports whether a personal access token with scopes may make r. Write tokens may make any
+// request and read tokens safe ones; any scope is enough for a route that has accepted it with AllowScope.
+func allowsRequest(scopes []string, r *http.Request) bool {
+	if slices.Contains(scopes, ScopeWrite) {
+		return true
+	}
+	if slices.Contains(scopes, ScopeRead) && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		return true
+	}
+	accepted, _ := r.Context().Value(allowedScopesKey{}).([]string)
+	for _, scope := range scopes {
+		if slices.Contains(accepted, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+type allowedScopesKey struct{}
+
+// AllowScope lets personal access tokens with scope call next even if their other scopes would not allow the
+// request. It must wrap AuthMiddleware, e.g. AllowScope(ScopeExport, authMw(handler)).
+func AllowScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted, _ := r.Context().Value(allowedScopesKey{}).([]string)
+		ctx := context.WithValue(r.Context(), allowedScopesKey{}, append(slices.Clone(accepted), scope))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireLogin refuses requests made with a personal access token, for routes that manage the account or its
+// tokens. It must run after AuthMiddleware.
+func RequireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := GetPrincipal(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !slices.Contains(p.Scopes, ScopeAll) {
+			http.Error(w, "Personal access tokens cannot be used here", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pkg/gcp"
+	fs "pkg/gcp/firestore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersonalTokens(t *testing.T) {
+	ctx := context.Background()
+	clients := &gcp.Clients{Firestore: fs.NewMemoryClient()}
+	store := NewPersonalTokenStore(clients.Firestore)
+	authMw := AuthMiddleware(clients)
+
+	var seen *Principal
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { seen, _ = GetPrincipal(r) })
+	status := func(h http.Handler, method, token string) int {
+		r := httptest.NewRequest(method, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	read, readToken, err := store.CreateToken(ctx, "u1", "nightly", []string{ScopeRead}, time.Hour)
+	require.NoError(t, err)
+	_, exportToken, err := store.CreateToken(ctx, "u1", "export", []string{ScopeExport}, time.Hour)
+	require.NoError(t, err)
+	_, expiredToken, err := store.CreateToken(ctx, "u1", "old", []string{ScopeWrite}, -time.Minute)
+	require.NoError(t, err)
+
+	// scopes decide which requests a token may make
+	assert.Equal(t, http.StatusOK, status(authMw(ok), http.MethodGet, readToken))
+	assert.Equal(t, "u1", seen.UserID)
+	assert.Equal(t, read.ID, seen.TokenID)
+	assert.False(t, seen.HasScope(ScopeWrite))
+	assert.Equal(t, http.StatusForbidden, status(authMw(ok), http.MethodPost, readToken))
+	assert.Equal(t, http.StatusForbidden, status(authMw(ok), http.MethodGet, exportToken))
+	assert.Equal(t, http.StatusOK, status(AllowScope(ScopeExport, authMw(ok)), http.MethodGet, exportToken))
+	assert.Equal(t, http.StatusForbidden, status(authMw(RequireLogin(ok)), http.MethodGet, readToken))
+
+	assert.Equal(t, http.StatusUnauthorized, status(authMw(ok), http.MethodGet, expiredToken))
+	assert.Equal(t, http.StatusUnauthorized, status(authMw(ok), http.MethodGet, readToken+"x"))
+	assert.Equal(t, http.StatusUnauthorized, status(authMw(ok), http.MethodGet, PersonalTokenPrefix+"nope"))
+
+	tokens, err := store.ListTokens(ctx, "u1")
+	require.NoError(t, err)
+	assert.Len(t, tokens, 3)
+	for _, tok := range tokens {
+		if tok.ID == read.ID {
+			assert.WithinDuration(t, time.Now(), tok.LastUsedAt, time.Minute)
+		}
+	}
+
+	assert.ErrorIs(t, store.RevokeToken(ctx, "someone-else", read.ID), fs.ErrNotFound)
+	require.NoError(t, store.RevokeToken(ctx, "u1", read.ID))
+	assert.Equal(t, http.StatusUnauthorized, status(authMw(ok), http.MethodGet, readToken))
+	revoked, err := store.RevokeUserTokens(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, revoked)
+	assert.Equal(t, http.StatusUnauthorized, status(AllowScope(ScopeExport, authMw(ok)), http.MethodGet, exportToken))
+}
@@ -0,0 +1,61 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// ScopeAll is held by access tokens issued at login, which may do anything their user can.
+const ScopeAll = "*"
+
+var ErrNoPrincipal = errors.New("request is not authenticated")
+
+// Principal is who a request was authenticated as. AuthMiddleware sets it once per request, after verifying
+// the token, so handlers read it with GetPrincipal instead of parsing the token again.
+type Principal struct {
+	UserID string
+	Email  string
+	Scopes []string
+	// TokenID identifies the credential used. For access tokens it is the session the token belongs to, and for
+	// personal access tokens the token's ID.
+	TokenID       string
+	EmailVerified bool
+}
+
+// HasScope reports whether p may act within scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, ScopeAll) || slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored in ctx by AuthMiddleware.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// GetPrincipal returns who r was authenticated as, or ErrNoPrincipal if the route is not behind AuthMiddleware.
+func GetPrincipal(r *http.Request) (*Principal, error) {
+	p, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		return nil, ErrNoPrincipal
+	}
+	return p, nil
+}
+
+// GetUserID returns the ID of the user r was authenticated as.
+func GetUserID(r *http.Request) (string, error) {
+	p, err := GetPrincipal(r)
+	if err != nil {
+		return "", err
+	}
+	return p.UserID, nil
+}
@@ -0,0 +1,269 @@
+package jwt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	fs "pkg/gcp/firestore"
+)
+
+const (
+	sessionCollectionID = "authSessions"
+	refreshTokenBytes   = 32
+	// maxUsedRefreshHashes bounds how many rotated-out refresh tokens are remembered for reuse detection
+	maxUsedRefreshHashes = 50
+	// sessionStatusTTL is how long AuthMiddleware trusts that a session is still active before checking again.
+	// Revocations made in this process take effect immediately.
+	sessionStatusTTL  = 15 * time.Second
+	maxCachedSessions = 10000
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token that was already rotated out is used again, which
+	// means it was copied. The whole session is revoked, logging out both the user and whoever copied it.
+	ErrRefreshTokenReused = errors.New("refresh token reused; session revoked")
+)
+
+// Session is one login on one device. Every access token names its session in the sid claim and every
+// refresh token belongs to one, so revoking a session logs that device out.
+type Session struct {
+	UserID           string `firestore:"userID" json:"userID"`
+	RefreshTokenHash string `firestore:"refreshTokenHash" json:"-"`
+	// UsedRefreshTokenHashes are the refresh tokens this session has rotated out, newest last
+	UsedRefreshTokenHashes []string  `firestore:"usedRefreshTokenHashes" json:"-"`
+	UserAgent              string    `firestore:"userAgent" json:"userAgent"`
+	CreatedAt              time.Time `firestore:"createdAt" json:"createdAt"`
+	LastUsedAt             time.Time `firestore:"lastUsedAt" json:"lastUsedAt"`
+	ExpiresAt              time.Time `firestore:"expiresAt" json:"expiresAt"`
+	Revoked                bool      `firestore:"revoked" json:"revoked"`
+	RevokedAt              time.Time `firestore:"revokedAt" json:"revokedAt"`
+}
+
+type SessionStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewSessionStore(client fs.FirestoreClientInterface) *SessionStore {
+	return &SessionStore{genericStore: fs.NewGenericStore(client, sessionCollectionID)}
+}
+
+// newRefreshSecret returns a random refresh token secret and the hash stored in its place.
+func newRefreshSecret() (string, string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashRefreshSecret(secret), nil
+}
+
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a session for userID and returns its ID and first refresh token.
+// The refresh token is never stored; only its hash is.
+func (s *SessionStore) CreateSession(ctx context.Context, userID, userAgent string, refreshTTL time.Duration) (string, string, error) {
+	secret, hash, err := newRefreshSecret()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	sessionID, err := s.genericStore.CreateDoc(ctx, Session{
+		UserID:                 userID,
+		RefreshTokenHash:       hash,
+		UsedRefreshTokenHashes: []string{},
+		UserAgent:              userAgent,
+		CreatedAt:              now,
+		LastUsedAt:             now,
+		ExpiresAt:              now.Add(refreshTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return sessionID, sessionID + "." + secret, nil
+}
+
+// RotateRefreshToken exchanges refreshToken for a new one and extends the session by refreshTTL.
+// It returns the session, its ID and the new token. Presenting a token that was already exchanged revokes the
+// session and returns ErrRefreshTokenReused.
+func (s *SessionStore) RotateRefreshToken(ctx context.Context, refreshToken string, refreshTTL time.Duration) (*Session, string, string, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return nil, "", "", ErrInvalidRefreshToken
+	}
+	hash := hashRefreshSecret(secret)
+	newSecret, newHash, err := newRefreshSecret()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	var session Session
+	err = s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		doc, err := tx.GetDoc(sessionID)
+		if errors.Is(err, fs.ErrNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&session); err != nil {
+			return err
+		}
+		now := time.Now()
+		if session.Revoked || now.After(session.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(session.RefreshTokenHash)) != 1 {
+			for _, used := range session.UsedRefreshTokenHashes {
+				if used == hash {
+					return ErrRefreshTokenReused
+				}
+			}
+			return ErrInvalidRefreshToken
+		}
+
+		used := append(session.UsedRefreshTokenHashes, hash)
+		if len(used) > maxUsedRefreshHashes {
+			used = used[len(used)-maxUsedRefreshHashes:]
+		}
+		session.RefreshTokenHash = newHash
+		session.UsedRefreshTokenHashes = used
+		session.LastUsedAt = now
+		session.ExpiresAt = now.Add(refreshTTL)
+		return tx.UpdateDoc(sessionID, []fs.Update{
+			{Path: "refreshTokenHash", Value: newHash},
+			{Path: "usedRefreshTokenHashes", Value: used},
+			{Path: "lastUsedAt", Value: now},
+			{Path: "expiresAt", Value: session.ExpiresAt},
+		})
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		// the transaction's writes are discarded when it fails, so the revocation is written separately
+		if revokeErr := s.RevokeSession(ctx, sessionID); revokeErr != nil {
+			return nil, "", "", errors.Join(err, revokeErr)
+		}
+		return nil, "", "", err
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+	return &session, sessionID, sessionID + "." + newSecret, nil
+}
+
+// GetSession returns the session with sessionID.
+func (s *SessionStore) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	doc, err := s.genericStore.GetDoc(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := doc.DataTo(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeSession logs a session out. Its refresh token stops working and AuthMiddleware rejects its access tokens.
+func (s *SessionStore) RevokeSession(ctx context.Context, sessionID string) error {
+	err := s.genericStore.UpdateDoc(ctx, sessionID, []fs.Update{
+		{Path: "revoked", Value: true},
+		{Path: "revokedAt", Value: time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	sessionStatus.set(sessionID, true)
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of userID, logging the user out on all devices.
+// It returns the number of sessions revoked.
+func (s *SessionStore) RevokeUserSessions(ctx context.Context, userID string) (int, error) {
+	return s.RevokeOtherUserSessions(ctx, userID, "")
+}
+
+// RevokeOtherUserSessions revokes every active session of userID except keepSessionID, logging the user out
+// everywhere but the device they are using. It returns the number of sessions revoked.
+func (s *SessionStore) RevokeOtherUserSessions(ctx context.Context, userID, keepSessionID string) (int, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "userID", Op: "==", Value: userID},
+		{Path: "revoked", Op: "==", Value: false},
+	})
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for _, doc := range docs {
+		if doc.Ref.ID == keepSessionID {
+			continue
+		}
+		if err := s.RevokeSession(ctx, doc.Ref.ID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// IsRevoked reports whether sessionID has been revoked. Results are cached for sessionStatusTTL.
+// A session that does not exist is not revoked: sessions are never deleted while their tokens are valid, and
+// services running on a separate in-memory store cannot see sessions created by the auth service.
+func (s *SessionStore) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	if revoked, ok := sessionStatus.get(sessionID); ok {
+		return revoked, nil
+	}
+	session, err := s.GetSession(ctx, sessionID)
+	if errors.Is(err, fs.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	sessionStatus.set(sessionID, session.Revoked)
+	return session.Revoked, nil
+}
+
+type sessionStatusEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+// sessionStatusCache is shared by every SessionStore in the process, so a revocation is seen immediately by
+// AuthMiddleware in the service that made it.
+type sessionStatusCache struct {
+	mu      sync.Mutex
+	entries map[string]sessionStatusEntry
+}
+
+var sessionStatus = &sessionStatusCache{entries: make(map[string]sessionStatusEntry)}
+
+func (c *sessionStatusCache) get(sessionID string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[sessionID]
+	// revocation is permanent, so only active sessions need checking again
+	if !ok || (!e.revoked && time.Since(e.checkedAt) > sessionStatusTTL) {
+		return false, false
+	}
+	return e.revoked, true
+}
+
+func (c *sessionStatusCache) set(sessionID string, revoked bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCachedSessions {
+		c.entries = make(map[string]sessionStatusEntry)
+	}
+	c.entries[sessionID] = sessionStatusEntry{revoked: revoked, checkedAt: time.Now()}
+}
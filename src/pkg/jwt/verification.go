@@ -0,0 +1,78 @@
+package jwt
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Actions that VerificationPolicy can restrict to users with a verified email.
+const (
+	// ActionSessions is creating or joining a collaborative websocket session.
+	ActionSessions string = "sessions"
+	// ActionProjects is creating a project.
+	ActionProjects string = "projects"
+	// ActionAll restricts every action above.
+	ActionAll string = "all"
+)
+
+// VerificationPolicy says what users may not do until they have verified their email.
+type VerificationPolicy struct {
+	// Restrict lists the restricted actions. Set it to "none" to restrict nothing.
+	Restrict []string `env:"UNVERIFIED_EMAIL_RESTRICT" yaml:"restrict" default:"sessions"`
+}
+
+func (p *VerificationPolicy) Validate() error {
+	for _, action := range p.Restrict {
+		switch action {
+		case ActionSessions, ActionProjects, ActionAll, "none":
+		default:
+			return fmt.Errorf("UNVERIFIED_EMAIL_RESTRICT: unknown action %q", action)
+		}
+	}
+	return nil
+}
+
+// Restricts reports whether users with an unverified email may not perform action.
+func (p VerificationPolicy) Restricts(action string) bool {
+	return slices.Contains(p.Restrict, ActionAll) || slices.Contains(p.Restrict, action)
+}
+
+var (
+	verificationPolicyMu sync.RWMutex
+	verificationPolicy   = VerificationPolicy{Restrict: []string{ActionSessions}}
+)
+
+// SetVerificationPolicy sets the policy RequireVerifiedEmail enforces.
+func SetVerificationPolicy(p VerificationPolicy) {
+	verificationPolicyMu.Lock()
+	verificationPolicy = p
+	verificationPolicyMu.Unlock()
+}
+
+func currentVerificationPolicy() VerificationPolicy {
+	verificationPolicyMu.RLock()
+	defer verificationPolicyMu.RUnlock()
+	return verificationPolicy
+}
+
+// RequireVerifiedEmail rejects requests from users who have not verified their email if the policy restricts
+// action. It must run after AuthMiddleware.
+func RequireVerifiedEmail(action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := GetPrincipal(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !p.EmailVerified && currentVerificationPolicy().Restricts(action) {
+			http.Error(w, "Verify your email address first", http.StatusForbidden)
+			log.Info().Str("userID", p.UserID).Str("action", action).Msg("Refused request from unverified email")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,34 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	SetVerificationPolicy(VerificationPolicy{Restrict: []string{ActionSessions}})
+	t.Cleanup(func() { SetVerificationPolicy(VerificationPolicy{Restrict: []string{ActionSessions}}) })
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	status := func(action string, p *Principal) int {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if p != nil {
+			r = r.WithContext(WithPrincipal(r.Context(), p))
+		}
+		w := httptest.NewRecorder()
+		RequireVerifiedEmail(action, ok).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	unverified := &Principal{UserID: "u1"}
+	assert.Equal(t, http.StatusForbidden, status(ActionSessions, unverified))
+	assert.Equal(t, http.StatusOK, status(ActionProjects, unverified))
+	assert.Equal(t, http.StatusOK, status(ActionSessions, &Principal{UserID: "u1", EmailVerified: true}))
+	assert.Equal(t, http.StatusUnauthorized, status(ActionSessions, nil))
+
+	SetVerificationPolicy(VerificationPolicy{Restrict: []string{"none"}})
+	assert.Equal(t, http.StatusOK, status(ActionSessions, unverified))
+}
@@ -0,0 +1,190 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	PROVIDER_ENV string = "MAIL_PROVIDER"
+	DIR_ENV      string = "MAIL_DIR"
+	HOST_ENV     string = "SMTP_HOST"
+)
+
+const (
+	// LogProvider writes every message to the service log instead of sending it, for local development.
+	LogProvider string = "log"
+	// FileProvider writes every message to a .eml file in MAIL_DIR instead of sending it.
+	FileProvider string = "file"
+	// SMTPProvider sends messages through an SMTP server.
+	SMTPProvider string = "smtp"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects how email is sent.
+type Config struct {
+	Provider string `env:"MAIL_PROVIDER" yaml:"provider" default:"log"`
+	From     string `env:"MAIL_FROM" yaml:"from" default:"Canary <no-reply@canary.local>"`
+	// Dir is the directory FileProvider writes messages to.
+	Dir string `env:"MAIL_DIR" yaml:"dir"`
+
+	SMTPHost     string `env:"SMTP_HOST" yaml:"smtpHost"`
+	SMTPPort     int    `env:"SMTP_PORT" yaml:"smtpPort" default:"587"`
+	SMTPUsername string `env:"SMTP_USERNAME" yaml:"smtpUsername"`
+	SMTPPassword string `env:"SMTP_PASSWORD" yaml:"smtpPassword" secret:"true"`
+}
+
+func (c *Config) Validate() error {
+	switch c.Provider {
+	case LogProvider:
+		return nil
+	case FileProvider:
+		if c.Dir == "" {
+			return fmt.Errorf("%s must be set when %s is %q", DIR_ENV, PROVIDER_ENV, FileProvider)
+		}
+		return nil
+	case SMTPProvider:
+		if c.SMTPHost == "" {
+			return fmt.Errorf("%s must be set when %s is %q", HOST_ENV, PROVIDER_ENV, SMTPProvider)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown %s %q", PROVIDER_ENV, c.Provider)
+	}
+}
+
+// NewMailer returns the mailer selected by cfg.
+func NewMailer(cfg Config) (Mailer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Provider {
+	case FileProvider:
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case SMTPProvider:
+		return NewSMTPMailer(cfg), nil
+	default:
+		return NewLogMailer(), nil
+	}
+}
+
+type logMailer struct{}
+
+// NewLogMailer returns a Mailer that logs messages, links and all, instead of sending them.
+func NewLogMailer() Mailer {
+	return logMailer{}
+}
+
+func (logMailer) Send(ctx context.Context, msg Message) error {
+	log.Info().Str("to", msg.To).Str("subject", msg.Subject).Msg("Email (not sent):\n" + msg.Body)
+	return nil
+}
+
+type fileMailer struct {
+	dir  string
+	from string
+
+	mu sync.Mutex
+}
+
+// NewFileMailer returns a Mailer that writes each message to its own .eml file in dir, creating dir if needed.
+func NewFileMailer(dir, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitiseFileName(msg.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg), 0o600); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	log.Info().Str("to", msg.To).Str("path", path).Msg("Email written to file")
+	return nil
+}
+
+func sanitiseFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+type smtpMailer struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer returns a Mailer that sends through the SMTP server in cfg. The connection is upgraded with
+// STARTTLS when the server offers it, and credentials are only sent over TLS or to localhost.
+func NewSMTPMailer(cfg Config) Mailer {
+	m := &smtpMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		host: cfg.SMTPHost,
+		from: cfg.From,
+	}
+	if cfg.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return m
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	if err := smtp.SendMail(m.addr, m.auth, address(m.from), []string{msg.To}, format(m.from, msg)); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// address returns the bare address of a "Name <address>" sender.
+func address(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		return strings.TrimSuffix(from[i+1:], ">")
+	}
+	return from
+}
+
+// format renders msg as an RFC 5322 message. Header values are stripped of newlines so user input cannot add
+// headers.
+func format(from string, msg Message) []byte {
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	var b strings.Builder
+	b.WriteString("From: " + clean.Replace(from) + "\r\n")
+	b.WriteString("To: " + clean.Replace(msg.To) + "\r\n")
+	b.WriteString("Subject: " + clean.Replace(msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
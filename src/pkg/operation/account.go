@@ -0,0 +1,33 @@
+package operation
+
+// DeleteAccount is the operation that deletes a user and everything they own. Its subject is the user's ID,
+// and the user's email is kept in the "email" param for the steps that run after the user document is gone.
+const (
+	DeleteAccount = "deleteAccount"
+	// DeleteAccountStepAccount deletes the user document, their logins and their emailed tokens (auth service)
+	DeleteAccountStepAccount = "account"
+	// DeleteAccountStepProjects deletes the user's projects and everything in them, their memberships of
+	// others' projects, and hands over the organisations they are the last owner of (project service)
+	DeleteAccountStepProjects = "projects"
+	// DeleteAccountStepSessions ends the user's labelling sessions and removes them from others' (websocket service)
+	DeleteAccountStepSessions = "sessions"
+
+	ParamEmail = "email"
+)
+
+// DeleteAccountSteps are the steps of a DeleteAccount operation.
+var DeleteAccountSteps = []string{DeleteAccountStepAccount, DeleteAccountStepProjects, DeleteAccountStepSessions}
+
+// ChangeEmail is the operation that updates the copies of a user's email kept by other services after they
+// change it. Its subject is the user's ID, with the new email in the "email" param and the old one in
+// "previousEmail".
+const (
+	ChangeEmail = "changeEmail"
+	// ChangeEmailStepSessions updates the user's email in labelling sessions (websocket service)
+	ChangeEmailStepSessions = "sessions"
+
+	ParamPreviousEmail = "previousEmail"
+)
+
+// ChangeEmailSteps are the steps of a ChangeEmail operation.
+var ChangeEmailSteps = []string{ChangeEmailStepSessions}
@@ -0,0 +1,232 @@
+// Package operation tracks long-running work, such as deleting an account, that continues after the request
+// that started it has returned. An operation is split into steps, one for each service that owns part of the
+// data, and each service runs its step with a Worker. The operation document records how far it has got, so
+// clients can poll it and a step interrupted by a restart is picked up again.
+package operation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	fs "pkg/gcp/firestore"
+)
+
+const collectionID = "operations"
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Messages reported for a step whose last attempt failed. Operations can be read without logging in, so the
+// error itself is only stored and logged.
+const (
+	retryingMessage = "This step failed and will be tried again."
+	failedMessage   = "This step failed. Contact support with the operation ID."
+)
+
+// Step is one service's part of an operation.
+type Step struct {
+	Status   Status `firestore:"status" json:"status"`
+	Attempts int    `firestore:"attempts" json:"attempts"`
+	// Error is why the last attempt failed, for operators
+	Error string `firestore:"error,omitempty" json:"-"`
+	// Message is what callers are told when the last attempt failed
+	Message   string    `firestore:"message,omitempty" json:"error,omitempty"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+type Operation struct {
+	ID   string `firestore:"-" json:"operationID"`
+	Type string `firestore:"type" json:"type"`
+	// Subject is what the operation acts on, such as the ID of the user being deleted
+	Subject string `firestore:"subject" json:"-"`
+	// Params are anything else the steps need, as the subject may be gone by the time a step runs
+	Params    map[string]string `firestore:"params,omitempty" json:"-"`
+	Status    Status            `firestore:"status" json:"status"`
+	Steps     map[string]Step   `firestore:"steps" json:"steps"`
+	CreatedAt time.Time         `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time         `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// Done reports whether every step has finished, successfully or not.
+func (op *Operation) Done() bool {
+	return op.Status == StatusSucceeded || op.Status == StatusFailed
+}
+
+// Config sets how workers pick up and retry steps.
+type Config struct {
+	// PollInterval is how often a worker looks for steps to run, besides when it is kicked.
+	PollInterval time.Duration `env:"OPERATION_POLL_INTERVAL" yaml:"pollInterval" default:"30s"`
+	// Lease is how long a step may run before another worker assumes it was interrupted and runs it again.
+	Lease time.Duration `env:"OPERATION_LEASE" yaml:"lease" default:"10m"`
+	// MaxAttempts is how many times a failing step is tried before the operation fails.
+	MaxAttempts int `env:"OPERATION_MAX_ATTEMPTS" yaml:"maxAttempts" default:"3"`
+}
+
+func (c *Config) Validate() error {
+	if c.PollInterval <= 0 || c.Lease <= 0 {
+		return errors.New("OPERATION_POLL_INTERVAL and OPERATION_LEASE must be positive")
+	}
+	if c.MaxAttempts < 1 {
+		return errors.New("OPERATION_MAX_ATTEMPTS must be at least 1")
+	}
+	return nil
+}
+
+type Store struct {
+	genericStore *fs.GenericStore
+}
+
+func NewStore(client fs.FirestoreClientInterface) *Store {
+	return &Store{genericStore: fs.NewGenericStore(client, collectionID)}
+}
+
+// Create records a new operation of opType on subject with the given steps, all pending.
+func (s *Store) Create(ctx context.Context, opType, subject string, params map[string]string, steps []string) (*Operation, error) {
+	now := time.Now()
+	op := &Operation{
+		Type:      opType,
+		Subject:   subject,
+		Params:    params,
+		Status:    StatusPending,
+		Steps:     make(map[string]Step, len(steps)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, step := range steps {
+		op.Steps[step] = Step{Status: StatusPending, UpdatedAt: now}
+	}
+	id, err := s.genericStore.CreateDoc(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	op.ID = id
+	return op, nil
+}
+
+func decodeOperation(doc *fs.DocumentSnapshot) (*Operation, error) {
+	var op Operation
+	if err := doc.DataTo(&op); err != nil {
+		return nil, err
+	}
+	op.ID = doc.Ref.ID
+	return &op, nil
+}
+
+func (s *Store) Get(ctx context.Context, operationID string) (*Operation, error) {
+	doc, err := s.genericStore.GetDoc(ctx, operationID)
+	if err != nil {
+		return nil, err
+	}
+	return decodeOperation(doc)
+}
+
+// unfinished returns the operations of opType that have not finished.
+func (s *Store) unfinished(ctx context.Context, opType string) ([]*Operation, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "type", Op: "==", Value: opType},
+		{Path: "status", Op: "in", Value: []string{string(StatusPending), string(StatusRunning)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]*Operation, 0, len(docs))
+	for _, doc := range docs {
+		op, err := decodeOperation(doc)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// claim marks step of an operation as running if it is pending, or has been running for longer than lease, and
+// reports whether it did. Only one worker can claim a step at a time.
+func (s *Store) claim(ctx context.Context, operationID, step string, lease time.Duration) (*Operation, bool, error) {
+	var claimed *Operation
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		claimed = nil
+		doc, err := tx.GetDoc(operationID)
+		if err != nil {
+			return err
+		}
+		op, err := decodeOperation(doc)
+		if err != nil {
+			return err
+		}
+		st, ok := op.Steps[step]
+		now := time.Now()
+		if !ok || op.Done() {
+			return nil
+		}
+		if st.Status != StatusPending && (st.Status != StatusRunning || now.Sub(st.UpdatedAt) < lease) {
+			return nil
+		}
+		st.Status = StatusRunning
+		st.Attempts++
+		st.UpdatedAt = now
+		op.Steps[step] = st
+		claimed = op
+		return tx.UpdateDoc(operationID, []fs.Update{
+			{Path: "steps." + step, Value: st},
+			{Path: "status", Value: StatusRunning},
+			{Path: "updatedAt", Value: now},
+		})
+	})
+	return claimed, claimed != nil, err
+}
+
+// finish records the outcome of step. A failed step is set back to pending to be tried again until it has
+// been attempted maxAttempts times. The operation succeeds once all its steps have, and fails if any step
+// runs out of attempts.
+func (s *Store) finish(ctx context.Context, operationID, step string, stepErr error, maxAttempts int) error {
+	return s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		doc, err := tx.GetDoc(operationID)
+		if err != nil {
+			return err
+		}
+		op, err := decodeOperation(doc)
+		if err != nil {
+			return err
+		}
+		st, ok := op.Steps[step]
+		if !ok {
+			return fmt.Errorf("operation %s has no step %q", operationID, step)
+		}
+		now := time.Now()
+		st.UpdatedAt = now
+		switch {
+		case stepErr == nil:
+			st.Status, st.Error, st.Message = StatusSucceeded, "", ""
+		case st.Attempts < maxAttempts:
+			st.Status, st.Error, st.Message = StatusPending, stepErr.Error(), retryingMessage
+		default:
+			st.Status, st.Error, st.Message = StatusFailed, stepErr.Error(), failedMessage
+		}
+		op.Steps[step] = st
+
+		status := StatusSucceeded
+		for _, other := range op.Steps {
+			if other.Status == StatusFailed {
+				status = StatusFailed
+				break
+			}
+			if other.Status != StatusSucceeded {
+				status = StatusRunning
+			}
+		}
+		return tx.UpdateDoc(operationID, []fs.Update{
+			{Path: "steps." + step, Value: st},
+			{Path: "status", Value: status},
+			{Path: "updatedAt", Value: now},
+		})
+	})
+}
@@ -0,0 +1,101 @@
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	fs "pkg/gcp/firestore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{PollInterval: time.Hour, Lease: time.Minute, MaxAttempts: 2}
+
+func TestStepsCompleteOperation(t *testing.T) {
+	ctx := context.Background()
+	client := fs.NewMemoryClient()
+
+	var ran []string
+	first := NewWorker(client, "test", "first", func(ctx context.Context, op *Operation) error {
+		ran = append(ran, "first:"+op.Subject+":"+op.Params["key"])
+		return nil
+	}, testConfig)
+	second := NewWorker(client, "test", "second", func(ctx context.Context, op *Operation) error {
+		ran = append(ran, "second")
+		return nil
+	}, testConfig)
+
+	op, err := first.Store.Create(ctx, "test", "subject", map[string]string{"key": "value"}, []string{"first", "second"})
+	require.NoError(t, err)
+
+	first.RunPending(ctx)
+	got, err := first.Store.Get(ctx, op.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, got.Status)
+	assert.Equal(t, StatusSucceeded, got.Steps["first"].Status)
+	assert.Equal(t, StatusPending, got.Steps["second"].Status)
+
+	second.RunPending(ctx)
+	got, err = first.Store.Get(ctx, op.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+
+	// a finished operation is not run again
+	first.RunPending(ctx)
+	second.RunPending(ctx)
+	assert.Equal(t, []string{"first:subject:value", "second"}, ran)
+}
+
+func TestFailingStepIsRetriedThenFails(t *testing.T) {
+	ctx := context.Background()
+	client := fs.NewMemoryClient()
+
+	attempts := 0
+	w := NewWorker(client, "test", "only", func(ctx context.Context, op *Operation) error {
+		attempts++
+		return errors.New("broken")
+	}, testConfig)
+	op, err := w.Store.Create(ctx, "test", "subject", nil, []string{"only"})
+	require.NoError(t, err)
+
+	w.RunPending(ctx)
+	got, err := w.Store.Get(ctx, op.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, got.Steps["only"].Status)
+	assert.Equal(t, "broken", got.Steps["only"].Error)
+	assert.False(t, got.Done())
+	// the error is kept from callers, who only see that the step will be retried
+	body, err := json.Marshal(got)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "broken")
+	assert.Contains(t, string(body), retryingMessage)
+
+	w.RunPending(ctx)
+	w.RunPending(ctx)
+	got, err = w.Store.Get(ctx, op.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, got.Status)
+	assert.Equal(t, 2, got.Steps["only"].Attempts)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestClaimTakesOverExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(fs.NewMemoryClient())
+	op, err := store.Create(ctx, "test", "subject", nil, []string{"only"})
+	require.NoError(t, err)
+
+	_, ok, err := store.claim(ctx, op.ID, "only", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, ok, err = store.claim(ctx, op.ID, "only", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "a running step should not be claimed twice")
+	_, ok, err = store.claim(ctx, op.ID, "only", 0)
+	require.NoError(t, err)
+	assert.True(t, ok, "a step whose lease has expired should be claimed again")
+}
@@ -0,0 +1,96 @@
+package operation
+
+import (
+	"context"
+	"time"
+
+	fs "pkg/gcp/firestore"
+
+	"github.com/rs/zerolog/log"
+)
+
+// StepFunc runs one step of an operation. It may be run again after an error or an interrupted attempt, so
+// it must be safe to repeat.
+type StepFunc func(ctx context.Context, op *Operation) error
+
+// Worker runs one step of every operation of a type. A service starts one Worker for each step it owns.
+type Worker struct {
+	Store  *Store
+	opType string
+	step   string
+	run    StepFunc
+	cfg    Config
+	kick   chan struct{}
+}
+
+func NewWorker(client fs.FirestoreClientInterface, opType, step string, run StepFunc, cfg Config) *Worker {
+	return &Worker{
+		Store:  NewStore(client),
+		opType: opType,
+		step:   step,
+		run:    run,
+		cfg:    cfg,
+		kick:   make(chan struct{}, 1),
+	}
+}
+
+// Start looks for steps to run until ctx is cancelled, every PollInterval or when Kick is called.
+func (w *Worker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(w.cfg.PollInterval)
+		defer ticker.Stop()
+		for {
+			w.RunPending(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-w.kick:
+			}
+		}
+	}()
+}
+
+// Kick makes the worker look for steps now rather than at its next poll, such as after creating an operation.
+func (w *Worker) Kick() {
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+// RunPending runs the worker's step of each unfinished operation that it can claim.
+func (w *Worker) RunPending(ctx context.Context) {
+	ops, err := w.Store.unfinished(ctx, w.opType)
+	if err != nil {
+		log.Error().Err(err).Str("type", w.opType).Msg("Failed to list operations")
+		return
+	}
+	for _, op := range ops {
+		if ctx.Err() != nil {
+			return
+		}
+		w.runStep(ctx, op.ID)
+	}
+}
+
+func (w *Worker) runStep(ctx context.Context, operationID string) {
+	op, ok, err := w.Store.claim(ctx, operationID, w.step, w.cfg.Lease)
+	if err != nil {
+		log.Error().Err(err).Str("operationID", operationID).Str("step", w.step).Msg("Failed to claim operation step")
+		return
+	}
+	if !ok {
+		return
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, w.cfg.Lease)
+	stepErr := w.run(stepCtx, op)
+	cancel()
+	if stepErr != nil {
+		log.Error().Err(stepErr).Str("operationID", operationID).Str("step", w.step).Msg("Operation step failed")
+	}
+	if err := w.Store.finish(ctx, operationID, w.step, stepErr, w.cfg.MaxAttempts); err != nil {
+		log.Error().Err(err).Str("operationID", operationID).Str("step", w.step).Msg("Failed to record operation step")
+	}
+}
@@ -1,18 +1,26 @@
 package password
 
 import (
+	"errors"
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
+// isBcrypt reports whether hash is a bcrypt hash, which start with "$2a$", "$2b$" or "$2y$".
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2")
 }
 
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-
+// checkBcrypt checks password against a bcrypt hash stored before passwords were hashed with argon2id.
+func checkBcrypt(password, hash string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return ErrMismatch
+	default:
+		return ErrInvalidHash
+	}
 }
@@ -0,0 +1,43 @@
+// Package password hashes passwords and checks them against their hashes.
+//
+// New hashes are argon2id in the PHC string format, "$argon2id$v=19$m=...,t=...,p=...$salt$key", which carries
+// the parameters it was made with. Raising the parameters therefore does not invalidate stored hashes: they still
+// verify with the parameters they name, and NeedsRehash reports them so they can be replaced once the password is
+// known. bcrypt hashes from before argon2id are checked the same way and always need a rehash.
+package password
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrMismatch is returned when a password does not match its hash.
+	ErrMismatch = errors.New("password does not match hash")
+	// ErrInvalidHash is returned when a hash is not in a format the package knows.
+	ErrInvalidHash = errors.New("invalid password hash")
+)
+
+// HashPassword hashes password with argon2id at the current parameters.
+func HashPassword(password string) (string, error) {
+	return hashArgon2id(password, currentParams)
+}
+
+// CheckPasswordHash returns nil if password matches hash, ErrMismatch if it does not, and ErrInvalidHash if hash
+// cannot be read.
+func CheckPasswordHash(password, hash string) error {
+	if isBcrypt(hash) {
+		return checkBcrypt(password, hash)
+	}
+	return checkArgon2id(password, hash)
+}
+
+// NeedsRehash reports whether hash was made with anything other than argon2id at the current parameters. Once a
+// password has been checked against such a hash, it should be hashed again and stored in its place.
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return true
+	}
+	p, _, _, err := decodeArgon2id(hash)
+	return err != nil || p != currentParams
+}
@@ -0,0 +1,56 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAndCheck(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+	assert.NoError(t, CheckPasswordHash("correct horse", hash))
+	assert.ErrorIs(t, CheckPasswordHash("wrong horse", hash), ErrMismatch)
+	assert.False(t, NeedsRehash(hash))
+
+	other, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "each hash has its own salt")
+}
+
+func TestBcryptStillVerifies(t *testing.T) {
+	b, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	hash := string(b)
+	assert.NoError(t, CheckPasswordHash("correct horse", hash))
+	assert.ErrorIs(t, CheckPasswordHash("wrong horse", hash), ErrMismatch)
+	assert.True(t, NeedsRehash(hash))
+}
+
+func TestOlderParamsStillVerify(t *testing.T) {
+	old := currentParams
+	old.Iterations = 1
+	hash, err := hashArgon2id("correct horse", old)
+	require.NoError(t, err)
+	assert.NoError(t, CheckPasswordHash("correct horse", hash))
+	assert.True(t, NeedsRehash(hash))
+}
+
+func TestInvalidHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=0,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$!!$a2V5",
+		"$argon2i$v=19$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$2a$10$short",
+	} {
+		assert.ErrorIs(t, CheckPasswordHash("x", hash), ErrInvalidHash, hash)
+		assert.True(t, NeedsRehash(hash), hash)
+	}
+}
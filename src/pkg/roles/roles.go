@@ -0,0 +1,64 @@
+// Package roles defines what a user may do in a project or organisation they have been given access to. Roles
+// are ranked, and each one can do everything the ones below it can. A user's role in an organisation is also
+// their role in every project the organisation owns.
+package roles
+
+import "fmt"
+
+type Role string
+
+const (
+	// Viewer can see the project, its images and annotations, and export them
+	Viewer Role = "viewer"
+	// Annotator can also add, move and delete keypoints and bounding boxes
+	Annotator Role = "annotator"
+	// Reviewer can also mark batches complete
+	Reviewer Role = "reviewer"
+	// Admin can also manage batches, images, labels, the project's settings and its members
+	Admin Role = "admin"
+	// Owner can also delete the project and transfer it. A project owned by a user has exactly one, that user; one
+	// owned by an organisation has the organisation's owners.
+	Owner Role = "owner"
+)
+
+var ranks = map[Role]int{
+	Viewer:    1,
+	Annotator: 2,
+	Reviewer:  3,
+	Admin:     4,
+	Owner:     5,
+}
+
+// Parse returns the role named s, or an error if there is no such role.
+func Parse(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := ranks[r]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return r, nil
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := ranks[r]
+	return ok
+}
+
+// AtLeast reports whether r allows everything min does. The empty role, for someone with no access, allows nothing.
+func (r Role) AtLeast(min Role) bool {
+	return r.Valid() && ranks[r] >= ranks[min]
+}
+
+// Outranks reports whether r is above other, which it must be to grant, change or take away other.
+func (r Role) Outranks(other Role) bool {
+	return r.Valid() && ranks[r] > ranks[other]
+}
+
+// Max returns the higher of a and b, for users who have a role in a project both directly and through its
+// organisation.
+func Max(a, b Role) Role {
+	if a.Outranks(b) || !b.Valid() {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,29 @@
+package roles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanks(t *testing.T) {
+	assert.True(t, Owner.AtLeast(Viewer))
+	assert.True(t, Reviewer.AtLeast(Reviewer))
+	assert.False(t, Annotator.AtLeast(Reviewer))
+	assert.False(t, Role("").AtLeast(Viewer))
+	assert.False(t, Role("superuser").AtLeast(Viewer))
+
+	assert.True(t, Admin.Outranks(Reviewer))
+	assert.False(t, Admin.Outranks(Admin))
+	assert.False(t, Role("").Outranks(Viewer))
+
+	assert.Equal(t, Admin, Max(Annotator, Admin))
+	assert.Equal(t, Viewer, Max(Viewer, ""))
+	assert.Equal(t, Role(""), Max("", ""))
+
+	r, err := Parse("annotator")
+	assert.NoError(t, err)
+	assert.Equal(t, Annotator, r)
+	_, err = Parse("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package throttle
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"pkg/jwt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxBodyPeek is how much of a request body PeekBodyField reads to find its field.
+const maxBodyPeek = 1 << 16
+
+// Key names what attempts are counted against, such as the email being logged in to or the client's address.
+type Key struct {
+	Name string
+	// Shared keys, like an IP address, are used by many people at once, so they get SharedFactor times the
+	// attempts and a success does not clear them.
+	Shared bool
+	From   func(r *http.Request) string
+}
+
+// ByClientIP counts attempts per client address.
+func (l *Limiter) ByClientIP() Key {
+	return Key{Name: "ip", Shared: true, From: l.clientIP}
+}
+
+func (l *Limiter) clientIP(r *http.Request) string {
+	return ClientIP(r, l.cfg.TrustedProxyHops)
+}
+
+// ClientIP returns the address of the client, read from the X-Forwarded-For entry added by the outermost of
+// trustedProxyHops proxies. See Config.TrustedProxyHops.
+func ClientIP(r *http.Request, trustedProxyHops int) string {
+	if hops := trustedProxyHops; hops > 0 {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			addrs := strings.Split(strings.Join(fwd, ","), ",")
+			if len(addrs) >= hops {
+				return strings.TrimSpace(addrs[len(addrs)-hops])
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByBodyField counts attempts per value of a string field in the JSON request body, compared case-insensitively.
+func ByBodyField(field string) Key {
+	return Key{Name: field, From: func(r *http.Request) string {
+		return strings.ToLower(PeekBodyField(r, field))
+	}}
+}
+
+// PeekBodyField returns a string field of the JSON request body, or "" if there is none. The body is left for
+// the handler to read again.
+func PeekBodyField(r *http.Request, field string) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyPeek))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return ""
+	}
+	var fields map[string]any
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	value, _ := fields[field].(string)
+	return strings.TrimSpace(value)
+}
+
+// ByUser counts attempts per authenticated user. It must run after AuthMiddleware.
+func ByUser() Key {
+	return Key{Name: "user", From: func(r *http.Request) string {
+		userID, _ := jwt.GetUserID(r)
+		return userID
+	}}
+}
+
+// Middleware limits attempts at next under keys. A response with one of the failure statuses counts as a failed
+// attempt, a 2xx response as a success, and anything else is not counted. Blocked requests get 429 with
+// Retry-After, whichever key is blocked, so the response does not say whether an account exists.
+func (l *Limiter) Middleware(failureStatuses []int, keys ...Key) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ids := make([]string, len(keys))
+			for i, k := range keys {
+				ids[i] = k.From(r)
+			}
+			attempt, wait := l.Begin(keys, ids)
+			if attempt == nil {
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				http.Error(w, "Too many failed attempts; try again later", http.StatusTooManyRequests)
+				log.Info().Str("path", r.URL.Path).Dur("wait", wait).Msg("Throttled attempt")
+				return
+			}
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			switch {
+			case slices.Contains(failureStatuses, sw.status):
+				attempt.Failed()
+			case sw.status >= 200 && sw.status < 300:
+				attempt.Succeeded()
+			default:
+				attempt.Ignored()
+			}
+		})
+	}
+}
+
+// statusWriter remembers the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
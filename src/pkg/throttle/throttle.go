@@ -0,0 +1,203 @@
+// Package throttle slows down and then locks out repeated failed attempts at guessing a secret, such as a
+// login or session password.
+package throttle
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxEntries bounds how many keys a Limiter remembers, so a flood of made up emails cannot exhaust memory.
+const maxEntries = 100_000
+
+// Config sets how quickly failed attempts are slowed down and locked out.
+type Config struct {
+	// FreeAttempts is how many failures in a row are allowed before each further attempt has to wait.
+	FreeAttempts int `env:"THROTTLE_FREE_ATTEMPTS" yaml:"freeAttempts" default:"3"`
+	// BaseDelay is the wait after the first failure past FreeAttempts. It doubles with every failure after that.
+	BaseDelay time.Duration `env:"THROTTLE_BASE_DELAY" yaml:"baseDelay" default:"1s"`
+	// LockoutAttempts is how many failures in a row lock the key out for LockoutDuration.
+	LockoutAttempts int `env:"THROTTLE_LOCKOUT_ATTEMPTS" yaml:"lockoutAttempts" default:"10"`
+	// LockoutDuration is also how long failures are remembered once attempts stop.
+	LockoutDuration time.Duration `env:"THROTTLE_LOCKOUT_DURATION" yaml:"lockoutDuration" default:"15m"`
+	// SharedFactor multiplies the attempt limits of keys shared by many users, such as an IP address behind NAT.
+	SharedFactor int `env:"THROTTLE_SHARED_FACTOR" yaml:"sharedFactor" default:"10"`
+	// TrustedProxyHops is how many proxies in front of the service append to X-Forwarded-For. Behind Cloud Run
+	// it is 1. With 0 the connection's address is used and the header is ignored, as a client can forge it.
+	TrustedProxyHops int `env:"TRUSTED_PROXY_HOPS" yaml:"trustedProxyHops" default:"0"`
+}
+
+func (c *Config) Validate() error {
+	if c.FreeAttempts < 0 || c.LockoutAttempts <= c.FreeAttempts {
+		return fmt.Errorf("THROTTLE_LOCKOUT_ATTEMPTS must be more than THROTTLE_FREE_ATTEMPTS")
+	}
+	if c.BaseDelay <= 0 || c.LockoutDuration < c.BaseDelay {
+		return fmt.Errorf("THROTTLE_BASE_DELAY must be positive and no longer than THROTTLE_LOCKOUT_DURATION")
+	}
+	if c.SharedFactor < 1 {
+		return fmt.Errorf("THROTTLE_SHARED_FACTOR must be at least 1")
+	}
+	if c.TrustedProxyHops < 0 {
+		return fmt.Errorf("TRUSTED_PROXY_HOPS must not be negative")
+	}
+	return nil
+}
+
+type entry struct {
+	failures     int
+	lastAttempt  time.Time
+	blockedUntil time.Time
+}
+
+// Limiter tracks attempts per key in memory. Each instance of a service keeps its own counts.
+type Limiter struct {
+	cfg     Config
+	mu      sync.Mutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+func New(cfg Config) *Limiter {
+	return &Limiter{cfg: cfg, entries: make(map[string]*entry), now: time.Now}
+}
+
+// Attempt is one guess, counted against every key it was made under.
+type Attempt struct {
+	l    *Limiter
+	keys []Key
+	ids  []string
+}
+
+// Begin starts an attempt under each non-empty id, or returns how long to wait if any of them is blocked.
+// The attempt is counted as a failure straight away, so concurrent guesses cannot all slip past the check
+// before the first failure is recorded. Finish the attempt with Succeeded, Failed or Ignored.
+func (l *Limiter) Begin(keys []Key, ids []string) (*Attempt, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	var wait time.Duration
+	for i, id := range ids {
+		if id == "" {
+			continue
+		}
+		if e := l.lookup(keys[i].Name+":"+id, now); e != nil && e.blockedUntil.After(now) {
+			wait = max(wait, e.blockedUntil.Sub(now))
+		}
+	}
+	if wait > 0 {
+		return nil, wait
+	}
+
+	for i, id := range ids {
+		if id == "" {
+			continue
+		}
+		name := keys[i].Name + ":" + id
+		e := l.lookup(name, now)
+		if e == nil {
+			l.prune(now)
+			e = &entry{}
+			l.entries[name] = e
+		}
+		e.failures++
+		e.lastAttempt = now
+		if d := l.delay(e.failures, keys[i].Shared); d > 0 {
+			e.blockedUntil = now.Add(d)
+		}
+	}
+	return &Attempt{l: l, keys: keys, ids: ids}, 0
+}
+
+// Succeeded forgets the failures of every key that is not shared. A shared key only gets this attempt back,
+// so one good login from an address does not wipe out the failures of everyone else behind it.
+func (a *Attempt) Succeeded() {
+	a.finish(func(k Key, name string, e *entry) {
+		if k.Shared {
+			e.failures--
+			return
+		}
+		delete(a.l.entries, name)
+	})
+}
+
+// Failed leaves the attempt counted as a failure.
+func (a *Attempt) Failed() {}
+
+// Ignored takes back an attempt that did not test the secret, such as a malformed request.
+func (a *Attempt) Ignored() {
+	a.finish(func(_ Key, _ string, e *entry) { e.failures-- })
+}
+
+func (a *Attempt) finish(f func(Key, string, *entry)) {
+	a.l.mu.Lock()
+	defer a.l.mu.Unlock()
+	for i, id := range a.ids {
+		if id == "" {
+			continue
+		}
+		name := a.keys[i].Name + ":" + id
+		if e, ok := a.l.entries[name]; ok && e.failures > 0 {
+			f(a.keys[i], name, e)
+		}
+	}
+}
+
+// delay is how long a key must wait after its nth failure in a row.
+func (l *Limiter) delay(n int, shared bool) time.Duration {
+	free, lockout := l.cfg.FreeAttempts, l.cfg.LockoutAttempts
+	if shared {
+		free, lockout = free*l.cfg.SharedFactor, lockout*l.cfg.SharedFactor
+	}
+	if n >= lockout {
+		return l.cfg.LockoutDuration
+	}
+	if n <= free {
+		return 0
+	}
+	d := l.cfg.BaseDelay
+	for i := free + 1; i < n && d < l.cfg.LockoutDuration; i++ {
+		d *= 2
+	}
+	return min(d, l.cfg.LockoutDuration)
+}
+
+// lookup returns the entry for name, forgetting it if it has been quiet for longer than LockoutDuration.
+// The caller holds l.mu.
+func (l *Limiter) lookup(name string, now time.Time) *entry {
+	e, ok := l.entries[name]
+	if !ok {
+		return nil
+	}
+	if l.expired(e, now) {
+		delete(l.entries, name)
+		return nil
+	}
+	return e
+}
+
+func (l *Limiter) expired(e *entry, now time.Time) bool {
+	return !e.blockedUntil.After(now) && now.Sub(e.lastAttempt) > l.cfg.LockoutDuration
+}
+
+// prune makes room for a new entry. The caller holds l.mu.
+func (l *Limiter) prune(now time.Time) {
+	if len(l.entries) < maxEntries {
+		return
+	}
+	for name, e := range l.entries {
+		if l.expired(e, now) {
+			delete(l.entries, name)
+		}
+	}
+	// still full of live entries: drop the ones that are not blocked rather than grow without bound
+	for name, e := range l.entries {
+		if len(l.entries) < maxEntries {
+			return
+		}
+		if !e.blockedUntil.After(now) {
+			delete(l.entries, name)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package throttle
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(Config{
+		FreeAttempts:    2,
+		BaseDelay:       time.Second,
+		LockoutAttempts: 5,
+		LockoutDuration: time.Minute,
+		SharedFactor:    2,
+	})
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestBackoffAndLockout(t *testing.T) {
+	l, now := testLimiter()
+	keys, ids := []Key{{Name: "email"}}, []string{"a@example.com"}
+
+	// two free failures, then 1s, 2s, and a lockout on the fifth
+	for i, want := range []time.Duration{0, 0, time.Second, 2 * time.Second, time.Minute} {
+		a, wait := l.Begin(keys, ids)
+		require.NotNil(t, a, "attempt %d", i+1)
+		require.Zero(t, wait)
+		a.Failed()
+
+		e := l.entries["email:a@example.com"]
+		assert.Equal(t, want, max(e.blockedUntil.Sub(*now), 0), "attempt %d", i+1)
+		if want > 0 {
+			a, wait = l.Begin(keys, ids)
+			assert.Nil(t, a)
+			assert.Equal(t, want, wait)
+			*now = now.Add(want)
+		}
+	}
+
+	// another key is unaffected
+	a, wait := l.Begin(keys, []string{"b@example.com"})
+	require.NotNil(t, a)
+	assert.Zero(t, wait)
+
+	// failures are forgotten once the key has been quiet for LockoutDuration
+	*now = now.Add(2 * time.Minute)
+	a, _ = l.Begin(keys, ids)
+	require.NotNil(t, a)
+	assert.Equal(t, 1, l.entries["email:a@example.com"].failures)
+}
+
+func TestSuccessResetsAccountButNotSharedKey(t *testing.T) {
+	l, _ := testLimiter()
+	keys := []Key{{Name: "email"}, {Name: "ip", Shared: true}}
+	ids := []string{"a@example.com", "10.0.0.1"}
+
+	for range 2 {
+		a, _ := l.Begin(keys, ids)
+		a.Failed()
+	}
+	a, _ := l.Begin(keys, ids)
+	a.Succeeded()
+
+	assert.NotContains(t, l.entries, "email:a@example.com")
+	assert.Equal(t, 2, l.entries["ip:10.0.0.1"].failures)
+
+	a, _ = l.Begin(keys, ids)
+	a.Ignored()
+	assert.Equal(t, 0, l.entries["email:a@example.com"].failures)
+	assert.Equal(t, 2, l.entries["ip:10.0.0.1"].failures)
+}
+
+func TestSharedKeyGetsMoreAttempts(t *testing.T) {
+	l, _ := testLimiter()
+	assert.Zero(t, l.delay(4, true))
+	assert.Equal(t, time.Second, l.delay(5, true))
+	assert.Equal(t, time.Minute, l.delay(10, true))
+}
+
+func TestMiddleware(t *testing.T) {
+	l, now := testLimiter()
+	handler := l.Middleware([]int{http.StatusUnauthorized}, l.ByClientIP(), ByBodyField("email"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if strings.Contains(string(body), "right") {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		}))
+	post := func(email, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for range 3 {
+		assert.Equal(t, http.StatusUnauthorized, post("A@example.com", "wrong").Code)
+	}
+	// the handler still sees the whole body, and the email is matched case-insensitively
+	rec := post("a@example.com", "right")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// a different account from the same address is still allowed
+	assert.Equal(t, http.StatusOK, post("b@example.com", "right").Code)
+
+	*now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, post("a@example.com", "right").Code)
+	assert.NotContains(t, l.entries, "email:a@example.com")
+}
+
+func TestClientIP(t *testing.T) {
+	l := New(Config{TrustedProxyHops: 1})
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	assert.Equal(t, "10.0.0.2", l.clientIP(req))
+
+	// the client can put anything at the front of the header, but the proxy appends the real address
+	req.Header.Add("X-Forwarded-For", "1.2.3.4, 5.6.7.8")
+	assert.Equal(t, "5.6.7.8", l.clientIP(req))
+
+	assert.Equal(t, "10.0.0.2", New(Config{}).clientIP(req))
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"auth-service/firestore"
+	"pkg/audit"
+	fs "pkg/gcp/firestore"
+	"pkg/jwt"
+	"pkg/mail"
+	"pkg/operation"
+	"pkg/password"
+
+	"github.com/rs/zerolog/log"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type ChangeEmailRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewEmail        string `json:"newEmail"`
+}
+
+// recentLoginWindow is how recently a user without a password must have logged in to confirm changes to their
+// account, in place of the password they do not have
+const recentLoginWindow = 10 * time.Minute
+
+// checkCurrentPassword checks currentPassword against the caller's account. Users who only log in with an
+// OpenID Connect provider have no password, and confirm the change by having logged in within recentLoginWindow
+// instead. It writes the error response and returns false if the caller cannot be found or is not confirmed,
+// recording that as a failed attempt at action.
+func (h *UserHandler) checkCurrentPassword(w http.ResponseWriter, r *http.Request, currentPassword string, action audit.Action) (*jwt.Principal, *firestore.User, bool) {
+	principal, err := jwt.GetPrincipal(r)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get principal from JWT for account change")
+		return nil, nil, false
+	}
+	user, err := h.UserStore.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", principal.UserID).Msg("Failed to get user for account change")
+		return nil, nil, false
+	}
+	if user.Password == "" {
+		session, err := h.SessionStore.GetSession(r.Context(), principal.TokenID)
+		if err != nil && !errors.Is(err, fs.ErrNotFound) {
+			http.Error(w, "Failed to get session", http.StatusInternalServerError)
+			log.Error().Err(err).Str("userID", principal.UserID).Msg("Failed to get session for account change")
+			return nil, nil, false
+		}
+		if session == nil || session.UserID != principal.UserID || time.Since(session.CreatedAt) > recentLoginWindow {
+			http.Error(w, "Log in again to confirm this change", http.StatusForbidden)
+			log.Info().Str("userID", principal.UserID).Msg("Login too old to confirm account change without a password")
+			h.recordAccountEvent(r, action, principal.UserID, audit.OutcomeFailure, map[string]string{"reason": "login not recent"})
+			return nil, nil, false
+		}
+		return principal, user, true
+	}
+	if err := password.CheckPasswordHash(currentPassword, user.Password); err != nil {
+		http.Error(w, "Invalid password", http.StatusForbidden)
+		log.Info().Str("userID", principal.UserID).Msg("Password mismatch for account change")
+		h.recordAccountEvent(r, action, principal.UserID, audit.OutcomeFailure, map[string]string{"reason": "wrong password"})
+		return nil, nil, false
+	}
+	return principal, user, true
+}
+
+// ChangePasswordHandler sets a new password for the caller. Their other devices are logged out, and their
+// personal access tokens and any password reset links already sent stop working; the session making the
+// change stays logged in.
+func (h *UserHandler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid change password request")
+		return
+	}
+	principal, _, ok := h.checkCurrentPassword(w, r, req.CurrentPassword, audit.ActionChangePassword)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
+	if !isSecurePassword(req.NewPassword) {
+		http.Error(w, "Password must be at least 12 characters and include uppercase, lowercase, number, and special character", http.StatusBadRequest)
+		log.Info().Str("userID", userID).Msg("Password does not meet security requirements for change")
+		return
+	}
+	hashedPassword, err := password.HashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Error hashing password for change")
+		return
+	}
+	// everything the old password let in is shut out first, so a failure leaves the old password in place for the
+	// user to try again with rather than a new password with a thief still logged in
+	revoked, err := h.SessionStore.RevokeOtherUserSessions(r.Context(), userID, principal.TokenID)
+	if err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to revoke other sessions for password change")
+		return
+	}
+	if err := h.PasswordResetStore.InvalidateUserTokens(r.Context(), userID); err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to invalidate password reset tokens for password change")
+		return
+	}
+	if _, err := h.PersonalTokenStore.RevokeUserTokens(r.Context(), userID); err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to revoke personal tokens for password change")
+		return
+	}
+	if err := h.UserStore.UpdatePassword(r.Context(), userID, hashedPassword); err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to update password for change")
+		return
+	}
+
+	h.recordAccountEvent(r, audit.ActionChangePassword, userID, audit.OutcomeSuccess, nil)
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("userID", userID).Int("sessionsRevoked", revoked).Msg("Password changed")
+	if err := json.NewEncoder(w).Encode(map[string]any{"message": "Password changed", "sessionsRevoked": revoked}); err != nil {
+		log.Error().Err(err).Msg("Error writing change password response")
+	}
+}
+
+// ChangeEmailHandler moves the caller's account to a new email. The new email has to be verified with the
+// link sent to it, and the old one is told about the change. Copies of the email kept by the other services
+// are updated in the background, and access tokens pick it up when they are next refreshed.
+func (h *UserHandler) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid change email request")
+		return
+	}
+	principal, user, ok := h.checkCurrentPassword(w, r, req.CurrentPassword, audit.ActionChangeEmail)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
+	newEmail := firestore.NormaliseEmail(req.NewEmail)
+	if !isValidEmail(newEmail) {
+		http.Error(w, "Invalid email format", http.StatusBadRequest)
+		log.Info().Str("userID", userID).Msg("Invalid email format for change")
+		return
+	}
+	if newEmail == firestore.NormaliseEmail(user.Email) {
+		http.Error(w, "That is already your email", http.StatusBadRequest)
+		return
+	}
+
+	// links already sent went to the old address, so they must not verify or reset the new one
+	if err := h.VerificationStore.InvalidateUserTokens(r.Context(), userID); err != nil {
+		http.Error(w, "Failed to change email", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to invalidate verification tokens for email change")
+		return
+	}
+	if err := h.PasswordResetStore.InvalidateUserTokens(r.Context(), userID); err != nil {
+		http.Error(w, "Failed to change email", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to invalidate password reset tokens for email change")
+		return
+	}
+	err := h.UserStore.UpdateEmail(r.Context(), userID, newEmail)
+	if errors.Is(err, fs.ErrAlreadyExists) {
+		http.Error(w, "Email already in use", http.StatusBadRequest)
+		log.Info().Str("userID", userID).Msg("Email already in use for change")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to change email", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to update email")
+		return
+	}
+
+	// the other services only learn of the new email through the operation, so without one the change is undone
+	_, err = h.Operations.Create(r.Context(), operation.ChangeEmail, userID, map[string]string{
+		operation.ParamEmail:         newEmail,
+		operation.ParamPreviousEmail: user.Email,
+	}, operation.ChangeEmailSteps)
+	if err != nil {
+		http.Error(w, "Failed to change email", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to create change email operation")
+		if err := h.UserStore.RestoreEmail(context.WithoutCancel(r.Context()), userID, user.Email, user.EmailVerified); err != nil {
+			log.Error().Err(err).Str("userID", userID).Msg("Failed to restore email after failed change")
+		}
+		return
+	}
+	h.sendVerificationInBackground(r, userID, newEmail)
+	h.sendEmailChangedNotice(r, user.Email, newEmail)
+	h.recordAccountEvent(r, audit.ActionChangeEmail, userID, audit.OutcomeSuccess, map[string]string{"previousEmail": user.Email, "email": newEmail})
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("userID", userID).Msg("Email changed")
+	if err := json.NewEncoder(w).Encode(map[string]any{"message": "Email changed", "email": newEmail, "emailVerified": false}); err != nil {
+		log.Error().Err(err).Msg("Error writing change email response")
+	}
+}
+
+// sendEmailChangedNotice tells the old address that the account has moved, so its owner notices if they
+// did not do it.
+func (h *UserHandler) sendEmailChangedNotice(r *http.Request, oldEmail, newEmail string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), sendMailTimeout)
+	go func() {
+		defer cancel()
+		err := h.Mailer.Send(ctx, mail.Message{
+			To:      oldEmail,
+			Subject: "Your Canary email address was changed",
+			Body: fmt.Sprintf("The email address of your Canary account was changed to %s.\n\n"+
+				"If this wasn't you, contact the Canary team straight away.\n", newEmail),
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to send email changed notice")
+		}
+	}()
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"auth-service/firestore"
+	"auth-service/oidc"
+	fs "pkg/gcp/firestore"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// oidcStateCookie holds the state of the login started in this browser, so a callback sent to someone else's
+	// browser cannot log them in as the attacker
+	oidcStateCookie = "canary_oidc_state"
+	// oidcLoginCodeTTL is how long the frontend has to exchange a login code for tokens
+	oidcLoginCodeTTL = time.Minute
+)
+
+// Reasons a login with the provider failed, sent to the frontend as the error query parameter.
+const (
+	oidcErrorDenied     = "denied"
+	oidcErrorExpired    = "expired"
+	oidcErrorUnverified = "email_unverified"
+	oidcErrorFailed     = "failed"
+)
+
+var errOIDCEmailUnverified = errors.New("the provider has not verified the email")
+
+type OIDCTokenRequest struct {
+	LoginCode string `json:"loginCode"`
+}
+
+// OIDCLoginHandler sends the browser to the provider to log in.
+func (h *UserHandler) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	verifier := oidc.GenerateVerifier()
+	nonce, err := oidc.GenerateNonce()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to generate OIDC nonce")
+		return
+	}
+	state, err := h.OIDCLoginStore.StartLogin(r.Context(), verifier, nonce, h.OIDC.LoginTTL)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to store OIDC login")
+		return
+	}
+	authURL, err := h.OIDCProvider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		http.Error(w, "Login provider is unavailable", http.StatusBadGateway)
+		log.Error().Err(err).Msg("Failed to build OIDC authorization URL")
+		return
+	}
+	h.setOIDCStateCookie(w, state, int(h.OIDC.LoginTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (h *UserHandler) setOIDCStateCookie(w http.ResponseWriter, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.OIDC.RedirectURL, "https://"),
+		// the provider sends the browser back with a top level GET, which Lax cookies are sent with
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// OIDCCallbackHandler is where the provider sends the browser back to. It finds or creates the user the ID token
+// is for and sends the browser on to the frontend with a code it exchanges for tokens at /oidc/token, so tokens
+// never appear in a URL.
+func (h *UserHandler) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	// each login can only come back once, whatever happens
+	h.setOIDCStateCookie(w, "", -1)
+	if providerErr := q.Get("error"); providerErr != "" {
+		log.Info().Str("error", providerErr).Str("description", q.Get("error_description")).Msg("OIDC provider refused login")
+		h.redirectToFrontend(w, r, "error", oidcErrorDenied)
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		log.Info().Msg("OIDC callback without the state of a login started in this browser")
+		h.redirectToFrontend(w, r, "error", oidcErrorExpired)
+		return
+	}
+	login, err := h.OIDCLoginStore.FinishLogin(r.Context(), state)
+	if errors.Is(err, firestore.ErrInvalidToken) {
+		log.Info().Msg("OIDC callback for an unknown, expired or finished login")
+		h.redirectToFrontend(w, r, "error", oidcErrorExpired)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to finish OIDC login")
+		h.redirectToFrontend(w, r, "error", oidcErrorFailed)
+		return
+	}
+
+	claims, err := h.OIDCProvider.Exchange(r.Context(), q.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to exchange OIDC code")
+		h.redirectToFrontend(w, r, "error", oidcErrorFailed)
+		return
+	}
+	userID, err := h.oidcUser(r.Context(), claims)
+	if errors.Is(err, errOIDCEmailUnverified) {
+		log.Info().Str("subject", claims.Subject).Msg("OIDC login without a verified email")
+		h.redirectToFrontend(w, r, "error", oidcErrorUnverified)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("subject", claims.Subject).Msg("Failed to find or create user for OIDC login")
+		h.redirectToFrontend(w, r, "error", oidcErrorFailed)
+		return
+	}
+	code, err := h.OIDCLoginCodeStore.CreateToken(r.Context(), userID, oidcLoginCodeTTL)
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to create OIDC login code")
+		h.redirectToFrontend(w, r, "error", oidcErrorFailed)
+		return
+	}
+	log.Info().Str("userID", userID).Msg("OIDC login accepted")
+	h.redirectToFrontend(w, r, "loginCode", code)
+}
+
+func (h *UserHandler) redirectToFrontend(w http.ResponseWriter, r *http.Request, key, value string) {
+	link, err := withQuery(h.OIDC.FrontendURL, key, value)
+	if err != nil {
+		http.Error(w, "Invalid OIDC_FRONTEND_URL", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Invalid OIDC_FRONTEND_URL")
+		return
+	}
+	http.Redirect(w, r, link, http.StatusFound)
+}
+
+// oidcUser returns the user claims log in as. An identity that has logged in before keeps logging in as the same
+// user. Otherwise it is linked to the user with the same email, or a new user is created, which both trust the
+// email and so need the provider to have verified it.
+func (h *UserHandler) oidcUser(ctx context.Context, claims *oidc.Claims) (string, error) {
+	identity := firestore.Identity{Issuer: claims.Issuer, Subject: claims.Subject}
+	_, userID, err := h.UserStore.FindByIdentity(ctx, identity)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, fs.ErrNotFound) {
+		return "", err
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return "", errOIDCEmailUnverified
+	}
+
+	_, userID, err = h.UserStore.FindByEmail(ctx, claims.Email)
+	if errors.Is(err, fs.ErrNotFound) {
+		userID, err = h.UserStore.CreateOIDCUser(ctx, claims.Email, identity)
+		if err != nil {
+			return "", err
+		}
+		log.Info().Str("userID", userID).Str("issuer", identity.Issuer).Msg("User created from OIDC login")
+		return userID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	claimed, err := h.UserStore.LinkIdentity(ctx, userID, identity)
+	if err != nil {
+		return "", err
+	}
+	log.Info().Str("userID", userID).Str("issuer", identity.Issuer).Bool("claimed", claimed).Msg("OIDC identity linked to user")
+	if claimed {
+		// the password was set by someone who never proved they own the email, so they are logged out too
+		if _, err := h.SessionStore.RevokeUserSessions(ctx, userID); err != nil {
+			return "", err
+		}
+		if _, err := h.PersonalTokenStore.RevokeUserTokens(ctx, userID); err != nil {
+			return "", err
+		}
+		if err := h.PasswordResetStore.InvalidateUserTokens(ctx, userID); err != nil {
+			return "", err
+		}
+	}
+	return userID, nil
+}
+
+// OIDCTokenHandler exchanges the login code from the callback for tokens. The response is the same as /login's:
+// users with two-factor authentication get a challenge to answer at /login/2fa.
+func (h *UserHandler) OIDCTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req OIDCTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LoginCode == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid OIDC token request")
+		return
+	}
+	userID, err := h.OIDCLoginCodeStore.ConsumeToken(r.Context(), req.LoginCode)
+	if errors.Is(err, firestore.ErrInvalidToken) {
+		http.Error(w, "Login has expired; log in again", http.StatusUnauthorized)
+		log.Info().Msg("Invalid or expired OIDC login code")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to consume OIDC login code")
+		return
+	}
+	user, err := h.UserStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to get user for OIDC login")
+		return
+	}
+	if user.TwoFactor != nil && user.TwoFactor.Enabled {
+		h.writeTwoFactorChallenge(w, userID)
+		return
+	}
+	h.startSession(w, r, userID, user, loginOIDC)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	fs "pkg/gcp/firestore"
+	"pkg/operation"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// OperationHandler reports the progress of a background operation such as an account deletion. It needs no
+// token, as the caller may have just deleted their account, so it shows only the status of each step and
+// nothing about who or what the operation is for. Operation IDs are random and hard to guess.
+func (h *UserHandler) OperationHandler(w http.ResponseWriter, r *http.Request) {
+	operationID := mux.Vars(r)["operationID"]
+	op, err := h.Operations.Get(r.Context(), operationID)
+	if errors.Is(err, fs.ErrNotFound) {
+		http.Error(w, "Operation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get operation", http.StatusInternalServerError)
+		log.Error().Err(err).Str("operationID", operationID).Msg("Failed to get operation")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(op); err != nil {
+		log.Error().Err(err).Str("operationID", operationID).Msg("Error writing operation response")
+	}
+}
+
+// deleteAccount is the auth service's step of deleting an account: it logs the user out everywhere, revokes
+// their personal access tokens, drops their emailed tokens and deletes the user. Their email is free to
+// register again once it has run.
+func (h *UserHandler) deleteAccount(ctx context.Context, op *operation.Operation) error {
+	userID := op.Subject
+	if _, err := h.SessionStore.RevokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if _, err := h.PersonalTokenStore.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := h.PasswordResetStore.DeleteUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := h.VerificationStore.DeleteUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := h.OIDCLoginCodeStore.DeleteUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := h.UserStore.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	log.Info().Str("userID", userID).Str("operationID", op.ID).Msg("User deleted")
+	return nil
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"auth-service/firestore"
+	"pkg/audit"
+	fs "pkg/gcp/firestore"
+	"pkg/mail"
+	"pkg/password"
+
+	"github.com/rs/zerolog/log"
+)
+
+const sendMailTimeout = 30 * time.Second
+
+// PasswordResetConfig sets how password reset emails are sent.
+type PasswordResetConfig struct {
+	TokenTTL time.Duration `env:"PASSWORD_RESET_TOKEN_TTL" yaml:"tokenTTL" default:"1h"`
+	// URL is the frontend page that resets a password. The token is added as the token query parameter.
+	URL string `env:"PASSWORD_RESET_URL" yaml:"url" default:"http://localhost:5173/reset-password"`
+	// ResendInterval is how long after a reset email is sent to a user before another one is.
+	ResendInterval time.Duration `env:"PASSWORD_RESET_RESEND_INTERVAL" yaml:"resendInterval" default:"1m"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h *UserHandler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid forgot password request")
+		return
+	}
+
+	// the response is the same whether or not the email has an account, so it cannot be used to find accounts,
+	// and the email is sent in the background so the response time does not tell either
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), sendMailTimeout)
+	go func() {
+		defer cancel()
+		h.sendPasswordReset(ctx, req.Email)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "If the email has an account, a reset link has been sent"}); err != nil {
+		log.Error().Err(err).Msg("Error writing forgot password response")
+	}
+}
+
+func (h *UserHandler) sendPasswordReset(ctx context.Context, email string) {
+	_, userID, err := h.UserStore.FindByEmail(ctx, email)
+	if errors.Is(err, fs.ErrNotFound) {
+		log.Info().Str("email", email).Msg("Password reset requested for unknown email")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("email", email).Msg("Failed to find user for password reset")
+		return
+	}
+	// the requester is not told either way, so a flood of requests for one address sends it one email at most
+	// every ResendInterval
+	last, err := h.PasswordResetStore.LastCreatedAt(ctx, userID)
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to read previous password reset emails")
+		return
+	}
+	if time.Since(last) < h.PasswordReset.ResendInterval {
+		log.Info().Str("userID", userID).Msg("Password reset email sent recently; not sending another")
+		return
+	}
+	token, err := h.PasswordResetStore.CreateToken(ctx, userID, h.PasswordReset.TokenTTL)
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to create password reset token")
+		return
+	}
+	link, err := withQuery(h.PasswordReset.URL, "token", token)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid PASSWORD_RESET_URL")
+		return
+	}
+	err = h.Mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Reset your Canary password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Canary account.\n\n"+
+			"To choose a new password, open this link within %s:\n\n%s\n\n"+
+			"If this wasn't you, you can ignore this email; your password has not been changed.\n",
+			h.PasswordReset.TokenTTL, link),
+	})
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to send password reset email")
+		return
+	}
+	log.Info().Str("userID", userID).Msg("Password reset email sent")
+}
+
+// withQuery returns rawURL with the query parameter key set to value.
+func withQuery(rawURL, key, value string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (h *UserHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid reset password request")
+		return
+	}
+	// checked before the token is used up, so a weak password does not cost the user their link
+	if !isSecurePassword(req.Password) {
+		http.Error(w, "Password must be at least 12 characters and include uppercase, lowercase, number, and special character", http.StatusBadRequest)
+		log.Info().Msg("Password does not meet security requirements for reset")
+		return
+	}
+	hashedPassword, err := password.HashPassword(req.Password)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Error hashing password for reset")
+		return
+	}
+
+	userID, err := h.PasswordResetStore.ConsumeToken(r.Context(), req.Token)
+	if errors.Is(err, firestore.ErrInvalidToken) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		log.Info().Msg("Invalid password reset token")
+		h.recordAccountEvent(r, audit.ActionResetPassword, "", audit.OutcomeFailure, map[string]string{"reason": "invalid token"})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to consume password reset token")
+		return
+	}
+	if err := h.UserStore.UpdatePassword(r.Context(), userID, hashedPassword); err != nil {
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to update password for reset")
+		return
+	}
+	// whoever knew the old password is logged out everywhere, and loses any tokens they created
+	if _, err := h.SessionStore.RevokeUserSessions(r.Context(), userID); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to revoke sessions after password reset")
+	}
+	if _, err := h.PersonalTokenStore.RevokeUserTokens(r.Context(), userID); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to revoke personal tokens after password reset")
+	}
+
+	h.recordAccountEvent(r, audit.ActionResetPassword, userID, audit.OutcomeSuccess, nil)
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("userID", userID).Msg("Password reset")
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Password reset"}); err != nil {
+		log.Error().Err(err).Msg("Error writing reset password response")
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"pkg/audit"
+	fs "pkg/gcp/firestore"
+	"pkg/jwt"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+const maxPersonalTokenNameLength = 100
+
+// PersonalTokenConfig sets how long personal access tokens may last.
+type PersonalTokenConfig struct {
+	// DefaultTTL is how long a token lasts if the request does not say
+	DefaultTTL time.Duration `env:"PERSONAL_TOKEN_DEFAULT_TTL" yaml:"defaultTTL" default:"720h"`
+	// MaxTTL is the longest a token may be asked to last
+	MaxTTL time.Duration `env:"PERSONAL_TOKEN_MAX_TTL" yaml:"maxTTL" default:"8760h"`
+}
+
+func (c *PersonalTokenConfig) Validate() error {
+	if c.MaxTTL <= 0 || c.DefaultTTL <= 0 || c.DefaultTTL > c.MaxTTL {
+		return errors.New("PERSONAL_TOKEN_DEFAULT_TTL must be positive and no more than PERSONAL_TOKEN_MAX_TTL")
+	}
+	return nil
+}
+
+type CreatePersonalTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays is how many days the token lasts. Zero uses PERSONAL_TOKEN_DEFAULT_TTL.
+	ExpiresInDays int `json:"expiresInDays,omitempty"`
+}
+
+// CreatePersonalTokenResponse includes the token itself, which is only ever shown here.
+type CreatePersonalTokenResponse struct {
+	*jwt.PersonalToken
+	Token string `json:"token"`
+}
+
+// CreatePersonalTokenHandler issues the caller a personal access token for scripts, limited to the requested
+// scopes. Only users with a verified email can create them.
+func (h *UserHandler) CreatePersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	principal, err := jwt.GetPrincipal(r)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get principal from JWT for personal token")
+		return
+	}
+	var req CreatePersonalTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid create personal token request")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxPersonalTokenNameLength {
+		http.Error(w, "Give the token a name of at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "Give the token at least one scope: read, write or export", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(jwt.PersonalTokenScopes, scope) {
+			http.Error(w, "Unknown scope "+scope+"; use read, write or export", http.StatusBadRequest)
+			return
+		}
+	}
+	ttl := h.PersonalTokens.DefaultTTL
+	if req.ExpiresInDays != 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+	if ttl <= 0 || ttl > h.PersonalTokens.MaxTTL {
+		http.Error(w, "Tokens must expire within "+h.PersonalTokens.MaxTTL.String(), http.StatusBadRequest)
+		return
+	}
+	// the verification policy is not checked on requests made with a token, so it is checked here instead
+	if !principal.EmailVerified {
+		http.Error(w, "Verify your email address first", http.StatusForbidden)
+		return
+	}
+
+	token, secret, err := h.PersonalTokenStore.CreateToken(r.Context(), principal.UserID, req.Name, slices.Compact(slices.Sorted(slices.Values(req.Scopes))), ttl)
+	if err != nil {
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", principal.UserID).Msg("Failed to create personal token")
+		return
+	}
+	h.Audit.RecordRequest(r, audit.Event{
+		Action:       audit.ActionCreateToken,
+		ResourceType: audit.ResourceToken,
+		ResourceID:   token.ID,
+		Outcome:      audit.OutcomeSuccess,
+		Details:      map[string]string{"scopes": strings.Join(token.Scopes, ","), "expiresAt": token.ExpiresAt.Format(time.RFC3339)},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	log.Info().Str("userID", principal.UserID).Str("tokenID", token.ID).Strs("scopes", token.Scopes).Msg("Personal token created")
+	if err := json.NewEncoder(w).Encode(CreatePersonalTokenResponse{PersonalToken: token, Token: secret}); err != nil {
+		log.Error().Err(err).Msg("Error writing create personal token response")
+	}
+}
+
+// ListPersonalTokensHandler lists the caller's tokens that have not been revoked, with when each was last used.
+func (h *UserHandler) ListPersonalTokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT for personal tokens")
+		return
+	}
+	tokens, err := h.PersonalTokenStore.ListTokens(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to list tokens", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to list personal tokens")
+		return
+	}
+	slices.SortFunc(tokens, func(a, b *jwt.PersonalToken) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"tokens": tokens}); err != nil {
+		log.Error().Err(err).Msg("Error writing personal tokens response")
+	}
+}
+
+func (h *UserHandler) RevokePersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT for personal token")
+		return
+	}
+	tokenID := mux.Vars(r)["tokenID"]
+	err = h.PersonalTokenStore.RevokeToken(r.Context(), userID, tokenID)
+	if errors.Is(err, fs.ErrNotFound) {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Str("tokenID", tokenID).Msg("Failed to revoke personal token")
+		return
+	}
+	log.Info().Str("userID", userID).Str("tokenID", tokenID).Msg("Personal token revoked")
+	h.Audit.RecordRequest(r, audit.Event{Action: audit.ActionRevokeToken, ResourceType: audit.ResourceToken, ResourceID: tokenID, Outcome: audit.OutcomeSuccess})
+	w.WriteHeader(http.StatusNoContent)
+}
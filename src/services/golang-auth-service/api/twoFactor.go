@@ -0,0 +1,304 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"auth-service/firestore"
+	"auth-service/totp"
+	"pkg/audit"
+	"pkg/jwt"
+	"pkg/throttle"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	twoFactorChallengePurpose = "2fa-challenge"
+	recoveryCodeCount         = 10
+	// recovery codes are ten characters of five bits each, written as two groups of five
+	recoveryCodeLength = 10
+)
+
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+
+// TwoFactorConfig sets up TOTP two-factor authentication.
+type TwoFactorConfig struct {
+	// Issuer is the name authenticator apps show the account under
+	Issuer string `env:"TOTP_ISSUER" yaml:"issuer" default:"Canary"`
+	// ChallengeTTL is how long a user has after entering their password to enter their code
+	ChallengeTTL time.Duration `env:"TWO_FACTOR_CHALLENGE_TTL" yaml:"challengeTTL" default:"5m"`
+}
+
+// TwoFactorChallengeResponse is returned by login instead of a TokenResponse when the user has two-factor
+// authentication enabled. The challenge token and a code are exchanged for tokens at /login/2fa.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+	ExpiresIn         int64  `json:"expiresIn"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	// Code is a code from the authenticator app or an unused recovery code
+	Code string `json:"code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI to show as a QR code
+	URI string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func (h *UserHandler) writeTwoFactorChallenge(w http.ResponseWriter, userID string) {
+	token, err := jwt.GeneratePurposeToken(twoFactorChallengePurpose, userID, h.TwoFactor.ChallengeTTL)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to generate two-factor challenge")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("userID", userID).Msg("Password accepted, waiting for two-factor code")
+	err = json.NewEncoder(w).Encode(TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int64(h.TwoFactor.ChallengeTTL.Seconds()),
+	})
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Error writing two-factor challenge response")
+	}
+}
+
+// challengeUserKey throttles codes per user, whichever challenge token they come with, so logging in again
+// for a new challenge does not give more guesses.
+func challengeUserKey() throttle.Key {
+	return throttle.Key{Name: "2fa", From: func(r *http.Request) string {
+		userID, _ := jwt.ParsePurposeToken(throttle.PeekBodyField(r, "challengeToken"), twoFactorChallengePurpose)
+		return userID
+	}}
+}
+
+func (h *UserHandler) TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid two-factor login request")
+		return
+	}
+	userID, err := jwt.ParsePurposeToken(req.ChallengeToken, twoFactorChallengePurpose)
+	if err != nil {
+		http.Error(w, "Login has expired; enter your password again", http.StatusUnauthorized)
+		log.Info().Err(err).Msg("Invalid two-factor challenge token")
+		return
+	}
+	ok, err := h.UserStore.CheckTwoFactorCode(r.Context(), userID, req.Code, true)
+	if errors.Is(err, firestore.ErrTwoFactorNotEnrolled) {
+		// two-factor authentication was turned off since the challenge was issued
+		ok, err = false, nil
+	}
+	if err != nil {
+		http.Error(w, "Failed to check code", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to check two-factor code")
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		log.Info().Str("userID", userID).Msg("Invalid two-factor code for login")
+		h.recordAccountEvent(r, audit.ActionLogin, userID, audit.OutcomeFailure, map[string]string{"reason": "wrong code"})
+		return
+	}
+	user, err := h.UserStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to get user for two-factor login")
+		return
+	}
+	h.startSession(w, r, userID, user, loginTwoFactor)
+}
+
+// EnrollTwoFactorHandler creates a new TOTP secret for the caller. It is not used at login until confirmed
+// with EnableTwoFactorHandler.
+func (h *UserHandler) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	principal, err := jwt.GetPrincipal(r)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT for two-factor enrolment")
+		return
+	}
+	user, err := h.UserStore.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", principal.UserID).Msg("Failed to get user for two-factor enrolment")
+		return
+	}
+	if user.TwoFactor != nil && user.TwoFactor.Enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to generate TOTP secret")
+		return
+	}
+	if err := h.UserStore.StartTwoFactor(r.Context(), principal.UserID, secret); err != nil {
+		http.Error(w, "Failed to start two-factor enrolment", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", principal.UserID).Msg("Failed to store TOTP secret")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("userID", principal.UserID).Msg("Two-factor enrolment started")
+	err = json.NewEncoder(w).Encode(TwoFactorEnrollResponse{
+		Secret: secret,
+		URI:    totp.URI(h.TwoFactor.Issuer, user.Email, secret),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error writing two-factor enrolment response")
+	}
+}
+
+// EnableTwoFactorHandler turns on two-factor login once the caller enters a code from their newly enrolled app,
+// and returns their recovery codes. They are only ever shown here.
+func (h *UserHandler) EnableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.checkCallerCode(w, r, false, audit.ActionEnableTwoFactor)
+	if !ok {
+		return
+	}
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to generate recovery codes")
+		return
+	}
+	if err := h.UserStore.EnableTwoFactor(r.Context(), userID, codes); err != nil {
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to enable two-factor authentication")
+		return
+	}
+	log.Info().Str("userID", userID).Msg("Two-factor authentication enabled")
+	h.recordAccountEvent(r, audit.ActionEnableTwoFactor, userID, audit.OutcomeSuccess, nil)
+	writeRecoveryCodes(w, codes)
+}
+
+// RecoveryCodesHandler replaces the caller's recovery codes, for when they have used or lost them.
+func (h *UserHandler) RecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.checkCallerCode(w, r, true, audit.ActionRecoveryCodes)
+	if !ok {
+		return
+	}
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to generate recovery codes")
+		return
+	}
+	if err := h.UserStore.ReplaceRecoveryCodes(r.Context(), userID, codes); err != nil {
+		http.Error(w, "Failed to replace recovery codes", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to replace recovery codes")
+		return
+	}
+	log.Info().Str("userID", userID).Msg("Recovery codes replaced")
+	h.recordAccountEvent(r, audit.ActionRecoveryCodes, userID, audit.OutcomeSuccess, nil)
+	writeRecoveryCodes(w, codes)
+}
+
+func (h *UserHandler) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.checkCallerCode(w, r, true, audit.ActionDisableTwoFactor)
+	if !ok {
+		return
+	}
+	if err := h.UserStore.DisableTwoFactor(r.Context(), userID); err != nil {
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to disable two-factor authentication")
+		return
+	}
+	h.recordAccountEvent(r, audit.ActionDisableTwoFactor, userID, audit.OutcomeSuccess, nil)
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("userID", userID).Msg("Two-factor authentication disabled")
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"}); err != nil {
+		log.Error().Err(err).Msg("Error writing disable two-factor response")
+	}
+}
+
+// checkCallerCode reads a TwoFactorCodeRequest and checks its code against the caller's enrolment. enabled
+// says whether two-factor authentication must already be on, in which case recovery codes are accepted too.
+// It writes the error response and returns false if the code is not accepted, recording a wrong code as a
+// failed attempt at action.
+func (h *UserHandler) checkCallerCode(w http.ResponseWriter, r *http.Request, enabled bool, action audit.Action) (string, bool) {
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT for two-factor code")
+		return "", false
+	}
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid two-factor code request")
+		return "", false
+	}
+	user, err := h.UserStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to get user for two-factor code")
+		return "", false
+	}
+	if user.TwoFactor == nil || user.TwoFactor.Enabled != enabled {
+		if enabled {
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		} else if user.TwoFactor == nil {
+			http.Error(w, "Start two-factor enrolment first", http.StatusConflict)
+		} else {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		}
+		return "", false
+	}
+
+	ok, err := h.UserStore.CheckTwoFactorCode(r.Context(), userID, req.Code, enabled)
+	if err != nil {
+		http.Error(w, "Failed to check code", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to check two-factor code")
+		return "", false
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusForbidden)
+		log.Info().Str("userID", userID).Msg("Invalid two-factor code")
+		h.recordAccountEvent(r, action, userID, audit.OutcomeFailure, map[string]string{"reason": "wrong code"})
+		return "", false
+	}
+	return userID, true
+}
+
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	b := make([]byte, recoveryCodeLength)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := recoveryCodeEncoding.EncodeToString(b)[:recoveryCodeLength]
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+	}
+	return codes, nil
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		log.Error().Err(err).Msg("Error writing recovery codes response")
+	}
+}
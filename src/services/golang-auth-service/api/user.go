@@ -1,41 +1,146 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"auth-service/firestore"
+	"auth-service/oidc"
+	"pkg/audit"
 	fs "pkg/gcp/firestore"
 	"pkg/handler"
 	"pkg/jwt"
+	"pkg/mail"
+	"pkg/operation"
 	"pkg/password"
+	"pkg/throttle"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
 )
 
+// Options are the settings and dependencies of the user routes.
+type Options struct {
+	Tokens            jwt.TokenConfig
+	PasswordReset     PasswordResetConfig
+	EmailVerification EmailVerificationConfig
+	Mailer            mail.Mailer
+	TwoFactor         TwoFactorConfig
+	PersonalTokens    PersonalTokenConfig
+	// OIDC sets up logging in with an OpenID Connect provider, if one is configured
+	OIDC oidc.Config
+	// Throttle limits failed logins per account and per client address
+	Throttle throttle.Config
+	// Operations sets how account deletions are picked up and retried
+	Operations operation.Config
+}
+
 type UserHandler struct {
 	*handler.Handler
-	UserStore *firestore.UserStore
+	UserStore          *firestore.UserStore
+	SessionStore       *jwt.SessionStore
+	PasswordResetStore *firestore.OneTimeTokenStore
+	VerificationStore  *firestore.OneTimeTokenStore
+	PersonalTokenStore *jwt.PersonalTokenStore
+	OIDCLoginStore     *firestore.OIDCLoginStore
+	OIDCLoginCodeStore *firestore.OneTimeTokenStore
+	TokenConfig        jwt.TokenConfig
+	PasswordReset      PasswordResetConfig
+	EmailVerification  EmailVerificationConfig
+	Mailer             mail.Mailer
+	TwoFactor          TwoFactorConfig
+	PersonalTokens     PersonalTokenConfig
+	OIDC               oidc.Config
+	// OIDCProvider is nil unless a provider is configured
+	OIDCProvider *oidc.Provider
+	LoginLimiter *throttle.Limiter
+	// ResetLimiter limits requests for password reset emails
+	ResetLimiter    *throttle.Limiter
+	Operations      *operation.Store
+	AccountDeletion *operation.Worker
 }
 
-func NewUserHandler(h *handler.Handler) *UserHandler {
-	return &UserHandler{
-		Handler:   h,
-		UserStore: firestore.NewUserStore(h.Clients.Firestore),
+func NewUserHandler(h *handler.Handler, opts Options) *UserHandler {
+	uh := &UserHandler{
+		Handler:            h,
+		UserStore:          firestore.NewUserStore(h.Clients.Firestore),
+		SessionStore:       jwt.NewSessionStore(h.Clients.Firestore),
+		PasswordResetStore: firestore.NewPasswordResetStore(h.Clients.Firestore),
+		VerificationStore:  firestore.NewEmailVerificationStore(h.Clients.Firestore),
+		PersonalTokenStore: jwt.NewPersonalTokenStore(h.Clients.Firestore),
+		OIDCLoginStore:     firestore.NewOIDCLoginStore(h.Clients.Firestore),
+		OIDCLoginCodeStore: firestore.NewOIDCLoginCodeStore(h.Clients.Firestore),
+		TokenConfig:        opts.Tokens,
+		PasswordReset:      opts.PasswordReset,
+		EmailVerification:  opts.EmailVerification,
+		Mailer:             opts.Mailer,
+		TwoFactor:          opts.TwoFactor,
+		PersonalTokens:     opts.PersonalTokens,
+		OIDC:               opts.OIDC,
+		LoginLimiter:       throttle.New(opts.Throttle),
+		ResetLimiter:       throttle.New(opts.Throttle),
+		Operations:         operation.NewStore(h.Clients.Firestore),
+	}
+	if opts.OIDC.Enabled() {
+		uh.OIDCProvider = oidc.NewProvider(opts.OIDC)
 	}
+	uh.AccountDeletion = operation.NewWorker(h.Clients.Firestore, operation.DeleteAccount, operation.DeleteAccountStepAccount,
+		uh.deleteAccount, opts.Operations)
+	return uh
 }
 
-func RegisterUserRoutes(r *mux.Router, h *handler.Handler) {
-	uh := NewUserHandler(h)
+func RegisterUserRoutes(r *mux.Router, h *handler.Handler, opts Options) {
+	uh := NewUserHandler(h, opts)
+	uh.AccountDeletion.Start(h.Ctx)
+	// managing the account needs the user to have logged in; personal access tokens are refused
+	loginMw := func(next http.Handler) http.Handler { return h.AuthMw(jwt.RequireLogin(next)) }
 	r.HandleFunc("/register", uh.RegisterHandler).Methods("POST")
-	r.HandleFunc("/login", uh.LoginHandler).Methods("POST")
-	r.HandleFunc("/auth/{userID}", uh.AuthHandler).Methods("POST")
-	r.HandleFunc("/user", uh.DeleteHandler).Methods("DELETE")
-	// refresh token - renew token
-	r.HandleFunc("/refresh_token/{userID}", uh.RefreshHandler).Methods("POST")
-	// logout - make token invalid
+	// failed logins back off per email and per client address, then lock out for a while
+	loginThrottle := uh.LoginLimiter.Middleware([]int{http.StatusUnauthorized}, uh.LoginLimiter.ByClientIP(), throttle.ByBodyField("email"))
+	r.Handle("/login", loginThrottle(http.HandlerFunc(uh.LoginHandler))).Methods("POST")
+	// the second step of logging in for users with two-factor authentication, throttled per user
+	twoFactorThrottle := uh.LoginLimiter.Middleware([]int{http.StatusUnauthorized}, uh.LoginLimiter.ByClientIP(), challengeUserKey())
+	r.Handle("/login/2fa", twoFactorThrottle(http.HandlerFunc(uh.TwoFactorLoginHandler))).Methods("POST")
+	// log in with the OpenID Connect provider: the browser is sent to it and comes back to the callback, and the
+	// frontend then exchanges the login code it was given for tokens
+	if uh.OIDCProvider != nil {
+		r.HandleFunc("/oidc/login", uh.OIDCLoginHandler).Methods("GET")
+		r.HandleFunc("/oidc/callback", uh.OIDCCallbackHandler).Methods("GET")
+		r.HandleFunc("/oidc/token", uh.OIDCTokenHandler).Methods("POST")
+	}
+	r.Handle("/auth/{userID}", h.AuthMw(http.HandlerFunc(uh.AuthHandler))).Methods("POST")
+	// delete the caller's account and everything they own, and follow the deletion while it runs
+	codeThrottle := uh.LoginLimiter.Middleware([]int{http.StatusForbidden}, throttle.ByUser())
+	r.Handle("/user", loginMw(codeThrottle(http.HandlerFunc(uh.DeleteHandler)))).Methods("DELETE")
+	r.HandleFunc("/operations/{operationID}", uh.OperationHandler).Methods("GET")
+	// change the caller's password or email, confirmed with their current password
+	r.Handle("/password/change", loginMw(codeThrottle(http.HandlerFunc(uh.ChangePasswordHandler)))).Methods("POST")
+	r.Handle("/email/change", loginMw(codeThrottle(http.HandlerFunc(uh.ChangeEmailHandler)))).Methods("POST")
+	// exchange a refresh token for a new access and refresh token
+	r.HandleFunc("/refresh_token", uh.RefreshHandler).Methods("POST")
+	// revoke the caller's session, or every session of the caller
+	r.Handle("/logout", loginMw(http.HandlerFunc(uh.LogoutHandler))).Methods("POST")
+	r.Handle("/logout/all", loginMw(http.HandlerFunc(uh.LogoutAllHandler))).Methods("POST")
+	// email a single-use reset link, and set a new password with it. Every request for a link counts against the
+	// email and the client address, so the endpoint cannot be used to flood an inbox or pile up reset tokens.
+	resetThrottle := uh.ResetLimiter.Middleware([]int{http.StatusAccepted}, uh.ResetLimiter.ByClientIP(), throttle.ByBodyField("email"))
+	r.Handle("/password/forgot", resetThrottle(http.HandlerFunc(uh.ForgotPasswordHandler))).Methods("POST")
+	r.HandleFunc("/password/reset", uh.ResetPasswordHandler).Methods("POST")
+	// confirm an email address with the token from the verification email, or send that email again
+	r.HandleFunc("/email/verify", uh.VerifyEmailHandler).Methods("POST")
+	r.Handle("/email/verify/resend", loginMw(http.HandlerFunc(uh.ResendVerificationHandler))).Methods("POST")
+	// set up an authenticator app, confirm it with a code, and manage recovery codes
+	r.Handle("/2fa/enroll", loginMw(http.HandlerFunc(uh.EnrollTwoFactorHandler))).Methods("POST")
+	r.Handle("/2fa/enable", loginMw(codeThrottle(http.HandlerFunc(uh.EnableTwoFactorHandler)))).Methods("POST")
+	r.Handle("/2fa/disable", loginMw(codeThrottle(http.HandlerFunc(uh.DisableTwoFactorHandler)))).Methods("POST")
+	r.Handle("/2fa/recovery-codes", loginMw(codeThrottle(http.HandlerFunc(uh.RecoveryCodesHandler)))).Methods("POST")
+	// create, list and revoke personal access tokens for scripts
+	r.Handle("/tokens", loginMw(http.HandlerFunc(uh.CreatePersonalTokenHandler))).Methods("POST")
+	r.Handle("/tokens", loginMw(http.HandlerFunc(uh.ListPersonalTokensHandler))).Methods("GET")
+	r.Handle("/tokens/{tokenID}", loginMw(http.HandlerFunc(uh.RevokePersonalTokenHandler))).Methods("DELETE")
 }
 
 type RegisterRequest struct {
@@ -48,9 +153,24 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// TokenResponse is returned by login and refresh. ExpiresIn is the access token's lifetime in seconds.
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	UserID       string `json:"userID"`
+	// EmailVerified is false until the user follows the link in their verification email
+	EmailVerified bool `json:"emailVerified"`
+}
+
+// DeleteRequest confirms deleting the caller's account. Code is needed if they have two-factor authentication.
 type DeleteRequest struct {
-	Email    string `json:"email"`
 	Password string `json:"password"`
+	Code     string `json:"code,omitempty"`
 }
 
 func (h *UserHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
@@ -70,17 +190,6 @@ func (h *UserHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		log.Error().Str("email", req.Email).Msg("Password does not meet security requirements for register")
 		return
 	}
-	doc, _, err := h.UserStore.FindByEmail(r.Context(), req.Email)
-	if err != nil && err != fs.ErrNotFound {
-		http.Error(w, "Error processing email", http.StatusBadRequest)
-		log.Error().Err(err).Str("email", req.Email).Msg("Error processing email for register")
-		return
-	}
-	if doc != nil {
-		http.Error(w, "Email already in use", http.StatusBadRequest)
-		log.Error().Str("email", req.Email).Msg("Email already in use for register")
-		return
-	}
 	hashedPassword, err := password.HashPassword(req.Password)
 	if err != nil {
 		http.Error(w, "Error hashing password", http.StatusInternalServerError)
@@ -88,11 +197,19 @@ func (h *UserHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	userID, err := h.UserStore.CreateUser(r.Context(), req.Email, string(hashedPassword))
+	if errors.Is(err, fs.ErrAlreadyExists) {
+		http.Error(w, "Email already in use", http.StatusBadRequest)
+		log.Error().Str("email", req.Email).Msg("Email already in use for register")
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		log.Error().Err(err).Str("email", req.Email).Msg("Error creating user for register")
 		return
 	}
+	h.sendVerificationInBackground(r, userID, req.Email)
+	h.recordAccountEvent(r, audit.ActionRegister, userID, audit.OutcomeSuccess, nil)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	log.Info().Str("email", req.Email).Str("userID", userID).Msg("User registered successfully")
@@ -108,31 +225,108 @@ func (h *UserHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		log.Error().Err(err).Msg("Invalid login request")
 		return
 	}
+	// an unknown email and a wrong password get the same response, and take as long, so neither tells an
+	// attacker which emails have accounts
 	user, userID, err := h.UserStore.FindByEmail(r.Context(), req.Email)
-	if err != nil {
-		http.Error(w, "Invalid email or password", http.StatusNotFound)
+	if errors.Is(err, fs.ErrNotFound) {
+		_ = password.CheckPasswordHash(req.Password, dummyPasswordHash())
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		log.Info().Str("email", req.Email).Msg("User not found")
+		h.recordAccountEvent(r, audit.ActionLogin, "", audit.OutcomeFailure, map[string]string{"email": req.Email, "reason": "unknown email"})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		log.Error().Err(err).Str("email", req.Email).Msg("Failed to find user for login")
 		return
 	}
 
+	// an account without a password fails at once, so it is checked against the dummy hash to take as long
+	if user.Password == "" {
+		_ = password.CheckPasswordHash(req.Password, dummyPasswordHash())
+	}
 	if err := password.CheckPasswordHash(req.Password, user.Password); err != nil {
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		log.Info().Str("email", req.Email).Msg("Password mismatch for login")
+		h.recordAccountEvent(r, audit.ActionLogin, userID, audit.OutcomeFailure, map[string]string{"reason": "wrong password"})
+		return
+	}
+	if password.NeedsRehash(user.Password) {
+		h.rehashPassword(r.Context(), userID, req.Password)
+	}
+	// enrolled users finish logging in with a code from their authenticator app at /login/2fa
+	if user.TwoFactor != nil && user.TwoFactor.Enabled {
+		h.writeTwoFactorChallenge(w, userID)
 		return
 	}
-	token, err := jwt.GenerateJWT(r.Context(), h.Clients, userID, req.Email)
+	h.startSession(w, r, userID, user, loginPassword)
+}
+
+// rehashPassword replaces the stored hash of userID, made with an older algorithm or weaker parameters, with one
+// of pw at the current parameters. The password has already been checked, so failing to store the new hash only
+// leaves the old one in place for the next login.
+func (h *UserHandler) rehashPassword(ctx context.Context, userID, pw string) {
+	hashedPassword, err := password.HashPassword(pw)
+	if err == nil {
+		err = h.UserStore.UpdatePassword(ctx, userID, hashedPassword)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Failed to upgrade password hash")
+		return
+	}
+	log.Info().Str("userID", userID).Msg("Upgraded password hash")
+}
+
+// How a user proved who they are when logging in, as recorded in the audit log.
+const (
+	loginPassword  = "password"
+	loginTwoFactor = "2fa"
+	loginOIDC      = "oidc"
+)
+
+// startSession logs userID in: it creates a session and writes its tokens. method is how they logged in.
+func (h *UserHandler) startSession(w http.ResponseWriter, r *http.Request, userID string, user *firestore.User, method string) {
+	sessionID, refreshToken, err := h.SessionStore.CreateSession(r.Context(), userID, r.UserAgent(), h.TokenConfig.RefreshTokenTTL)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to create session for login")
+		return
+	}
+	log.Info().Str("email", user.Email).Str("sessionID", sessionID).Msg("User logged in successfully")
+	h.recordAccountEvent(r, audit.ActionLogin, userID, audit.OutcomeSuccess, map[string]string{"method": method, "sessionID": sessionID})
+	h.writeTokens(w, r, userID, user, sessionID, refreshToken)
+}
+
+// writeTokens issues an access token for the session and writes it with refreshToken as a TokenResponse.
+func (h *UserHandler) writeTokens(w http.ResponseWriter, r *http.Request, userID string, user *firestore.User, sessionID, refreshToken string) {
+	token, err := jwt.GenerateJWT(r.Context(), jwt.AccessClaims{
+		UserID:        userID,
+		Email:         user.Email,
+		SessionID:     sessionID,
+		EmailVerified: user.EmailVerified,
+	}, h.TokenConfig.AccessTokenTTL)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		log.Error().Err(err).Str("email", req.Email).Msg("Failed to generate JWT for login")
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to generate JWT")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	log.Info().Str("email", req.Email).Msg("User logged in successfully")
-	if err := json.NewEncoder(w).Encode(map[string]string{"token": token, "userID": userID}); err != nil {
-		log.Error().Err(err).Str("email", req.Email).Msg("Error writing login response")
+	resp := TokenResponse{
+		Token:         token,
+		RefreshToken:  refreshToken,
+		ExpiresIn:     int64(h.TokenConfig.AccessTokenTTL.Seconds()),
+		UserID:        userID,
+		EmailVerified: user.EmailVerified,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Error writing token response")
 	}
 }
 
+// DeleteHandler deletes the caller's account once they have confirmed it with their password, or a recent login
+// if they have none. The deletion
+// runs in the background, as it cascades to every project and session of the user in the other services, so
+// it responds with the ID of an operation to follow at /operations/{operationID}.
 func (h *UserHandler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	var req DeleteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -140,18 +334,41 @@ func (h *UserHandler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 		log.Error().Err(err).Msg("Invalid delete user request")
 		return
 	}
+	principal, user, ok := h.checkCurrentPassword(w, r, req.Password, audit.ActionDeleteAccount)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
+	if user.TwoFactor != nil && user.TwoFactor.Enabled {
+		ok, err := h.UserStore.CheckTwoFactorCode(r.Context(), userID, req.Code, true)
+		if err != nil {
+			http.Error(w, "Failed to check code", http.StatusInternalServerError)
+			log.Error().Err(err).Str("userID", userID).Msg("Failed to check two-factor code for delete user")
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid code", http.StatusForbidden)
+			log.Info().Str("userID", userID).Msg("Invalid two-factor code for delete user")
+			h.recordAccountEvent(r, audit.ActionDeleteAccount, userID, audit.OutcomeFailure, map[string]string{"reason": "wrong code"})
+			return
+		}
+	}
 
-	err := h.UserStore.DeleteUser(r.Context(), req.Email, req.Password)
+	op, err := h.Operations.Create(r.Context(), operation.DeleteAccount, userID,
+		map[string]string{operation.ParamEmail: user.Email}, operation.DeleteAccountSteps)
 	if err != nil {
 		http.Error(w, "Error deleting user", http.StatusInternalServerError)
-		log.Error().Err(err).Str("email", req.Email).Msg("Error deleting user")
+		log.Error().Err(err).Str("userID", userID).Msg("Error creating delete account operation")
 		return
 	}
+	h.AccountDeletion.Kick()
+	h.recordAccountEvent(r, audit.ActionDeleteAccount, userID, audit.OutcomeSuccess, map[string]string{"operationID": op.ID})
 
-	w.WriteHeader(http.StatusOK)
-	log.Info().Str("email", req.Email).Msg("User deleted successfully")
-	if _, err := w.Write([]byte("User deleted")); err != nil {
-		log.Error().Err(err).Str("email", req.Email).Msg("Error writing delete response")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	log.Info().Str("userID", userID).Str("operationID", op.ID).Msg("User deletion started")
+	if err := json.NewEncoder(w).Encode(op); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Error writing delete response")
 	}
 }
 
@@ -159,7 +376,10 @@ func (h *UserHandler) AuthHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userID"]
 
-	err := jwt.ValidateJWT(r, userID)
+	claimUserID, err := jwt.GetUserID(r)
+	if err == nil && claimUserID != userID {
+		err = errors.New("userID mismatch in token")
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		if _, ferr := fmt.Fprintf(w, "Invalid token %s", err.Error()); ferr != nil {
@@ -177,49 +397,102 @@ func (h *UserHandler) AuthHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *UserHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID := vars["userID"]
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid refresh token request")
+		return
+	}
 
-	err := jwt.ValidateJWT(r, userID)
+	session, sessionID, refreshToken, err := h.SessionStore.RotateRefreshToken(r.Context(), req.RefreshToken, h.TokenConfig.RefreshTokenTTL)
+	if errors.Is(err, jwt.ErrRefreshTokenReused) {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		log.Warn().Msg("Refresh token reused, session revoked")
+		return
+	}
+	if errors.Is(err, jwt.ErrInvalidRefreshToken) {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		log.Info().Msg("Invalid refresh token")
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		if _, err := w.Write([]byte("Invalid token")); err != nil {
-			log.Error().Err(err).Msg("Error writing invalid token response")
-		}
-		log.Error().Err(err).Msg("Invalid JWT token")
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to rotate refresh token")
 		return
 	}
 
-	// Get email from existing JWT or lookup by userID
-	tokenString, _ := jwt.GetAuthTokenString(r)
-	claims, _ := jwt.GetJWTClaims(tokenString)
-	email := ""
-	if claims != nil {
-		if emailClaim, ok := claims["email"].(string); ok {
-			email = emailClaim
-		}
+	// the email is read again so tokens pick up changes to it
+	user, err := h.UserStore.GetUserByID(r.Context(), session.UserID)
+	if errors.Is(err, fs.ErrNotFound) {
+		_ = h.SessionStore.RevokeSession(r.Context(), sessionID)
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		log.Info().Str("userID", session.UserID).Msg("Refresh for deleted user")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", session.UserID).Msg("Failed to get user for refresh")
+		return
 	}
+	log.Info().Str("userID", session.UserID).Str("sessionID", sessionID).Msg("Token refreshed")
+	h.writeTokens(w, r, session.UserID, user, sessionID, refreshToken)
+}
 
-	// If no email in token, look it up
-	if email == "" {
-		user, err := h.UserStore.GetUserByID(r.Context(), userID)
-		if err != nil {
-			http.Error(w, "Failed to get user info", http.StatusInternalServerError)
-			log.Error().Err(err).Str("userID", userID).Msg("Failed to get user for refresh")
-			return
-		}
-		email = user.Email
+func (h *UserHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	principal, err := jwt.GetPrincipal(r)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get session from JWT for logout")
+		return
+	}
+	sessionID := principal.TokenID
+	if err := h.SessionStore.RevokeSession(r.Context(), sessionID); err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		log.Error().Err(err).Str("sessionID", sessionID).Msg("Failed to revoke session")
+		return
 	}
+	h.recordAccountEvent(r, audit.ActionLogout, principal.UserID, audit.OutcomeSuccess, map[string]string{"sessionID": sessionID})
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("sessionID", sessionID).Msg("User logged out")
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"}); err != nil {
+		log.Error().Err(err).Msg("Error writing logout response")
+	}
+}
 
-	token, err := jwt.GenerateJWT(r.Context(), h.Clients, userID, email)
+func (h *UserHandler) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := jwt.GetUserID(r)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		log.Error().Err(err).Str("userID", userID).Msg("Failed to generate JWT for login")
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT for logout")
 		return
 	}
+	revoked, err := h.SessionStore.RevokeUserSessions(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to revoke user sessions")
+		return
+	}
+	h.recordAccountEvent(r, audit.ActionLogoutAll, userID, audit.OutcomeSuccess, nil)
 	w.Header().Set("Content-Type", "application/json")
-	log.Info().Str("userID", userID).Msg("User logged in successfully")
-	if err := json.NewEncoder(w).Encode(map[string]string{"token": token}); err != nil {
-		log.Error().Err(err).Str("userID", userID).Msg("Error writing refresh token response")
+	log.Info().Str("userID", userID).Int("sessions", revoked).Msg("User logged out of all devices")
+	if err := json.NewEncoder(w).Encode(map[string]any{"message": "Logged out of all devices", "sessionsRevoked": revoked}); err != nil {
+		log.Error().Err(err).Msg("Error writing logout response")
+	}
+}
+
+// recordAccountEvent records action on the account of userID in the audit log. The actor is whoever the
+// request was authenticated as; for requests that are not, such as logins, it is userID once the attempt has
+// succeeded and nobody before, as a failed attempt does not prove who made it. details may be nil.
+func (h *UserHandler) recordAccountEvent(r *http.Request, action audit.Action, userID string, outcome audit.Outcome, details map[string]string) {
+	e := audit.Event{
+		Action:       action,
+		ResourceType: audit.ResourceUser,
+		ResourceID:   userID,
+		Outcome:      outcome,
+		Details:      details,
+	}
+	if outcome == audit.OutcomeSuccess {
+		e.ActorID = userID
 	}
+	h.Audit.RecordRequest(r, e)
 }
@@ -2,7 +2,10 @@ package api
 
 import (
 	"regexp"
+	"sync"
 	"unicode"
+
+	"pkg/password"
 )
 
 // Helpers
@@ -30,3 +33,10 @@ func isSecurePassword(password string) bool {
 	}
 	return hasUpper && hasLower && hasNumber && hasSpecial
 }
+
+// dummyPasswordHash is checked against when a login email has no account, or an account without a password, so
+// the response takes as long as checking a real password.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := password.HashPassword("not a real password")
+	return hash
+})
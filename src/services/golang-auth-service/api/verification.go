@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-service/firestore"
+	"pkg/jwt"
+	"pkg/mail"
+
+	"github.com/rs/zerolog/log"
+)
+
+// EmailVerificationConfig sets how verification emails are sent.
+type EmailVerificationConfig struct {
+	TokenTTL time.Duration `env:"EMAIL_VERIFICATION_TOKEN_TTL" yaml:"tokenTTL" default:"24h"`
+	// URL is the frontend page that verifies an email. The token is added as the token query parameter.
+	URL string `env:"EMAIL_VERIFICATION_URL" yaml:"url" default:"http://localhost:5173/verify-email"`
+	// ResendInterval is how long a user must wait before another verification email is sent.
+	ResendInterval time.Duration `env:"EMAIL_VERIFICATION_RESEND_INTERVAL" yaml:"resendInterval" default:"1m"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// sendVerificationInBackground emails userID a verification link without holding up the request.
+func (h *UserHandler) sendVerificationInBackground(r *http.Request, userID, email string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), sendMailTimeout)
+	go func() {
+		defer cancel()
+		if err := h.sendVerification(ctx, userID, email); err != nil {
+			log.Error().Err(err).Str("userID", userID).Msg("Failed to send verification email")
+		}
+	}()
+}
+
+func (h *UserHandler) sendVerification(ctx context.Context, userID, email string) error {
+	token, err := h.VerificationStore.CreateToken(ctx, userID, h.EmailVerification.TokenTTL)
+	if err != nil {
+		return err
+	}
+	link, err := withQuery(h.EmailVerification.URL, "token", token)
+	if err != nil {
+		return fmt.Errorf("invalid EMAIL_VERIFICATION_URL: %w", err)
+	}
+	err = h.Mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Verify your Canary email address",
+		Body: fmt.Sprintf("Welcome to Canary!\n\n"+
+			"To confirm this is your email address, open this link within %s:\n\n%s\n\n"+
+			"If you didn't create a Canary account, you can ignore this email.\n",
+			h.EmailVerification.TokenTTL, link),
+	})
+	if err != nil {
+		return err
+	}
+	log.Info().Str("userID", userID).Msg("Verification email sent")
+	return nil
+}
+
+func (h *UserHandler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Msg("Invalid verify email request")
+		return
+	}
+	userID, err := h.VerificationStore.ConsumeToken(r.Context(), req.Token)
+	if errors.Is(err, firestore.ErrInvalidToken) {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		log.Info().Msg("Invalid email verification token")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to consume email verification token")
+		return
+	}
+	if err := h.UserStore.SetEmailVerified(r.Context(), userID); err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to mark email verified")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("userID", userID).Msg("Email verified")
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"}); err != nil {
+		log.Error().Err(err).Msg("Error writing verify email response")
+	}
+}
+
+func (h *UserHandler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT for verification resend")
+		return
+	}
+	user, err := h.UserStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to get user for verification resend")
+		return
+	}
+	if user.EmailVerified {
+		http.Error(w, "Email already verified", http.StatusConflict)
+		return
+	}
+
+	last, err := h.VerificationStore.LastCreatedAt(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to read previous verification emails")
+		return
+	}
+	if wait := h.EmailVerification.ResendInterval - time.Since(last); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "Verification email sent recently; try again later", http.StatusTooManyRequests)
+		log.Info().Str("userID", userID).Msg("Verification resend rate limited")
+		return
+	}
+
+	if err := h.sendVerification(r.Context(), userID, user.Email); err != nil {
+		http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to send verification email")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"}); err != nil {
+		log.Error().Err(err).Msg("Error writing verification resend response")
+	}
+}
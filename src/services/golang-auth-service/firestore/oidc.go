@@ -0,0 +1,139 @@
+package firestore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	fs "pkg/gcp/firestore"
+)
+
+const oidcLoginCollectionID = "oidcLogins"
+
+// Identity is an account at an OpenID Connect provider, named by the provider's issuer URL and the subject the
+// provider gives the account.
+type Identity struct {
+	Issuer  string `firestore:"issuer" json:"issuer"`
+	Subject string `firestore:"subject" json:"subject"`
+}
+
+// CreateOIDCUser creates a user for someone logging in with identity for the first time. The provider has
+// verified email, and the user has no password until they set one with a password reset.
+// It returns fs.ErrAlreadyExists if another user has the email.
+func (s *UserStore) CreateOIDCUser(ctx context.Context, email string, identity Identity) (string, error) {
+	return s.createWithEmail(ctx, User{
+		Email:         NormaliseEmail(email),
+		EmailVerified: true,
+		Identities:    []Identity{identity},
+	})
+}
+
+// LinkIdentity lets identity log in as userID, whose email the provider has verified. If the user had not
+// verified it themselves their password and two-factor authentication are removed, since whoever set them never
+// showed they own the email, and claimed is true so their sessions can be revoked too.
+func (s *UserStore) LinkIdentity(ctx context.Context, userID string, identity Identity) (claimed bool, err error) {
+	err = s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		doc, err := tx.GetDoc(userID)
+		if err != nil {
+			return err
+		}
+		user, err := decodeUser(doc)
+		if err != nil {
+			return err
+		}
+		var updates []fs.Update
+		if !slices.Contains(user.Identities, identity) {
+			updates = append(updates, fs.Update{Path: "identities", Value: append(user.Identities, identity)})
+		}
+		claimed = !user.EmailVerified
+		if claimed {
+			updates = append(updates, fs.Update{Path: "emailVerified", Value: true}, fs.Update{Path: "password", Value: ""},
+				// an authenticator enrolled by whoever registered the email would lock its owner out
+				fs.Update{Path: "twoFactor", Value: nil})
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.UpdateDoc(userID, updates)
+	})
+	return claimed, err
+}
+
+// OIDCLogin is a login that has been sent to the provider and not yet come back. The PKCE code verifier and
+// nonce stay here, so only this service can redeem the code the provider sends back.
+type OIDCLogin struct {
+	StateHash string    `firestore:"stateHash"`
+	Verifier  string    `firestore:"verifier"`
+	Nonce     string    `firestore:"nonce"`
+	CreatedAt time.Time `firestore:"createdAt"`
+	ExpiresAt time.Time `firestore:"expiresAt"`
+	Used      bool      `firestore:"used"`
+}
+
+type OIDCLoginStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewOIDCLoginStore(client fs.FirestoreClientInterface) *OIDCLoginStore {
+	return &OIDCLoginStore{genericStore: fs.NewGenericStore(client, oidcLoginCollectionID)}
+}
+
+// StartLogin stores a login with verifier and nonce that can be finished until ttl has passed, and returns the
+// state to send to the provider, which it sends back.
+func (s *OIDCLoginStore) StartLogin(ctx context.Context, verifier, nonce string, ttl time.Duration) (string, error) {
+	b := make([]byte, oneTimeTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	loginID, err := s.genericStore.CreateDoc(ctx, OIDCLogin{
+		StateHash: hashTokenSecret(secret),
+		Verifier:  verifier,
+		Nonce:     nonce,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return loginID + "." + secret, nil
+}
+
+// FinishLogin marks the login with state as finished and returns it. It returns ErrInvalidToken if there is no
+// such login, or it has expired or already finished.
+func (s *OIDCLoginStore) FinishLogin(ctx context.Context, state string) (*OIDCLogin, error) {
+	loginID, secret, ok := strings.Cut(state, ".")
+	if !ok || loginID == "" || secret == "" {
+		return nil, ErrInvalidToken
+	}
+	hash := hashTokenSecret(secret)
+
+	var login OIDCLogin
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		doc, err := tx.GetDoc(loginID)
+		if errors.Is(err, fs.ErrNotFound) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&login); err != nil {
+			return err
+		}
+		if login.Used || time.Now().After(login.ExpiresAt) ||
+			subtle.ConstantTimeCompare([]byte(hash), []byte(login.StateHash)) != 1 {
+			return ErrInvalidToken
+		}
+		return tx.UpdateDoc(loginID, []fs.Update{{Path: "used", Value: true}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
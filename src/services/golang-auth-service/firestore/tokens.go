@@ -0,0 +1,164 @@
+package firestore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	fs "pkg/gcp/firestore"
+)
+
+const (
+	passwordResetCollectionID     = "passwordResets"
+	emailVerificationCollectionID = "emailVerifications"
+	oidcLoginCodeCollectionID     = "oidcLoginCodes"
+	oneTimeTokenBytes             = 32
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// OneTimeToken is an outstanding emailed token, such as a password reset link. Only a hash of it is stored.
+type OneTimeToken struct {
+	UserID    string    `firestore:"userID"`
+	TokenHash string    `firestore:"tokenHash"`
+	CreatedAt time.Time `firestore:"createdAt"`
+	ExpiresAt time.Time `firestore:"expiresAt"`
+	Used      bool      `firestore:"used"`
+}
+
+// OneTimeTokenStore issues tokens that expire and can be used once. Each purpose has its own collection, so a
+// token for one cannot be used for another.
+type OneTimeTokenStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewPasswordResetStore(client fs.FirestoreClientInterface) *OneTimeTokenStore {
+	return &OneTimeTokenStore{genericStore: fs.NewGenericStore(client, passwordResetCollectionID)}
+}
+
+func NewEmailVerificationStore(client fs.FirestoreClientInterface) *OneTimeTokenStore {
+	return &OneTimeTokenStore{genericStore: fs.NewGenericStore(client, emailVerificationCollectionID)}
+}
+
+// NewOIDCLoginCodeStore issues the codes the frontend exchanges for tokens once a user has logged in with an
+// OpenID Connect provider.
+func NewOIDCLoginCodeStore(client fs.FirestoreClientInterface) *OneTimeTokenStore {
+	return &OneTimeTokenStore{genericStore: fs.NewGenericStore(client, oidcLoginCodeCollectionID)}
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken returns a token for userID that is valid until ttl has passed or it is used.
+func (s *OneTimeTokenStore) CreateToken(ctx context.Context, userID string, ttl time.Duration) (string, error) {
+	b := make([]byte, oneTimeTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	tokenID, err := s.genericStore.CreateDoc(ctx, OneTimeToken{
+		UserID:    userID,
+		TokenHash: hashTokenSecret(secret),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return tokenID + "." + secret, nil
+}
+
+// ConsumeToken marks token as used and returns the user it belongs to. The user's other outstanding tokens
+// are invalidated too, so older emails stop working once one of them has been used.
+func (s *OneTimeTokenStore) ConsumeToken(ctx context.Context, token string) (string, error) {
+	tokenID, secret, ok := strings.Cut(token, ".")
+	if !ok || tokenID == "" || secret == "" {
+		return "", ErrInvalidToken
+	}
+	hash := hashTokenSecret(secret)
+
+	var stored OneTimeToken
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		doc, err := tx.GetDoc(tokenID)
+		if errors.Is(err, fs.ErrNotFound) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&stored); err != nil {
+			return err
+		}
+		if stored.Used || time.Now().After(stored.ExpiresAt) ||
+			subtle.ConstantTimeCompare([]byte(hash), []byte(stored.TokenHash)) != 1 {
+			return ErrInvalidToken
+		}
+		return tx.UpdateDoc(tokenID, []fs.Update{{Path: "used", Value: true}})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.InvalidateUserTokens(ctx, stored.UserID); err != nil {
+		return "", err
+	}
+	return stored.UserID, nil
+}
+
+// LastCreatedAt returns when the newest token for userID was issued, or the zero time if there is none.
+func (s *OneTimeTokenStore) LastCreatedAt(ctx context.Context, userID string) (time.Time, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "userID", Op: "==", Value: userID},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	for _, doc := range docs {
+		var t OneTimeToken
+		if err := doc.DataTo(&t); err != nil {
+			return time.Time{}, err
+		}
+		if t.CreatedAt.After(last) {
+			last = t.CreatedAt
+		}
+	}
+	return last, nil
+}
+
+// DeleteUserTokens deletes every token issued to userID, used or not.
+func (s *OneTimeTokenStore) DeleteUserTokens(ctx context.Context, userID string) error {
+	err := s.genericStore.DeleteDocsByQuery(ctx, []fs.QueryParameter{
+		{Path: "userID", Op: "==", Value: userID},
+	})
+	if errors.Is(err, fs.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// InvalidateUserTokens marks every outstanding token of userID as used, so emails already sent stop working.
+func (s *OneTimeTokenStore) InvalidateUserTokens(ctx context.Context, userID string) error {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "userID", Op: "==", Value: userID},
+		{Path: "used", Op: "==", Value: false},
+	})
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := s.genericStore.UpdateDoc(ctx, doc.Ref.ID, []fs.Update{{Path: "used", Value: true}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
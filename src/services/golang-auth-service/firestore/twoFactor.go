@@ -0,0 +1,108 @@
+package firestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"auth-service/totp"
+	fs "pkg/gcp/firestore"
+)
+
+var ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not set up")
+
+// TwoFactor is a user's TOTP enrolment. Enabled is set once the user has proven their app works by entering a
+// code from it; until then login is unaffected.
+type TwoFactor struct {
+	Secret  string `firestore:"secret"`
+	Enabled bool   `firestore:"enabled"`
+	// LastStep is the time step of the last code accepted, so a code cannot be replayed
+	LastStep int64 `firestore:"lastStep"`
+	// RecoveryCodes holds hashes of the unused recovery codes
+	RecoveryCodes []string `firestore:"recoveryCodes"`
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case and the dash between its halves.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// StartTwoFactor stores a new, not yet enabled, TOTP secret for userID.
+func (s *UserStore) StartTwoFactor(ctx context.Context, userID, secret string) error {
+	return s.genericStore.UpdateDoc(ctx, userID, []fs.Update{
+		{Path: "twoFactor", Value: TwoFactor{Secret: secret}},
+	})
+}
+
+// EnableTwoFactor turns on two-factor login for userID and replaces their recovery codes.
+func (s *UserStore) EnableTwoFactor(ctx context.Context, userID string, recoveryCodes []string) error {
+	return s.genericStore.UpdateDoc(ctx, userID, []fs.Update{
+		{Path: "twoFactor.enabled", Value: true},
+		{Path: "twoFactor.recoveryCodes", Value: hashRecoveryCodes(recoveryCodes)},
+	})
+}
+
+// ReplaceRecoveryCodes invalidates the recovery codes of userID in favour of new ones.
+func (s *UserStore) ReplaceRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error {
+	return s.genericStore.UpdateDoc(ctx, userID, []fs.Update{
+		{Path: "twoFactor.recoveryCodes", Value: hashRecoveryCodes(recoveryCodes)},
+	})
+}
+
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return hashes
+}
+
+// DisableTwoFactor removes the TOTP secret and recovery codes of userID.
+func (s *UserStore) DisableTwoFactor(ctx context.Context, userID string) error {
+	return s.genericStore.UpdateDoc(ctx, userID, []fs.Update{
+		{Path: "twoFactor", Value: nil},
+	})
+}
+
+// CheckTwoFactorCode reports whether code is a current TOTP code for userID, or, if allowRecovery is set and
+// two-factor login is enabled, one of their unused recovery codes. An accepted code is used up.
+func (s *UserStore) CheckTwoFactorCode(ctx context.Context, userID, code string, allowRecovery bool) (bool, error) {
+	ok := false
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		ok = false
+		doc, err := tx.GetDoc(userID)
+		if err != nil {
+			return err
+		}
+		user, err := decodeUser(doc)
+		if err != nil {
+			return err
+		}
+		tf := user.TwoFactor
+		if tf == nil || tf.Secret == "" {
+			return ErrTwoFactorNotEnrolled
+		}
+
+		if step, valid := totp.Validate(tf.Secret, code, time.Now(), tf.LastStep); valid {
+			ok = true
+			return tx.UpdateDoc(userID, []fs.Update{{Path: "twoFactor.lastStep", Value: step}})
+		}
+		if !allowRecovery || !tf.Enabled {
+			return nil
+		}
+		hash := hashRecoveryCode(code)
+		if i := slices.Index(tf.RecoveryCodes, hash); i >= 0 {
+			ok = true
+			remaining := slices.Delete(slices.Clone(tf.RecoveryCodes), i, i+1)
+			return tx.UpdateDoc(userID, []fs.Update{{Path: "twoFactor.recoveryCodes", Value: remaining}})
+		}
+		return nil
+	})
+	return ok, err
+}
@@ -2,6 +2,7 @@ package firestore
 
 import (
 	"context"
+	"strings"
 
 	fs "pkg/gcp/firestore"
 )
@@ -11,9 +12,28 @@ const (
 )
 
 type User struct {
-	Email    string `firestore:"email" json:"email"`
-	Password string `firestore:"password" json:"password"`
+	Email         string `firestore:"email" json:"email"`
+	Password      string `firestore:"password" json:"password"`
+	EmailVerified bool   `firestore:"emailVerified" json:"emailVerified"`
+	// TwoFactor is nil until the user starts enrolling an authenticator app
+	TwoFactor *TwoFactor `firestore:"twoFactor,omitempty" json:"-"`
+	// Identities are the accounts at OpenID Connect providers that log in as this user
+	Identities []Identity `firestore:"identities,omitempty" json:"-"`
 }
+
+// decodeUser reads a user document. Accounts created before emails were verified have no emailVerified
+// field and are treated as verified, so existing users are not locked out.
+func decodeUser(doc *fs.DocumentSnapshot) (*User, error) {
+	var user User
+	if err := doc.DataTo(&user); err != nil {
+		return nil, err
+	}
+	if _, ok := doc.Data()["emailVerified"]; !ok {
+		user.EmailVerified = true
+	}
+	return &user, nil
+}
+
 type UserStore struct {
 	genericStore *fs.GenericStore
 }
@@ -22,30 +42,72 @@ func NewUserStore(client fs.FirestoreClientInterface) *UserStore {
 	return &UserStore{genericStore: fs.NewGenericStore(client, userCollectionID)}
 }
 
+// NormaliseEmail returns email as it is stored, trimmed and in lower case, so case variants are the same address.
+func NormaliseEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// emailQuery matches the user with email. Accounts created before emails were normalised kept the case they were
+// registered with, so the address as given is matched too.
+func emailQuery(email string) []fs.QueryParameter {
+	normalised, given := NormaliseEmail(email), strings.TrimSpace(email)
+	if normalised == given {
+		return []fs.QueryParameter{{Path: "email", Op: "==", Value: normalised}}
+	}
+	return []fs.QueryParameter{{Path: "email", Op: "in", Value: []string{normalised, given}}}
+}
+
 func (s *UserStore) FindByEmail(ctx context.Context, email string) (*User, string, error) {
-	queryParams := []fs.QueryParameter{
-		{Path: "email", Op: "==", Value: email},
+	doc, err := s.genericStore.GetDocByQuery(ctx, emailQuery(email))
+	if err != nil {
+		return nil, "", err
 	}
+	user, err := decodeUser(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, doc.Ref.ID, nil
+}
 
-	doc, err := s.genericStore.GetDocByQuery(ctx, queryParams)
+// FindByIdentity returns the user that identity logs in as.
+func (s *UserStore) FindByIdentity(ctx context.Context, identity Identity) (*User, string, error) {
+	doc, err := s.genericStore.GetDocByQuery(ctx, []fs.QueryParameter{
+		{Path: "identities", Op: "array-contains", Value: identity},
+	})
 	if err != nil {
 		return nil, "", err
 	}
-	// Convert to User
-	var user User
-	if err := doc.DataTo(&user); err != nil {
+	user, err := decodeUser(doc)
+	if err != nil {
 		return nil, "", err
 	}
-	return &user, doc.Ref.ID, nil
+	return user, doc.Ref.ID, nil
 }
 
+// CreateUser creates a user with email, or returns fs.ErrAlreadyExists if another user has it.
 func (s *UserStore) CreateUser(ctx context.Context, email, hashedPassword string) (string, error) {
-	user := User{
-		Email:    email,
-		Password: hashedPassword,
-	}
+	return s.createWithEmail(ctx, User{Email: NormaliseEmail(email), Password: hashedPassword})
+}
 
-	return s.genericStore.CreateDoc(ctx, user)
+// createWithEmail creates user unless another user has its email. The check and the write are one transaction,
+// so two requests for the same email at once cannot both create a user.
+func (s *UserStore) createWithEmail(ctx context.Context, user User) (string, error) {
+	var userID string
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection(emailQuery(user.Email))
+		if err != nil {
+			return err
+		}
+		if len(docs) > 0 {
+			return fs.ErrAlreadyExists
+		}
+		userID, err = tx.CreateDoc(user)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
 }
 
 func (s *UserStore) GetUserByID(ctx context.Context, userID string) (*User, error) {
@@ -53,19 +115,53 @@ func (s *UserStore) GetUserByID(ctx context.Context, userID string) (*User, erro
 	if err != nil {
 		return nil, err
 	}
+	return decodeUser(doc)
+}
 
-	var user User
-	if err := doc.DataTo(&user); err != nil {
-		return nil, err
-	}
+// SetEmailVerified marks the email of userID as verified.
+func (s *UserStore) SetEmailVerified(ctx context.Context, userID string) error {
+	return s.genericStore.UpdateDoc(ctx, userID, []fs.Update{
+		{Path: "emailVerified", Value: true},
+	})
+}
 
-	return &user, nil
+// UpdatePassword replaces the password hash of userID.
+func (s *UserStore) UpdatePassword(ctx context.Context, userID, hashedPassword string) error {
+	return s.genericStore.UpdateDoc(ctx, userID, []fs.Update{
+		{Path: "password", Value: hashedPassword},
+	})
 }
 
-func (s *UserStore) DeleteUser(ctx context.Context, email string, hashedPassword string) error {
-	queryParams := []fs.QueryParameter{
-		{Path: "email", Op: "==", Value: email},
-		{Path: "password", Op: "==", Value: hashedPassword},
-	}
-	return s.genericStore.DeleteDocByQuery(ctx, queryParams)
+// UpdateEmail changes the email of userID. The new email is unverified until the user follows the link sent to it.
+// It returns fs.ErrAlreadyExists if another user has the email, checked in the same transaction as the change.
+func (s *UserStore) UpdateEmail(ctx context.Context, userID, email string) error {
+	email = NormaliseEmail(email)
+	return s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection(emailQuery(email))
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if doc.Ref.ID != userID {
+				return fs.ErrAlreadyExists
+			}
+		}
+		return tx.UpdateDoc(userID, []fs.Update{
+			{Path: "email", Value: email},
+			{Path: "emailVerified", Value: false},
+		})
+	})
+}
+
+// RestoreEmail puts back the email of userID and whether it was verified, undoing an UpdateEmail.
+func (s *UserStore) RestoreEmail(ctx context.Context, userID, email string, verified bool) error {
+	return s.genericStore.UpdateDoc(ctx, userID, []fs.Update{
+		{Path: "email", Value: email},
+		{Path: "emailVerified", Value: verified},
+	})
+}
+
+// DeleteUser deletes the user document of userID. It is not an error if it is already gone.
+func (s *UserStore) DeleteUser(ctx context.Context, userID string) error {
+	return s.genericStore.DeleteDoc(ctx, userID)
 }
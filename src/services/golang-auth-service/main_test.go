@@ -6,17 +6,31 @@ import (
 	"encoding/json"
 	"math/rand"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"auth-service/api"
 	authFirestore "auth-service/firestore"
+	"auth-service/oidc"
+	"auth-service/oidc/oidctest"
 	"auth-service/run"
+	"auth-service/totp"
+	"pkg/audit"
+	"pkg/config"
 	"pkg/gcp"
+	fs "pkg/gcp/firestore"
 	"pkg/handler"
 	"pkg/jwt"
+	"pkg/mail"
+	"pkg/operation"
+	"pkg/throttle"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -30,31 +44,106 @@ func setupTestServer(ctx context.Context) (*gcp.Clients, *httptest.Server) {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
 	_ = godotenv.Load()
-	opts := gcp.ClientOptions{}
-	opts.LoadClientOptions()
+	// Run against the in-memory document store so the test needs no GCP credentials
+	opts := gcp.ClientOptions{
+		UseFirestore:    true,
+		FirestoreConfig: fs.FireStoreClientConfig{Backend: fs.MemoryBackend},
+	}
 	clients, err := gcp.InitialiseClients(ctx, opts)
 	if err != nil {
 		panic(err)
 	}
+	_ = os.Setenv("JWT_SECRET", "test-secret")
 
-	projectID := os.Getenv("GCP_PROJECT_ID")
-	secretName := os.Getenv("JWT_SECRET_NAME")
-	secret, err := clients.GSM.GetSecret(ctx, projectID, secretName)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to retrieve JWT Secret")
-	}
-	_ = os.Setenv("JWT_SECRET", secret)
+	// the server's URL is needed for the OIDC redirect URL before its routes are set up
+	server := httptest.NewUnstartedServer(nil)
+	serverURL := "http://" + server.Listener.Addr().String()
 
 	r := mux.NewRouter()
 	authMw := jwt.AuthMiddleware(clients)
-	h := handler.NewHandler(ctx, clients, authMw)
-	api.RegisterUserRoutes(r, h)
+	h := handler.NewHandler(ctx, clients, authMw, audit.NewLog(clients.Firestore, "auth-service", audit.Config{}))
+	api.RegisterUserRoutes(r, h, api.Options{
+		Tokens:        jwt.TokenConfig{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour},
+		PasswordReset: api.PasswordResetConfig{TokenTTL: time.Hour, URL: "http://localhost:5173/reset-password", ResendInterval: time.Minute},
+		EmailVerification: api.EmailVerificationConfig{
+			TokenTTL:       time.Hour,
+			URL:            "http://localhost:5173/verify-email",
+			ResendInterval: time.Minute,
+		},
+		Mailer:    sentMail,
+		TwoFactor: api.TwoFactorConfig{Issuer: "Canary", ChallengeTTL: time.Minute},
+		Throttle: throttle.Config{
+			FreeAttempts:    3,
+			BaseDelay:       time.Minute,
+			LockoutAttempts: 5,
+			LockoutDuration: time.Hour,
+			SharedFactor:    100,
+		},
+		Operations:     operation.Config{PollInterval: time.Hour, Lease: time.Minute, MaxAttempts: 1},
+		PersonalTokens: api.PersonalTokenConfig{DefaultTTL: time.Hour, MaxTTL: 24 * time.Hour},
+		OIDC: oidc.Config{
+			DiscoveryURL: mockOIDC.URL,
+			ClientID:     mockOIDC.ClientID,
+			ClientSecret: mockOIDC.ClientSecret,
+			RedirectURL:  serverURL + "/oidc/callback",
+			FrontendURL:  oidcFrontendURL,
+			Scopes:       []string{"openid", "email"},
+			LoginTTL:     time.Minute,
+		},
+	})
 
 	// Wrap router with CORS middleware
-	corsWrapped := run.CorsMiddleware(r)
-	return clients, httptest.NewServer(corsWrapped)
+	server.Config.Handler = run.CorsMiddleware(config.CORS{AllowOrigin: "*"}, r)
+	server.Start()
+	return clients, server
+}
+
+const oidcFrontendURL = "http://frontend.test/oidc/callback"
+
+var mockOIDC = oidctest.NewProvider("canary", "canary-secret")
+
+// mailbox is a mail.Mailer that keeps sent messages for the tests to read
+type mailbox struct {
+	mu   sync.Mutex
+	msgs []mail.Message
 }
 
+func (m *mailbox) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.msgs = append(m.msgs, msg)
+	return nil
+}
+
+// waitFor returns the token from the link in the first email sent to to whose subject contains subject.
+// Emails are sent in the background, so it waits for one to arrive.
+func (m *mailbox) waitFor(t *testing.T, to, subject string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		for i, msg := range m.msgs {
+			if msg.To == to && strings.Contains(msg.Subject, subject) {
+				m.msgs = append(m.msgs[:i], m.msgs[i+1:]...)
+				m.mu.Unlock()
+				start := strings.Index(msg.Body, "http://")
+				if start < 0 {
+					t.Fatalf("no link in email %q", msg.Subject)
+				}
+				link, err := url.Parse(strings.Fields(msg.Body[start:])[0])
+				assert.NoError(t, err)
+				return link.Query().Get("token")
+			}
+		}
+		m.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no %q email sent to %s", subject, to)
+	return ""
+}
+
+var sentMail = &mailbox{}
+
 func randomEmail() string {
 	return "testuser" + strconv.Itoa(rand.Intn(1000000)) + "@example.com"
 }
@@ -71,7 +160,9 @@ func TestRegisterAndLoginFlow(t *testing.T) {
 	defer func() {
 		defer func() { _ = clients.Firestore.Close() }()
 		userStore := authFirestore.NewUserStore(clients.Firestore)
-		_ = userStore.DeleteUser(ctx, email, password)
+		if _, userID, err := userStore.FindByEmail(ctx, email); err == nil {
+			_ = userStore.DeleteUser(ctx, userID)
+		}
 	}()
 
 	// 1. Register user
@@ -109,5 +200,640 @@ func TestRegisterAndLoginFlow(t *testing.T) {
 	})
 	resp, err = http.Post(server.URL+"/login", "application/json", bytes.NewBuffer(loginBodyInvalidEmail))
 	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestLoginThrottling(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	password := "testPassword123!"
+	resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// wrong passwords are allowed until the free attempts run out, then even the right one has to wait
+	for range 3 {
+		resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": "WrongPassword"})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+	resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": "WrongPassword"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	// an email without an account is throttled the same way, so a 429 does not give away which emails exist
+	unknown := randomEmail()
+	for range 4 {
+		resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": unknown, "password": password})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+	resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": unknown, "password": password})
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
+
+func TestLegacyPasswordRehash(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	// a user stored with a bcrypt hash from before passwords were hashed with argon2id
+	email := randomEmail()
+	userStore := authFirestore.NewUserStore(clients.Firestore)
+	userID, err := userStore.CreateUser(ctx, email, "$2a$10$6uB.iNmfaynycpPTiXfpjeZ.8062IeHy2M7NgmWcHN1E1ozzlIfQm")
+	assert.NoError(t, err)
+
+	// a wrong password leaves the old hash alone
+	resp := postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": "WrongPassword"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	user, err := userStore.GetUserByID(ctx, userID)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$2a$"))
+
+	// logging in with the right one replaces it with an argon2id hash, which the next login checks
+	login(t, server.URL, email, "legacyPassword123!")
+	user, err = userStore.GetUserByID(ctx, userID)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$argon2id$"))
+	login(t, server.URL, email, "legacyPassword123!")
+}
+
+func postJSON(t *testing.T, url, token string, body any) *http.Response {
+	return sendJSON(t, http.MethodPost, url, token, body)
+}
+
+func sendJSON(t *testing.T, method, url, token string, body any) *http.Response {
+	payload, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(payload))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	return resp
+}
+
+func login(t *testing.T, serverURL, email, password string) api.TokenResponse {
+	resp := postJSON(t, serverURL+"/login", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var tokens api.TokenResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	return tokens
+}
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	password := "testPassword123!"
+	resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": "WrongPassword"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	tokens := login(t, server.URL, email, password)
+	resp = postJSON(t, server.URL+"/logout", tokens.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	docs, err := fs.NewGenericStore(clients.Firestore, "auditEvents").ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "resourceID", Op: "==", Value: tokens.UserID},
+	}, fs.WithOrderBy("time", fs.Asc))
+	assert.NoError(t, err)
+	var got []string
+	for _, doc := range docs {
+		var e audit.Event
+		assert.NoError(t, doc.DataTo(&e))
+		assert.Equal(t, "auth-service", e.Service)
+		assert.NotEmpty(t, e.IP)
+		// a failed login does not prove who made it
+		if e.Outcome == audit.OutcomeSuccess {
+			assert.Equal(t, tokens.UserID, e.ActorID)
+		} else {
+			assert.Empty(t, e.ActorID)
+		}
+		got = append(got, string(e.Action)+":"+string(e.Outcome))
+	}
+	assert.Equal(t, []string{"user.register:success", "user.login:failure", "user.login:success", "user.logout:success"}, got)
+}
+
+func TestRefreshRotationAndLogout(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	password := "testPassword123!"
+	resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	tokens := login(t, server.URL, email, password)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, int64(60), tokens.ExpiresIn)
+
+	// each refresh token can be exchanged once
+	resp = postJSON(t, server.URL+"/refresh_token", "", map[string]string{"refreshToken": tokens.RefreshToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var rotated api.TokenResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&rotated))
+	assert.NotEqual(t, tokens.RefreshToken, rotated.RefreshToken)
+
+	// reusing the old one revokes the session, so the rotated tokens stop working too
+	resp = postJSON(t, server.URL+"/refresh_token", "", map[string]string{"refreshToken": tokens.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/refresh_token", "", map[string]string{"refreshToken": rotated.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/auth/"+rotated.UserID, rotated.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// logout only ends the current session
+	first := login(t, server.URL, email, password)
+	second := login(t, server.URL, email, password)
+	resp = postJSON(t, server.URL+"/logout", first.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/auth/"+first.UserID, first.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/auth/"+second.UserID, second.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// logging out everywhere ends the rest
+	third := login(t, server.URL, email, password)
+	resp = postJSON(t, server.URL+"/logout/all", second.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	for _, s := range []api.TokenResponse{second, third} {
+		resp = postJSON(t, server.URL+"/auth/"+s.UserID, s.Token, nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		resp = postJSON(t, server.URL+"/refresh_token", "", map[string]string{"refreshToken": s.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	oldPassword := "testPassword123!"
+	newPassword := "newTestPassword456?"
+	resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": oldPassword})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	session := login(t, server.URL, email, oldPassword)
+
+	// unknown emails get the same answer and no email
+	resp = postJSON(t, server.URL+"/password/forgot", "", map[string]string{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/password/forgot", "", map[string]string{"email": email})
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	token := sentMail.waitFor(t, email, "Reset")
+	assert.NotEmpty(t, token)
+
+	// weak passwords are refused without using up the token
+	resp = postJSON(t, server.URL+"/password/reset", "", map[string]string{"token": token, "password": "weak"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/password/reset", "", map[string]string{"token": token, "password": newPassword})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// tokens work once
+	resp = postJSON(t, server.URL+"/password/reset", "", map[string]string{"token": token, "password": "anotherPassword789!"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// existing sessions are logged out and only the new password works
+	resp = postJSON(t, server.URL+"/auth/"+session.UserID, session.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": oldPassword})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	login(t, server.URL, email, newPassword)
+
+	// asking for reset links is throttled per email whether or not it has an account
+	flooded := randomEmail()
+	for range 4 {
+		resp = postJSON(t, server.URL+"/password/forgot", "", map[string]string{"email": flooded})
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+	resp = postJSON(t, server.URL+"/password/forgot", "", map[string]string{"email": flooded})
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+}
+
+func TestEmailVerification(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	password := "testPassword123!"
+	resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	token := sentMail.waitFor(t, email, "Verify")
+
+	tokens := login(t, server.URL, email, password)
+	assert.False(t, tokens.EmailVerified)
+
+	// a new email cannot be requested straight away
+	resp = postJSON(t, server.URL+"/email/verify/resend", tokens.Token, nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	resp = postJSON(t, server.URL+"/email/verify", "", map[string]string{"token": token})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/email/verify", "", map[string]string{"token": token})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// the next access token says the email is verified
+	resp = postJSON(t, server.URL+"/refresh_token", "", map[string]string{"refreshToken": tokens.RefreshToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var refreshed api.TokenResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&refreshed))
+	assert.True(t, refreshed.EmailVerified)
+	resp = postJSON(t, server.URL+"/email/verify/resend", refreshed.Token, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	password := "testPassword123!"
+	resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	tokens := login(t, server.URL, email, password)
+
+	// enrolling does not change login until a code from the app is entered
+	resp = postJSON(t, server.URL+"/2fa/enroll", tokens.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var enrolment api.TwoFactorEnrollResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&enrolment))
+	assert.Contains(t, enrolment.URI, "otpauth://totp/Canary:")
+	login(t, server.URL, email, password)
+
+	resp = postJSON(t, server.URL+"/2fa/enable", tokens.Token, map[string]string{"code": "000000"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	step := totp.Step(time.Now())
+	code, err := totp.Code(enrolment.Secret, step)
+	assert.NoError(t, err)
+	resp = postJSON(t, server.URL+"/2fa/enable", tokens.Token, map[string]string{"code": code})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var recovery api.RecoveryCodesResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&recovery))
+	assert.Len(t, recovery.RecoveryCodes, 10)
+
+	// the password now only gets a challenge, which is not an access token
+	challenge := func() string {
+		resp := postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": password})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var c api.TwoFactorChallengeResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&c))
+		assert.True(t, c.TwoFactorRequired)
+		return c.ChallengeToken
+	}
+	challengeToken := challenge()
+	resp = postJSON(t, server.URL+"/logout", challengeToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// a code cannot be used twice
+	resp = postJSON(t, server.URL+"/login/2fa", "", map[string]string{"challengeToken": challengeToken, "code": code})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	next, err := totp.Code(enrolment.Secret, step+1)
+	assert.NoError(t, err)
+	resp = postJSON(t, server.URL+"/login/2fa", "", map[string]string{"challengeToken": challengeToken, "code": next})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var loggedIn api.TokenResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&loggedIn))
+	assert.NotEmpty(t, loggedIn.Token)
+
+	// recovery codes work once each, with or without the dash
+	recoveryCode := strings.ToUpper(strings.ReplaceAll(recovery.RecoveryCodes[0], "-", ""))
+	resp = postJSON(t, server.URL+"/login/2fa", "", map[string]string{"challengeToken": challenge(), "code": recoveryCode})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/login/2fa", "", map[string]string{"challengeToken": challenge(), "code": recoveryCode})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = postJSON(t, server.URL+"/2fa/disable", loggedIn.Token, map[string]string{"code": recovery.RecoveryCodes[1]})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	login(t, server.URL, email, password)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	password := "testPassword123!"
+	resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	tokens := login(t, server.URL, email, password)
+
+	// deleting needs a logged in caller and their password
+	resp = sendJSON(t, http.MethodDelete, server.URL+"/user", "", api.DeleteRequest{Password: password})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = sendJSON(t, http.MethodDelete, server.URL+"/user", tokens.Token, api.DeleteRequest{Password: "WrongPassword1!"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = sendJSON(t, http.MethodDelete, server.URL+"/user", tokens.Token, api.DeleteRequest{Password: password})
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var op operation.Operation
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&op))
+	assert.NotEmpty(t, op.ID)
+	assert.Equal(t, operation.DeleteAccount, op.Type)
+
+	// the auth service deletes the account in the background; the other services own the remaining steps
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(server.URL + "/operations/" + op.ID)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			return false
+		}
+		var got operation.Operation
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			return false
+		}
+		return got.Steps[operation.DeleteAccountStepAccount].Status == operation.StatusSucceeded
+	}, 5*time.Second, 20*time.Millisecond)
+
+	_, _, err := authFirestore.NewUserStore(clients.Firestore).FindByEmail(ctx, email)
+	assert.ErrorIs(t, err, fs.ErrNotFound)
+	resp = postJSON(t, server.URL+"/refresh_token", "", api.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/operations/unknown")
+	assert.NoError(t, err)
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
+
+func TestChangePasswordAndEmail(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	password := "testPassword123!"
+	resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	oldVerifyToken := sentMail.waitFor(t, email, "Verify")
+	here := login(t, server.URL, email, password)
+	elsewhere := login(t, server.URL, email, password)
+
+	// the current password is needed, and the new one must be secure
+	newPassword := "newPassword456!"
+	resp = postJSON(t, server.URL+"/password/change", here.Token, api.ChangePasswordRequest{CurrentPassword: "WrongPassword1!", NewPassword: newPassword})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/password/change", here.Token, api.ChangePasswordRequest{CurrentPassword: password, NewPassword: "weak"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/password/change", here.Token, api.ChangePasswordRequest{CurrentPassword: password, NewPassword: newPassword})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// only the session that made the change stays logged in
+	resp = postJSON(t, server.URL+"/refresh_token", "", api.RefreshRequest{RefreshToken: elsewhere.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/refresh_token", "", api.RefreshRequest{RefreshToken: here.RefreshToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	here = login(t, server.URL, email, newPassword)
+
+	taken := randomEmail()
+	resp = postJSON(t, server.URL+"/register", "", map[string]string{"email": taken, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/email/change", here.Token, api.ChangeEmailRequest{CurrentPassword: newPassword, NewEmail: taken})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	// emails differing only in case are the same address
+	resp = postJSON(t, server.URL+"/email/change", here.Token, api.ChangeEmailRequest{CurrentPassword: newPassword, NewEmail: strings.ToUpper(taken)})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/email/change", here.Token, api.ChangeEmailRequest{CurrentPassword: newPassword, NewEmail: " " + strings.ToUpper(email)})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/register", "", map[string]string{"email": strings.ToUpper(taken), "password": password})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/email/change", here.Token, api.ChangeEmailRequest{CurrentPassword: password, NewEmail: randomEmail()})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	newEmail := randomEmail()
+	resp = postJSON(t, server.URL+"/email/change", here.Token, api.ChangeEmailRequest{CurrentPassword: newPassword, NewEmail: newEmail})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the account moves to the new email, which has to be verified with the link sent to it
+	resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": newPassword})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	tokens := login(t, server.URL, newEmail, newPassword)
+	assert.False(t, tokens.EmailVerified)
+	resp = postJSON(t, server.URL+"/email/verify", "", map[string]string{"token": oldVerifyToken})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/email/verify", "", map[string]string{"token": sentMail.waitFor(t, newEmail, "Verify")})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the other services are asked to update their copies of the email
+	docs, err := fs.NewGenericStore(clients.Firestore, "operations").ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "type", Op: "==", Value: operation.ChangeEmail},
+		{Path: "params.email", Op: "==", Value: newEmail},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, docs, 1)
+}
+
+func TestPersonalTokens(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	password := "testPassword123!"
+	resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	verifyToken := sentMail.waitFor(t, email, "Verify")
+
+	// only verified users can create tokens
+	tokens := login(t, server.URL, email, password)
+	create := api.CreatePersonalTokenRequest{Name: "nightly export", Scopes: []string{"export"}}
+	resp = postJSON(t, server.URL+"/tokens", tokens.Token, create)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/email/verify", "", map[string]string{"token": verifyToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	tokens = login(t, server.URL, email, password)
+
+	resp = postJSON(t, server.URL+"/tokens", tokens.Token, api.CreatePersonalTokenRequest{Name: "bad", Scopes: []string{"admin"}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/tokens", tokens.Token, api.CreatePersonalTokenRequest{Name: "long", Scopes: []string{"read"}, ExpiresInDays: 2})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/tokens", tokens.Token, create)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created api.CreatePersonalTokenResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	assert.True(t, strings.HasPrefix(created.Token, jwt.PersonalTokenPrefix))
+	assert.Equal(t, []string{"export"}, created.Scopes)
+
+	// a personal token cannot manage tokens or the account
+	resp = sendJSON(t, http.MethodGet, server.URL+"/tokens", created.Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = sendJSON(t, http.MethodGet, server.URL+"/tokens", tokens.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var listed struct {
+		Tokens []jwt.PersonalToken `json:"tokens"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&listed))
+	assert.Len(t, listed.Tokens, 1)
+	assert.Equal(t, created.ID, listed.Tokens[0].ID)
+
+	resp = sendJSON(t, http.MethodDelete, server.URL+"/tokens/"+created.ID, tokens.Token, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = sendJSON(t, http.MethodDelete, server.URL+"/tokens/"+created.ID, tokens.Token, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// oidcLogin logs in through the mock provider as user, as a browser would, and returns where the frontend was
+// sent at the end.
+func oidcLogin(t *testing.T, serverURL string, user oidctest.User) url.Values {
+	t.Helper()
+	mockOIDC.SetUser(user)
+	jar, err := cookiejar.New(nil)
+	assert.NoError(t, err)
+	browser := &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if strings.HasPrefix(req.URL.String(), oidcFrontendURL) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}}
+	resp, err := browser.Get(serverURL + "/oidc/login")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	return location.Query()
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	exchange := func(loginCode string) api.TokenResponse {
+		resp := postJSON(t, server.URL+"/oidc/token", "", api.OIDCTokenRequest{LoginCode: loginCode})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var tokens api.TokenResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+		return tokens
+	}
+
+	// a new user is created the first time, and the same user is logged in after
+	newUser := oidctest.User{Subject: "sub-" + strconv.Itoa(rand.Intn(1000000)), Email: randomEmail(), EmailVerified: true}
+	first := exchange(oidcLogin(t, server.URL, newUser).Get("loginCode"))
+	assert.True(t, first.EmailVerified)
+	loginCode := oidcLogin(t, server.URL, newUser).Get("loginCode")
+	assert.Equal(t, first.UserID, exchange(loginCode).UserID)
+	// login codes work once
+	resp := postJSON(t, server.URL+"/oidc/token", "", api.OIDCTokenRequest{LoginCode: loginCode})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// an identity is linked to the existing user with its email, whose unverified password stops working
+	email := randomEmail()
+	password := "testPassword123!"
+	resp = postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	registered := login(t, server.URL, email, password)
+	linked := exchange(oidcLogin(t, server.URL, oidctest.User{Subject: "sub-linked", Email: email, EmailVerified: true}).Get("loginCode"))
+	assert.Equal(t, registered.UserID, linked.UserID)
+	resp = postJSON(t, server.URL+"/login", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/refresh_token", "", api.RefreshRequest{RefreshToken: registered.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// two-factor authentication enabled by whoever registered the email first does not lock its owner out
+	email = randomEmail()
+	resp = postJSON(t, server.URL+"/register", "", map[string]string{"email": email, "password": password})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	squatter := login(t, server.URL, email, password)
+	resp = postJSON(t, server.URL+"/2fa/enroll", squatter.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var enrolment api.TwoFactorEnrollResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&enrolment))
+	code, err := totp.Code(enrolment.Secret, totp.Step(time.Now()))
+	assert.NoError(t, err)
+	resp = postJSON(t, server.URL+"/2fa/enable", squatter.Token, map[string]string{"code": code})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	owner := exchange(oidcLogin(t, server.URL, oidctest.User{Subject: "sub-squatted", Email: email, EmailVerified: true}).Get("loginCode"))
+	assert.Equal(t, squatter.UserID, owner.UserID)
+	assert.NotEmpty(t, owner.Token)
+	user, err := authFirestore.NewUserStore(clients.Firestore).GetUserByID(ctx, owner.UserID)
+	assert.NoError(t, err)
+	assert.Nil(t, user.TwoFactor)
+
+	// an email the provider has not verified is not trusted
+	result := oidcLogin(t, server.URL, oidctest.User{Subject: "sub-unverified", Email: randomEmail()})
+	assert.Equal(t, "email_unverified", result.Get("error"))
+	assert.Empty(t, result.Get("loginCode"))
+
+	// the callback only finishes logins started in the same browser
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = noRedirects.Get(server.URL + "/oidc/callback?code=stolen&state=stolen")
+	assert.NoError(t, err)
+	assert.Equal(t, oidcFrontendURL+"?error=expired", resp.Header.Get("Location"))
+
+	// a user without a password confirms account changes with a recent login instead
+	sessions := fs.NewGenericStore(clients.Firestore, "authSessions")
+	docs, err := sessions.ReadCollection(ctx, []fs.QueryParameter{{Path: "userID", Op: "==", Value: first.UserID}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, docs)
+	for _, doc := range docs {
+		assert.NoError(t, sessions.UpdateDoc(ctx, doc.Ref.ID, []fs.Update{{Path: "createdAt", Value: time.Now().Add(-time.Hour)}}))
+	}
+	resp = postJSON(t, server.URL+"/email/change", first.Token, api.ChangeEmailRequest{NewEmail: randomEmail()})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendJSON(t, http.MethodDelete, server.URL+"/user", first.Token, api.DeleteRequest{})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	again := exchange(oidcLogin(t, server.URL, newUser).Get("loginCode"))
+	resp = sendJSON(t, http.MethodDelete, server.URL+"/user", again.Token, api.DeleteRequest{})
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
+
+func TestConcurrentRegisterCreatesOneUser(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	email := randomEmail()
+	const requests = 5
+	created := make(chan bool, requests)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every other request uses another case of the same address
+			address := email
+			if i%2 == 1 {
+				address = strings.ToUpper(email)
+			}
+			resp := postJSON(t, server.URL+"/register", "", map[string]string{"email": address, "password": "testPassword123!"})
+			created <- resp.StatusCode == http.StatusCreated
+		}()
+	}
+	wg.Wait()
+	close(created)
+	n := 0
+	for ok := range created {
+		if ok {
+			n++
+		}
+	}
+	assert.Equal(t, 1, n)
+}
@@ -0,0 +1,214 @@
+// Package oidc logs users in with an OpenID Connect provider, using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/jwt"
+
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DiscoveryPath is where a provider publishes its configuration, under its issuer URL.
+	DiscoveryPath     = "/.well-known/openid-configuration"
+	fetchTimeout      = 10 * time.Second
+	maxDiscoveryBytes = 1 << 20
+	// clockSkew is how far the provider's clock may be from ours when checking an ID token's times
+	clockSkew  = time.Minute
+	nonceBytes = 32
+)
+
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Config sets up logging in with an OpenID Connect provider. It is off unless DiscoveryURL is set.
+type Config struct {
+	// DiscoveryURL is the provider's issuer URL, or the URL of its discovery document under it
+	DiscoveryURL string `env:"OIDC_DISCOVERY_URL" yaml:"discoveryURL"`
+	ClientID     string `env:"OIDC_CLIENT_ID" yaml:"clientID"`
+	ClientSecret string `env:"OIDC_CLIENT_SECRET" yaml:"clientSecret" secret:"true"`
+	// RedirectURL is this service's /oidc/callback as the provider reaches it, and must be registered with it
+	RedirectURL string `env:"OIDC_REDIRECT_URL" yaml:"redirectURL" default:"http://localhost:3003/oidc/callback"`
+	// FrontendURL is the page the browser is sent to once the provider is done. A login code to exchange at
+	// /oidc/token is added as the loginCode query parameter, or the reason it failed as error.
+	FrontendURL string   `env:"OIDC_FRONTEND_URL" yaml:"frontendURL" default:"http://localhost:5173/oidc/callback"`
+	Scopes      []string `env:"OIDC_SCOPES" yaml:"scopes" default:"openid,email,profile"`
+	// LoginTTL is how long a user has to log in at the provider
+	LoginTTL time.Duration `env:"OIDC_LOGIN_TTL" yaml:"loginTTL" default:"10m"`
+}
+
+// Enabled reports whether a provider is configured.
+func (c *Config) Enabled() bool {
+	return c.DiscoveryURL != ""
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.ClientID == "" || c.RedirectURL == "" || c.FrontendURL == "" {
+		return errors.New("OIDC_CLIENT_ID, OIDC_REDIRECT_URL and OIDC_FRONTEND_URL are required with OIDC_DISCOVERY_URL")
+	}
+	if !slices.Contains(c.Scopes, "openid") {
+		return errors.New("OIDC_SCOPES must include openid")
+	}
+	if c.LoginTTL <= 0 {
+		return errors.New("OIDC_LOGIN_TTL must be positive")
+	}
+	return nil
+}
+
+// Claims are the parts of an ID token that are used to find or create the user.
+type Claims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Nonce         string `json:"nonce"`
+	// AuthorizedParty is the client the token was issued to, when it has more than one audience
+	AuthorizedParty string `json:"azp,omitempty"`
+	jwtlib.RegisteredClaims
+}
+
+// discovery is the part of the provider's discovery document that is used.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider. Its discovery document is fetched on first use, so the auth service
+// starts even while the provider is unreachable, and its signing keys are cached like the auth service's own.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      *jwt.JWKSCache
+}
+
+func NewProvider(cfg Config) *Provider {
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: fetchTimeout}}
+}
+
+// GenerateVerifier returns a new PKCE code verifier.
+func GenerateVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// GenerateNonce returns a new nonce to bind an ID token to the login that asked for it.
+func GenerateNonce() (string, error) {
+	b := make([]byte, nonceBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// discover returns the provider's discovery document, fetching it if it has not been yet.
+func (p *Provider) discover(ctx context.Context) (*discovery, *jwt.JWKSCache, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, p.keys, nil
+	}
+
+	issuer := strings.TrimSuffix(strings.TrimSuffix(p.cfg.DiscoveryURL, DiscoveryPath), "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+DiscoveryPath, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to fetch OIDC discovery document: %s", resp.Status)
+	}
+	var d discovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDiscoveryBytes)).Decode(&d); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode OIDC discovery document: %w", err)
+	}
+	// the issuer has to be the URL the document was found under, so another provider cannot stand in for it
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, nil, fmt.Errorf("OIDC discovery document is for issuer %q, not %q", d.Issuer, issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, nil, errors.New("OIDC discovery document is missing an endpoint")
+	}
+	p.discovery = &d
+	p.keys = jwt.NewJWKSCache(d.JWKSURI, 0)
+	return p.discovery, p.keys, nil
+}
+
+func (p *Provider) oauth2Config(d *discovery) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint:     oauth2.Endpoint{AuthURL: d.AuthorizationEndpoint, TokenURL: d.TokenEndpoint},
+	}
+}
+
+// AuthCodeURL returns the provider's login page for a login with state, nonce and the PKCE code verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2Config(d).AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+// Exchange redeems the code the provider sent back for an ID token and returns its verified claims. The ID token
+// must be signed by the provider, be for this client and carry nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	d, keys, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.oauth2Config(d).Exchange(context.WithValue(ctx, oauth2.HTTPClient, p.client), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange OIDC code: %w", err)
+	}
+	raw, _ := token.Extra("id_token").(string)
+	if raw == "" {
+		return nil, fmt.Errorf("%w: the token response has none", ErrInvalidIDToken)
+	}
+
+	var claims Claims
+	err = keys.Verify(ctx, raw, &claims,
+		jwtlib.WithIssuer(d.Issuer),
+		jwtlib.WithAudience(p.cfg.ClientID),
+		jwtlib.WithExpirationRequired(),
+		jwtlib.WithIssuedAt(),
+		jwtlib.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: issued to %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	}
+	return &claims, nil
+}
@@ -0,0 +1,34 @@
+package run
+
+import (
+	"auth-service/api"
+	"auth-service/oidc"
+	"pkg/audit"
+	"pkg/config"
+	"pkg/gcp"
+	"pkg/gcp/secrets"
+	"pkg/jwt"
+	"pkg/mail"
+	"pkg/operation"
+	"pkg/throttle"
+)
+
+// Config is everything the auth service reads at startup. See pkg/config for how it is loaded.
+type Config struct {
+	Server   config.Server     `yaml:"server"`
+	Clients  gcp.ClientOptions `yaml:"clients"`
+	Secrets  secrets.Config    `yaml:"secrets"`
+	JWT      jwt.KeyConfig     `yaml:"jwt"`
+	Tokens   jwt.TokenConfig   `yaml:"tokens"`
+	Mail     mail.Config       `yaml:"mail"`
+	Throttle throttle.Config   `yaml:"throttle"`
+	Audit    audit.Config      `yaml:"audit"`
+	// Operations sets how the account deletion step run by this service is picked up and retried
+	Operations operation.Config `yaml:"operations"`
+
+	PasswordReset     api.PasswordResetConfig     `yaml:"passwordReset"`
+	EmailVerification api.EmailVerificationConfig `yaml:"emailVerification"`
+	TwoFactor         api.TwoFactorConfig         `yaml:"twoFactor"`
+	PersonalTokens    api.PersonalTokenConfig     `yaml:"personalTokens"`
+	OIDC              oidc.Config                 `yaml:"oidc"`
+}
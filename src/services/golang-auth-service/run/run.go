@@ -9,26 +9,25 @@ import (
 	"syscall"
 	"time"
 
+	"pkg/audit"
+	"pkg/config"
 	"pkg/gcp"
+	"pkg/gcp/secrets"
 	"pkg/handler"
 	"pkg/jwt"
+	"pkg/mail"
 
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-func CorsMiddleware(next http.Handler) http.Handler {
+func CorsMiddleware(cfg config.CORS, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		allowedOrigin := os.Getenv("CORS_ALLOW_ORIGIN")
-		if allowedOrigin == "" {
-			allowedOrigin = "*" // fallback for dev
-		}
-		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-		w.Header().Set("Access-Control-Allow-Methods", os.Getenv("CORS_ALLOW_METHODS"))
-		w.Header().Set("Access-Control-Allow-Headers", os.Getenv("CORS_ALLOW_HEADERS"))
-		w.Header().Set("Access-Control-Allow-Credentials", os.Getenv("CORS_ALLOW_CREDENTIALS"))
+		w.Header().Set("Access-Control-Allow-Origin", cfg.AllowOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", cfg.AllowMethods)
+		w.Header().Set("Access-Control-Allow-Headers", cfg.AllowHeaders)
+		w.Header().Set("Access-Control-Allow-Credentials", cfg.AllowCredentials)
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -43,25 +42,33 @@ func Run() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
-	_ = godotenv.Load()
-	port := os.Getenv("PORT")
 
-	opts := gcp.ClientOptions{}
-	opts.LoadClientOptions()
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	config.Log(&cfg)
+	port := cfg.Server.Port
 
-	clients, err := gcp.InitialiseClients(ctx, opts)
+	clients, err := gcp.InitialiseClients(ctx, cfg.Clients)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize clients")
 	}
 	defer func() { _ = clients.CloseClients() }()
 
-	projectID := os.Getenv("GCP_PROJECT_ID")
-	secretName := os.Getenv("JWT_SECRET_NAME")
-	secret, err := clients.GSM.GetSecret(ctx, projectID, secretName)
+	// Load the JWT signing keys from the configured secrets provider; they are refreshed in the background
+	provider, err := secrets.NewProvider(cfg.Secrets, clients.GSM)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to retrieve JWT Secret")
+		log.Fatal().Err(err).Msg("Failed to initialize secrets provider")
+	}
+	if err := jwt.InitialiseKeys(ctx, provider, cfg.JWT); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load JWT keys")
+	}
+
+	mailer, err := mail.NewMailer(cfg.Mail)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize mailer")
 	}
-	_ = os.Setenv("JWT_SECRET", secret)
 
 	r := mux.NewRouter()
 
@@ -73,9 +80,22 @@ func Run() {
 		}
 	}).Methods("GET")
 
-	h := handler.NewHandler(ctx, clients, authMw)
-	api.RegisterUserRoutes(r, h)
-	corsWrapped := CorsMiddleware(r)
+	// Public keys for the other services to verify tokens with; see JWT_JWKS_URL
+	r.HandleFunc(jwt.JWKSPath, jwt.JWKSHandler).Methods("GET")
+
+	h := handler.NewHandler(ctx, clients, authMw, audit.NewLog(clients.Firestore, "auth-service", cfg.Audit))
+	api.RegisterUserRoutes(r, h, api.Options{
+		Tokens:            cfg.Tokens,
+		PasswordReset:     cfg.PasswordReset,
+		EmailVerification: cfg.EmailVerification,
+		Mailer:            mailer,
+		TwoFactor:         cfg.TwoFactor,
+		PersonalTokens:    cfg.PersonalTokens,
+		OIDC:              cfg.OIDC,
+		Throttle:          cfg.Throttle,
+		Operations:        cfg.Operations,
+	})
+	corsWrapped := CorsMiddleware(cfg.Server.CORS, r)
 
 	server := &http.Server{
 		Addr:    ":" + port,
@@ -0,0 +1,45 @@
+package totp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the SHA-1 test vectors of RFC 6238 appendix B, truncated to 6 digits
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+
+func TestCode(t *testing.T) {
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		got, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, "time %d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step, ok := Validate(rfcSecret, "005924", now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	// the previous step's code is still accepted, but no code is accepted once it or a later one has been used
+	prev, _ := Code(rfcSecret, Step(now)-1)
+	_, ok = Validate(rfcSecret, prev, now, 0)
+	assert.True(t, ok)
+	_, ok = Validate(rfcSecret, prev, now, step)
+	assert.False(t, ok)
+	_, ok = Validate(rfcSecret, "005924", now, step)
+	assert.False(t, ok)
+
+	_, ok = Validate(rfcSecret, "005925", now, 0)
+	assert.False(t, ok)
+	_, ok = Validate(rfcSecret, "005924", now.Add(2*time.Minute), 0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	fs "pkg/gcp/firestore"
+	"pkg/handler"
+	"pkg/operation"
+	"pkg/roles"
+	"project-service/firestore"
+
+	"github.com/rs/zerolog/log"
+)
+
+// StartAccountDeletion runs the project service's step of deleting an account in the background: it deletes
+// every project the user owns, with everything in it, and takes them out of the projects shared with them and
+// their organisations.
+func StartAccountDeletion(h *handler.Handler, cfg operation.Config, buckets Buckets) *operation.Worker {
+	ph := newProjectHandler(h, buckets)
+	worker := operation.NewWorker(h.Clients.Firestore, operation.DeleteAccount, operation.DeleteAccountStepProjects, ph.deleteUserProjects, cfg)
+	worker.Start(h.Ctx)
+	return worker
+}
+
+func (h *ProjectHandler) deleteUserProjects(ctx context.Context, op *operation.Operation) error {
+	userID := op.Subject
+	projects, err := h.ProjectStore.GetProjectsByUserID(ctx, userID, nil)
+	if err != nil {
+		return fmt.Errorf("list projects: %w", err)
+	}
+	for _, p := range projects {
+		if err := h.deleteProject(ctx, p.ProjectID); err != nil {
+			return fmt.Errorf("project %s: %w", p.ProjectID, err)
+		}
+	}
+	if err := h.MemberStore.DeleteMembershipsByUserID(ctx, userID); err != nil {
+		return fmt.Errorf("remove memberships: %w", err)
+	}
+	if err := h.leaveOrganisations(ctx, userID); err != nil {
+		return fmt.Errorf("leave organisations: %w", err)
+	}
+	log.Info().Str("userID", userID).Str("operationID", op.ID).Int("projects", len(projects)).Msg("Deleted projects of deleted user")
+	return nil
+}
+
+// leaveOrganisations takes userID out of every organisation they belong to. The ones they are the last owner of
+// are handed over first, so their projects are not stranded.
+func (h *ProjectHandler) leaveOrganisations(ctx context.Context, userID string) error {
+	memberships, err := h.OrgMemberStore.GetMembershipsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, m := range memberships {
+		err := h.OrgMemberStore.RemoveMember(ctx, m.OrgID, userID)
+		if errors.Is(err, firestore.ErrLastOwner) {
+			err = h.handOverOrganisation(ctx, m.OrgID, userID)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotFound) {
+			return fmt.Errorf("organisation %s: %w", m.OrgID, err)
+		}
+	}
+	return nil
+}
+
+// handOverOrganisation makes the longest standing of the highest ranked other members of orgID its owner in
+// place of userID, its last owner. An organisation with nobody else in it is deleted with its projects.
+func (h *ProjectHandler) handOverOrganisation(ctx context.Context, orgID, userID string) error {
+	members, err := h.OrgMemberStore.GetMembersByOrgID(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	var successor *firestore.OrgMember
+	for i, m := range members {
+		if m.UserID == userID {
+			continue
+		}
+		if successor == nil || m.Role.Outranks(successor.Role) || (m.Role == successor.Role && m.AddedAt.Before(successor.AddedAt)) {
+			successor = &members[i]
+		}
+	}
+	if successor == nil {
+		log.Info().Str("orgID", orgID).Str("userID", userID).Msg("Deleting organisation left without members")
+		return h.deleteOrganisation(ctx, orgID)
+	}
+	if err := h.OrgMemberStore.UpdateRole(ctx, orgID, successor.UserID, roles.Owner); err != nil {
+		return err
+	}
+	log.Info().Str("orgID", orgID).Str("userID", userID).Str("newOwner", successor.UserID).Msg("Handed over organisation of deleted user")
+	return h.OrgMemberStore.RemoveMember(ctx, orgID, userID)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pkg/audit"
+	fs "pkg/gcp/firestore"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidTimeRange = errors.New("from and to must be RFC 3339 times, such as 2025-01-31T09:00:00Z, with from before to")
+
+// parseAuditFilter reads the optional actorID, from and to query parameters of the audit log of projectID.
+func parseAuditFilter(r *http.Request, projectID string) (audit.Filter, error) {
+	query := r.URL.Query()
+	f := audit.Filter{ProjectID: projectID, ActorID: query.Get("actorID")}
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		raw := query.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return audit.Filter{}, ErrInvalidTimeRange
+		}
+		*bound.t = t
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && f.To.Before(f.From) {
+		return audit.Filter{}, ErrInvalidTimeRange
+	}
+	return f, nil
+}
+
+// ListAuditEventsHandler returns a page of the audit log of a project, newest first: who changed or exported it
+// and its batches and members, and when. Only the owner can read it. The events can be narrowed to one user with
+// actorID and to a time range with from and to.
+func (h *ProjectHandler) ListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["projectID"]
+
+	f, err := parseAuditFilter(r, projectID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Invalid audit log filter")
+		return
+	}
+	pageSize, pageToken, _, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Invalid pagination parameters")
+		return
+	}
+	// the log of a busy project is too long to return whole, so it is always paged
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+
+	events, nextPageToken, err := h.Audit.Query(r.Context(), f, pageSize, pageToken)
+	if errors.Is(err, fs.ErrInvalidPageToken) {
+		http.Error(w, "Invalid pageToken", http.StatusBadRequest)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Invalid page token")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error getting audit log", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to query audit log")
+		return
+	}
+
+	if nextPageToken != "" {
+		w.Header().Set(NextPageTokenHeader, nextPageToken)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("projectID", projectID).Int("events", len(events)).Msg("Successfully returned audit log")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to encode audit log response")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"pkg/audit"
+	fs "pkg/gcp/firestore"
 	"pkg/handler"
 	"project-service/firestore"
 
@@ -18,16 +20,16 @@ type BatchHandler struct {
 	Buckets
 }
 
-func newBatchHandler(h *handler.Handler) *BatchHandler {
+func newBatchHandler(h *handler.Handler, buckets Buckets) *BatchHandler {
 	return &BatchHandler{
 		Handler: h,
 		Stores:  InitialiseStores(h),
-		Buckets: InitialiseBuckets(h),
+		Buckets: buckets,
 	}
 }
 
-func RegisterBatchRoutes(r *mux.Router, h *handler.Handler) {
-	bh := newBatchHandler(h)
+func RegisterBatchRoutes(r *mux.Router, h *handler.Handler, buckets Buckets) {
+	bh := newBatchHandler(h, buckets)
 
 	routes := []Route{
 		// Create a batch
@@ -47,7 +49,7 @@ func RegisterBatchRoutes(r *mux.Router, h *handler.Handler) {
 	}
 
 	for _, rt := range routes {
-		wrapped := h.AuthMw(ValidateOwnershipMiddleware(http.HandlerFunc(rt.handlerFunc), bh.Stores))
+		wrapped := h.AuthMw(RequireProjectRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), bh.Stores))
 		r.Handle(rt.pattern, wrapped).Methods(rt.method)
 	}
 }
@@ -69,6 +71,7 @@ func (h *BatchHandler) UpdateBatchHandler(w http.ResponseWriter, r *http.Request
 		log.Error().Err(err).Str("batchID", batchID).Msg("Error updating batch")
 		return
 	}
+	h.Audit.RecordRequest(r, projectEvent(audit.ActionUpdateBatch, requestProjectID(r), audit.ResourceBatch, batchID))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -104,7 +107,25 @@ func (h *BatchHandler) LoadBatchesInfoHandler(w http.ResponseWriter, r *http.Req
 	vars := mux.Vars(r)
 	projectID := vars["projectID"]
 
-	batches, err := h.BatchStore.GetBatchesByProjectID(h.Ctx, projectID)
+	pageSize, pageToken, paged, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Invalid pagination parameters")
+		return
+	}
+
+	var batches []firestore.Batch
+	var nextPageToken string
+	if paged {
+		batches, nextPageToken, err = h.BatchStore.GetBatchesPageByProjectID(h.Ctx, projectID, pageSize, pageToken)
+	} else {
+		batches, err = h.BatchStore.GetBatchesByProjectID(h.Ctx, projectID)
+	}
+	if err == fs.ErrInvalidPageToken {
+		http.Error(w, "Invalid pageToken", http.StatusBadRequest)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Invalid page token")
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error getting batches", http.StatusInternalServerError)
 		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to get batches by projectID")
@@ -116,8 +137,24 @@ func (h *BatchHandler) LoadBatchesInfoHandler(w http.ResponseWriter, r *http.Req
 			log.Error().Err(err).Str("batchID", batch.BatchID).Msg("Failed to get total image count")
 		}
 		batches[i].NumberOfTotalFiles = fileCount
+
+		// annotation totals are counted by aggregation so annotations are never downloaded
+		imageIDs, err := h.ImageStore.GetImageIDsByBatchIDs(h.Ctx, []string{batch.BatchID})
+		if err != nil {
+			log.Error().Err(err).Str("batchID", batch.BatchID).Msg("Failed to list image IDs for annotation counts")
+			continue
+		}
+		if batches[i].NumberOfKeypoints, err = h.KeypointStore.CountKeypointsByImageIDs(h.Ctx, imageIDs); err != nil {
+			log.Error().Err(err).Str("batchID", batch.BatchID).Msg("Failed to count keypoints")
+		}
+		if batches[i].NumberOfBoundingBoxes, err = h.BoundingBoxStore.CountBoundingBoxesByImageIDs(h.Ctx, imageIDs); err != nil {
+			log.Error().Err(err).Str("batchID", batch.BatchID).Msg("Failed to count bounding boxes")
+		}
 	}
 
+	if nextPageToken != "" {
+		w.Header().Set(NextPageTokenHeader, nextPageToken)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(batches); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -134,6 +171,10 @@ func (h *BatchHandler) CreateBatchHandler(w http.ResponseWriter, r *http.Request
 		log.Error().Err(err).Msg("Invalid create batch request")
 		return
 	}
+	// the project is in the body, so RequireProjectRole could not check it
+	if !authorizeProject(w, r, h.Stores, req.ProjectID, routeRoles["POST /batch"]) {
+		return
+	}
 
 	batchID, err := h.BatchStore.CreateBatch(h.Ctx, req)
 	if err != nil {
@@ -141,6 +182,9 @@ func (h *BatchHandler) CreateBatchHandler(w http.ResponseWriter, r *http.Request
 		log.Error().Err(err).Msg("Error creating batch")
 		return
 	}
+	created := projectEvent(audit.ActionCreateBatch, req.ProjectID, audit.ResourceBatch, batchID)
+	created.Details = map[string]string{"name": req.BatchName}
+	h.Audit.RecordRequest(r, created)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -169,6 +213,9 @@ func (h *BatchHandler) RenameBatchHandler(w http.ResponseWriter, r *http.Request
 		log.Error().Err(err).Str("batchID", batchID).Msg("Error renaming batch")
 		return
 	}
+	renamed := projectEvent(audit.ActionUpdateBatch, requestProjectID(r), audit.ResourceBatch, batchID)
+	renamed.Details = map[string]string{"name": req.NewBatchName}
+	h.Audit.RecordRequest(r, renamed)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -198,29 +245,38 @@ func (h *BatchHandler) DeleteBatchHandler(w http.ResponseWriter, r *http.Request
 		log.Error().Err(err).Str("batchID", batchID).Msg("Error deleting images in bucket for batch")
 		return
 	}
-	// 3) Delete image metadata in firestore
-	if err := h.ImageStore.DeleteImagesByBatchID(h.Ctx, batchID); err != nil {
-		http.Error(w, "Error deleting images metadata", http.StatusInternalServerError)
-		log.Error().Err(err).Str("batchID", batchID).Msg("Error deleting images metadata for batch")
-		return
-	}
-
-	// 4) Cascade delete annotations: keypoints and bounding boxes associated with those images
+	// 3) Queue deletes of image metadata and their keypoints and bounding boxes on one bulk writer
 	imageIDs := make([]string, 0, len(images))
 	for _, img := range images {
 		imageIDs = append(imageIDs, img.ImageID)
 	}
-	if err := h.KeypointStore.DeleteKeypointsByImageIDs(h.Ctx, imageIDs); err != nil {
+	bw := h.Clients.Firestore.NewBulkWriter(h.Ctx)
+	if err := h.ImageStore.DeleteImagesByIDs(bw, imageIDs); err != nil {
+		_ = bw.End()
+		http.Error(w, "Error deleting images metadata", http.StatusInternalServerError)
+		log.Error().Err(err).Str("batchID", batchID).Msg("Error deleting images metadata for batch")
+		return
+	}
+	if err := h.KeypointStore.DeleteKeypointsByImageIDs(h.Ctx, bw, imageIDs); err != nil {
+		_ = bw.End()
 		http.Error(w, "Error deleting keypoints for batch", http.StatusInternalServerError)
 		log.Error().Err(err).Str("batchID", batchID).Msg("Error deleting keypoints for images in batch")
 		return
 	}
-	if err := h.BoundingBoxStore.DeleteBoundingBoxesByImageIDs(h.Ctx, imageIDs); err != nil {
+	if err := h.BoundingBoxStore.DeleteBoundingBoxesByImageIDs(h.Ctx, bw, imageIDs); err != nil {
+		_ = bw.End()
 		http.Error(w, "Error deleting bounding boxes for batch", http.StatusInternalServerError)
 		log.Error().Err(err).Str("batchID", batchID).Msg("Error deleting bounding boxes for images in batch")
 		return
 	}
 
+	// 4) Send the queued deletes; the batch document is kept if any of them failed so the delete can be retried
+	if err := endBulkWrite(bw); err != nil {
+		http.Error(w, "Error deleting batch contents", http.StatusInternalServerError)
+		log.Error().Err(err).Str("batchID", batchID).Msg("Error deleting images and annotations for batch")
+		return
+	}
+
 	// 5) Finally delete the batch document
 	err = h.BatchStore.DeleteBatch(h.Ctx, batchID)
 	if err != nil {
@@ -228,6 +284,7 @@ func (h *BatchHandler) DeleteBatchHandler(w http.ResponseWriter, r *http.Request
 		log.Error().Err(err).Str("batchID", batchID).Msg("Error deleting batch")
 		return
 	}
+	h.Audit.RecordRequest(r, projectEvent(audit.ActionDeleteBatch, requestProjectID(r), audit.ResourceBatch, batchID))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -249,6 +306,8 @@ func (h *BatchHandler) DeleteAllBatchesHandler(w http.ResponseWriter, r *http.Re
 		log.Error().Err(err).Str("projectID", projectID).Msg("Error deleting batches")
 		return
 	}
+	// every batch of the project went, so the event names the project
+	h.Audit.RecordRequest(r, projectEvent(audit.ActionDeleteBatch, projectID, audit.ResourceProject, projectID))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -14,14 +14,12 @@ type BoundingBoxHandler struct {
 	*handler.Handler
 	// These are embedded fields so you don't need to call .Stores to get the inner fields
 	Stores
-	Buckets
 }
 
 func newBoundingBoxHandler(h *handler.Handler) *BoundingBoxHandler {
 	return &BoundingBoxHandler{
 		Handler: h,
 		Stores:  InitialiseStores(h),
-		Buckets: InitialiseBuckets(h),
 	}
 }
 
@@ -37,7 +35,8 @@ func RegisterBoundingBoxRoutes(r *mux.Router, h *handler.Handler) {
 	}
 
 	for _, rt := range routes {
-		r.Handle(rt.pattern, h.AuthMw(http.HandlerFunc(rt.handlerFunc))).Methods(rt.method)
+		wrapped := h.AuthMw(RequireProjectRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), bbh.Stores))
+		r.Handle(rt.pattern, wrapped).Methods(rt.method)
 	}
 }
 
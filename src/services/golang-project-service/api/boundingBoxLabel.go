@@ -16,14 +16,12 @@ type BoundingBoxLabelHandler struct {
 	*handler.Handler
 	// These are embedded fields so you don't need to call .Stores to get the inner fields
 	Stores
-	Buckets
 }
 
 func newBoundingBoxLabelHandler(h *handler.Handler) *BoundingBoxLabelHandler {
 	return &BoundingBoxLabelHandler{
 		Handler: h,
 		Stores:  InitialiseStores(h),
-		Buckets: InitialiseBuckets(h),
 	}
 }
 
@@ -38,7 +36,8 @@ func RegisterBoundingBoxLabelRoutes(r *mux.Router, h *handler.Handler) {
 	}
 
 	for _, rt := range routes {
-		r.Handle(rt.pattern, h.AuthMw(http.HandlerFunc(rt.handlerFunc))).Methods(rt.method)
+		wrapped := h.AuthMw(RequireProjectRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), bblh.Stores))
+		r.Handle(rt.pattern, wrapped).Methods(rt.method)
 	}
 }
 
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"pkg/audit"
 	"pkg/handler"
+	"pkg/jwt"
 	"project-service/firestore"
 	"slices"
 	"time"
@@ -76,16 +78,16 @@ type ExportHandler struct {
 	Buckets
 }
 
-func newExportHandler(h *handler.Handler) *ExportHandler {
+func newExportHandler(h *handler.Handler, buckets Buckets) *ExportHandler {
 	return &ExportHandler{
 		Handler: h,
 		Stores:  InitialiseStores(h),
-		Buckets: InitialiseBuckets(h),
+		Buckets: buckets,
 	}
 }
 
-func RegisterExportRoutes(r *mux.Router, h *handler.Handler) {
-	eh := newExportHandler(h)
+func RegisterExportRoutes(r *mux.Router, h *handler.Handler, buckets Buckets) {
+	eh := newExportHandler(h, buckets)
 
 	routes := []Route{
 		// Get all images from a batch
@@ -95,11 +97,20 @@ func RegisterExportRoutes(r *mux.Router, h *handler.Handler) {
 	}
 
 	for _, rt := range routes {
-		wrapped := h.AuthMw(ValidateOwnershipMiddleware(http.HandlerFunc(rt.handlerFunc), eh.Stores))
+		// personal access tokens limited to exporting can call these, for scripts that download datasets
+		wrapped := jwt.AllowScope(jwt.ScopeExport, h.AuthMw(RequireProjectRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), eh.Stores)))
 		r.Handle(rt.pattern, wrapped).Methods(rt.method)
 	}
 }
 
+// recordExport records in the audit log that the caller downloaded the dataset of projectID in format. It is
+// called as the download starts, since a client keeps whatever part of the dataset it has received.
+func (h *ExportHandler) recordExport(r *http.Request, projectID, format string) {
+	e := projectEvent(audit.ActionExport, projectID, audit.ResourceProject, projectID)
+	e.Details = map[string]string{"format": format}
+	h.Audit.RecordRequest(r, e)
+}
+
 func (h *ExportHandler) getCompletedBatches(projectID string) ([]*firestore.Batch, error) {
 	batches, err := h.BatchStore.GetBatchesByProjectID(h.Ctx, projectID)
 	if err != nil {
@@ -245,6 +256,7 @@ func (h *ExportHandler) exportKeypointCOCOHandler(w http.ResponseWriter, r *http
 	// start creating coco format
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", "attachment; filename=keypoints.zip")
+	h.recordExport(r, projectID, "coco_keypoints")
 	zipWriter := zip.NewWriter(w)
 	defer func() {
 		if err := zipWriter.Close(); err != nil {
@@ -489,6 +501,7 @@ func (h *ExportHandler) exportBoundingBoxCOCOHandler(w http.ResponseWriter, r *h
 	// start creating coco format
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", "attachment; filename=bounding_boxes.zip")
+	h.recordExport(r, projectID, "coco_bounding_boxes")
 	zipWriter := zip.NewWriter(w)
 	defer func() {
 		if err := zipWriter.Close(); err != nil {
@@ -658,6 +671,7 @@ func (h *ExportHandler) exportBoundingBoxPascalVOCHandler(w http.ResponseWriter,
 
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", "attachment; filename=bounding_boxes.zip")
+	h.recordExport(r, projectID, "pascal_voc")
 	zipWriter := zip.NewWriter(w)
 	defer func() {
 		if err := zipWriter.Close(); err != nil {
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
@@ -16,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"pkg/gcp/bucket"
+	pfs "pkg/gcp/firestore"
 	"pkg/handler"
 	fs "project-service/firestore"
 	"strings"
@@ -97,16 +99,16 @@ func extractVideoConfigs(form *multipart.Form) (map[string]VideoExtractionConfig
 	return configs, nil
 }
 
-func newImageHandler(h *handler.Handler) *ImageHandler {
+func newImageHandler(h *handler.Handler, buckets Buckets) *ImageHandler {
 	return &ImageHandler{
 		Handler: h,
 		Stores:  InitialiseStores(h),
-		Buckets: InitialiseBuckets(h),
+		Buckets: buckets,
 	}
 }
 
-func RegisterImageRoutes(r *mux.Router, h *handler.Handler) {
-	ih := newImageHandler(h)
+func RegisterImageRoutes(r *mux.Router, h *handler.Handler, buckets Buckets) {
+	ih := newImageHandler(h, buckets)
 
 	routes := []Route{
 		// Get all images from a batch
@@ -122,7 +124,7 @@ func RegisterImageRoutes(r *mux.Router, h *handler.Handler) {
 	}
 
 	for _, rt := range routes {
-		wrapped := h.AuthMw(ValidateOwnershipMiddleware(http.HandlerFunc(rt.handlerFunc), ih.Stores))
+		wrapped := h.AuthMw(RequireProjectRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), ih.Stores))
 		r.Handle(rt.pattern, wrapped).Methods(rt.method)
 	}
 }
@@ -137,17 +139,46 @@ func (h *ImageHandler) LoadImagesHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	pageSize, pageToken, paged, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Error().Err(err).Str("batchID", batchID).Msg("Invalid pagination parameters")
+		return
+	}
+	urlExpiry, customExpiry, err := parseURLExpiry(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Error().Err(err).Str("batchID", batchID).Msg("Invalid urlExpiry parameter")
+		return
+	}
+
 	// Retrieve image metadata from Firestore
-	images, err := h.ImageStore.GetImagesByBatchID(ctx, batchID)
+	var images []fs.Image
+	var nextPageToken string
+	if paged {
+		images, nextPageToken, err = h.ImageStore.GetImagesPageByBatchID(ctx, batchID, pageSize, pageToken)
+	} else {
+		images, err = h.ImageStore.GetImagesByBatchID(ctx, batchID)
+	}
+	if err == pfs.ErrInvalidPageToken {
+		http.Error(w, "Invalid pageToken", http.StatusBadRequest)
+		log.Error().Err(err).Str("batchID", batchID).Msg("Invalid page token")
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to load image metadata", http.StatusInternalServerError)
 		log.Error().Err(err).Str("batchID", batchID).Msg("Failed to load image metadata")
 		return
 	}
 
-	// Implement Signed URLs
+	// Signed URLs are cached by the bucket, so listing the same batch again does not sign every URL again
 	for i := range images {
-		signedURL, err := h.ImageBucket.GetSignedURL(ctx, images[i].ImageName)
+		var signedURL string
+		if customExpiry {
+			signedURL, err = h.ImageBucket.GetSignedURLWithExpiry(ctx, images[i].ImageName, urlExpiry)
+		} else {
+			signedURL, err = h.ImageBucket.GetSignedURL(ctx, images[i].ImageName)
+		}
 		if err != nil {
 			log.Error().Err(err).Str("imageName", images[i].ImageName).Msg("Failed to get signed URL for image")
 		}
@@ -155,6 +186,9 @@ func (h *ImageHandler) LoadImagesHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Respond with image metadata as JSON
+	if nextPageToken != "" {
+		w.Header().Set(NextPageTokenHeader, nextPageToken)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(images); err != nil {
@@ -219,8 +253,8 @@ func (h *ImageHandler) UploadImagesHandler(w http.ResponseWriter, r *http.Reques
 	var imageData bucket.ObjectList
 	imgUpStart := time.Now()
 	if imageData, err = h.ImageBucket.CreateImages(ctx, batchID, imageObjects); err != nil {
-		http.Error(w, "Failed to upload images", http.StatusInternalServerError)
 		log.Error().Err(err).Str("batchID", batchID).Msg("Failed to upload images to bucket")
+		writeUploadFailure(w, batchID, "Failed to upload images", nil, err)
 		return
 	}
 	log.Info().
@@ -234,8 +268,8 @@ func (h *ImageHandler) UploadImagesHandler(w http.ResponseWriter, r *http.Reques
 	if len(imageData) > 0 {
 		imgs, err := h.ImageStore.CreateImageMetadata(ctx, batchID, imageData, false)
 		if err != nil {
-			http.Error(w, "Failed to create image metadata", http.StatusInternalServerError)
 			log.Error().Err(err).Str("batchID", batchID).Msg("Failed to create image metadata in Firestore")
+			writeUploadFailure(w, batchID, "Failed to create image metadata", h.rollbackUpload(ctx, batchID, imageData, imgs), err)
 			return
 		}
 		createdImages = imgs
@@ -249,11 +283,12 @@ func (h *ImageHandler) UploadImagesHandler(w http.ResponseWriter, r *http.Reques
 			Msg("Created image metadata in Firestore (batch)")
 	}
 
+	// the video frames are uploaded on their own, so the images are rolled back with them if they fail
 	var videoData bucket.ObjectList
 	vidUpStart := time.Now()
 	if videoData, err = h.ImageBucket.CreateImages(ctx, batchID, videoFrameObjects); err != nil {
-		http.Error(w, "Failed to upload videos", http.StatusInternalServerError)
 		log.Error().Err(err).Str("batchID", batchID).Msg("Failed to upload videos to bucket")
+		writeUploadFailure(w, batchID, "Failed to upload videos", h.rollbackUpload(ctx, batchID, imageData, createdImages), err)
 		return
 	}
 	if len(videoData) > 0 {
@@ -269,8 +304,9 @@ func (h *ImageHandler) UploadImagesHandler(w http.ResponseWriter, r *http.Reques
 	if len(videoData) > 0 {
 		frames, err := h.ImageStore.CreateImageMetadata(ctx, batchID, videoData, true)
 		if err != nil {
-			http.Error(w, "Failed to create video metadata", http.StatusInternalServerError)
 			log.Error().Err(err).Str("batchID", batchID).Msg("Failed to create video metadata in Firestore")
+			objects := append(append(bucket.ObjectList{}, imageData...), videoData...)
+			writeUploadFailure(w, batchID, "Failed to create video metadata", h.rollbackUpload(ctx, batchID, objects, append(createdImages, frames...)), err)
 			return
 		}
 		createdVideoFrames = frames
@@ -284,7 +320,7 @@ func (h *ImageHandler) UploadImagesHandler(w http.ResponseWriter, r *http.Reques
 			Dur("took", time.Since(vidMetaStart)).
 			Msg("Created video frame metadata in Firestore (batch)")
 	}
-	w.WriteHeader(http.StatusOK)
+	files := append(uploadedFileResults(createdImages), uploadedFileResults(createdVideoFrames)...)
 
 	summaryParts := []string{}
 	if len(createdImages) > 0 {
@@ -295,15 +331,117 @@ func (h *ImageHandler) UploadImagesHandler(w http.ResponseWriter, r *http.Reques
 	}
 	if len(summaryParts) == 0 {
 		log.Warn().Str("batchID", batchID).Msg("Upload handler completed with no media persisted")
-		if _, err := w.Write([]byte("No media uploaded")); err != nil {
-			log.Error().Err(err).Str("batchID", batchID).Msg("Failed to write no media uploaded response")
-		}
+		writeUploadResponse(w, http.StatusOK, uploadResponse{BatchID: batchID, Message: "No media uploaded", Files: files})
 		return
 	}
 	log.Info().Str("batchID", batchID).Msg(fmt.Sprintf("Uploaded and stored metadata for %s", strings.Join(summaryParts, " and ")))
-	if _, err := w.Write([]byte("Upload successful")); err != nil {
-		log.Error().Err(err).Str("batchID", batchID).Msg("Failed to write upload successful response")
+	writeUploadResponse(w, http.StatusOK, uploadResponse{BatchID: batchID, Message: "Upload successful", Files: files})
+}
+
+const (
+	uploadStatusUploaded   = "uploaded"
+	uploadStatusFailed     = "failed"
+	uploadStatusAborted    = "aborted"
+	uploadStatusRolledBack = "rolledBack"
+)
+
+// uploadFileResult reports what happened to one uploaded image or video frame
+type uploadFileResult struct {
+	ObjectName string `json:"objectName"`
+	ImageID    string `json:"imageID,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+type uploadResponse struct {
+	BatchID string             `json:"batchID"`
+	Message string             `json:"message"`
+	Files   []uploadFileResult `json:"files"`
+}
+
+func uploadedFileResults(images []fs.Image) []uploadFileResult {
+	files := make([]uploadFileResult, 0, len(images))
+	for _, im := range images {
+		files = append(files, uploadFileResult{ObjectName: im.ImageName, ImageID: im.ImageID, Status: uploadStatusUploaded})
 	}
+	return files
+}
+
+// writeUploadFailure responds with the files that were rolled back plus, when the bucket upload itself failed,
+// the outcome of every object in the failed batch
+func writeUploadFailure(w http.ResponseWriter, batchID string, message string, files []uploadFileResult, err error) {
+	var batchErr *bucket.BatchUploadError
+	if errors.As(err, &batchErr) {
+		for _, r := range batchErr.Results {
+			file := uploadFileResult{ObjectName: r.ObjectName}
+			switch {
+			case errors.Is(r.Err, bucket.ErrUploadAborted):
+				file.Status = uploadStatusAborted
+			case r.Err != nil:
+				file.Status = uploadStatusFailed
+				file.Error = r.Err.Error()
+			case r.RollbackErr != nil:
+				file.Status = uploadStatusUploaded
+				file.Error = r.RollbackErr.Error()
+			default:
+				file.Status = uploadStatusRolledBack
+			}
+			files = append(files, file)
+		}
+	}
+	writeUploadResponse(w, http.StatusInternalServerError, uploadResponse{BatchID: batchID, Message: message, Files: files})
+}
+
+func writeUploadResponse(w http.ResponseWriter, status int, resp uploadResponse) {
+	if resp.Files == nil {
+		resp.Files = []uploadFileResult{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Error().Err(err).Str("batchID", resp.BatchID).Msg("Failed to write upload response")
+	}
+}
+
+// rollbackUpload removes the objects and image metadata an upload stored before a later step failed, so a failed
+// upload leaves nothing behind. It returns the outcome for each object.
+func (h *ImageHandler) rollbackUpload(ctx context.Context, batchID string, objects bucket.ObjectList, images []fs.Image) []uploadFileResult {
+	ctx = context.WithoutCancel(ctx)
+	names := make([]string, len(objects))
+	for i, obj := range objects {
+		names[i] = obj.ImageName
+	}
+	var objectsErr, metadataErr error
+	if len(names) > 0 {
+		if objectsErr = h.ImageBucket.DeleteImages(ctx, names); objectsErr != nil {
+			log.Error().Err(objectsErr).Str("batchID", batchID).Msg("Failed to delete objects of failed upload")
+		}
+	}
+	if len(images) > 0 {
+		imageIDs := make([]string, len(images))
+		for i, im := range images {
+			imageIDs[i] = im.ImageID
+		}
+		bw := h.Clients.Firestore.NewBulkWriter(ctx)
+		if metadataErr = h.ImageStore.DeleteImagesByIDs(bw, imageIDs); metadataErr != nil {
+			_ = bw.End()
+		} else {
+			metadataErr = endBulkWrite(bw)
+		}
+		if metadataErr != nil {
+			log.Error().Err(metadataErr).Str("batchID", batchID).Msg("Failed to delete image metadata of failed upload")
+		}
+	}
+
+	files := make([]uploadFileResult, len(objects))
+	for i, obj := range objects {
+		files[i] = uploadFileResult{ObjectName: obj.ImageName, Status: uploadStatusRolledBack}
+		if err := errors.Join(objectsErr, metadataErr); err != nil {
+			files[i].Status = uploadStatusUploaded
+			files[i].Error = err.Error()
+		}
+	}
+	return files
 }
 
 func generateImageData(batchID string, form *multipart.Form) (bucket.ObjectList, error) {
@@ -453,7 +591,8 @@ func generateVideoData(batchID string, form *multipart.Form, configs map[string]
 			outputArgs["frames:v"] = *cfg.MaxFrames
 		}
 
-		outPattern := filepath.Join(dname, "frame_%04d.png")
+		// pad the frame numbers so that reading the directory lists the frames in order
+		outPattern := filepath.Join(dname, "frame_%08d.png")
 		if err = stream.Output(outPattern, outputArgs).OverWriteOutput().Run(); err != nil {
 			return nil, cleanup, fmt.Errorf("failed to extract frames using ffmpeg-go: %w", err)
 		}
@@ -543,28 +682,35 @@ func (h *ImageHandler) DeleteImagesHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Delete image metadata from Firestore
-	if err := h.ImageStore.DeleteImagesByBatchID(ctx, batchID); err != nil {
-		http.Error(w, "Failed to delete image metadata", http.StatusInternalServerError)
-		log.Error().Err(err).Str("batchID", batchID).Msg("Failed to delete image metadata from Firestore")
-		return
-	}
-
-	// Cascade delete annotations for these images
+	// Delete image metadata and cascade delete annotations for these images through one bulk writer
 	imageIDs := make([]string, 0, len(images))
 	for _, img := range images {
 		imageIDs = append(imageIDs, img.ImageID)
 	}
-	if err := h.KeypointStore.DeleteKeypointsByImageIDs(ctx, imageIDs); err != nil {
+	bw := h.Clients.Firestore.NewBulkWriter(ctx)
+	if err := h.ImageStore.DeleteImagesByIDs(bw, imageIDs); err != nil {
+		_ = bw.End()
+		http.Error(w, "Failed to delete image metadata", http.StatusInternalServerError)
+		log.Error().Err(err).Str("batchID", batchID).Msg("Failed to delete image metadata from Firestore")
+		return
+	}
+	if err := h.KeypointStore.DeleteKeypointsByImageIDs(ctx, bw, imageIDs); err != nil {
+		_ = bw.End()
 		http.Error(w, "Failed to delete keypoints for images", http.StatusInternalServerError)
 		log.Error().Err(err).Str("batchID", batchID).Msg("Failed to delete keypoints for images")
 		return
 	}
-	if err := h.BoundingBoxStore.DeleteBoundingBoxesByImageIDs(ctx, imageIDs); err != nil {
+	if err := h.BoundingBoxStore.DeleteBoundingBoxesByImageIDs(ctx, bw, imageIDs); err != nil {
+		_ = bw.End()
 		http.Error(w, "Failed to delete bounding boxes for images", http.StatusInternalServerError)
 		log.Error().Err(err).Str("batchID", batchID).Msg("Failed to delete bounding boxes for images")
 		return
 	}
+	if err := endBulkWrite(bw); err != nil {
+		http.Error(w, "Failed to delete images and annotations", http.StatusInternalServerError)
+		log.Error().Err(err).Str("batchID", batchID).Msg("Failed to delete images and annotations")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -16,14 +16,12 @@ type KeypointHandler struct {
 	*handler.Handler
 	// These are embedded fields so you don't need to call .Stores to get the inner fields
 	Stores
-	Buckets
 }
 
 func newKeypointHandler(h *handler.Handler) *KeypointHandler {
 	return &KeypointHandler{
 		Handler: h,
 		Stores:  InitialiseStores(h),
-		Buckets: InitialiseBuckets(h),
 	}
 }
 
@@ -40,7 +38,8 @@ func RegisterKeypointRoutes(r *mux.Router, h *handler.Handler) {
 	}
 
 	for _, rt := range routes {
-		r.Handle(rt.pattern, h.AuthMw(http.HandlerFunc(rt.handlerFunc))).Methods(rt.method)
+		wrapped := h.AuthMw(RequireProjectRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), kh.Stores))
+		r.Handle(rt.pattern, wrapped).Methods(rt.method)
 	}
 }
 
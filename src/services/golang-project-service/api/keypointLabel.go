@@ -16,14 +16,12 @@ type KeypointLabelHandler struct {
 	*handler.Handler
 	// These are embedded fields so you don't need to call .Stores to get the inner fields
 	Stores
-	Buckets
 }
 
 func newKeypointLabelHandler(h *handler.Handler) *KeypointLabelHandler {
 	return &KeypointLabelHandler{
 		Handler: h,
 		Stores:  InitialiseStores(h),
-		Buckets: InitialiseBuckets(h),
 	}
 }
 
@@ -38,7 +36,8 @@ func RegisterKeypointLabelRoutes(r *mux.Router, h *handler.Handler) {
 	}
 
 	for _, rt := range routes {
-		r.Handle(rt.pattern, h.AuthMw(http.HandlerFunc(rt.handlerFunc))).Methods(rt.method)
+		wrapped := h.AuthMw(RequireProjectRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), klh.Stores))
+		r.Handle(rt.pattern, wrapped).Methods(rt.method)
 	}
 }
 
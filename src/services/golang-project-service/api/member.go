@@ -0,0 +1,495 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"pkg/audit"
+	fs "pkg/gcp/firestore"
+	"pkg/handler"
+	"pkg/jwt"
+	"pkg/roles"
+	"project-service/firestore"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// InviteConfig sets how invites to projects work.
+type InviteConfig struct {
+	// TTL is how long an invite can be accepted for
+	TTL time.Duration `env:"INVITE_TTL" yaml:"ttl" default:"168h"`
+}
+
+func (c *InviteConfig) Validate() error {
+	if c.TTL <= 0 {
+		return errors.New("INVITE_TTL must be positive")
+	}
+	return nil
+}
+
+// errRoleNotBelowCaller is returned by the checks of member changes that need the member's role to be below the
+// caller's.
+var errRoleNotBelowCaller = errors.New("the member's role is not below the caller's")
+
+type UpdateMemberRequest struct {
+	Role roles.Role `json:"role"`
+}
+
+type MemberHandler struct {
+	*handler.Handler
+	// These are embedded fields so you don't need to call .Stores to get the inner fields
+	Stores
+	Invites InviteConfig
+}
+
+func newMemberHandler(h *handler.Handler, cfg InviteConfig) *MemberHandler {
+	return &MemberHandler{
+		Handler: h,
+		Stores:  InitialiseStores(h),
+		Invites: cfg,
+	}
+}
+
+func RegisterMemberRoutes(r *mux.Router, h *handler.Handler, cfg InviteConfig) {
+	mh := newMemberHandler(h, cfg)
+
+	routes := []Route{
+		// List the owner and members of a project
+		{"GET", "/projects/{projectID}/members", mh.ListMembersHandler},
+		// Change a member's role
+		{"PATCH", "/projects/{projectID}/members/{userID}", jwt.RequireLogin(http.HandlerFunc(mh.UpdateMemberHandler)).ServeHTTP},
+		// Remove a member, or leave the project
+		{"DELETE", "/projects/{projectID}/members/{userID}", jwt.RequireLogin(http.HandlerFunc(mh.DeleteMemberHandler)).ServeHTTP},
+		// List the invites to a project that have not been answered
+		{"GET", "/projects/{projectID}/invites", mh.ListProjectInvitesHandler},
+		// Invite an email to a project
+		{"POST", "/projects/{projectID}/invites", jwt.RequireLogin(http.HandlerFunc(mh.CreateInviteHandler)).ServeHTTP},
+		// Revoke an invite
+		{"DELETE", "/projects/{projectID}/invites/{inviteID}", jwt.RequireLogin(http.HandlerFunc(mh.RevokeInviteHandler)).ServeHTTP},
+		// List the invites sent to the user's email
+		{"GET", "/invites", jwt.RequireLogin(http.HandlerFunc(mh.ListMyInvitesHandler)).ServeHTTP},
+		// Accept or decline an invite sent to the user's email
+		{"POST", "/invites/{inviteID}/accept", jwt.RequireLogin(http.HandlerFunc(mh.AcceptInviteHandler)).ServeHTTP},
+		{"POST", "/invites/{inviteID}/decline", jwt.RequireLogin(http.HandlerFunc(mh.DeclineInviteHandler)).ServeHTTP},
+	}
+
+	for _, rt := range routes {
+		wrapped := h.AuthMw(RequireProjectRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), mh.Stores))
+		r.Handle(rt.pattern, wrapped).Methods(rt.method)
+	}
+}
+
+// ListMembersHandler returns everyone with access to the project, starting with its owner. The members of an
+// organisation that owns the project are listed by the organisation, not here.
+func (h *MemberHandler) ListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["projectID"]
+
+	project, err := h.ProjectStore.GetProject(r.Context(), projectID)
+	if err != nil {
+		http.Error(w, "Error getting project", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to get project for members")
+		return
+	}
+	members, err := h.MemberStore.GetMembersByProjectID(r.Context(), projectID)
+	if err != nil {
+		http.Error(w, "Error getting members", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to get project members")
+		return
+	}
+	if project.UserID != "" {
+		owner := firestore.ProjectMember{ProjectID: projectID, UserID: project.UserID, Role: roles.Owner}
+		members = append([]firestore.ProjectMember{owner}, members...)
+	}
+	for i := range members {
+		members[i].Email = userEmail(r.Context(), h.UserStore, members[i].UserID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("projectID", projectID).Int("members", len(members)).Msg("Successfully returned project members")
+	if err := json.NewEncoder(w).Encode(members); err != nil {
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to encode members response")
+	}
+}
+
+// userEmail returns the current email of userID, or an empty string if it cannot be found.
+func userEmail(ctx context.Context, users *firestore.UserStore, userID string) string {
+	user, err := users.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Failed to get email of project member")
+		return ""
+	}
+	return user.Email
+}
+
+// UpdateMemberHandler changes a member's role. Callers can only change the roles of members below them, to roles
+// below their own, so admins cannot make other admins and nobody can make an owner.
+func (h *MemberHandler) UpdateMemberHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID, memberID := vars["projectID"], vars["userID"]
+
+	var req UpdateMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Role.Valid() {
+		http.Error(w, "role must be one of viewer, annotator, reviewer or admin", http.StatusBadRequest)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Invalid update member request")
+		return
+	}
+	caller := callerRole(r)
+	member, err := h.MemberStore.UpdateRole(r.Context(), projectID, memberID, req.Role, func(m firestore.ProjectMember) error {
+		if !caller.Outranks(m.Role) || !caller.Outranks(req.Role) {
+			return errRoleNotBelowCaller
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotFound) {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		log.Info().Str("projectID", projectID).Str("memberID", memberID).Msg("Update of a user who is not a member")
+		return
+	}
+	if errors.Is(err, errRoleNotBelowCaller) {
+		http.Error(w, "You can only change the roles of members below you, to roles below yours", http.StatusForbidden)
+		log.Warn().Str("projectID", projectID).Str("memberID", memberID).Str("role", string(caller)).Msg("Member update above caller's role")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating member", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Str("memberID", memberID).Msg("Failed to update member role")
+		return
+	}
+	updated := projectEvent(audit.ActionUpdateMember, projectID, audit.ResourceMember, memberID)
+	updated.Details = map[string]string{"previousRole": string(member.Role), "role": string(req.Role)}
+	h.Audit.RecordRequest(r, updated)
+	member.Role = req.Role
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("projectID", projectID).Str("memberID", memberID).Str("role", string(req.Role)).Msg("Updated member role")
+	if err := json.NewEncoder(w).Encode(member); err != nil {
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to encode member response")
+	}
+}
+
+// DeleteMemberHandler removes a member from the project. Members can always leave; removing someone else needs
+// a role above theirs.
+func (h *MemberHandler) DeleteMemberHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID, memberID := vars["projectID"], vars["userID"]
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return
+	}
+
+	caller := callerRole(r)
+	member, err := h.MemberStore.RemoveMember(r.Context(), projectID, memberID, func(m firestore.ProjectMember) error {
+		if memberID != userID && !caller.Outranks(m.Role) {
+			return errRoleNotBelowCaller
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotFound) && memberID == userID && caller == roles.Owner {
+		http.Error(w, "The owner cannot leave their project", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, fs.ErrNotFound) {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		log.Info().Str("projectID", projectID).Str("memberID", memberID).Msg("Removal of a user who is not a member")
+		return
+	}
+	if errors.Is(err, errRoleNotBelowCaller) {
+		http.Error(w, "You can only remove members below you", http.StatusForbidden)
+		log.Warn().Str("projectID", projectID).Str("memberID", memberID).Str("role", string(caller)).Msg("Member removal above caller's role")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error removing member", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Str("memberID", memberID).Msg("Failed to remove member")
+		return
+	}
+	removed := projectEvent(audit.ActionRemoveMember, projectID, audit.ResourceMember, memberID)
+	removed.Details = map[string]string{"role": string(member.Role)}
+	h.Audit.RecordRequest(r, removed)
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info().Str("projectID", projectID).Str("memberID", memberID).Str("removedBy", userID).Msg("Removed project member")
+}
+
+func (h *MemberHandler) ListProjectInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["projectID"]
+
+	invites, err := h.InviteStore.GetPendingInvitesByProjectID(r.Context(), projectID)
+	if err != nil {
+		http.Error(w, "Error getting invites", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to get project invites")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("projectID", projectID).Int("invites", len(invites)).Msg("Successfully returned project invites")
+	if err := json.NewEncoder(w).Encode(invites); err != nil {
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to encode invites response")
+	}
+}
+
+// CreateInviteHandler invites an email to the project with a role below the caller's. Whoever logs in with that
+// email, once verified, sees the invite at GET /invites.
+func (h *MemberHandler) CreateInviteHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["projectID"]
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return
+	}
+
+	var req firestore.CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Invalid create invite request")
+		return
+	}
+	if !validInviteEmail(req.Email) {
+		http.Error(w, "A valid email is required", http.StatusBadRequest)
+		log.Info().Str("projectID", projectID).Msg("Invite with an invalid email")
+		return
+	}
+	if !req.Role.Valid() {
+		http.Error(w, "role must be one of viewer, annotator, reviewer or admin", http.StatusBadRequest)
+		log.Info().Str("projectID", projectID).Str("role", string(req.Role)).Msg("Invite with an invalid role")
+		return
+	}
+	if caller := callerRole(r); !caller.Outranks(req.Role) {
+		http.Error(w, "You can only invite people with roles below yours", http.StatusForbidden)
+		log.Warn().Str("projectID", projectID).Str("role", string(caller)).Str("invited", string(req.Role)).Msg("Invite above caller's role")
+		return
+	}
+
+	invite, err := h.InviteStore.CreateInvite(r.Context(), firestore.Invite{
+		ProjectID: projectID,
+		Email:     req.Email,
+		Role:      req.Role,
+		InvitedBy: userID,
+	}, h.Invites.TTL)
+	if err != nil {
+		http.Error(w, "Error creating invite", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to create invite")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	log.Info().Str("projectID", projectID).Str("inviteID", invite.InviteID).Str("role", string(invite.Role)).Msg("Invite created")
+	if err := json.NewEncoder(w).Encode(invite); err != nil {
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to encode invite response")
+	}
+}
+
+func (h *MemberHandler) RevokeInviteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID, inviteID := vars["projectID"], vars["inviteID"]
+
+	invite, err := h.InviteStore.GetInvite(r.Context(), inviteID)
+	if errors.Is(err, fs.ErrNotFound) || (err == nil && invite.ProjectID != projectID) {
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		log.Info().Str("projectID", projectID).Str("inviteID", inviteID).Msg("Revoke of an invite not to this project")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error revoking invite", http.StatusInternalServerError)
+		log.Error().Err(err).Str("inviteID", inviteID).Msg("Failed to get invite")
+		return
+	}
+	if caller := callerRole(r); !caller.Outranks(invite.Role) {
+		http.Error(w, "You can only revoke invites with roles below yours", http.StatusForbidden)
+		log.Warn().Str("projectID", projectID).Str("inviteID", inviteID).Str("role", string(caller)).Msg("Revoke of invite above caller's role")
+		return
+	}
+	if _, err := h.InviteStore.CloseInvite(r.Context(), inviteID, firestore.InviteRevoked); err != nil {
+		writeCloseInviteError(w, err, inviteID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info().Str("projectID", projectID).Str("inviteID", inviteID).Msg("Invite revoked")
+}
+
+// validInviteEmail reports whether email is a bare address that can be invited.
+func validInviteEmail(email string) bool {
+	_, err := mail.ParseAddress(email)
+	return err == nil && !strings.ContainsAny(email, "<>")
+}
+
+func writeCloseInviteError(w http.ResponseWriter, err error, inviteID string) {
+	switch {
+	case errors.Is(err, fs.ErrNotFound):
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		log.Info().Str("inviteID", inviteID).Msg("Invite not found")
+	case errors.Is(err, firestore.ErrInviteClosed):
+		http.Error(w, "Invite has expired or already been answered", http.StatusConflict)
+		log.Info().Str("inviteID", inviteID).Msg("Invite is no longer pending")
+	default:
+		http.Error(w, "Error updating invite", http.StatusInternalServerError)
+		log.Error().Err(err).Str("inviteID", inviteID).Msg("Failed to update invite")
+	}
+}
+
+// verifiedEmail returns the email of the caller if they have verified it and it is still theirs, so an invite
+// can only be answered from the inbox it was sent to.
+func (h *MemberHandler) verifiedEmail(w http.ResponseWriter, r *http.Request) (userID, email string, ok bool) {
+	p, err := jwt.GetPrincipal(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get principal from JWT")
+		return "", "", false
+	}
+	user, err := h.UserStore.GetUserByID(r.Context(), p.UserID)
+	if err != nil {
+		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", p.UserID).Msg("Failed to get user for invites")
+		return "", "", false
+	}
+	if !p.EmailVerified || !strings.EqualFold(p.Email, user.Email) {
+		http.Error(w, "Verify your email to see the invites sent to it", http.StatusForbidden)
+		log.Info().Str("userID", p.UserID).Msg("Invites asked for without a verified email")
+		return "", "", false
+	}
+	return p.UserID, user.Email, true
+}
+
+// ListMyInvitesHandler returns the invites sent to the caller's email that can still be accepted.
+func (h *MemberHandler) ListMyInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, email, ok := h.verifiedEmail(w, r)
+	if !ok {
+		return
+	}
+	invites, err := h.InviteStore.GetPendingInvitesByEmail(r.Context(), email)
+	if err != nil {
+		http.Error(w, "Error getting invites", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to get invites by email")
+		return
+	}
+	pending := make([]firestore.Invite, 0, len(invites))
+	for _, inv := range invites {
+		err := h.nameInvite(r.Context(), &inv)
+		if errors.Is(err, fs.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, "Error getting invites", http.StatusInternalServerError)
+			log.Error().Err(err).Str("inviteID", inv.InviteID).Msg("Failed to get project or organisation of invite")
+			return
+		}
+		pending = append(pending, inv)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("userID", userID).Int("invites", len(pending)).Msg("Successfully returned user's invites")
+	if err := json.NewEncoder(w).Encode(pending); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to encode invites response")
+	}
+}
+
+// nameInvite fills in the name of the project or organisation inv is to. It returns fs.ErrNotFound if that has
+// been deleted.
+func (h *MemberHandler) nameInvite(ctx context.Context, inv *firestore.Invite) error {
+	if inv.OrgID != "" {
+		org, err := h.OrganisationStore.GetOrganisation(ctx, inv.OrgID)
+		if err != nil {
+			return err
+		}
+		inv.OrgName = org.Name
+		return nil
+	}
+	project, err := h.ProjectStore.GetProject(ctx, inv.ProjectID)
+	if err != nil {
+		return err
+	}
+	inv.ProjectName = project.ProjectName
+	return nil
+}
+
+// AcceptInviteHandler makes the caller a member of the project or organisation they were invited to.
+func (h *MemberHandler) AcceptInviteHandler(w http.ResponseWriter, r *http.Request) {
+	inviteID := mux.Vars(r)["inviteID"]
+	invite, userID, ok := h.answerInvite(w, r, inviteID, firestore.InviteAccepted)
+	if !ok {
+		return
+	}
+
+	role, err := h.addMember(r.Context(), invite, userID)
+	if err != nil {
+		// put the invite back so it can be accepted again
+		if reopenErr := h.InviteStore.ReopenInvite(r.Context(), inviteID); reopenErr != nil {
+			log.Error().Err(reopenErr).Str("inviteID", inviteID).Msg("Failed to reopen invite")
+		}
+		http.Error(w, "Error accepting invite", http.StatusInternalServerError)
+		log.Error().Err(err).Str("inviteID", inviteID).Str("userID", userID).Msg("Failed to add member")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("projectID", invite.ProjectID).Str("orgID", invite.OrgID).Str("userID", userID).Str("role", string(role)).Msg("Invite accepted")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"projectID": invite.ProjectID,
+		"orgID":     invite.OrgID,
+		"role":      role,
+	})
+}
+
+// addMember gives userID the role invite is for and returns the role they end up with. The owner has no member
+// document, so an invite they accept to their own project changes nothing.
+func (h *MemberHandler) addMember(ctx context.Context, invite *firestore.Invite, userID string) (roles.Role, error) {
+	if invite.OrgID != "" {
+		return h.OrgMemberStore.AddMember(ctx, invite.OrgID, userID, invite.Role, invite.InvitedBy)
+	}
+	project, err := h.ProjectStore.GetProject(ctx, invite.ProjectID)
+	if err != nil {
+		return "", err
+	}
+	if project.UserID == userID {
+		return roles.Owner, nil
+	}
+	return h.MemberStore.AddMember(ctx, invite.ProjectID, userID, invite.Role, invite.InvitedBy)
+}
+
+func (h *MemberHandler) DeclineInviteHandler(w http.ResponseWriter, r *http.Request) {
+	inviteID := mux.Vars(r)["inviteID"]
+	invite, userID, ok := h.answerInvite(w, r, inviteID, firestore.InviteDeclined)
+	if !ok {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	log.Info().Str("projectID", invite.ProjectID).Str("orgID", invite.OrgID).Str("userID", userID).Msg("Invite declined")
+}
+
+// answerInvite closes the invite inviteID with status if it was sent to the caller's verified email. It writes
+// the error response and returns false if it was not, or cannot be answered.
+func (h *MemberHandler) answerInvite(w http.ResponseWriter, r *http.Request, inviteID string, status firestore.InviteStatus) (*firestore.Invite, string, bool) {
+	userID, email, ok := h.verifiedEmail(w, r)
+	if !ok {
+		return nil, "", false
+	}
+	invite, err := h.InviteStore.GetInvite(r.Context(), inviteID)
+	// invites to other emails are not found, so their IDs cannot be probed
+	if errors.Is(err, fs.ErrNotFound) || (err == nil && !invite.EmailMatches(email)) {
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		log.Info().Str("userID", userID).Str("inviteID", inviteID).Msg("Answer to an invite not sent to the user")
+		return nil, "", false
+	}
+	if err != nil {
+		http.Error(w, "Error answering invite", http.StatusInternalServerError)
+		log.Error().Err(err).Str("inviteID", inviteID).Msg("Failed to get invite")
+		return nil, "", false
+	}
+	invite, err = h.InviteStore.CloseInvite(r.Context(), inviteID, status)
+	if err != nil {
+		writeCloseInviteError(w, err, inviteID)
+		return nil, "", false
+	}
+	return invite, userID, true
+}
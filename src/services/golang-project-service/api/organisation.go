@@ -0,0 +1,504 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	fs "pkg/gcp/firestore"
+	"pkg/handler"
+	"pkg/jwt"
+	"pkg/roles"
+	"project-service/firestore"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+type OrganisationHandler struct {
+	// ProjectHandler is embedded for its stores and for deleting the projects of organisations
+	*ProjectHandler
+	Invites InviteConfig
+}
+
+func newOrganisationHandler(h *handler.Handler, cfg InviteConfig, buckets Buckets) *OrganisationHandler {
+	return &OrganisationHandler{
+		ProjectHandler: newProjectHandler(h, buckets),
+		Invites:        cfg,
+	}
+}
+
+func RegisterOrganisationRoutes(r *mux.Router, h *handler.Handler, cfg InviteConfig, buckets Buckets) {
+	oh := newOrganisationHandler(h, cfg, buckets)
+
+	routes := []Route{
+		// Create an organisation, with the user as its owner
+		{"POST", "/organisations", jwt.RequireVerifiedEmail(jwt.ActionProjects, http.HandlerFunc(oh.CreateOrganisationHandler)).ServeHTTP},
+		// List the organisations the user belongs to
+		{"GET", "/organisations", oh.ListOrganisationsHandler},
+		// Get, rename or delete an organisation
+		{"GET", "/organisations/{orgID}", oh.GetOrganisationHandler},
+		{"PATCH", "/organisations/{orgID}", jwt.RequireLogin(http.HandlerFunc(oh.UpdateOrganisationHandler)).ServeHTTP},
+		{"DELETE", "/organisations/{orgID}", jwt.RequireLogin(http.HandlerFunc(oh.DeleteOrganisationHandler)).ServeHTTP},
+		// List the projects an organisation owns
+		{"GET", "/organisations/{orgID}/projects", oh.ListOrganisationProjectsHandler},
+		// List, change or remove the members of an organisation
+		{"GET", "/organisations/{orgID}/members", oh.ListOrgMembersHandler},
+		{"PATCH", "/organisations/{orgID}/members/{userID}", jwt.RequireLogin(http.HandlerFunc(oh.UpdateOrgMemberHandler)).ServeHTTP},
+		{"DELETE", "/organisations/{orgID}/members/{userID}", jwt.RequireLogin(http.HandlerFunc(oh.DeleteOrgMemberHandler)).ServeHTTP},
+		// List, send or revoke invites to an organisation; they are answered at /invites
+		{"GET", "/organisations/{orgID}/invites", oh.ListOrgInvitesHandler},
+		{"POST", "/organisations/{orgID}/invites", jwt.RequireLogin(http.HandlerFunc(oh.CreateOrgInviteHandler)).ServeHTTP},
+		{"DELETE", "/organisations/{orgID}/invites/{inviteID}", jwt.RequireLogin(http.HandlerFunc(oh.RevokeOrgInviteHandler)).ServeHTTP},
+	}
+
+	for _, rt := range routes {
+		wrapped := h.AuthMw(RequireOrgRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), oh.Stores))
+		r.Handle(rt.pattern, wrapped).Methods(rt.method)
+	}
+}
+
+// canManageOrgRole reports whether a member with role caller may grant, change or take away role. Unlike in
+// projects, owners can make other owners, so an organisation can be handed over.
+func canManageOrgRole(caller, role roles.Role) bool {
+	return caller == roles.Owner || caller.Outranks(role)
+}
+
+func (h *OrganisationHandler) CreateOrganisationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return
+	}
+	var req firestore.OrganisationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "A name is required", http.StatusBadRequest)
+		log.Error().Err(err).Str("userID", userID).Msg("Invalid create organisation request")
+		return
+	}
+
+	org, err := h.OrganisationStore.CreateOrganisation(h.Ctx, strings.TrimSpace(req.Name), userID)
+	if err != nil {
+		http.Error(w, "Error creating organisation", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to create organisation")
+		return
+	}
+	if _, err := h.OrgMemberStore.AddMember(h.Ctx, org.OrgID, userID, roles.Owner, userID); err != nil {
+		// an organisation nobody belongs to can never be reached, so do not leave it behind
+		if delErr := h.OrganisationStore.DeleteOrganisation(h.Ctx, org.OrgID); delErr != nil {
+			log.Error().Err(delErr).Str("orgID", org.OrgID).Msg("Failed to delete organisation without an owner")
+		}
+		http.Error(w, "Error creating organisation", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", org.OrgID).Msg("Failed to add owner to organisation")
+		return
+	}
+	org.Role = roles.Owner
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	log.Info().Str("orgID", org.OrgID).Str("userID", userID).Msg("Organisation created")
+	if err := json.NewEncoder(w).Encode(org); err != nil {
+		log.Error().Err(err).Str("orgID", org.OrgID).Msg("Failed to encode organisation response")
+	}
+}
+
+// ListOrganisationsHandler returns the organisations the user belongs to, with their role in each, by name.
+func (h *OrganisationHandler) ListOrganisationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return
+	}
+	memberships, err := h.OrgMemberStore.GetMembershipsByUserID(h.Ctx, userID)
+	if err != nil {
+		http.Error(w, "Error getting organisations", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to get organisation memberships")
+		return
+	}
+	orgs := make([]firestore.Organisation, 0, len(memberships))
+	for _, m := range memberships {
+		org, err := h.OrganisationStore.GetOrganisation(h.Ctx, m.OrgID)
+		if errors.Is(err, fs.ErrNotFound) {
+			// the organisation is being deleted
+			continue
+		}
+		if err != nil {
+			http.Error(w, "Error getting organisations", http.StatusInternalServerError)
+			log.Error().Err(err).Str("orgID", m.OrgID).Msg("Failed to get organisation")
+			return
+		}
+		org.Role = m.Role
+		orgs = append(orgs, *org)
+	}
+	slices.SortFunc(orgs, func(a, b firestore.Organisation) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.OrgID, b.OrgID))
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("userID", userID).Int("organisations", len(orgs)).Msg("Successfully returned organisations")
+	if err := json.NewEncoder(w).Encode(orgs); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to encode organisations response")
+	}
+}
+
+func (h *OrganisationHandler) GetOrganisationHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgID"]
+	org, err := h.OrganisationStore.GetOrganisation(h.Ctx, orgID)
+	if err != nil {
+		http.Error(w, "Error getting organisation", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to get organisation")
+		return
+	}
+	org.Role = callerOrgRole(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("orgID", orgID).Msg("Successfully returned organisation")
+	if err := json.NewEncoder(w).Encode(org); err != nil {
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to encode organisation response")
+	}
+}
+
+func (h *OrganisationHandler) UpdateOrganisationHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgID"]
+	var req firestore.OrganisationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "A name is required", http.StatusBadRequest)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Invalid update organisation request")
+		return
+	}
+	if err := h.OrganisationStore.RenameOrganisation(h.Ctx, orgID, strings.TrimSpace(req.Name)); err != nil {
+		http.Error(w, "Error updating organisation", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to rename organisation")
+		return
+	}
+	org, err := h.OrganisationStore.GetOrganisation(h.Ctx, orgID)
+	if err != nil {
+		http.Error(w, "Error getting organisation", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to get organisation")
+		return
+	}
+	org.Role = callerOrgRole(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("orgID", orgID).Msg("Updated organisation")
+	if err := json.NewEncoder(w).Encode(org); err != nil {
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to encode organisation response")
+	}
+}
+
+// DeleteOrganisationHandler deletes an organisation once it owns no projects. They have to be transferred or
+// deleted first, so deleting an organisation never takes a team's work with it by accident.
+func (h *OrganisationHandler) DeleteOrganisationHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgID"]
+	projects, err := h.ProjectStore.GetProjectsByOrgIDs(h.Ctx, []string{orgID})
+	if err != nil {
+		http.Error(w, "Error deleting organisation", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to get projects of organisation")
+		return
+	}
+	if len(projects) > 0 {
+		http.Error(w, "Transfer or delete the organisation's projects first", http.StatusConflict)
+		log.Info().Str("orgID", orgID).Int("projects", len(projects)).Msg("Delete of an organisation that still owns projects")
+		return
+	}
+	if err := h.deleteOrganisation(h.Ctx, orgID); err != nil {
+		http.Error(w, "Error deleting organisation", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to delete organisation")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info().Str("orgID", orgID).Msg("Organisation deleted")
+}
+
+// deleteOrganisation deletes an organisation with its projects, members and invites. The organisation document
+// goes before its members and invites, which are only reachable through it, so if deleting them fails all that
+// is left is documents nobody can see.
+func (h *ProjectHandler) deleteOrganisation(ctx context.Context, orgID string) error {
+	projects, err := h.ProjectStore.GetProjectsByOrgIDs(ctx, []string{orgID})
+	if err != nil {
+		return fmt.Errorf("list projects: %w", err)
+	}
+	for _, p := range projects {
+		if err := h.deleteProject(ctx, p.ProjectID); err != nil {
+			return fmt.Errorf("project %s: %w", p.ProjectID, err)
+		}
+	}
+	if err := h.OrganisationStore.DeleteOrganisation(ctx, orgID); err != nil && !errors.Is(err, fs.ErrNotFound) {
+		return fmt.Errorf("delete organisation: %w", err)
+	}
+
+	bw := h.Clients.Firestore.NewBulkWriter(ctx)
+	if err := h.OrgMemberStore.DeleteMembersByOrgID(ctx, bw, orgID); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete members: %w", err)
+	}
+	if err := h.InviteStore.DeleteInvitesByOrgID(ctx, bw, orgID); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete invites: %w", err)
+	}
+	if err := endBulkWrite(bw); err != nil {
+		return fmt.Errorf("delete members and invites: %w", err)
+	}
+	return nil
+}
+
+// ListOrganisationProjectsHandler returns the projects the organisation owns, by name.
+func (h *OrganisationHandler) ListOrganisationProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgID"]
+	projects, err := h.ProjectStore.GetProjectsByOrgIDs(h.Ctx, []string{orgID})
+	if err != nil {
+		http.Error(w, "Error getting projects", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to get projects of organisation")
+		return
+	}
+	for i := range projects {
+		count, err := h.BatchStore.GetTotalBatchCountByProjectID(h.Ctx, projects[i].ProjectID)
+		if err != nil {
+			http.Error(w, "Error getting batch count", http.StatusInternalServerError)
+			log.Error().Err(err).Str("projectID", projects[i].ProjectID).Msg("Failed to get batch count")
+			return
+		}
+		projects[i].NumberOfBatches = count
+		projects[i].Role = callerOrgRole(r)
+	}
+	slices.SortFunc(projects, func(a, b firestore.Project) int {
+		return cmp.Or(strings.Compare(a.ProjectName, b.ProjectName), strings.Compare(a.ProjectID, b.ProjectID))
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("orgID", orgID).Int("projects", len(projects)).Msg("Successfully returned organisation projects")
+	if err := json.NewEncoder(w).Encode(projects); err != nil {
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to encode projects response")
+	}
+}
+
+// ListOrgMembersHandler returns the members of the organisation, highest role first.
+func (h *OrganisationHandler) ListOrgMembersHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgID"]
+	members, err := h.OrgMemberStore.GetMembersByOrgID(h.Ctx, orgID)
+	if err != nil {
+		http.Error(w, "Error getting members", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to get organisation members")
+		return
+	}
+	slices.SortStableFunc(members, func(a, b firestore.OrgMember) int {
+		switch {
+		case a.Role.Outranks(b.Role):
+			return -1
+		case b.Role.Outranks(a.Role):
+			return 1
+		}
+		return a.AddedAt.Compare(b.AddedAt)
+	})
+	for i := range members {
+		members[i].Email = userEmail(h.Ctx, h.UserStore, members[i].UserID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("orgID", orgID).Int("members", len(members)).Msg("Successfully returned organisation members")
+	if err := json.NewEncoder(w).Encode(members); err != nil {
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to encode members response")
+	}
+}
+
+// UpdateOrgMemberHandler changes a member's role. Callers can only change the roles of members below them, to
+// roles below their own, except that owners can change anyone's as long as the organisation keeps an owner.
+func (h *OrganisationHandler) UpdateOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, memberID := vars["orgID"], vars["userID"]
+
+	var req UpdateMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Role.Valid() {
+		http.Error(w, "role must be one of viewer, annotator, reviewer, admin or owner", http.StatusBadRequest)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Invalid update organisation member request")
+		return
+	}
+	member, err := h.OrgMemberStore.GetMember(h.Ctx, orgID, memberID)
+	if errors.Is(err, fs.ErrNotFound) {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		log.Info().Str("orgID", orgID).Str("memberID", memberID).Msg("Update of a user who is not a member")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating member", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Str("memberID", memberID).Msg("Failed to get organisation member")
+		return
+	}
+	caller := callerOrgRole(r)
+	if !canManageOrgRole(caller, member.Role) || !canManageOrgRole(caller, req.Role) {
+		http.Error(w, "You can only change the roles of members below you, to roles below yours", http.StatusForbidden)
+		log.Warn().Str("orgID", orgID).Str("memberID", memberID).Str("role", string(caller)).Msg("Organisation member update above caller's role")
+		return
+	}
+	err = h.OrgMemberStore.UpdateRole(h.Ctx, orgID, memberID, req.Role)
+	if errors.Is(err, firestore.ErrLastOwner) {
+		http.Error(w, "Make someone else an owner first", http.StatusConflict)
+		log.Info().Str("orgID", orgID).Str("memberID", memberID).Msg("Demotion of the last owner")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating member", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Str("memberID", memberID).Msg("Failed to update organisation member role")
+		return
+	}
+	member.Role = req.Role
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("orgID", orgID).Str("memberID", memberID).Str("role", string(req.Role)).Msg("Updated organisation member role")
+	if err := json.NewEncoder(w).Encode(member); err != nil {
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to encode member response")
+	}
+}
+
+// DeleteOrgMemberHandler removes a member from the organisation. Members can always leave unless they are its last
+// owner; removing someone else needs a role that can manage theirs.
+func (h *OrganisationHandler) DeleteOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, memberID := vars["orgID"], vars["userID"]
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return
+	}
+
+	if memberID != userID {
+		member, err := h.OrgMemberStore.GetMember(h.Ctx, orgID, memberID)
+		if errors.Is(err, fs.ErrNotFound) {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			log.Info().Str("orgID", orgID).Str("memberID", memberID).Msg("Removal of a user who is not a member")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error removing member", http.StatusInternalServerError)
+			log.Error().Err(err).Str("orgID", orgID).Str("memberID", memberID).Msg("Failed to get organisation member")
+			return
+		}
+		if caller := callerOrgRole(r); !canManageOrgRole(caller, member.Role) {
+			http.Error(w, "You can only remove members below you", http.StatusForbidden)
+			log.Warn().Str("orgID", orgID).Str("memberID", memberID).Str("role", string(caller)).Msg("Organisation member removal above caller's role")
+			return
+		}
+	}
+	err = h.OrgMemberStore.RemoveMember(h.Ctx, orgID, memberID)
+	if errors.Is(err, firestore.ErrLastOwner) {
+		http.Error(w, "Make someone else an owner first, or delete the organisation", http.StatusConflict)
+		log.Info().Str("orgID", orgID).Str("memberID", memberID).Msg("Removal of the last owner")
+		return
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotFound) {
+		http.Error(w, "Error removing member", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Str("memberID", memberID).Msg("Failed to remove organisation member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info().Str("orgID", orgID).Str("memberID", memberID).Str("removedBy", userID).Msg("Removed organisation member")
+}
+
+func (h *OrganisationHandler) ListOrgInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgID"]
+
+	invites, err := h.InviteStore.GetPendingInvitesByOrgID(h.Ctx, orgID)
+	if err != nil {
+		http.Error(w, "Error getting invites", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to get organisation invites")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("orgID", orgID).Int("invites", len(invites)).Msg("Successfully returned organisation invites")
+	if err := json.NewEncoder(w).Encode(invites); err != nil {
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to encode invites response")
+	}
+}
+
+// CreateOrgInviteHandler invites an email to the organisation with a role the caller can manage. It is answered
+// like an invite to a project, at /invites.
+func (h *OrganisationHandler) CreateOrgInviteHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgID"]
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return
+	}
+
+	var req firestore.CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Invalid create invite request")
+		return
+	}
+	if !validInviteEmail(req.Email) {
+		http.Error(w, "A valid email is required", http.StatusBadRequest)
+		log.Info().Str("orgID", orgID).Msg("Invite with an invalid email")
+		return
+	}
+	if !req.Role.Valid() {
+		http.Error(w, "role must be one of viewer, annotator, reviewer, admin or owner", http.StatusBadRequest)
+		log.Info().Str("orgID", orgID).Str("role", string(req.Role)).Msg("Invite with an invalid role")
+		return
+	}
+	if caller := callerOrgRole(r); !canManageOrgRole(caller, req.Role) {
+		http.Error(w, "You can only invite people with roles below yours", http.StatusForbidden)
+		log.Warn().Str("orgID", orgID).Str("role", string(caller)).Str("invited", string(req.Role)).Msg("Invite above caller's role")
+		return
+	}
+
+	invite, err := h.InviteStore.CreateInvite(h.Ctx, firestore.Invite{
+		OrgID:     orgID,
+		Email:     req.Email,
+		Role:      req.Role,
+		InvitedBy: userID,
+	}, h.Invites.TTL)
+	if err != nil {
+		http.Error(w, "Error creating invite", http.StatusInternalServerError)
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to create invite")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	log.Info().Str("orgID", orgID).Str("inviteID", invite.InviteID).Str("role", string(invite.Role)).Msg("Invite created")
+	if err := json.NewEncoder(w).Encode(invite); err != nil {
+		log.Error().Err(err).Str("orgID", orgID).Msg("Failed to encode invite response")
+	}
+}
+
+func (h *OrganisationHandler) RevokeOrgInviteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, inviteID := vars["orgID"], vars["inviteID"]
+
+	invite, err := h.InviteStore.GetInvite(h.Ctx, inviteID)
+	if errors.Is(err, fs.ErrNotFound) || (err == nil && invite.OrgID != orgID) {
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		log.Info().Str("orgID", orgID).Str("inviteID", inviteID).Msg("Revoke of an invite not to this organisation")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error revoking invite", http.StatusInternalServerError)
+		log.Error().Err(err).Str("inviteID", inviteID).Msg("Failed to get invite")
+		return
+	}
+	if caller := callerOrgRole(r); !canManageOrgRole(caller, invite.Role) {
+		http.Error(w, "You can only revoke invites with roles below yours", http.StatusForbidden)
+		log.Warn().Str("orgID", orgID).Str("inviteID", inviteID).Str("role", string(caller)).Msg("Revoke of invite above caller's role")
+		return
+	}
+	if _, err := h.InviteStore.CloseInvite(h.Ctx, inviteID, firestore.InviteRevoked); err != nil {
+		writeCloseInviteError(w, err, inviteID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info().Str("orgID", orgID).Str("inviteID", inviteID).Msg("Invite revoked")
+}
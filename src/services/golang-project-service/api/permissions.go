@@ -0,0 +1,405 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	fs "pkg/gcp/firestore"
+	"pkg/jwt"
+	"pkg/roles"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// anyUser is the role of routes that are not about an existing project or organisation, which any logged in user
+// may call.
+const anyUser roles.Role = ""
+
+// routeRoles is the role a user needs in the project or organisation a route is about to call it, keyed by method
+// and pattern. Every route of the project service must be listed; registering one that is not panics at startup.
+var routeRoles = map[string]roles.Role{
+	// projects
+	"GET /projects/{projectID}":       roles.Viewer,
+	"POST /projects":                  anyUser,
+	"DELETE /projects/{projectID}":    roles.Owner,
+	"PATCH /projects/{projectID}":     roles.Admin,
+	"GET /projects/{projectID}/stats": roles.Viewer,
+	// the new owner is checked by TransferProjectHandler
+	"POST /projects/{projectID}/transfer": roles.Owner,
+	"GET /projects/{projectID}/audit":     roles.Owner,
+
+	// members and invites; members may remove themselves, which DeleteMemberHandler allows
+	"GET /projects/{projectID}/members":               roles.Viewer,
+	"PATCH /projects/{projectID}/members/{userID}":    roles.Admin,
+	"DELETE /projects/{projectID}/members/{userID}":   roles.Viewer,
+	"GET /projects/{projectID}/invites":               roles.Admin,
+	"POST /projects/{projectID}/invites":              roles.Admin,
+	"DELETE /projects/{projectID}/invites/{inviteID}": roles.Admin,
+	"GET /invites":                     anyUser,
+	"POST /invites/{inviteID}/accept":  anyUser,
+	"POST /invites/{inviteID}/decline": anyUser,
+
+	// organisations; owners may also change other owners, which the handlers allow
+	"POST /organisations":                              anyUser,
+	"GET /organisations":                               anyUser,
+	"GET /organisations/{orgID}":                       roles.Viewer,
+	"PATCH /organisations/{orgID}":                     roles.Admin,
+	"DELETE /organisations/{orgID}":                    roles.Owner,
+	"GET /organisations/{orgID}/projects":              roles.Viewer,
+	"GET /organisations/{orgID}/members":               roles.Viewer,
+	"PATCH /organisations/{orgID}/members/{userID}":    roles.Admin,
+	"DELETE /organisations/{orgID}/members/{userID}":   roles.Viewer,
+	"GET /organisations/{orgID}/invites":               roles.Admin,
+	"POST /organisations/{orgID}/invites":              roles.Admin,
+	"DELETE /organisations/{orgID}/invites/{inviteID}": roles.Admin,
+
+	// batches; the project of a new batch is in the body, so CreateBatchHandler checks it
+	"POST /batch":                          roles.Admin,
+	"PUT /batch/{batchID}":                 roles.Admin,
+	"DELETE /batch/{batchID}":              roles.Admin,
+	"GET /projects/{projectID}/batches":    roles.Viewer,
+	"GET /batch/{batchID}":                 roles.Viewer,
+	"DELETE /projects/{projectID}/batches": roles.Admin,
+	"PATCH /batch/{batchID}":               roles.Reviewer,
+
+	// images
+	"GET /batch/{batchID}/images":                      roles.Viewer,
+	"POST /batch/{batchID}/images":                     roles.Admin,
+	"DELETE /batch/{batchID}/images":                   roles.Admin,
+	"GET /images/{imageID}/previous":                   roles.Viewer,
+	"POST /images/{imageID}/annotations/copy_previous": roles.Annotator,
+
+	// keypoints
+	"POST /projects/{projectID}/images/{imageID}/keypoints":             roles.Annotator,
+	"GET /projects/{projectID}/images/{imageID}/keypoints":              roles.Viewer,
+	"GET /projects/{projectID}/boundingboxes/{boundingBoxID}/keypoints": roles.Viewer,
+	"GET /projects/{projectID}/keypoints/{keypointID}":                  roles.Viewer,
+	"PATCH /projects/{projectID}/keypoints/{keypointID}":                roles.Annotator,
+	"DELETE /projects/{projectID}/keypoints/{keypointID}":               roles.Annotator,
+
+	// bounding boxes
+	"POST /projects/{projectID}/images/{imageID}/boundingboxes":  roles.Annotator,
+	"GET /projects/{projectID}/images/{imageID}/boundingboxes":   roles.Viewer,
+	"GET /projects/{projectID}/boundingboxes/{boundingBoxID}":    roles.Viewer,
+	"PATCH /projects/{projectID}/boundingboxes/{boundingBoxID}":  roles.Annotator,
+	"DELETE /projects/{projectID}/boundingboxes/{boundingBoxID}": roles.Annotator,
+
+	// labels
+	"POST /projects/{projectID}/keypointlabels":                          roles.Admin,
+	"GET /projects/{projectID}/keypointlabels":                           roles.Viewer,
+	"DELETE /projects/{projectID}/keypointlabel/{keypointLabelID}":       roles.Admin,
+	"PATCH /projects/{projectID}/keypointlabel/{keypointLabelID}":        roles.Admin,
+	"POST /projects/{projectID}/boundingboxlabels":                       roles.Admin,
+	"GET /projects/{projectID}/boundingboxlabels":                        roles.Viewer,
+	"DELETE /projects/{projectID}/boundingboxlabel/{boundingBoxLabelID}": roles.Admin,
+	"PATCH /projects/{projectID}/boundingboxlabel/{boundingBoxLabelID}":  roles.Admin,
+
+	// exports
+	"GET /project/{projectID}/keypoints/export/coco":           roles.Viewer,
+	"GET /project/{projectID}/boundingboxes/export/coco":       roles.Viewer,
+	"GET /project/{projectID}/boundingboxes/export/pascal_voc": roles.Viewer,
+}
+
+// routeRole returns the role rt needs, from routeRoles.
+func routeRole(rt Route) roles.Role {
+	role, ok := routeRoles[rt.method+" "+rt.pattern]
+	if !ok {
+		panic(fmt.Sprintf("no role for route %s %s in routeRoles", rt.method, rt.pattern))
+	}
+	return role
+}
+
+// Resolver looks up a projectID given some other ID
+type Resolver func(ctx context.Context, id string, stores Stores) (string, error)
+
+// matches the key in the URL with a function that returns the projectID associated with it
+var resolvers = map[string]Resolver{
+	"projectID": func(ctx context.Context, id string, stores Stores) (string, error) {
+		return id, nil
+	},
+	"batchID": func(ctx context.Context, id string, stores Stores) (string, error) {
+		batch, err := stores.BatchStore.GetBatch(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return batch.ProjectID, nil
+	},
+	"imageID": resolveImageProjectID,
+	"keypointID": func(ctx context.Context, id string, stores Stores) (string, error) {
+		kp, err := stores.KeypointStore.GetKeypoint(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return resolveImageProjectID(ctx, kp.ImageID, stores)
+	},
+	"boundingBoxID": func(ctx context.Context, id string, stores Stores) (string, error) {
+		bb, err := stores.BoundingBoxStore.GetBoundingBox(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return resolveImageProjectID(ctx, bb.ImageID, stores)
+	},
+	"keypointLabelID": func(ctx context.Context, id string, stores Stores) (string, error) {
+		label, err := stores.KeypointLabelStore.GetKeypointLabel(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return label.ProjectID, nil
+	},
+	"boundingBoxLabelID": func(ctx context.Context, id string, stores Stores) (string, error) {
+		label, err := stores.BoundingBoxLabelStore.GetBoundingBoxLabel(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return label.ProjectID, nil
+	},
+}
+
+func resolveImageProjectID(ctx context.Context, imageID string, stores Stores) (string, error) {
+	image, err := stores.ImageStore.GetImage(ctx, imageID)
+	if err != nil {
+		return "", err
+	}
+	batch, err := stores.BatchStore.GetBatch(ctx, image.BatchID)
+	if err != nil {
+		return "", err
+	}
+	return batch.ProjectID, nil
+}
+
+var errMixedProjects = errors.New("the IDs in the URL belong to different projects")
+
+// resolveProjectID returns the project the IDs in vars belong to. ok is false if there are none, or the
+// projectID is the "*" wildcard of list routes.
+func resolveProjectID(ctx context.Context, vars map[string]string, stores Stores) (projectID string, ok bool, err error) {
+	for key, resolver := range resolvers {
+		id, found := vars[key]
+		if !found || id == "*" {
+			continue
+		}
+		resolved, err := resolver(ctx, id, stores)
+		if err != nil {
+			return "", false, fmt.Errorf("resolve %s %s: %w", key, id, err)
+		}
+		// a keypoint of another project must not be reachable through a project the user can edit
+		if ok && resolved != projectID {
+			return "", false, errMixedProjects
+		}
+		projectID, ok = resolved, true
+	}
+	return projectID, ok, nil
+}
+
+// ProjectRole returns the role userID has in projectID: owner if it is their project, otherwise the higher of
+// their role in the organisation that owns it and their member role, and the empty role if they have no access.
+func ProjectRole(ctx context.Context, stores Stores, projectID, userID string) (roles.Role, error) {
+	project, err := stores.ProjectStore.GetProject(ctx, projectID)
+	if err != nil {
+		return "", err
+	}
+	if project.UserID == userID {
+		return roles.Owner, nil
+	}
+	var role roles.Role
+	if project.OrgID != "" {
+		if role, err = stores.OrgMemberStore.GetRole(ctx, project.OrgID, userID); err != nil {
+			return "", err
+		}
+	}
+	member, err := stores.MemberStore.GetMember(ctx, projectID, userID)
+	if errors.Is(err, fs.ErrNotFound) {
+		return role, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return roles.Max(role, member.Role), nil
+}
+
+// inSession reports whether userID is in the labelling session of projectID that r names with the X-Session-Id
+// header. Session members can read the project while it runs even if they are not project members.
+func inSession(r *http.Request, stores Stores, projectID, userID string) bool {
+	sessionID := r.Header.Get("X-Session-Id")
+	if sessionID == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	session, err := stores.SessionStore.GetSession(r.Context(), sessionID)
+	if err != nil {
+		log.Debug().Err(err).Str("sessionID", sessionID).Msg("Failed to get session for session access")
+		return false
+	}
+	if session.ProjectID != projectID {
+		return false
+	}
+	if session.Owner.ID == userID {
+		return true
+	}
+	for _, member := range session.Members {
+		if member.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+type projectRoleKey struct{}
+
+type projectIDKey struct{}
+
+// callerRole returns the role RequireProjectRole found the caller to have in the project of the request.
+func callerRole(r *http.Request) roles.Role {
+	role, _ := r.Context().Value(projectRoleKey{}).(roles.Role)
+	return role
+}
+
+// requestProjectID returns the project RequireProjectRole resolved the IDs in the URL to, such as the project of
+// a batch, or "" if there was none.
+func requestProjectID(r *http.Request) string {
+	projectID, _ := r.Context().Value(projectIDKey{}).(string)
+	return projectID
+}
+
+// RequireProjectRole runs before the API routes and only lets the request through if the user it was
+// authenticated as, whether by an access token or a personal access token, has at least role in the project the
+// IDs in the URL belong to. Routes with no project in the URL are let through for the handler to check.
+func RequireProjectRole(role roles.Role, next http.Handler, stores Stores) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := jwt.GetUserID(r)
+		if err != nil {
+			log.Warn().Err(err).Msg("RequireProjectRole: unauthorized - invalid/missing JWT")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if role == anyUser {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		projectID, ok, err := resolveProjectID(r.Context(), mux.Vars(r), stores)
+		if err != nil {
+			log.Warn().Err(err).Str("userID", userID).Msg("RequireProjectRole: failed to resolve projectID")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		have, err := ProjectRole(r.Context(), stores, projectID, userID)
+		if errors.Is(err, fs.ErrNotFound) {
+			log.Warn().Str("userID", userID).Str("projectID", projectID).Msg("RequireProjectRole: project not found")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Str("userID", userID).Str("projectID", projectID).Msg("RequireProjectRole: failed to get role")
+			http.Error(w, "Failed to check access", http.StatusInternalServerError)
+			return
+		}
+		if !have.AtLeast(role) && role == roles.Viewer && inSession(r, stores, projectID, userID) {
+			log.Info().Str("userID", userID).Str("projectID", projectID).Msg("RequireProjectRole: authorized via session membership")
+			have = roles.Viewer
+		}
+		if !have.AtLeast(role) {
+			log.Warn().Str("userID", userID).Str("projectID", projectID).Str("role", string(have)).Str("required", string(role)).Msg("RequireProjectRole: role too low")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), projectRoleKey{}, have)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, projectIDKey{}, projectID)))
+	})
+}
+
+type orgRoleKey struct{}
+
+// callerOrgRole returns the role RequireOrgRole found the caller to have in the organisation of the request.
+func callerOrgRole(r *http.Request) roles.Role {
+	role, _ := r.Context().Value(orgRoleKey{}).(roles.Role)
+	return role
+}
+
+// RequireOrgRole is RequireProjectRole for the organisation routes: it only lets the request through if the user
+// has at least role in the organisation orgID in the URL. Non-members are refused whether or not the
+// organisation exists, so its ID cannot be probed.
+func RequireOrgRole(role roles.Role, next http.Handler, stores Stores) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := jwt.GetUserID(r)
+		if err != nil {
+			log.Warn().Err(err).Msg("RequireOrgRole: unauthorized - invalid/missing JWT")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		orgID, ok := mux.Vars(r)["orgID"]
+		if role == anyUser || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		have, err := stores.OrgMemberStore.GetRole(r.Context(), orgID, userID)
+		if err != nil {
+			log.Error().Err(err).Str("userID", userID).Str("orgID", orgID).Msg("RequireOrgRole: failed to get role")
+			http.Error(w, "Failed to check access", http.StatusInternalServerError)
+			return
+		}
+		if !have.AtLeast(role) {
+			log.Warn().Str("userID", userID).Str("orgID", orgID).Str("role", string(have)).Str("required", string(role)).Msg("RequireOrgRole: role too low")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), orgRoleKey{}, have)))
+	})
+}
+
+// authorizeProject checks the caller has at least role in projectID, for handlers whose project is not in the
+// URL. It writes the error response and returns false if they do not.
+func authorizeProject(w http.ResponseWriter, r *http.Request, stores Stores, projectID string, role roles.Role) bool {
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return false
+	}
+	if projectID == "" {
+		http.Error(w, "projectID is required", http.StatusBadRequest)
+		log.Error().Str("userID", userID).Msg("Request without a projectID")
+		return false
+	}
+	have, err := ProjectRole(r.Context(), stores, projectID, userID)
+	if err != nil && !errors.Is(err, fs.ErrNotFound) {
+		http.Error(w, "Failed to check access", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Str("projectID", projectID).Msg("Failed to get project role")
+		return false
+	}
+	if !have.AtLeast(role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		log.Warn().Str("userID", userID).Str("projectID", projectID).Str("required", string(role)).Msg("User's role in project is too low")
+		return false
+	}
+	return true
+}
+
+// authorizeOrg checks the caller has at least role in orgID, for handlers that are given an organisation in the
+// body. It writes the error response and returns false if they do not.
+func authorizeOrg(w http.ResponseWriter, r *http.Request, stores Stores, orgID string, role roles.Role) bool {
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return false
+	}
+	have, err := stores.OrgMemberStore.GetRole(r.Context(), orgID, userID)
+	if err != nil {
+		http.Error(w, "Failed to check access", http.StatusInternalServerError)
+		log.Error().Err(err).Str("userID", userID).Str("orgID", orgID).Msg("Failed to get organisation role")
+		return false
+	}
+	if !have.AtLeast(role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		log.Warn().Str("userID", userID).Str("orgID", orgID).Str("required", string(role)).Msg("User's role in organisation is too low")
+		return false
+	}
+	return true
+}
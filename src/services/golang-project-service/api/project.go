@@ -1,12 +1,22 @@
 package api
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"pkg/audit"
+	fs "pkg/gcp/firestore"
 	"pkg/handler"
 	"pkg/jwt"
+	"pkg/roles"
 	"project-service/firestore"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
@@ -22,30 +32,37 @@ type ProjectHandler struct {
 	Buckets
 }
 
-func newProjectHandler(h *handler.Handler) *ProjectHandler {
+func newProjectHandler(h *handler.Handler, buckets Buckets) *ProjectHandler {
 	return &ProjectHandler{
 		Handler: h,
 		Stores:  InitialiseStores(h),
-		Buckets: InitialiseBuckets(h),
+		Buckets: buckets,
 	}
 }
 
-func RegisterProjectRoutes(r *mux.Router, h *handler.Handler) {
-	ph := newProjectHandler(h)
+func RegisterProjectRoutes(r *mux.Router, h *handler.Handler, buckets Buckets) {
+	ph := newProjectHandler(h, buckets)
 
 	routes := []Route{
-		// Get all projects owned by a user
+		// Get a project, or with the * wildcard all projects the user owns or reaches through their organisations
+		// and invites
 		{"GET", "/projects/{projectID}", ph.LoadProjectsHandler},
-		// Create a project
-		{"POST", "/projects", ph.CreateProjectHandler},
+		// Create a project, if the verification policy allows it
+		{"POST", "/projects", jwt.RequireVerifiedEmail(jwt.ActionProjects, http.HandlerFunc(ph.CreateProjectHandler)).ServeHTTP},
 		// Delete a project
-		{"DELETE", "/projects/{projectID}", ph.DeleteProjectHandler},
+		{"DELETE", "/projects/{projectID}", jwt.RequireLogin(http.HandlerFunc(ph.DeleteProjectHandler)).ServeHTTP},
 		// Update project
 		{"PATCH", "/projects/{projectID}", ph.UpdateProjectHandler},
+		// Get image and annotation totals for the project dashboard
+		{"GET", "/projects/{projectID}/stats", ph.LoadProjectStatsHandler},
+		// Hand a project over to another user or an organisation
+		{"POST", "/projects/{projectID}/transfer", jwt.RequireLogin(http.HandlerFunc(ph.TransferProjectHandler)).ServeHTTP},
+		// Read the project's audit log, filtered by user and time range
+		{"GET", "/projects/{projectID}/audit", ph.ListAuditEventsHandler},
 	}
 
 	for _, rt := range routes {
-		wrapped := h.AuthMw(ValidateOwnershipMiddleware(http.HandlerFunc(rt.handlerFunc), ph.Stores))
+		wrapped := h.AuthMw(RequireProjectRole(routeRole(rt), http.HandlerFunc(rt.handlerFunc), ph.Stores))
 		r.Handle(rt.pattern, wrapped).Methods(rt.method)
 	}
 }
@@ -53,7 +70,7 @@ func RegisterProjectRoutes(r *mux.Router, h *handler.Handler) {
 func (h *ProjectHandler) LoadProjectsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	projectID := vars["projectID"]
-	userID, err := jwt.GetUserIDFromJWT(r)
+	userID, err := jwt.GetUserID(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		log.Error().Err(err).Msg("Failed to get userID from JWT")
@@ -62,7 +79,25 @@ func (h *ProjectHandler) LoadProjectsHandler(w http.ResponseWriter, r *http.Requ
 
 	// if wildcard, return all projectID
 	if projectID == "*" {
-		projects, err := h.ProjectStore.GetProjectsByUserID(h.Ctx, userID)
+		pageSize, pageToken, paged, err := parsePagination(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Error().Err(err).Str("userID", userID).Msg("Invalid pagination parameters")
+			return
+		}
+
+		var projects []firestore.Project
+		var nextPageToken string
+		if paged {
+			projects, nextPageToken, err = h.loadProjectsPage(h.Ctx, userID, pageSize, pageToken)
+		} else {
+			projects, err = h.loadProjects(h.Ctx, userID)
+		}
+		if err == fs.ErrInvalidPageToken {
+			http.Error(w, "Invalid pageToken", http.StatusBadRequest)
+			log.Error().Err(err).Str("userID", userID).Msg("Invalid page token")
+			return
+		}
 		if err != nil {
 			http.Error(w, "Error getting projects", http.StatusInternalServerError)
 			log.Error().Str("projectID", projectID).Err(err).Msg("Failed to get projects by Project ID")
@@ -79,6 +114,9 @@ func (h *ProjectHandler) LoadProjectsHandler(w http.ResponseWriter, r *http.Requ
 			projects[i].NumberOfBatches = count
 		}
 
+		if nextPageToken != "" {
+			w.Header().Set(NextPageTokenHeader, nextPageToken)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		log.Info().Str("userID", userID).Msg("Successfully returned projects by User ID")
@@ -101,6 +139,7 @@ func (h *ProjectHandler) LoadProjectsHandler(w http.ResponseWriter, r *http.Requ
 			return
 		}
 		project.NumberOfBatches = count
+		project.Role = callerRole(r)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -112,6 +151,141 @@ func (h *ProjectHandler) LoadProjectsHandler(w http.ResponseWriter, r *http.Requ
 
 }
 
+// sharedPageTokenPrefix starts the page tokens of the projects of the user's organisations and the ones shared
+// with them, which are listed after the user's own
+const sharedPageTokenPrefix = "shared."
+
+// loadProjects returns the projects userID owns followed by the ones of their organisations and the ones shared
+// with them.
+func (h *ProjectHandler) loadProjects(ctx context.Context, userID string) ([]firestore.Project, error) {
+	orgRoles, err := h.organisationRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := h.ProjectStore.GetProjectsByUserID(ctx, userID, slices.Collect(maps.Keys(orgRoles)))
+	if err != nil {
+		return nil, err
+	}
+	var owned, others []firestore.Project
+	for _, p := range projects {
+		if p.UserID == userID {
+			p.Role = roles.Owner
+			owned = append(owned, p)
+		} else {
+			p.Role = orgRoles[p.OrgID]
+			others = append(others, p)
+		}
+	}
+	others, err = h.addSharedProjects(ctx, userID, others)
+	if err != nil {
+		return nil, err
+	}
+	return append(owned, others...), nil
+}
+
+// loadProjectsPage returns one page of what loadProjects does. The user's own projects are paged through with
+// the store's page tokens, then the others with a sharedPageTokenPrefix token holding how many have been listed
+// already.
+func (h *ProjectHandler) loadProjectsPage(ctx context.Context, userID string, pageSize int, pageToken string) ([]firestore.Project, string, error) {
+	var projects []firestore.Project
+	offset := 0
+	if rawOffset, ok := strings.CutPrefix(pageToken, sharedPageTokenPrefix); ok {
+		var err error
+		if offset, err = strconv.Atoi(rawOffset); err != nil || offset < 0 {
+			return nil, "", fs.ErrInvalidPageToken
+		}
+	} else {
+		owned, nextPageToken, err := h.ProjectStore.GetProjectsPageByUserID(ctx, userID, pageSize, pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		for i := range owned {
+			owned[i].Role = roles.Owner
+		}
+		if nextPageToken != "" {
+			return owned, nextPageToken, nil
+		}
+		projects = owned
+	}
+
+	others, err := h.otherProjects(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if offset > len(others) {
+		return nil, "", fs.ErrInvalidPageToken
+	}
+	end := min(offset+pageSize-len(projects), len(others))
+	projects = append(projects, others[offset:end]...)
+	if end == len(others) {
+		return projects, "", nil
+	}
+	return projects, sharedPageTokenPrefix + strconv.Itoa(end), nil
+}
+
+// organisationRoles returns the role userID has in each organisation they belong to, by organisation ID.
+func (h *ProjectHandler) organisationRoles(ctx context.Context, userID string) (map[string]roles.Role, error) {
+	memberships, err := h.OrgMemberStore.GetMembershipsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	orgRoles := make(map[string]roles.Role, len(memberships))
+	for _, m := range memberships {
+		orgRoles[m.OrgID] = m.Role
+	}
+	return orgRoles, nil
+}
+
+// otherProjects returns the projects userID can reach without owning them: those of their organisations and the
+// ones shared with them, ordered by name.
+func (h *ProjectHandler) otherProjects(ctx context.Context, userID string) ([]firestore.Project, error) {
+	orgRoles, err := h.organisationRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := h.ProjectStore.GetProjectsByOrgIDs(ctx, slices.Collect(maps.Keys(orgRoles)))
+	if err != nil {
+		return nil, err
+	}
+	for i := range projects {
+		projects[i].Role = orgRoles[projects[i].OrgID]
+	}
+	return h.addSharedProjects(ctx, userID, projects)
+}
+
+// addSharedProjects adds the projects userID is a member of to projects and orders them all by name. A project
+// that is already there, through an organisation, gets the member role if it is higher.
+func (h *ProjectHandler) addSharedProjects(ctx context.Context, userID string, projects []firestore.Project) ([]firestore.Project, error) {
+	memberships, err := h.MemberStore.GetMembershipsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range memberships {
+		if i := slices.IndexFunc(projects, func(p firestore.Project) bool { return p.ProjectID == m.ProjectID }); i >= 0 {
+			projects[i].Role = roles.Max(projects[i].Role, m.Role)
+			continue
+		}
+		project, err := h.ProjectStore.GetProject(ctx, m.ProjectID)
+		if errors.Is(err, fs.ErrNotFound) {
+			// the project is being deleted
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if project.UserID == userID {
+			// a stale membership of a project transferred to the user, who lists it as their own
+			continue
+		}
+		project.Role = m.Role
+		projects = append(projects, *project)
+	}
+	slices.SortFunc(projects, func(a, b firestore.Project) int {
+		return cmp.Or(strings.Compare(a.ProjectName, b.ProjectName), strings.Compare(a.ProjectID, b.ProjectID))
+	})
+	return projects, nil
+}
+
 func (h *ProjectHandler) CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
 	var req firestore.CreateProjectRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -119,6 +293,20 @@ func (h *ProjectHandler) CreateProjectHandler(w http.ResponseWriter, r *http.Req
 		log.Error().Err(err).Msg("Invalid create project request")
 		return
 	}
+	// projects belong to the caller, or to an organisation they administer, whatever the body says
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return
+	}
+	req.UserID = userID
+	if req.OrgID != "" {
+		if !authorizeOrg(w, r, h.Stores, req.OrgID, roles.Admin) {
+			return
+		}
+		req.UserID = ""
+	}
 
 	projectID, err := h.ProjectStore.CreateProject(h.Ctx, req)
 	if err != nil {
@@ -152,6 +340,9 @@ func (h *ProjectHandler) CreateProjectHandler(w http.ResponseWriter, r *http.Req
 		}
 		log.Info().Str("projectID", projectID).Msg("Created default labels")
 	}
+	created := projectEvent(audit.ActionCreateProject, projectID, audit.ResourceProject, projectID)
+	created.Details = map[string]string{"name": req.ProjectName}
+	h.Audit.RecordRequest(r, created)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -166,78 +357,96 @@ func (h *ProjectHandler) CreateProjectHandler(w http.ResponseWriter, r *http.Req
 func (h *ProjectHandler) DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	projectID := vars["projectID"]
-	// 1) Get batches under this project
-	batches, err := h.BatchStore.GetBatchesByProjectID(h.Ctx, projectID)
-	if err != nil {
+	if err := h.deleteProject(h.Ctx, projectID); err != nil {
 		http.Error(w, "Error deleting project", http.StatusInternalServerError)
-		log.Error().Err(err).Str("projectID", projectID).Msg("Error listing batches during project delete")
+		log.Error().Err(err).Str("projectID", projectID).Msg("Error deleting project")
 		return
 	}
+	h.Audit.RecordRequest(r, projectEvent(audit.ActionDeleteProject, projectID, audit.ResourceProject, projectID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	log.Info().Str("projectID", projectID).Msg("Project deleted successfully")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"projectID": projectID,
+		"deleted":   true,
+		"message":   "Project deleted",
+	})
+}
+
+// deleteProject deletes a project and everything in it: its batches, their images in the bucket and in
+// Firestore, the annotations on those images, the project's labels, and its members and invites. The project
+// document goes last, so if anything fails the project is still there and deleting it again picks up where this
+// left off.
+func (h *ProjectHandler) deleteProject(ctx context.Context, projectID string) error {
+	// 1) Get batches under this project
+	batches, err := h.BatchStore.GetBatchesByProjectID(ctx, projectID)
+	if err != nil {
+		return fmt.Errorf("list batches: %w", err)
+	}
 
-	// 2) For each batch, delete images (bucket + firestore), and any annotations
-	allImageIDs := make([]string, 0, 64)
+	// 2) List the images of every batch for annotation deletion later
+	batchIDs := make([]string, 0, len(batches))
 	for _, b := range batches {
-		// list images for annotation deletion later
-		imgs, err := h.ImageStore.GetImagesByBatchID(h.Ctx, b.BatchID)
-		if err != nil {
-			http.Error(w, "Error deleting project: list images", http.StatusInternalServerError)
-			log.Error().Err(err).Str("projectID", projectID).Str("batchID", b.BatchID).Msg("Error listing images for batch during project delete")
-			return
-		}
-		for _, img := range imgs {
-			allImageIDs = append(allImageIDs, img.ImageID)
-		}
-		// delete images in bucket
-		if err := h.ImageBucket.DeleteImagesByBatchID(h.Ctx, b.BatchID); err != nil {
-			http.Error(w, "Error deleting project images", http.StatusInternalServerError)
-			log.Error().Err(err).Str("projectID", projectID).Str("batchID", b.BatchID).Msg("Error deleting images in bucket for batch")
-			return
-		}
-		// delete image metadata in firestore
-		if err := h.ImageStore.DeleteImagesByBatchID(h.Ctx, b.BatchID); err != nil {
-			http.Error(w, "Error deleting project images metadata", http.StatusInternalServerError)
-			log.Error().Err(err).Str("projectID", projectID).Str("batchID", b.BatchID).Msg("Error deleting images metadata for batch")
-			return
-		}
+		batchIDs = append(batchIDs, b.BatchID)
+	}
+	allImageIDs, err := h.ImageStore.GetImageIDsByBatchIDs(ctx, batchIDs)
+	if err != nil {
+		return fmt.Errorf("list images: %w", err)
 	}
 
-	// 2b) Delete annotations associated with those images (keypoints, bounding boxes)
-	if len(allImageIDs) > 0 {
-		if err := h.KeypointStore.DeleteKeypointsByImageIDs(h.Ctx, allImageIDs); err != nil {
-			http.Error(w, "Error deleting project keypoints", http.StatusInternalServerError)
-			log.Error().Err(err).Str("projectID", projectID).Msg("Error deleting keypoints for project images")
-			return
-		}
-		if err := h.BoundingBoxStore.DeleteBoundingBoxesByImageIDs(h.Ctx, allImageIDs); err != nil {
-			http.Error(w, "Error deleting project bounding boxes", http.StatusInternalServerError)
-			log.Error().Err(err).Str("projectID", projectID).Msg("Error deleting bounding boxes for project images")
-			return
+	// 2b) Delete images in bucket for each batch
+	for _, b := range batches {
+		if err := h.ImageBucket.DeleteImagesByBatchID(ctx, b.BatchID); err != nil {
+			return fmt.Errorf("delete images in bucket for batch %s: %w", b.BatchID, err)
 		}
 	}
 
-	// 3) Delete all batches for this project
-	if err := h.BatchStore.DeleteAllBatches(h.Ctx, projectID); err != nil {
-		http.Error(w, "Error deleting project batches", http.StatusInternalServerError)
-		log.Error().Err(err).Str("projectID", projectID).Msg("Error deleting batches for project")
-		return
+	// 3) Queue deletes of image metadata, annotations, labels, members, invites and batches on one bulk writer
+	bw := h.Clients.Firestore.NewBulkWriter(ctx)
+	if err := h.ImageStore.DeleteImagesByIDs(bw, allImageIDs); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete images metadata: %w", err)
+	}
+	if err := h.KeypointStore.DeleteKeypointsByImageIDs(ctx, bw, allImageIDs); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete keypoints: %w", err)
+	}
+	if err := h.BoundingBoxStore.DeleteBoundingBoxesByImageIDs(ctx, bw, allImageIDs); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete bounding boxes: %w", err)
+	}
+	if err := h.KeypointLabelStore.DeleteKeypointLabelsByProjectID(ctx, bw, projectID); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete keypoint labels: %w", err)
+	}
+	if err := h.BoundingBoxLabelStore.DeleteBoundingBoxLabelsByProjectID(ctx, bw, projectID); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete bounding box labels: %w", err)
+	}
+	if err := h.MemberStore.DeleteMembersByProjectID(ctx, bw, projectID); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete members: %w", err)
+	}
+	if err := h.InviteStore.DeleteInvitesByProjectID(ctx, bw, projectID); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete invites: %w", err)
+	}
+	if err := h.BatchStore.DeleteBatchesByIDs(bw, batchIDs); err != nil {
+		_ = bw.End()
+		return fmt.Errorf("delete batches: %w", err)
 	}
 
-	// 4) Delete the project itself
-	err = h.ProjectStore.DeleteProject(h.Ctx, projectID)
-	if err != nil {
-		http.Error(w, "Error deleting project", http.StatusInternalServerError)
-		log.Error().Err(err).Str("projectID", projectID).Msg("Error deleting project")
-		return
+	// 3b) Send the queued deletes; the project document is kept if any of them failed so the delete can be retried
+	if err := endBulkWrite(bw); err != nil {
+		return fmt.Errorf("delete batches, images, annotations, labels and members: %w", err)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	log.Info().Str("projectID", projectID).Msg("Project deleted successfully")
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"projectID": projectID,
-		"deleted":   true,
-		"message":   "Project deleted",
-	})
+	// 4) Delete the project itself
+	if err := h.ProjectStore.DeleteProject(ctx, projectID); err != nil {
+		return fmt.Errorf("delete project: %w", err)
+	}
+	return nil
 }
 
 func (h *ProjectHandler) UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
@@ -257,6 +466,7 @@ func (h *ProjectHandler) UpdateProjectHandler(w http.ResponseWriter, r *http.Req
 		log.Error().Err(err).Str("projectID", projectID).Msg("Error updating project settings")
 		return
 	}
+	h.Audit.RecordRequest(r, projectEvent(audit.ActionUpdateProject, projectID, audit.ResourceProject, projectID))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -265,3 +475,208 @@ func (h *ProjectHandler) UpdateProjectHandler(w http.ResponseWriter, r *http.Req
 		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to encode update project response")
 	}
 }
+
+// TransferProjectHandler hands a project over to another user or an organisation. A new user owner must already
+// have access to the project, so nobody is given a project they have not accepted, and a new organisation owner
+// must be one the caller administers. A user who owned the project stays on as an admin.
+func (h *ProjectHandler) TransferProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["projectID"]
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT")
+		return
+	}
+
+	var req firestore.TransferProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.UserID == "") == (req.OrgID == "") {
+		http.Error(w, "Exactly one of userID and orgID is required", http.StatusBadRequest)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Invalid transfer project request")
+		return
+	}
+	project, err := h.ProjectStore.GetProject(h.Ctx, projectID)
+	if err != nil {
+		http.Error(w, "Error getting project", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to get project to transfer")
+		return
+	}
+	if project.UserID == req.UserID && project.OrgID == req.OrgID {
+		http.Error(w, "The project already belongs to them", http.StatusBadRequest)
+		return
+	}
+
+	if req.OrgID != "" {
+		if !authorizeOrg(w, r, h.Stores, req.OrgID, roles.Admin) {
+			return
+		}
+	} else {
+		role, err := ProjectRole(h.Ctx, h.Stores, projectID, req.UserID)
+		if err != nil {
+			http.Error(w, "Error transferring project", http.StatusInternalServerError)
+			log.Error().Err(err).Str("projectID", projectID).Str("newOwner", req.UserID).Msg("Failed to get role of new owner")
+			return
+		}
+		if role == "" {
+			http.Error(w, "The new owner must already be a member of the project", http.StatusBadRequest)
+			log.Info().Str("projectID", projectID).Str("newOwner", req.UserID).Msg("Transfer to a user without access")
+			return
+		}
+	}
+
+	// the previous owner keeps access before ownership moves, so a failure part way never locks them out
+	if project.UserID != "" {
+		if _, err := h.MemberStore.AddMember(h.Ctx, projectID, project.UserID, roles.Admin, userID); err != nil {
+			http.Error(w, "Error transferring project", http.StatusInternalServerError)
+			log.Error().Err(err).Str("projectID", projectID).Msg("Failed to keep previous owner as a member")
+			return
+		}
+	}
+	if err := h.ProjectStore.TransferProject(h.Ctx, projectID, req); err != nil {
+		http.Error(w, "Error transferring project", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to transfer project")
+		return
+	}
+	// owners have no member document; one left behind is harmless, since ownership outranks it
+	if req.UserID != "" {
+		if _, err := h.MemberStore.RemoveMember(h.Ctx, projectID, req.UserID, nil); err != nil && !errors.Is(err, fs.ErrNotFound) {
+			log.Warn().Err(err).Str("projectID", projectID).Str("userID", req.UserID).Msg("Failed to remove membership of new owner")
+		}
+	}
+
+	transferred := projectEvent(audit.ActionTransferProject, projectID, audit.ResourceProject, projectID)
+	transferred.Details = map[string]string{
+		"previousUserID": project.UserID,
+		"previousOrgID":  project.OrgID,
+		"userID":         req.UserID,
+		"orgID":          req.OrgID,
+	}
+	h.Audit.RecordRequest(r, transferred)
+
+	w.Header().Set("Content-Type", "application/json")
+	log.Info().Str("projectID", projectID).Str("userID", req.UserID).Str("orgID", req.OrgID).Str("transferredBy", userID).Msg("Project transferred")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"projectID":   projectID,
+		"userID":      req.UserID,
+		"orgID":       req.OrgID,
+		"transferred": true,
+	})
+}
+
+type BatchStats struct {
+	BatchID    string `json:"batchID"`
+	BatchName  string `json:"batchName"`
+	IsComplete bool   `json:"isComplete"`
+	firestore.ImageStats
+	NumberOfKeypoints     int64            `json:"numberOfKeypoints"`
+	NumberOfBoundingBoxes int64            `json:"numberOfBoundingBoxes"`
+	KeypointsByLabel      map[string]int64 `json:"keypointsByLabel"`
+	BoundingBoxesByLabel  map[string]int64 `json:"boundingBoxesByLabel"`
+}
+
+type ProjectStats struct {
+	ProjectID               string           `json:"projectID"`
+	NumberOfBatches         int64            `json:"numberOfBatches"`
+	NumberOfCompleteBatches int64            `json:"numberOfCompleteBatches"`
+	NumberOfImages          int64            `json:"numberOfImages"`
+	NumberOfKeypoints       int64            `json:"numberOfKeypoints"`
+	NumberOfBoundingBoxes   int64            `json:"numberOfBoundingBoxes"`
+	KeypointsByLabel        map[string]int64 `json:"keypointsByLabel"`
+	BoundingBoxesByLabel    map[string]int64 `json:"boundingBoxesByLabel"`
+	Batches                 []BatchStats     `json:"batches"`
+}
+
+// LoadProjectStatsHandler returns image totals and annotation counts per label for every batch in the project.
+// All numbers come from aggregation queries, so no annotation documents are read.
+func (h *ProjectHandler) LoadProjectStatsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectID"]
+
+	batches, err := h.BatchStore.GetBatchesByProjectID(h.Ctx, projectID)
+	if err != nil {
+		http.Error(w, "Error getting project stats", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to get batches for project stats")
+		return
+	}
+	keypointLabels, err := h.KeypointLabelStore.GetKeypointLabelsByProjectID(h.Ctx, projectID)
+	if err != nil {
+		http.Error(w, "Error getting project stats", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to get keypoint labels for project stats")
+		return
+	}
+	boundingBoxLabels, err := h.BoundingBoxLabelStore.GetBoundingBoxLabelsByProjectID(h.Ctx, projectID)
+	if err != nil {
+		http.Error(w, "Error getting project stats", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to get bounding box labels for project stats")
+		return
+	}
+	keypointLabelIDs := make([]string, 0, len(keypointLabels))
+	for _, l := range keypointLabels {
+		keypointLabelIDs = append(keypointLabelIDs, l.KeypointLabelID)
+	}
+	boundingBoxLabelIDs := make([]string, 0, len(boundingBoxLabels))
+	for _, l := range boundingBoxLabels {
+		boundingBoxLabelIDs = append(boundingBoxLabelIDs, l.BoundingBoxLabelID)
+	}
+
+	stats := ProjectStats{
+		ProjectID:            projectID,
+		NumberOfBatches:      int64(len(batches)),
+		KeypointsByLabel:     make(map[string]int64, len(keypointLabelIDs)),
+		BoundingBoxesByLabel: make(map[string]int64, len(boundingBoxLabelIDs)),
+		Batches:              make([]BatchStats, 0, len(batches)),
+	}
+	for _, b := range batches {
+		batchStats, err := h.loadBatchStats(h.Ctx, b, keypointLabelIDs, boundingBoxLabelIDs)
+		if err != nil {
+			http.Error(w, "Error getting project stats", http.StatusInternalServerError)
+			log.Error().Err(err).Str("projectID", projectID).Str("batchID", b.BatchID).Msg("Failed to aggregate batch stats")
+			return
+		}
+		if b.IsComplete {
+			stats.NumberOfCompleteBatches++
+		}
+		stats.NumberOfImages += batchStats.NumberOfImages
+		stats.NumberOfKeypoints += batchStats.NumberOfKeypoints
+		stats.NumberOfBoundingBoxes += batchStats.NumberOfBoundingBoxes
+		for id, n := range batchStats.KeypointsByLabel {
+			stats.KeypointsByLabel[id] += n
+		}
+		for id, n := range batchStats.BoundingBoxesByLabel {
+			stats.BoundingBoxesByLabel[id] += n
+		}
+		stats.Batches = append(stats.Batches, batchStats)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Error().Err(err).Str("projectID", projectID).Msg("Failed to encode project stats response")
+		return
+	}
+	log.Info().Str("projectID", projectID).Msg("Successfully returned project stats")
+}
+
+func (h *ProjectHandler) loadBatchStats(ctx context.Context, b firestore.Batch, keypointLabelIDs, boundingBoxLabelIDs []string) (BatchStats, error) {
+	imageStats, err := h.ImageStore.GetImageStatsByBatchID(ctx, b.BatchID)
+	if err != nil {
+		return BatchStats{}, err
+	}
+	imageIDs, err := h.ImageStore.GetImageIDsByBatchIDs(ctx, []string{b.BatchID})
+	if err != nil {
+		return BatchStats{}, err
+	}
+	batchStats := BatchStats{BatchID: b.BatchID, BatchName: b.BatchName, IsComplete: b.IsComplete, ImageStats: imageStats}
+	if batchStats.NumberOfKeypoints, err = h.KeypointStore.CountKeypointsByImageIDs(ctx, imageIDs); err != nil {
+		return BatchStats{}, err
+	}
+	if batchStats.NumberOfBoundingBoxes, err = h.BoundingBoxStore.CountBoundingBoxesByImageIDs(ctx, imageIDs); err != nil {
+		return BatchStats{}, err
+	}
+	if batchStats.KeypointsByLabel, err = h.KeypointStore.CountKeypointsByLabel(ctx, imageIDs, keypointLabelIDs); err != nil {
+		return BatchStats{}, err
+	}
+	if batchStats.BoundingBoxesByLabel, err = h.BoundingBoxStore.CountBoundingBoxesByLabel(ctx, imageIDs, boundingBoxLabelIDs); err != nil {
+		return BatchStats{}, err
+	}
+	return batchStats, nil
+}
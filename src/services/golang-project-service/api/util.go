@@ -1,10 +1,18 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"pkg/audit"
+	"pkg/gcp/bucket"
+	fs "pkg/gcp/firestore"
 	"pkg/handler"
 	bk "project-service/bucket"
 	"project-service/firestore"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 type Route struct {
@@ -22,6 +30,11 @@ type Stores struct {
 	BoundingBoxStore      *firestore.BoundingBoxStore
 	BoundingBoxLabelStore *firestore.BoundingBoxLabelStore
 	SessionStore          *firestore.SessionStore
+	MemberStore           *firestore.MemberStore
+	InviteStore           *firestore.InviteStore
+	UserStore             *firestore.UserStore
+	OrganisationStore     *firestore.OrganisationStore
+	OrgMemberStore        *firestore.OrgMemberStore
 }
 
 type Buckets struct {
@@ -38,11 +51,86 @@ func InitialiseStores(h *handler.Handler) Stores {
 		BoundingBoxStore:      firestore.NewBoundingBoxStore(h.Clients.Firestore),
 		BoundingBoxLabelStore: firestore.NewBoundingBoxLabelStore(h.Clients.Firestore),
 		SessionStore:          firestore.NewSessionStore(h.Clients.Firestore),
+		MemberStore:           firestore.NewMemberStore(h.Clients.Firestore),
+		InviteStore:           firestore.NewInviteStore(h.Clients.Firestore),
+		UserStore:             firestore.NewUserStore(h.Clients.Firestore),
+		OrganisationStore:     firestore.NewOrganisationStore(h.Clients.Firestore),
+		OrgMemberStore:        firestore.NewOrgMemberStore(h.Clients.Firestore),
 	}
 }
 
-func InitialiseBuckets(h *handler.Handler) Buckets {
+// InitialiseBuckets creates the buckets the handlers share, so they share one cache of signed URLs.
+func InitialiseBuckets(h *handler.Handler, cfg bucket.GenericBucketConfig) Buckets {
 	return Buckets{
-		ImageBucket: bk.NewImageBucket(h.Clients.Bucket),
+		ImageBucket: bk.NewImageBucket(h.Clients.Bucket, cfg),
+	}
+}
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	// NextPageTokenHeader carries the pageToken for the next page of a paginated list response.
+	// It is absent on the last page.
+	NextPageTokenHeader = "X-Next-Page-Token"
+)
+
+var ErrInvalidPageSize = errors.New("pageSize must be a number between 1 and 1000")
+
+// parsePagination reads the optional pageSize and pageToken query parameters.
+// paged is false when neither is set, in which case list endpoints return every result.
+func parsePagination(r *http.Request) (pageSize int, pageToken string, paged bool, err error) {
+	query := r.URL.Query()
+	pageToken = query.Get("pageToken")
+	rawPageSize := query.Get("pageSize")
+	if rawPageSize == "" && pageToken == "" {
+		return 0, "", false, nil
+	}
+
+	pageSize = defaultPageSize
+	if rawPageSize != "" {
+		pageSize, err = strconv.Atoi(rawPageSize)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return 0, "", false, ErrInvalidPageSize
+		}
+	}
+	return pageSize, pageToken, true, nil
+}
+
+var ErrInvalidURLExpiry = errors.New("urlExpiry must be a duration such as 90m or 8h, at most 168h")
+
+// parseURLExpiry reads the optional urlExpiry query parameter. ok is false when it is absent,
+// in which case the bucket's default expiry applies.
+func parseURLExpiry(r *http.Request) (expiry time.Duration, ok bool, err error) {
+	raw := r.URL.Query().Get("urlExpiry")
+	if raw == "" {
+		return 0, false, nil
+	}
+	expiry, err = time.ParseDuration(raw)
+	if err != nil || expiry <= 0 || expiry > bucket.MaxSignedURLExpiry {
+		return 0, false, ErrInvalidURLExpiry
+	}
+	return expiry, true, nil
+}
+
+// projectEvent returns the audit event of a successful action on a resource in projectID.
+func projectEvent(action audit.Action, projectID, resourceType, resourceID string) audit.Event {
+	return audit.Event{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		ProjectID:    projectID,
+		Outcome:      audit.OutcomeSuccess,
+	}
+}
+
+// endBulkWrite flushes bw and logs every document that failed to write.
+func endBulkWrite(bw fs.BulkWriter) error {
+	err := bw.End()
+	var bulkErrs fs.BulkWriteErrors
+	if errors.As(err, &bulkErrs) {
+		for _, e := range bulkErrs {
+			log.Error().Err(e.Err).Str("collection", e.CollectionID).Str("docID", e.DocID).Msg("Bulk write failed for document")
+		}
 	}
+	return err
 }
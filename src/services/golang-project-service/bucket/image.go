@@ -5,14 +5,15 @@ import (
 	"fmt"
 	"io"
 	"pkg/gcp/bucket"
+	"time"
 )
 
 type ImageBucket struct {
 	genericBucket *bucket.GenericBucket
 }
 
-func NewImageBucket(bk bucket.BucketClientInterface) *ImageBucket {
-	return &ImageBucket{genericBucket: bucket.NewGenericBucket(bk)}
+func NewImageBucket(bk bucket.BucketClientInterface, cfg bucket.GenericBucketConfig) *ImageBucket {
+	return &ImageBucket{genericBucket: bucket.NewGenericBucket(bk, cfg.Options()...)}
 }
 
 func (b *ImageBucket) CreateImages(ctx context.Context, batchID string, objectList bucket.ObjectList) (bucket.ObjectList, error) {
@@ -28,6 +29,11 @@ func (b *ImageBucket) DeleteImage(ctx context.Context, batchID string, imageName
 	return b.genericBucket.DeleteObject(ctx, objectName)
 }
 
+// DeleteImages deletes the given object names, e.g. images whose metadata could not be created
+func (b *ImageBucket) DeleteImages(ctx context.Context, objectNames []string) error {
+	return b.genericBucket.DeleteObjects(ctx, objectNames)
+}
+
 func (b *ImageBucket) DeleteImagesByBatchID(ctx context.Context, batchID string) error {
 	return b.genericBucket.DeleteObjectsByPrefix(ctx, batchID)
 }
@@ -43,3 +49,7 @@ func (b *ImageBucket) StreamImage(ctx context.Context, imageName string) (io.Rea
 func (b *ImageBucket) GetSignedURL(ctx context.Context, imageName string) (string, error) {
 	return b.genericBucket.GetSignedURL(ctx, imageName)
 }
+
+func (b *ImageBucket) GetSignedURLWithExpiry(ctx context.Context, imageName string, expiry time.Duration) (string, error) {
+	return b.genericBucket.GetSignedURLWithExpiry(ctx, imageName, expiry)
+}
@@ -7,8 +7,6 @@ import (
 	fs "pkg/gcp/firestore"
 
 	"errors"
-
-	"cloud.google.com/go/firestore"
 )
 
 var ErrSameBatchName = errors.New("new batch name is the same as the current one")
@@ -24,6 +22,9 @@ type Batch struct {
 	ProjectID          string `firestore:"projectID,omitempty" json:"projectID"`
 	NumberOfTotalFiles int64  `firestore:"numberOfTotalFiles,omitempty" json:"numberOfTotalFiles"`
 	IsComplete         bool   `firestore:"isComplete,omitempty" json:"isComplete"`
+	// Annotation totals are aggregated when batches are listed and never stored
+	NumberOfKeypoints     int64 `firestore:"-" json:"numberOfKeypoints"`
+	NumberOfBoundingBoxes int64 `firestore:"-" json:"numberOfBoundingBoxes"`
 }
 
 type CreateBatchRequest struct {
@@ -59,6 +60,28 @@ func (s *BatchStore) GetBatchesByProjectID(ctx context.Context, projectID string
 		return nil, err
 	}
 
+	return batchesFromDocs(docs)
+}
+
+// GetBatchesPageByProjectID returns one page of a project's batches ordered by name.
+// The returned token is empty on the last page.
+func (s *BatchStore) GetBatchesPageByProjectID(ctx context.Context, projectID string, pageSize int, pageToken string) ([]Batch, string, error) {
+	queryParams := []fs.QueryParameter{
+		{Path: "projectID", Op: "==", Value: projectID},
+	}
+	orderBy := []fs.OrderBy{{Path: "batchName", Direction: fs.Asc}}
+	docs, nextPageToken, err := s.genericStore.ReadPage(ctx, queryParams, orderBy, pageSize, pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+	batches, err := batchesFromDocs(docs)
+	if err != nil {
+		return nil, "", err
+	}
+	return batches, nextPageToken, nil
+}
+
+func batchesFromDocs(docs []*fs.DocumentSnapshot) ([]Batch, error) {
 	batches := make([]Batch, 0, len(docs))
 	for _, doc := range docs {
 		var p Batch
@@ -92,7 +115,7 @@ func (s *BatchStore) CreateBatch(ctx context.Context, createBatchReq CreateBatch
 }
 
 func (s *BatchStore) RenameBatch(ctx context.Context, batchID string, renameBatchReq RenameBatchRequest) error {
-	updateParams := []firestore.Update{
+	updateParams := []fs.Update{
 		{Path: "batchName", Value: renameBatchReq.NewBatchName},
 		{Path: "lastUpdated", Value: time.Now()},
 	}
@@ -101,7 +124,7 @@ func (s *BatchStore) RenameBatch(ctx context.Context, batchID string, renameBatc
 }
 
 func (s *BatchStore) UpdateIsComplete(ctx context.Context, batchID string, isCompleteReq UpdateIsCompleteRequest) error {
-	updateParams := []firestore.Update{
+	updateParams := []fs.Update{
 		{Path: "isComplete", Value: isCompleteReq.IsComplete},
 	}
 
@@ -123,6 +146,11 @@ func (s *BatchStore) DeleteAllBatches(ctx context.Context, projectID string) err
 	return nil
 }
 
+// Queue deletes on bw for the provided batchIDs
+func (s *BatchStore) DeleteBatchesByIDs(bw fs.BulkWriter, batchIDs []string) error {
+	return s.genericStore.BulkDeleteDocs(bw, batchIDs)
+}
+
 func (s *BatchStore) GetBatch(ctx context.Context, batchID string) (*Batch, error) {
 	docSnap, err := s.genericStore.GetDoc(ctx, batchID)
 	if err != nil {
@@ -153,15 +181,15 @@ func (s *BatchStore) ListBatchIDsByProjectID(ctx context.Context, projectID stri
 
 // UpdateBatch allows updating batchName and/or isComplete
 func (s *BatchStore) UpdateBatch(ctx context.Context, batchID string, req Batch) (*Batch, error) {
-	updateParams := []firestore.Update{}
+	updateParams := []fs.Update{}
 
 	if req.BatchName != "" {
-		updateParams = append(updateParams, firestore.Update{Path: "batchName", Value: req.BatchName})
+		updateParams = append(updateParams, fs.Update{Path: "batchName", Value: req.BatchName})
 	}
 	// Always update lastUpdated
-	updateParams = append(updateParams, firestore.Update{Path: "lastUpdated", Value: time.Now()})
+	updateParams = append(updateParams, fs.Update{Path: "lastUpdated", Value: time.Now()})
 	// Update isComplete if present (true or false)
-	updateParams = append(updateParams, firestore.Update{Path: "isComplete", Value: req.IsComplete})
+	updateParams = append(updateParams, fs.Update{Path: "isComplete", Value: req.IsComplete})
 
 	if len(updateParams) == 0 {
 		return s.GetBatch(ctx, batchID)
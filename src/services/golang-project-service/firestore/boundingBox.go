@@ -4,8 +4,6 @@ import (
 	"context"
 
 	fs "pkg/gcp/firestore"
-
-	"cloud.google.com/go/firestore"
 )
 
 const boundingBoxCollectionID = "boundingBoxes"
@@ -50,6 +48,35 @@ func NewBoundingBoxStore(client fs.FirestoreClientInterface) *BoundingBoxStore {
 }
 
 // CRUD operations
+// CountBoundingBoxesByImageIDs returns the number of bounding boxes on any of the provided images
+func (s *BoundingBoxStore) CountBoundingBoxesByImageIDs(ctx context.Context, imageIDs []string) (int64, error) {
+	if len(imageIDs) == 0 {
+		return 0, nil
+	}
+	qp := []fs.QueryParameter{{Path: "imageID", Op: "in", Value: imageIDs}}
+	return s.genericStore.GetAggregationWithQuery(ctx, qp, fs.Count)
+}
+
+// CountBoundingBoxesByLabel returns the number of bounding boxes with each of boundingBoxLabelIDs on any of the provided images
+func (s *BoundingBoxStore) CountBoundingBoxesByLabel(ctx context.Context, imageIDs []string, boundingBoxLabelIDs []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(boundingBoxLabelIDs))
+	if len(imageIDs) == 0 {
+		for _, id := range boundingBoxLabelIDs {
+			counts[id] = 0
+		}
+		return counts, nil
+	}
+	qp := []fs.QueryParameter{{Path: "imageID", Op: "in", Value: imageIDs}}
+	grouped, err := s.genericStore.GetGroupedAggregations(ctx, qp, "boundingBoxLabelID", boundingBoxLabelIDs, []fs.AggregationField{{Alias: "count", Aggregation: fs.Count}})
+	if err != nil {
+		return nil, err
+	}
+	for id, result := range grouped {
+		counts[id] = int64(result["count"])
+	}
+	return counts, nil
+}
+
 func (s *BoundingBoxStore) CreateBoundingBox(ctx context.Context, req CreateBoundingBoxRequest) (string, error) {
 	bb := BoundingBox{
 		ImageID:            req.ImageID,
@@ -97,7 +124,7 @@ func (s *BoundingBoxStore) GetBoundingBox(ctx context.Context, boundingBoxID str
 }
 
 func (s *BoundingBoxStore) UpdateBoundingBoxPosition(ctx context.Context, req UpdateBoundingBoxPositionRequest) error {
-	updates := []firestore.Update{
+	updates := []fs.Update{
 		{Path: "box", Value: req.Box},
 		{Path: "boundingBoxLabelID", Value: req.BoundingBoxLabelID},
 	}
@@ -119,14 +146,9 @@ func (s *BoundingBoxStore) DeleteBoundingBoxesByImageID(ctx context.Context, ima
 	return nil
 }
 
-// Delete all bounding boxes associated with any of the provided imageIDs
-func (s *BoundingBoxStore) DeleteBoundingBoxesByImageIDs(ctx context.Context, imageIDs []string) error {
-	for _, id := range imageIDs {
-		if err := s.DeleteBoundingBoxesByImageID(ctx, id); err != nil {
-			return err
-		}
-	}
-	return nil
+// Queue deletes on bw for all bounding boxes associated with any of the provided imageIDs
+func (s *BoundingBoxStore) DeleteBoundingBoxesByImageIDs(ctx context.Context, bw fs.BulkWriter, imageIDs []string) error {
+	return s.genericStore.BulkDeleteDocsByQueryIn(ctx, bw, nil, "imageID", imageIDs)
 }
 
 func (s *BoundingBoxStore) DeleteBoundingBoxesByBoundingBoxLabelID(ctx context.Context, boundingBoxLabelID string) error {
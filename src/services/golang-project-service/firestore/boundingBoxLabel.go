@@ -4,8 +4,6 @@ import (
 	"context"
 
 	fs "pkg/gcp/firestore"
-
-	"cloud.google.com/go/firestore"
 )
 
 const (
@@ -69,46 +67,64 @@ func (s *BoundingBoxLabelStore) CreateBoundingBoxLabel(ctx context.Context, req
 		{Path: "projectID", Op: "==", Value: req.ProjectID},
 	}
 
-	docs, err := s.genericStore.ReadCollection(ctx, qp)
+	// check and create in one transaction so concurrent creates cannot both pass the check
+	var id string
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection(qp)
+		if err != nil {
+			return err
+		}
+		if len(docs) > 0 {
+			return fs.ErrAlreadyExists
+		}
+		id, err = tx.CreateDoc(boundingBoxLabel)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
-	if len(docs) > 0 {
-		return "", fs.ErrAlreadyExists
-	}
-
-	return s.genericStore.CreateDoc(ctx, boundingBoxLabel)
+	return id, nil
 }
 
 func (s *BoundingBoxLabelStore) DeleteBoundingBoxLabel(ctx context.Context, boundingBoxLabelID string) error {
 	return s.genericStore.DeleteDoc(ctx, boundingBoxLabelID)
 }
 
-func (s *BoundingBoxLabelStore) UpdateBoundingBoxLabelName(ctx context.Context, req UpdateBoundingBoxLabelRequest) error {
+// DeleteBoundingBoxLabelsByProjectID queues deletes on bw for every label of projectID.
+func (s *BoundingBoxLabelStore) DeleteBoundingBoxLabelsByProjectID(ctx context.Context, bw fs.BulkWriter, projectID string) error {
+	return s.genericStore.BulkDeleteDocsByQueryIn(ctx, bw, nil, "projectID", []string{projectID})
+}
 
-	bbl, err := s.GetBoundingBoxLabel(ctx, req.BoundingBoxLabelID)
-	if err == fs.ErrNotFound {
-		return fs.ErrNotFound
-	}
+func (s *BoundingBoxLabelStore) UpdateBoundingBoxLabelName(ctx context.Context, req UpdateBoundingBoxLabelRequest) error {
 
-	qp := []fs.QueryParameter{
-		{Path: "boundingBoxLabel", Op: "==", Value: req.BoundingBoxLabel},
-		{Path: "projectID", Op: "==", Value: bbl.ProjectID},
-	}
+	return s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docSnap, err := tx.GetDoc(req.BoundingBoxLabelID)
+		if err != nil {
+			return err
+		}
+		var bbl BoundingBoxLabel
+		if err := docSnap.DataTo(&bbl); err != nil {
+			return err
+		}
 
-	docs, err := s.genericStore.ReadCollection(ctx, qp)
-	if err != nil {
-		return err
-	}
-	if len(docs) > 0 {
-		return fs.ErrAlreadyExists
-	}
+		qp := []fs.QueryParameter{
+			{Path: "boundingBoxLabel", Op: "==", Value: req.BoundingBoxLabel},
+			{Path: "projectID", Op: "==", Value: bbl.ProjectID},
+		}
 
-	updateParams := []firestore.Update{
-		{Path: "boundingBoxLabel", Value: req.BoundingBoxLabel},
-	}
+		docs, err := tx.ReadCollection(qp)
+		if err != nil {
+			return err
+		}
+		if len(docs) > 0 {
+			return fs.ErrAlreadyExists
+		}
 
-	return s.genericStore.UpdateDoc(ctx, req.BoundingBoxLabelID, updateParams)
+		updateParams := []fs.Update{
+			{Path: "boundingBoxLabel", Value: req.BoundingBoxLabel},
+		}
+		return tx.UpdateDoc(req.BoundingBoxLabelID, updateParams)
+	})
 }
 
 func (s *BoundingBoxLabelStore) GetBoundingBoxLabel(ctx context.Context, boundingBoxLabelID string) (BoundingBoxLabel, error) {
@@ -25,6 +25,10 @@ type Image struct {
 	IsSequence  bool      `firestore:"isSequence" json:"isSequence"`
 	PrevImageID string    `firestore:"prevImageID" json:"prevImageID"`
 	NextImageID string    `firestore:"nextImageID" json:"nextImageID"`
+	// UploadedAt is shared by every image stored in one upload and Position is the image's place in it, so
+	// together they give the order images were uploaded in and video frames were extracted in
+	UploadedAt time.Time `firestore:"uploadedAt" json:"uploadedAt"`
+	Position   int64     `firestore:"position" json:"position"`
 }
 
 type ImageStore struct {
@@ -62,6 +66,32 @@ func (s *ImageStore) GetImagesByBatchID(ctx context.Context, batchID string) ([]
 		return nil, err
 	}
 
+	return imagesFromDocs(batchID, docs)
+}
+
+// GetImagesPageByBatchID returns one page of a batch's images in the order they were uploaded, with the frames of a
+// video in frame order. Images stored before uploadedAt and position were recorded are not listed. The returned
+// token is empty on the last page.
+func (s *ImageStore) GetImagesPageByBatchID(ctx context.Context, batchID string, pageSize int, pageToken string) ([]Image, string, error) {
+	queryParams := []fs.QueryParameter{
+		{Path: "batchID", Op: "==", Value: batchID},
+	}
+	orderBy := []fs.OrderBy{
+		{Path: "uploadedAt", Direction: fs.Asc},
+		{Path: "position", Direction: fs.Asc},
+	}
+	docs, nextPageToken, err := s.genericStore.ReadPage(ctx, queryParams, orderBy, pageSize, pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+	images, err := imagesFromDocs(batchID, docs)
+	if err != nil {
+		return nil, "", err
+	}
+	return images, nextPageToken, nil
+}
+
+func imagesFromDocs(batchID string, docs []*fs.DocumentSnapshot) ([]Image, error) {
 	images := make([]Image, 0, len(docs))
 	for _, doc := range docs {
 		var i Image
@@ -83,6 +113,35 @@ func (s *ImageStore) GetTotalImageCountByBatchID(ctx context.Context, batchID st
 	return s.genericStore.GetAggregationWithQuery(ctx, queryParams, fs.Count)
 }
 
+// ImageStats summarises the images of a batch without reading them
+type ImageStats struct {
+	NumberOfImages int64   `json:"numberOfImages"`
+	AverageWidth   float64 `json:"averageWidth"`
+	AverageHeight  float64 `json:"averageHeight"`
+}
+
+func (s *ImageStore) GetImageStatsByBatchID(ctx context.Context, batchID string) (ImageStats, error) {
+	queryParams := []fs.QueryParameter{
+		{Path: "batchID", Op: "==", Value: batchID},
+	}
+	result, err := s.genericStore.GetAggregations(ctx, queryParams, []fs.AggregationField{
+		{Alias: "numberOfImages", Aggregation: fs.Count},
+		{Alias: "averageWidth", Aggregation: fs.Average, Path: "width"},
+		{Alias: "averageHeight", Aggregation: fs.Average, Path: "height"},
+	})
+	if err != nil {
+		return ImageStats{}, err
+	}
+	return ImageStats{
+		NumberOfImages: int64(result["numberOfImages"]),
+		AverageWidth:   result["averageWidth"],
+		AverageHeight:  result["averageHeight"],
+	}, nil
+}
+
+// CreateImageMetadata stores an image document for every object in imageInfo, linking them in order when they are
+// the frames of a sequence. The writes are not atomic, so when they fail the images are returned with the error for
+// the caller to delete, as some of them may have been stored.
 func (s *ImageStore) CreateImageMetadata(ctx context.Context, batchID string, imageInfo bucket.ObjectList, isSequence bool) ([]Image, error) {
 	imageBatch := []Image{}
 
@@ -93,6 +152,7 @@ func (s *ImageStore) CreateImageMetadata(ctx context.Context, batchID string, im
 
 	nextImageID := ""
 	prevImageID := ""
+	uploadedAt := time.Now()
 
 	for i, objectData := range imageInfo {
 		if isSequence {
@@ -116,29 +176,39 @@ func (s *ImageStore) CreateImageMetadata(ctx context.Context, batchID string, im
 			IsSequence:  isSequence,
 			PrevImageID: prevImageID,
 			NextImageID: nextImageID,
+			UploadedAt:  uploadedAt,
+			Position:    int64(i),
 		})
 	}
 
 	imageInterfaces := make([]interface{}, len(imageBatch))
 	for i, img := range imageBatch {
 		imageInterfaces[i] = img
+		imageBatch[i].ImageID = ids[i]
 	}
 
 	if _, err = s.genericStore.CreateDocsBatch(ctx, imageInterfaces, ids); err != nil {
-		return nil, err
+		return imageBatch, err
 	}
 	return imageBatch, nil
 }
 
-func (s *ImageStore) DeleteImagesByBatchID(ctx context.Context, batchID string) error {
-	queryParams := []fs.QueryParameter{
-		{Path: "batchID", Op: "==", Value: batchID},
+// GetImageIDsByBatchIDs returns the IDs of every image in any of the provided batches
+func (s *ImageStore) GetImageIDsByBatchIDs(ctx context.Context, batchIDs []string) ([]string, error) {
+	docs, err := s.genericStore.ReadCollectionIn(ctx, nil, "batchID", batchIDs)
+	if err != nil {
+		return nil, err
 	}
-	err := s.genericStore.DeleteDocsByQuery(ctx, queryParams)
-	if err == fs.ErrNotFound {
-		return nil
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.Ref.ID
 	}
-	return err
+	return ids, nil
+}
+
+// Queue deletes on bw for the image metadata of the provided imageIDs
+func (s *ImageStore) DeleteImagesByIDs(bw fs.BulkWriter, imageIDs []string) error {
+	return s.genericStore.BulkDeleteDocs(bw, imageIDs)
 }
 
 func (s *ImageStore) GetImageMetadata(ctx context.Context, imageID string) (*Image, error) {
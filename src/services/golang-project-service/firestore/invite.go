@@ -0,0 +1,212 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	fs "pkg/gcp/firestore"
+	"pkg/roles"
+)
+
+const (
+	inviteCollectionID = "projectInvites"
+)
+
+var ErrInviteClosed = errors.New("invite has expired, been accepted or been revoked")
+
+type InviteStatus string
+
+const (
+	InvitePending  InviteStatus = "pending"
+	InviteAccepted InviteStatus = "accepted"
+	InviteDeclined InviteStatus = "declined"
+	InviteRevoked  InviteStatus = "revoked"
+)
+
+// Invite offers a role in a project or an organisation to whoever has the invited email. It is accepted by
+// logging in as a user whose verified email it is, so nothing secret has to be sent to them.
+type Invite struct {
+	InviteID string `firestore:"-" json:"inviteID"`
+	// only one of ProjectID and OrgID is set
+	ProjectID string       `firestore:"projectID,omitempty" json:"projectID,omitempty"`
+	OrgID     string       `firestore:"orgID,omitempty" json:"orgID,omitempty"`
+	Email     string       `firestore:"email" json:"email"`
+	Role      roles.Role   `firestore:"role" json:"role"`
+	InvitedBy string       `firestore:"invitedBy" json:"invitedBy"`
+	Status    InviteStatus `firestore:"status" json:"status"`
+	CreatedAt time.Time    `firestore:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time    `firestore:"expiresAt" json:"expiresAt"`
+	// ProjectName or OrgName is filled in when invites are listed for the invited user
+	ProjectName string `firestore:"-" json:"projectName,omitempty"`
+	OrgName     string `firestore:"-" json:"orgName,omitempty"`
+}
+
+type CreateInviteRequest struct {
+	Email string     `json:"email"`
+	Role  roles.Role `json:"role"`
+}
+
+type InviteStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewInviteStore(client fs.FirestoreClientInterface) *InviteStore {
+	return &InviteStore{genericStore: fs.NewGenericStore(client, inviteCollectionID)}
+}
+
+// normaliseEmail is how invite emails are stored and compared, since the same inbox can be typed in any case.
+func normaliseEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func invitesFromDocs(docs []*fs.DocumentSnapshot, now time.Time) ([]Invite, error) {
+	invites := make([]Invite, 0, len(docs))
+	for _, doc := range docs {
+		var inv Invite
+		if err := doc.DataTo(&inv); err != nil {
+			return nil, err
+		}
+		if now.After(inv.ExpiresAt) {
+			continue
+		}
+		inv.InviteID = doc.Ref.ID
+		invites = append(invites, inv)
+	}
+	return invites, nil
+}
+
+// scope is the query for the invites to the same project or organisation as inv.
+func (inv *Invite) scope() fs.QueryParameter {
+	if inv.OrgID != "" {
+		return fs.QueryParameter{Path: "orgID", Op: "==", Value: inv.OrgID}
+	}
+	return fs.QueryParameter{Path: "projectID", Op: "==", Value: inv.ProjectID}
+}
+
+// CreateInvite invites inv.Email to the project or organisation of inv with inv.Role for ttl. An earlier pending
+// invite of the same email to the same place is replaced, so there is only ever one to accept.
+func (s *InviteStore) CreateInvite(ctx context.Context, inv Invite, ttl time.Duration) (*Invite, error) {
+	now := time.Now()
+	inv.Email = normaliseEmail(inv.Email)
+	inv.Status = InvitePending
+	inv.CreatedAt = now
+	inv.ExpiresAt = now.Add(ttl)
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection([]fs.QueryParameter{
+			inv.scope(),
+			{Path: "email", Op: "==", Value: inv.Email},
+			{Path: "status", Op: "==", Value: InvitePending},
+		})
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err := tx.UpdateDoc(doc.Ref.ID, []fs.Update{{Path: "status", Value: InviteRevoked}}); err != nil {
+				return err
+			}
+		}
+		inv.InviteID, err = tx.CreateDoc(inv)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// GetInvite returns the invite inviteID, whatever its status.
+func (s *InviteStore) GetInvite(ctx context.Context, inviteID string) (*Invite, error) {
+	doc, err := s.genericStore.GetDoc(ctx, inviteID)
+	if err != nil {
+		return nil, err
+	}
+	var inv Invite
+	if err := doc.DataTo(&inv); err != nil {
+		return nil, err
+	}
+	inv.InviteID = doc.Ref.ID
+	return &inv, nil
+}
+
+// GetPendingInvitesByProjectID returns the invites to projectID that can still be accepted.
+func (s *InviteStore) GetPendingInvitesByProjectID(ctx context.Context, projectID string) ([]Invite, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "projectID", Op: "==", Value: projectID},
+		{Path: "status", Op: "==", Value: InvitePending},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitesFromDocs(docs, time.Now())
+}
+
+// GetPendingInvitesByOrgID returns the invites to orgID that can still be accepted.
+func (s *InviteStore) GetPendingInvitesByOrgID(ctx context.Context, orgID string) ([]Invite, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "orgID", Op: "==", Value: orgID},
+		{Path: "status", Op: "==", Value: InvitePending},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitesFromDocs(docs, time.Now())
+}
+
+// GetPendingInvitesByEmail returns the invites to email that can still be accepted.
+func (s *InviteStore) GetPendingInvitesByEmail(ctx context.Context, email string) ([]Invite, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "email", Op: "==", Value: normaliseEmail(email)},
+		{Path: "status", Op: "==", Value: InvitePending},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitesFromDocs(docs, time.Now())
+}
+
+// CloseInvite moves a pending invite to status and returns it. It returns ErrInviteClosed if the invite has
+// expired or is no longer pending, and fs.ErrNotFound if there is no such invite.
+func (s *InviteStore) CloseInvite(ctx context.Context, inviteID string, status InviteStatus) (*Invite, error) {
+	var inv Invite
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		doc, err := tx.GetDoc(inviteID)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&inv); err != nil {
+			return err
+		}
+		if inv.Status != InvitePending || time.Now().After(inv.ExpiresAt) {
+			return ErrInviteClosed
+		}
+		return tx.UpdateDoc(inviteID, []fs.Update{{Path: "status", Value: status}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	inv.InviteID = inviteID
+	inv.Status = status
+	return &inv, nil
+}
+
+// ReopenInvite puts an invite closed by CloseInvite back to pending, for when what closing it was for failed.
+func (s *InviteStore) ReopenInvite(ctx context.Context, inviteID string) error {
+	return s.genericStore.UpdateDoc(ctx, inviteID, []fs.Update{{Path: "status", Value: InvitePending}})
+}
+
+// EmailMatches reports whether email is the one inv was sent to.
+func (inv *Invite) EmailMatches(email string) bool {
+	return inv.Email == normaliseEmail(email)
+}
+
+// DeleteInvitesByProjectID queues deletes of every invite to projectID on bw.
+func (s *InviteStore) DeleteInvitesByProjectID(ctx context.Context, bw fs.BulkWriter, projectID string) error {
+	return s.genericStore.BulkDeleteDocsByQueryIn(ctx, bw, nil, "projectID", []string{projectID})
+}
+
+// DeleteInvitesByOrgID queues deletes of every invite to orgID on bw.
+func (s *InviteStore) DeleteInvitesByOrgID(ctx context.Context, bw fs.BulkWriter, orgID string) error {
+	return s.genericStore.BulkDeleteDocsByQueryIn(ctx, bw, nil, "orgID", []string{orgID})
+}
@@ -5,8 +5,6 @@ import (
 	"errors"
 
 	fs "pkg/gcp/firestore"
-
-	"cloud.google.com/go/firestore"
 )
 
 const keypointCollectionID = "keypoints"
@@ -60,6 +58,35 @@ func NewKeypointStore(client fs.FirestoreClientInterface) *KeypointStore {
 }
 
 // CRUD operations
+
+// CountKeypointsByImageIDs returns the number of keypoints on any of the provided images
+func (s *KeypointStore) CountKeypointsByImageIDs(ctx context.Context, imageIDs []string) (int64, error) {
+	if len(imageIDs) == 0 {
+		return 0, nil
+	}
+	qp := []fs.QueryParameter{{Path: "imageID", Op: "in", Value: imageIDs}}
+	return s.genericStore.GetAggregationWithQuery(ctx, qp, fs.Count)
+}
+
+// CountKeypointsByLabel returns the number of keypoints with each of keypointLabelIDs on any of the provided images
+func (s *KeypointStore) CountKeypointsByLabel(ctx context.Context, imageIDs []string, keypointLabelIDs []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(keypointLabelIDs))
+	if len(imageIDs) == 0 {
+		for _, id := range keypointLabelIDs {
+			counts[id] = 0
+		}
+		return counts, nil
+	}
+	qp := []fs.QueryParameter{{Path: "imageID", Op: "in", Value: imageIDs}}
+	grouped, err := s.genericStore.GetGroupedAggregations(ctx, qp, "keypointLabelID", keypointLabelIDs, []fs.AggregationField{{Alias: "count", Aggregation: fs.Count}})
+	if err != nil {
+		return nil, err
+	}
+	for id, result := range grouped {
+		counts[id] = int64(result["count"])
+	}
+	return counts, nil
+}
 func (s *KeypointStore) CreateKeypoint(ctx context.Context, req CreateKeypointRequest) (string, error) {
 	if req.BoundingBoxID == "" {
 		return "", ErrBoundingBoxRequired
@@ -71,14 +98,6 @@ func (s *KeypointStore) CreateKeypoint(ctx context.Context, req CreateKeypointRe
 		{Path: "boundingBoxID", Op: "==", Value: req.BoundingBoxID},
 	}
 
-	docs, err := s.genericStore.ReadCollection(ctx, qp)
-	if err != nil {
-		return "", err
-	}
-	if len(docs) > 0 {
-		return "", fs.ErrAlreadyExists
-	}
-
 	// convert request values into pointers (nil if missing/empty)
 	var imageIDPtr *string
 	if req.ImageID != "" {
@@ -107,7 +126,23 @@ func (s *KeypointStore) CreateKeypoint(ctx context.Context, req CreateKeypointRe
 		BoundingBoxID:   boundingBoxIDPtr,
 	}
 
-	return s.genericStore.CreateDoc(ctx, kp)
+	// check and create in one transaction so concurrent creates cannot both pass the check
+	var id string
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection(qp)
+		if err != nil {
+			return err
+		}
+		if len(docs) > 0 {
+			return fs.ErrAlreadyExists
+		}
+		id, err = tx.CreateDoc(kp)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
 }
 
 func (s *KeypointStore) GetKeypointsByImageID(ctx context.Context, imageID string) ([]Keypoint, error) {
@@ -172,13 +207,13 @@ func (s *KeypointStore) GetKeypoint(ctx context.Context, keypointID string) (*Ke
 }
 
 func (s *KeypointStore) UpdateKeypoint(ctx context.Context, req UpdateKeypointRequest) error {
-	updates := []firestore.Update{}
+	updates := []fs.Update{}
 
 	if req.KeypointLabelID != "" {
-		updates = append(updates, firestore.Update{Path: "keypointLabelID", Value: req.KeypointLabelID})
+		updates = append(updates, fs.Update{Path: "keypointLabelID", Value: req.KeypointLabelID})
 	}
 	if req.Position != nil {
-		updates = append(updates, firestore.Update{Path: "position", Value: req.Position})
+		updates = append(updates, fs.Update{Path: "position", Value: req.Position})
 	}
 
 	return s.genericStore.UpdateDoc(ctx, req.KeypointID, updates)
@@ -198,14 +233,9 @@ func (s *KeypointStore) DeleteKeypointsByImageID(ctx context.Context, imageID st
 	return nil
 }
 
-// Delete all keypoints associated with any of the provided imageIDs
-func (s *KeypointStore) DeleteKeypointsByImageIDs(ctx context.Context, imageIDs []string) error {
-	for _, id := range imageIDs {
-		if err := s.DeleteKeypointsByImageID(ctx, id); err != nil {
-			return err
-		}
-	}
-	return nil
+// Queue deletes on bw for all keypoints associated with any of the provided imageIDs
+func (s *KeypointStore) DeleteKeypointsByImageIDs(ctx context.Context, bw fs.BulkWriter, imageIDs []string) error {
+	return s.genericStore.BulkDeleteDocsByQueryIn(ctx, bw, nil, "imageID", imageIDs)
 }
 
 func (s *KeypointStore) DeleteKeypointsByKeypointLabelID(ctx context.Context, keypointLabelID string) error {
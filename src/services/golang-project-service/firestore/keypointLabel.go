@@ -4,8 +4,6 @@ import (
 	"context"
 
 	fs "pkg/gcp/firestore"
-
-	"cloud.google.com/go/firestore"
 )
 
 const (
@@ -69,46 +67,64 @@ func (s *KeypointLabelStore) CreateKeypointLabel(ctx context.Context, req Create
 		{Path: "projectID", Op: "==", Value: req.ProjectID},
 	}
 
-	docs, err := s.genericStore.ReadCollection(ctx, qp)
+	// check and create in one transaction so concurrent creates cannot both pass the check
+	var id string
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection(qp)
+		if err != nil {
+			return err
+		}
+		if len(docs) > 0 {
+			return fs.ErrAlreadyExists
+		}
+		id, err = tx.CreateDoc(keypointLabel)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
-	if len(docs) > 0 {
-		return "", fs.ErrAlreadyExists
-	}
-
-	return s.genericStore.CreateDoc(ctx, keypointLabel)
+	return id, nil
 }
 
 func (s *KeypointLabelStore) DeleteKeypointLabel(ctx context.Context, keypointLabelID string) error {
 	return s.genericStore.DeleteDoc(ctx, keypointLabelID)
 }
 
-func (s *KeypointLabelStore) UpdateKeypointLabelName(ctx context.Context, req UpdateKeypointLabelRequest) error {
+// DeleteKeypointLabelsByProjectID queues deletes on bw for every label of projectID.
+func (s *KeypointLabelStore) DeleteKeypointLabelsByProjectID(ctx context.Context, bw fs.BulkWriter, projectID string) error {
+	return s.genericStore.BulkDeleteDocsByQueryIn(ctx, bw, nil, "projectID", []string{projectID})
+}
 
-	kpl, err := s.GetKeypointLabel(ctx, req.KeypointLabelID)
-	if err == fs.ErrNotFound {
-		return fs.ErrNotFound
-	}
+func (s *KeypointLabelStore) UpdateKeypointLabelName(ctx context.Context, req UpdateKeypointLabelRequest) error {
 
-	qp := []fs.QueryParameter{
-		{Path: "keypointLabel", Op: "==", Value: req.KeypointLabel},
-		{Path: "projectID", Op: "==", Value: kpl.ProjectID},
-	}
+	return s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docSnap, err := tx.GetDoc(req.KeypointLabelID)
+		if err != nil {
+			return err
+		}
+		var kpl KeypointLabel
+		if err := docSnap.DataTo(&kpl); err != nil {
+			return err
+		}
 
-	docs, err := s.genericStore.ReadCollection(ctx, qp)
-	if err != nil {
-		return err
-	}
-	if len(docs) > 0 {
-		return fs.ErrAlreadyExists
-	}
+		qp := []fs.QueryParameter{
+			{Path: "keypointLabel", Op: "==", Value: req.KeypointLabel},
+			{Path: "projectID", Op: "==", Value: kpl.ProjectID},
+		}
 
-	updateParams := []firestore.Update{
-		{Path: "keypointLabel", Value: req.KeypointLabel},
-	}
+		docs, err := tx.ReadCollection(qp)
+		if err != nil {
+			return err
+		}
+		if len(docs) > 0 {
+			return fs.ErrAlreadyExists
+		}
 
-	return s.genericStore.UpdateDoc(ctx, req.KeypointLabelID, updateParams)
+		updateParams := []fs.Update{
+			{Path: "keypointLabel", Value: req.KeypointLabel},
+		}
+		return tx.UpdateDoc(req.KeypointLabelID, updateParams)
+	})
 }
 
 func (s *KeypointLabelStore) GetKeypointLabel(ctx context.Context, keypointLabelID string) (KeypointLabel, error) {
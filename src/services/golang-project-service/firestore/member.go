@@ -0,0 +1,185 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	fs "pkg/gcp/firestore"
+	"pkg/roles"
+)
+
+const (
+	memberCollectionID = "projectMembers"
+)
+
+// ProjectMember gives a user other than the owner a role in a project. The owner has no member document; they
+// are the project's userID.
+type ProjectMember struct {
+	ProjectID string     `firestore:"projectID" json:"projectID"`
+	UserID    string     `firestore:"userID" json:"userID"`
+	Role      roles.Role `firestore:"role" json:"role"`
+	AddedBy   string     `firestore:"addedBy" json:"addedBy"`
+	AddedAt   time.Time  `firestore:"addedAt" json:"addedAt"`
+	// Email is filled in when members are listed; it is not stored so it never goes stale
+	Email string `firestore:"-" json:"email,omitempty"`
+}
+
+type MemberStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewMemberStore(client fs.FirestoreClientInterface) *MemberStore {
+	return &MemberStore{genericStore: fs.NewGenericStore(client, memberCollectionID)}
+}
+
+func memberQuery(projectID, userID string) []fs.QueryParameter {
+	return []fs.QueryParameter{
+		{Path: "projectID", Op: "==", Value: projectID},
+		{Path: "userID", Op: "==", Value: userID},
+	}
+}
+
+// GetMember returns the membership of userID in projectID, or fs.ErrNotFound if they are not a member.
+func (s *MemberStore) GetMember(ctx context.Context, projectID, userID string) (*ProjectMember, error) {
+	doc, err := s.genericStore.GetDocByQuery(ctx, memberQuery(projectID, userID))
+	if err != nil {
+		return nil, err
+	}
+	var m ProjectMember
+	if err := doc.DataTo(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetMembersByProjectID returns every member of projectID, apart from its owner.
+func (s *MemberStore) GetMembersByProjectID(ctx context.Context, projectID string) ([]ProjectMember, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "projectID", Op: "==", Value: projectID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return membersFromDocs(docs)
+}
+
+// GetMembershipsByUserID returns every project userID is a member of, apart from the ones they own.
+func (s *MemberStore) GetMembershipsByUserID(ctx context.Context, userID string) ([]ProjectMember, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "userID", Op: "==", Value: userID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return membersFromDocs(docs)
+}
+
+func membersFromDocs(docs []*fs.DocumentSnapshot) ([]ProjectMember, error) {
+	members := make([]ProjectMember, 0, len(docs))
+	for _, doc := range docs {
+		var m ProjectMember
+		if err := doc.DataTo(&m); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// AddMember gives userID role in projectID. A user who is already a member keeps the higher of the two roles, so
+// accepting an old invite never demotes anyone.
+func (s *MemberStore) AddMember(ctx context.Context, projectID, userID string, role roles.Role, addedBy string) (roles.Role, error) {
+	// check and write in one transaction so concurrent accepts cannot make two member documents
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection(memberQuery(projectID, userID))
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			_, err = tx.CreateDoc(ProjectMember{
+				ProjectID: projectID,
+				UserID:    userID,
+				Role:      role,
+				AddedBy:   addedBy,
+				AddedAt:   time.Now(),
+			})
+			return err
+		}
+		var existing ProjectMember
+		if err := docs[0].DataTo(&existing); err != nil {
+			return err
+		}
+		if !role.Outranks(existing.Role) {
+			role = existing.Role
+			return nil
+		}
+		return tx.UpdateDoc(docs[0].Ref.ID, []fs.Update{{Path: "role", Value: role}})
+	})
+	if err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+// changeMember reads the membership of userID in projectID in a transaction, calls check with it if check is not
+// nil, and then fn with its document. It returns the membership as it was read, or fs.ErrNotFound if they are not
+// a member, or the error from check without changing anything. Checking in the transaction is what stops two
+// admins changing the same member at once from getting round a check on the member's role.
+func (s *MemberStore) changeMember(ctx context.Context, projectID, userID string, check func(ProjectMember) error, fn func(tx fs.Transaction, docID string) error) (*ProjectMember, error) {
+	var member ProjectMember
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection(memberQuery(projectID, userID))
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return fs.ErrNotFound
+		}
+		if err := docs[0].DataTo(&member); err != nil {
+			return err
+		}
+		if check != nil {
+			if err := check(member); err != nil {
+				return err
+			}
+		}
+		return fn(tx, docs[0].Ref.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// UpdateRole changes the role of userID in projectID if check, when given, allows it for their membership. It
+// returns the membership as it was before, fs.ErrNotFound if they are not a member, or the error from check.
+func (s *MemberStore) UpdateRole(ctx context.Context, projectID, userID string, role roles.Role, check func(ProjectMember) error) (*ProjectMember, error) {
+	return s.changeMember(ctx, projectID, userID, check, func(tx fs.Transaction, docID string) error {
+		return tx.UpdateDoc(docID, []fs.Update{{Path: "role", Value: role}})
+	})
+}
+
+// RemoveMember takes userID out of projectID if check, when given, allows it for their membership. It returns
+// the membership that was removed, fs.ErrNotFound if they are not a member, or the error from check.
+func (s *MemberStore) RemoveMember(ctx context.Context, projectID, userID string, check func(ProjectMember) error) (*ProjectMember, error) {
+	return s.changeMember(ctx, projectID, userID, check, func(tx fs.Transaction, docID string) error {
+		return tx.DeleteDoc(docID)
+	})
+}
+
+// DeleteMembersByProjectID queues deletes of every membership of projectID on bw.
+func (s *MemberStore) DeleteMembersByProjectID(ctx context.Context, bw fs.BulkWriter, projectID string) error {
+	return s.genericStore.BulkDeleteDocsByQueryIn(ctx, bw, nil, "projectID", []string{projectID})
+}
+
+// DeleteMembershipsByUserID removes userID from every project they are a member of.
+func (s *MemberStore) DeleteMembershipsByUserID(ctx context.Context, userID string) error {
+	err := s.genericStore.DeleteDocsByQuery(ctx, []fs.QueryParameter{
+		{Path: "userID", Op: "==", Value: userID},
+	})
+	if errors.Is(err, fs.ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,254 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	fs "pkg/gcp/firestore"
+	"pkg/roles"
+)
+
+const (
+	organisationCollectionID = "organisations"
+	orgMemberCollectionID    = "organisationMembers"
+)
+
+// ErrLastOwner is returned when a change would leave an organisation with no owner.
+var ErrLastOwner = errors.New("an organisation must keep at least one owner")
+
+// Organisation owns projects on behalf of a team, so they outlive any one member's account.
+type Organisation struct {
+	OrgID     string    `firestore:"-" json:"orgID"`
+	Name      string    `firestore:"name" json:"name"`
+	CreatedBy string    `firestore:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+	// Role is what the user who asked for the organisation can do in it; it is not stored
+	Role roles.Role `firestore:"-" json:"role,omitempty"`
+}
+
+// OrganisationRequest is the body of creating or renaming an organisation.
+type OrganisationRequest struct {
+	Name string `json:"name"`
+}
+
+// OrgMember gives a user a role in an organisation, and so in every project it owns. Unlike projects, an
+// organisation can have several owners.
+type OrgMember struct {
+	OrgID   string     `firestore:"orgID" json:"orgID"`
+	UserID  string     `firestore:"userID" json:"userID"`
+	Role    roles.Role `firestore:"role" json:"role"`
+	AddedBy string     `firestore:"addedBy" json:"addedBy"`
+	AddedAt time.Time  `firestore:"addedAt" json:"addedAt"`
+	// Email is filled in when members are listed; it is not stored so it never goes stale
+	Email string `firestore:"-" json:"email,omitempty"`
+}
+
+type OrganisationStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewOrganisationStore(client fs.FirestoreClientInterface) *OrganisationStore {
+	return &OrganisationStore{genericStore: fs.NewGenericStore(client, organisationCollectionID)}
+}
+
+func (s *OrganisationStore) CreateOrganisation(ctx context.Context, name, userID string) (*Organisation, error) {
+	org := Organisation{
+		Name:      name,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+	id, err := s.genericStore.CreateDoc(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	org.OrgID = id
+	return &org, nil
+}
+
+func (s *OrganisationStore) GetOrganisation(ctx context.Context, orgID string) (*Organisation, error) {
+	doc, err := s.genericStore.GetDoc(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	var org Organisation
+	if err := doc.DataTo(&org); err != nil {
+		return nil, err
+	}
+	org.OrgID = doc.Ref.ID
+	return &org, nil
+}
+
+func (s *OrganisationStore) RenameOrganisation(ctx context.Context, orgID, name string) error {
+	return s.genericStore.UpdateDoc(ctx, orgID, []fs.Update{{Path: "name", Value: name}})
+}
+
+func (s *OrganisationStore) DeleteOrganisation(ctx context.Context, orgID string) error {
+	return s.genericStore.DeleteDoc(ctx, orgID)
+}
+
+type OrgMemberStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewOrgMemberStore(client fs.FirestoreClientInterface) *OrgMemberStore {
+	return &OrgMemberStore{genericStore: fs.NewGenericStore(client, orgMemberCollectionID)}
+}
+
+func orgMemberQuery(orgID, userID string) []fs.QueryParameter {
+	return []fs.QueryParameter{
+		{Path: "orgID", Op: "==", Value: orgID},
+		{Path: "userID", Op: "==", Value: userID},
+	}
+}
+
+// GetRole returns the role of userID in orgID, or the empty role if they are not a member.
+func (s *OrgMemberStore) GetRole(ctx context.Context, orgID, userID string) (roles.Role, error) {
+	m, err := s.GetMember(ctx, orgID, userID)
+	if errors.Is(err, fs.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return m.Role, nil
+}
+
+// GetMember returns the membership of userID in orgID, or fs.ErrNotFound if they are not a member.
+func (s *OrgMemberStore) GetMember(ctx context.Context, orgID, userID string) (*OrgMember, error) {
+	doc, err := s.genericStore.GetDocByQuery(ctx, orgMemberQuery(orgID, userID))
+	if err != nil {
+		return nil, err
+	}
+	var m OrgMember
+	if err := doc.DataTo(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetMembersByOrgID returns every member of orgID, owners included.
+func (s *OrgMemberStore) GetMembersByOrgID(ctx context.Context, orgID string) ([]OrgMember, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "orgID", Op: "==", Value: orgID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orgMembersFromDocs(docs)
+}
+
+// GetMembershipsByUserID returns every organisation userID is a member of.
+func (s *OrgMemberStore) GetMembershipsByUserID(ctx context.Context, userID string) ([]OrgMember, error) {
+	docs, err := s.genericStore.ReadCollection(ctx, []fs.QueryParameter{
+		{Path: "userID", Op: "==", Value: userID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orgMembersFromDocs(docs)
+}
+
+func orgMembersFromDocs(docs []*fs.DocumentSnapshot) ([]OrgMember, error) {
+	members := make([]OrgMember, 0, len(docs))
+	for _, doc := range docs {
+		var m OrgMember
+		if err := doc.DataTo(&m); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// AddMember gives userID role in orgID. A user who is already a member keeps the higher of the two roles, so
+// accepting an old invite never demotes anyone.
+func (s *OrgMemberStore) AddMember(ctx context.Context, orgID, userID string, role roles.Role, addedBy string) (roles.Role, error) {
+	err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection(orgMemberQuery(orgID, userID))
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			_, err = tx.CreateDoc(OrgMember{
+				OrgID:   orgID,
+				UserID:  userID,
+				Role:    role,
+				AddedBy: addedBy,
+				AddedAt: time.Now(),
+			})
+			return err
+		}
+		var existing OrgMember
+		if err := docs[0].DataTo(&existing); err != nil {
+			return err
+		}
+		if !role.Outranks(existing.Role) {
+			role = existing.Role
+			return nil
+		}
+		return tx.UpdateDoc(docs[0].Ref.ID, []fs.Update{{Path: "role", Value: role}})
+	})
+	if err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+// changeMember reads every member of orgID in a transaction and calls fn with the document of userID and the
+// number of owners. It returns fs.ErrNotFound if userID is not a member. Reading them all in the transaction is
+// what stops two owners demoting each other at once and leaving none.
+func (s *OrgMemberStore) changeMember(ctx context.Context, orgID, userID string, fn func(tx fs.Transaction, docID string, member OrgMember, owners int) error) error {
+	return s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+		docs, err := tx.ReadCollection([]fs.QueryParameter{{Path: "orgID", Op: "==", Value: orgID}})
+		if err != nil {
+			return err
+		}
+		var docID string
+		var member OrgMember
+		owners := 0
+		for _, doc := range docs {
+			var m OrgMember
+			if err := doc.DataTo(&m); err != nil {
+				return err
+			}
+			if m.Role == roles.Owner {
+				owners++
+			}
+			if m.UserID == userID {
+				docID, member = doc.Ref.ID, m
+			}
+		}
+		if docID == "" {
+			return fs.ErrNotFound
+		}
+		return fn(tx, docID, member, owners)
+	})
+}
+
+// UpdateRole changes the role of userID in orgID. It returns ErrLastOwner if they are its only owner and
+// fs.ErrNotFound if they are not a member.
+func (s *OrgMemberStore) UpdateRole(ctx context.Context, orgID, userID string, role roles.Role) error {
+	return s.changeMember(ctx, orgID, userID, func(tx fs.Transaction, docID string, member OrgMember, owners int) error {
+		if member.Role == roles.Owner && role != roles.Owner && owners == 1 {
+			return ErrLastOwner
+		}
+		return tx.UpdateDoc(docID, []fs.Update{{Path: "role", Value: role}})
+	})
+}
+
+// RemoveMember takes userID out of orgID. It returns ErrLastOwner if they are its only owner and fs.ErrNotFound
+// if they are not a member.
+func (s *OrgMemberStore) RemoveMember(ctx context.Context, orgID, userID string) error {
+	return s.changeMember(ctx, orgID, userID, func(tx fs.Transaction, docID string, member OrgMember, owners int) error {
+		if member.Role == roles.Owner && owners == 1 {
+			return ErrLastOwner
+		}
+		return tx.DeleteDoc(docID)
+	})
+}
+
+// DeleteMembersByOrgID queues deletes of every membership of orgID on bw.
+func (s *OrgMemberStore) DeleteMembersByOrgID(ctx context.Context, bw fs.BulkWriter, orgID string) error {
+	return s.genericStore.BulkDeleteDocsByQueryIn(ctx, bw, nil, "orgID", []string{orgID})
+}
@@ -5,28 +5,39 @@ import (
 	"time"
 
 	fs "pkg/gcp/firestore"
-
-	"cloud.google.com/go/firestore"
+	"pkg/roles"
 )
 
 const (
 	projectCollectionID = "projects"
 )
 
+// Project is owned by either a user or an organisation, so only one of UserID and OrgID is set.
 type Project struct {
 	ProjectID       string    `firestore:"projectID,omitempty" json:"projectID"`
 	ProjectName     string    `firestore:"projectName,omitempty" json:"projectName"`
 	UserID          string    `firestore:"userID,omitempty" json:"userID"`
+	OrgID           string    `firestore:"orgID,omitempty" json:"orgID,omitempty"`
 	NumberOfBatches int64     `firestore:"numberOfBatches,omitempty" json:"numberOfBatches"`
 	LastUpdated     time.Time `firestore:"lastUpdated,omitempty" json:"lastUpdated"`
+	// Role is what the user who asked for the project can do in it; it is not stored
+	Role roles.Role `firestore:"-" json:"role,omitempty"`
 }
 
 type CreateProjectRequest struct {
-	UserID              string `json:"userID"`
+	UserID string `json:"userID"`
+	// OrgID creates the project in an organisation rather than for the user
+	OrgID               string `json:"orgID,omitempty"`
 	ProjectName         string `json:"projectName"`
 	CreateDefaultLabels bool   `json:"createDefaultLabels"`
 }
 
+// TransferProjectRequest names the new owner of a project: either a user or an organisation.
+type TransferProjectRequest struct {
+	UserID string `json:"userID,omitempty"`
+	OrgID  string `json:"orgID,omitempty"`
+}
+
 type RenameProjectRequest struct {
 	NewProjectName string `json:"newProjectName"`
 }
@@ -43,7 +54,9 @@ func NewProjectStore(client fs.FirestoreClientInterface) *ProjectStore {
 	return &ProjectStore{genericStore: fs.NewGenericStore(client, projectCollectionID)}
 }
 
-func (s *ProjectStore) GetProjectsByUserID(ctx context.Context, userID string) ([]Project, error) {
+// GetProjectsByUserID returns the projects userID owns, followed by the ones owned by orgIDs, the organisations
+// they belong to. Pass no orgIDs for only the projects that are the user's own.
+func (s *ProjectStore) GetProjectsByUserID(ctx context.Context, userID string, orgIDs []string) ([]Project, error) {
 
 	queryParams := []fs.QueryParameter{
 		{Path: "userID", Op: "==", Value: userID},
@@ -56,6 +69,45 @@ func (s *ProjectStore) GetProjectsByUserID(ctx context.Context, userID string) (
 		return nil, err
 	}
 
+	projects, err := projectsFromDocs(docs)
+	if err != nil {
+		return nil, err
+	}
+	orgProjects, err := s.GetProjectsByOrgIDs(ctx, orgIDs)
+	if err != nil {
+		return nil, err
+	}
+	return append(projects, orgProjects...), nil
+}
+
+// GetProjectsByOrgIDs returns the projects owned by any of orgIDs.
+func (s *ProjectStore) GetProjectsByOrgIDs(ctx context.Context, orgIDs []string) ([]Project, error) {
+	docs, err := s.genericStore.ReadCollectionIn(ctx, nil, "orgID", orgIDs)
+	if err != nil {
+		return nil, err
+	}
+	return projectsFromDocs(docs)
+}
+
+// GetProjectsPageByUserID returns one page of a user's projects ordered by name.
+// The returned token is empty on the last page.
+func (s *ProjectStore) GetProjectsPageByUserID(ctx context.Context, userID string, pageSize int, pageToken string) ([]Project, string, error) {
+	queryParams := []fs.QueryParameter{
+		{Path: "userID", Op: "==", Value: userID},
+	}
+	orderBy := []fs.OrderBy{{Path: "projectName", Direction: fs.Asc}}
+	docs, nextPageToken, err := s.genericStore.ReadPage(ctx, queryParams, orderBy, pageSize, pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+	projects, err := projectsFromDocs(docs)
+	if err != nil {
+		return nil, "", err
+	}
+	return projects, nextPageToken, nil
+}
+
+func projectsFromDocs(docs []*fs.DocumentSnapshot) ([]Project, error) {
 	projects := make([]Project, 0, len(docs))
 	for _, doc := range docs {
 		var p Project
@@ -87,6 +139,7 @@ func (s *ProjectStore) CreateProject(ctx context.Context, createProjectReq Creat
 	project := Project{
 		ProjectName: createProjectReq.ProjectName,
 		UserID:      createProjectReq.UserID,
+		OrgID:       createProjectReq.OrgID,
 		LastUpdated: time.Now(),
 	}
 
@@ -95,7 +148,7 @@ func (s *ProjectStore) CreateProject(ctx context.Context, createProjectReq Creat
 }
 
 func (s *ProjectStore) RenameProject(ctx context.Context, projectID string, renameProjectReq RenameProjectRequest) error {
-	updateParams := []firestore.Update{
+	updateParams := []fs.Update{
 		{Path: "projectName", Value: renameProjectReq.NewProjectName},
 		{Path: "lastUpdated", Value: time.Now()},
 	}
@@ -103,18 +156,39 @@ func (s *ProjectStore) RenameProject(ctx context.Context, projectID string, rena
 	return s.genericStore.UpdateDoc(ctx, projectID, updateParams)
 }
 
+// TransferProject makes the user or organisation in req the owner of projectID, in place of its current one. The
+// field of the other kind of owner is deleted, as it would be missing from a project created for the new owner, so
+// queries on it never match an empty value.
+func (s *ProjectStore) TransferProject(ctx context.Context, projectID string, req TransferProjectRequest) error {
+	updateParams := []fs.Update{
+		{Path: "userID", Value: ownerField(req.UserID)},
+		{Path: "orgID", Value: ownerField(req.OrgID)},
+		{Path: "lastUpdated", Value: time.Now()},
+	}
+
+	return s.genericStore.UpdateDoc(ctx, projectID, updateParams)
+}
+
+// ownerField is the update of an owner field to id, deleting it if id is empty.
+func ownerField(id string) interface{} {
+	if id == "" {
+		return fs.Delete
+	}
+	return id
+}
+
 func (s *ProjectStore) DeleteProject(ctx context.Context, projectID string) error {
 	return s.genericStore.DeleteDoc(ctx, projectID)
 }
 
 func (s *ProjectStore) UpdateProject(ctx context.Context, projectID string, req Project) (*Project, error) {
-	updateParams := []firestore.Update{}
+	updateParams := []fs.Update{}
 
 	if req.ProjectName != "" {
-		updateParams = append(updateParams, firestore.Update{Path: "projectName", Value: req.ProjectName})
+		updateParams = append(updateParams, fs.Update{Path: "projectName", Value: req.ProjectName})
 	}
 	// Always update lastUpdated
-	updateParams = append(updateParams, firestore.Update{Path: "lastUpdated", Value: time.Now()})
+	updateParams = append(updateParams, fs.Update{Path: "lastUpdated", Value: time.Now()})
 
 	if len(updateParams) == 0 {
 		return s.GetProject(ctx, projectID)
@@ -0,0 +1,647 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"pkg/audit"
+	"pkg/gcp"
+	"pkg/gcp/bucket"
+	fs "pkg/gcp/firestore"
+	"pkg/handler"
+	"pkg/jwt"
+	"pkg/roles"
+	"project-service/api"
+	"project-service/firestore"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestServer(ctx context.Context) (*gcp.Clients, *httptest.Server) {
+	// Setup logger to give colourised, human friendly output
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	// Run against the in-memory document store and a bucket on disk so the test needs no GCP credentials
+	opts := gcp.ClientOptions{
+		UseFirestore:    true,
+		FirestoreConfig: fs.FireStoreClientConfig{Backend: fs.MemoryBackend},
+		UseBucket:       true,
+		BucketConfig:    bucket.BucketClientConfig{Backend: bucket.LocalBackend, BucketName: "project-service-test"},
+	}
+	clients, err := gcp.InitialiseClients(ctx, opts)
+	if err != nil {
+		panic(err)
+	}
+	_ = os.Setenv("JWT_SECRET", "test-secret")
+
+	r := mux.NewRouter()
+	h := handler.NewHandler(ctx, clients, jwt.AuthMiddleware(clients), audit.NewLog(clients.Firestore, "project-service", audit.Config{}))
+	invites := api.InviteConfig{TTL: time.Hour}
+	buckets := api.InitialiseBuckets(h, bucket.GenericBucketConfig{UploadWorkers: 2, SignedURLExpiry: time.Hour})
+	api.RegisterProjectRoutes(r, h, buckets)
+	api.RegisterBatchRoutes(r, h, buckets)
+	api.RegisterImageRoutes(r, h, buckets)
+	api.RegisterKeypointLabelRoutes(r, h)
+	api.RegisterKeypointRoutes(r, h)
+	api.RegisterBoundingBoxLabelRoutes(r, h)
+	api.RegisterBoundingBoxRoutes(r, h)
+	api.RegisterExportRoutes(r, h, buckets)
+	api.RegisterMemberRoutes(r, h, invites)
+	api.RegisterOrganisationRoutes(r, h, invites, buckets)
+
+	return clients, httptest.NewServer(r)
+}
+
+// testUser is a user with a live session, as the auth service would have logged them in
+type testUser struct {
+	ID    string
+	Email string
+	Token string
+}
+
+func randomEmail() string {
+	return "testuser" + strconv.Itoa(rand.Intn(1000000)) + "@example.com"
+}
+
+// newUser stores a user with a random email and returns them with an access token. The email is verified.
+func newUser(t *testing.T, ctx context.Context, clients *gcp.Clients) testUser {
+	t.Helper()
+	email := randomEmail()
+	userID, err := fs.NewGenericStore(clients.Firestore, "users").CreateDoc(ctx, firestore.User{Email: email})
+	assert.NoError(t, err)
+	sessionID, _, err := jwt.NewSessionStore(clients.Firestore).CreateSession(ctx, userID, "test", time.Hour)
+	assert.NoError(t, err)
+	token, err := jwt.GenerateJWT(ctx, jwt.AccessClaims{UserID: userID, Email: email, SessionID: sessionID, EmailVerified: true}, time.Hour)
+	assert.NoError(t, err)
+	return testUser{ID: userID, Email: email, Token: token}
+}
+
+// testProject is a project with one batch of one image, and a member with each role below owner
+type testProject struct {
+	ID      string
+	BatchID string
+	ImageID string
+	Users   map[roles.Role]testUser
+}
+
+func newProject(t *testing.T, ctx context.Context, clients *gcp.Clients) testProject {
+	t.Helper()
+	owner := newUser(t, ctx, clients)
+	projectID, err := firestore.NewProjectStore(clients.Firestore).CreateProject(ctx, firestore.CreateProjectRequest{
+		UserID:      owner.ID,
+		ProjectName: "Test project",
+	})
+	assert.NoError(t, err)
+	batchID, err := firestore.NewBatchStore(clients.Firestore).CreateBatch(ctx, firestore.CreateBatchRequest{
+		ProjectID: projectID,
+		BatchName: "Test batch",
+	})
+	assert.NoError(t, err)
+	imageID, err := fs.NewGenericStore(clients.Firestore, "images").CreateDoc(ctx, firestore.Image{
+		ImageName: "test.jpg",
+		BatchID:   batchID,
+	})
+	assert.NoError(t, err)
+
+	p := testProject{ID: projectID, BatchID: batchID, ImageID: imageID, Users: map[roles.Role]testUser{roles.Owner: owner}}
+	members := firestore.NewMemberStore(clients.Firestore)
+	for _, role := range []roles.Role{roles.Viewer, roles.Annotator, roles.Reviewer, roles.Admin} {
+		p.Users[role] = newUser(t, ctx, clients)
+		_, err := members.AddMember(ctx, projectID, p.Users[role].ID, role, owner.ID)
+		assert.NoError(t, err)
+	}
+	return p
+}
+
+func postJSON(t *testing.T, url, token string, body any) *http.Response {
+	return sendJSON(t, http.MethodPost, url, token, body)
+}
+
+func sendJSON(t *testing.T, method, url, token string, body any) *http.Response {
+	return sendWithHeaders(t, method, url, token, body, nil)
+}
+
+func sendWithHeaders(t *testing.T, method, url, token string, body any, headers map[string]string) *http.Response {
+	return send(t, method, url, token, body, headers, nil)
+}
+
+// fetchJSON is sendJSON that decodes a successful response into out.
+func fetchJSON(t *testing.T, method, url, token string, body, out any) *http.Response {
+	return send(t, method, url, token, body, nil, out)
+}
+
+func send(t *testing.T, method, url, token string, body any, headers map[string]string, out any) *http.Response {
+	payload, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(payload))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return resp
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if out != nil && resp.StatusCode < 300 {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp
+}
+
+func TestRouteRoles(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	p := newProject(t, ctx, clients)
+	outsider := newUser(t, ctx, clients)
+
+	// bodies that cannot be decoded stop the handlers before they change anything, so only the role check decides
+	// whether a request is refused
+	const invalid = "not a request"
+	routes := []struct {
+		method string
+		path   string
+		role   roles.Role
+	}{
+		{"GET", "/projects/" + p.ID, roles.Viewer},
+		{"GET", "/projects/" + p.ID + "/members", roles.Viewer},
+		{"GET", "/batch/" + p.BatchID, roles.Viewer},
+		{"GET", "/batch/" + p.BatchID + "/images", roles.Viewer},
+		{"GET", "/images/" + p.ImageID + "/previous", roles.Viewer},
+		{"GET", "/projects/" + p.ID + "/images/" + p.ImageID + "/keypoints", roles.Viewer},
+		{"POST", "/projects/" + p.ID + "/images/" + p.ImageID + "/keypoints", roles.Annotator},
+		{"PATCH", "/batch/" + p.BatchID, roles.Reviewer},
+		{"PATCH", "/projects/" + p.ID, roles.Admin},
+		{"PUT", "/batch/" + p.BatchID, roles.Admin},
+		{"GET", "/projects/" + p.ID + "/invites", roles.Admin},
+		{"POST", "/projects/" + p.ID + "/keypointlabels", roles.Admin},
+		{"GET", "/projects/" + p.ID + "/audit", roles.Owner},
+	}
+	for _, rt := range routes {
+		for _, role := range []roles.Role{roles.Viewer, roles.Annotator, roles.Reviewer, roles.Admin, roles.Owner} {
+			resp := sendJSON(t, rt.method, server.URL+rt.path, p.Users[role].Token, invalid)
+			if role.AtLeast(rt.role) {
+				assert.NotEqual(t, http.StatusForbidden, resp.StatusCode, "%s %s as %s", rt.method, rt.path, role)
+			} else {
+				assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s %s as %s", rt.method, rt.path, role)
+			}
+		}
+		resp := sendJSON(t, rt.method, server.URL+rt.path, outsider.Token, invalid)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s %s as a non-member", rt.method, rt.path)
+		resp = sendJSON(t, rt.method, server.URL+rt.path, "", invalid)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "%s %s without a token", rt.method, rt.path)
+	}
+}
+
+func TestResourcesResolveToTheirProject(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	a := newProject(t, ctx, clients)
+	b := newProject(t, ctx, clients)
+	viewerA := a.Users[roles.Viewer]
+
+	// batches and images are checked against the project they are in, not one the caller can see
+	resp := sendJSON(t, "GET", server.URL+"/batch/"+a.BatchID, viewerA.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = sendJSON(t, "GET", server.URL+"/batch/"+b.BatchID, viewerA.Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendJSON(t, "GET", server.URL+"/images/"+b.ImageID+"/previous", viewerA.Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// an image of B cannot be reached through A, even by A's owner
+	resp = sendJSON(t, "GET", server.URL+"/projects/"+a.ID+"/images/"+a.ImageID+"/keypoints", viewerA.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = sendJSON(t, "GET", server.URL+"/projects/"+a.ID+"/images/"+b.ImageID+"/keypoints", a.Users[roles.Owner].Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/projects/"+a.ID+"/images/"+b.ImageID+"/keypoints", a.Users[roles.Owner].Token, map[string]any{})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// so is anything that does not exist
+	resp = sendJSON(t, "GET", server.URL+"/batch/missing", viewerA.Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestSessionViewerAccess(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	p := newProject(t, ctx, clients)
+	other := newProject(t, ctx, clients)
+	guest := newUser(t, ctx, clients)
+	sessions := fs.NewGenericStore(clients.Firestore, "sessions")
+	sessionID, err := sessions.CreateDoc(ctx, firestore.Session{
+		Owner:     firestore.Member{ID: p.Users[roles.Annotator].ID},
+		BatchID:   p.BatchID,
+		ProjectID: p.ID,
+		Members:   []firestore.Member{{ID: guest.ID, Email: guest.Email}},
+	})
+	assert.NoError(t, err)
+	withSession := map[string]string{"X-Session-Id": sessionID}
+
+	// a session member who is not a project member can read the project while the session runs
+	resp := sendJSON(t, "GET", server.URL+"/projects/"+p.ID, guest.Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendWithHeaders(t, "GET", server.URL+"/projects/"+p.ID, guest.Token, nil, withSession)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = sendWithHeaders(t, "GET", server.URL+"/batch/"+p.BatchID+"/images", guest.Token, nil, withSession)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// but not change it, or read routes that need more than viewer
+	resp = sendWithHeaders(t, "POST", server.URL+"/projects/"+p.ID+"/images/"+p.ImageID+"/keypoints", guest.Token, map[string]any{}, withSession)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendWithHeaders(t, "GET", server.URL+"/projects/"+p.ID+"/invites", guest.Token, nil, withSession)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// the session only opens its own project, and only to its members
+	resp = sendWithHeaders(t, "GET", server.URL+"/projects/"+other.ID, guest.Token, nil, withSession)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendWithHeaders(t, "GET", server.URL+"/projects/"+p.ID, newUser(t, ctx, clients).Token, nil, withSession)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestInviteEmailMatch(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	p := newProject(t, ctx, clients)
+	invitee := newUser(t, ctx, clients)
+	someoneElse := newUser(t, ctx, clients)
+
+	createInvite := func(role roles.Role) string {
+		var invite firestore.Invite
+		resp := fetchJSON(t, "POST", server.URL+"/projects/"+p.ID+"/invites", p.Users[roles.Admin].Token, firestore.CreateInviteRequest{Email: invitee.Email, Role: role}, &invite)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		return invite.InviteID
+	}
+
+	// admins cannot invite other admins
+	resp := postJSON(t, server.URL+"/projects/"+p.ID+"/invites", p.Users[roles.Admin].Token, firestore.CreateInviteRequest{Email: invitee.Email, Role: roles.Admin})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// only the invited email can answer an invite; to anyone else it does not exist
+	declined := createInvite(roles.Viewer)
+	resp = postJSON(t, server.URL+"/invites/"+declined+"/decline", someoneElse.Token, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/invites/"+declined+"/accept", someoneElse.Token, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/invites/"+declined+"/decline", invitee.Token, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/invites/"+declined+"/accept", invitee.Token, nil)
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+
+	accepted := createInvite(roles.Annotator)
+	resp = postJSON(t, server.URL+"/invites/"+accepted+"/accept", someoneElse.Token, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/invites/"+accepted+"/accept", invitee.Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	member, err := firestore.NewMemberStore(clients.Firestore).GetMember(ctx, p.ID, invitee.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, roles.Annotator, member.Role)
+	_, err = firestore.NewMemberStore(clients.Firestore).GetMember(ctx, p.ID, someoneElse.ID)
+	assert.ErrorIs(t, err, fs.ErrNotFound)
+
+	// an unverified email cannot answer invites sent to it
+	unverified := newUser(t, ctx, clients)
+	sessionID, _, err := jwt.NewSessionStore(clients.Firestore).CreateSession(ctx, unverified.ID, "test", time.Hour)
+	assert.NoError(t, err)
+	token, err := jwt.GenerateJWT(ctx, jwt.AccessClaims{UserID: unverified.ID, Email: unverified.Email, SessionID: sessionID}, time.Hour)
+	assert.NoError(t, err)
+	resp = sendJSON(t, "GET", server.URL+"/invites", token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestMemberChangesBelowCaller(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	p := newProject(t, ctx, clients)
+	admin := p.Users[roles.Admin]
+	otherAdmin := newUser(t, ctx, clients)
+	members := firestore.NewMemberStore(clients.Firestore)
+	_, err := members.AddMember(ctx, p.ID, otherAdmin.ID, roles.Admin, p.Users[roles.Owner].ID)
+	assert.NoError(t, err)
+	memberURL := func(userID string) string {
+		return fmt.Sprintf("%s/projects/%s/members/%s", server.URL, p.ID, userID)
+	}
+	roleOf := func(userID string) roles.Role {
+		m, err := members.GetMember(ctx, p.ID, userID)
+		assert.NoError(t, err)
+		return m.Role
+	}
+
+	// admins cannot promote anyone to admin, or change or remove another admin
+	resp := sendJSON(t, "PATCH", memberURL(p.Users[roles.Viewer].ID), admin.Token, api.UpdateMemberRequest{Role: roles.Admin})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, roles.Viewer, roleOf(p.Users[roles.Viewer].ID))
+	resp = sendJSON(t, "PATCH", memberURL(otherAdmin.ID), admin.Token, api.UpdateMemberRequest{Role: roles.Viewer})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, roles.Admin, roleOf(otherAdmin.ID))
+	resp = sendJSON(t, "DELETE", memberURL(otherAdmin.ID), admin.Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, roles.Admin, roleOf(otherAdmin.ID))
+	resp = sendJSON(t, "PATCH", memberURL(p.Users[roles.Owner].ID), admin.Token, api.UpdateMemberRequest{Role: roles.Viewer})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// members below them they can
+	resp = sendJSON(t, "PATCH", memberURL(p.Users[roles.Viewer].ID), admin.Token, api.UpdateMemberRequest{Role: roles.Reviewer})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, roles.Reviewer, roleOf(p.Users[roles.Viewer].ID))
+	resp = sendJSON(t, "DELETE", memberURL(p.Users[roles.Annotator].ID), admin.Token, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	_, err = members.GetMember(ctx, p.ID, p.Users[roles.Annotator].ID)
+	assert.ErrorIs(t, err, fs.ErrNotFound)
+
+	// anyone can leave, but not remove others; the owner can do both to admins
+	resp = sendJSON(t, "DELETE", memberURL(admin.ID), p.Users[roles.Reviewer].Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendJSON(t, "DELETE", memberURL(p.Users[roles.Reviewer].ID), p.Users[roles.Reviewer].Token, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = sendJSON(t, "PATCH", memberURL(otherAdmin.ID), p.Users[roles.Owner].Token, api.UpdateMemberRequest{Role: roles.Viewer})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = sendJSON(t, "DELETE", memberURL(admin.ID), p.Users[roles.Owner].Token, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = sendJSON(t, "DELETE", memberURL(p.Users[roles.Owner].ID), p.Users[roles.Owner].Token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// newOrganisation creates an organisation through the API, with owner as its owner, and adds a member with each
+// role below owner.
+func newOrganisation(t *testing.T, ctx context.Context, clients *gcp.Clients, serverURL string) (string, map[roles.Role]testUser) {
+	t.Helper()
+	users := map[roles.Role]testUser{roles.Owner: newUser(t, ctx, clients)}
+	var org firestore.Organisation
+	resp := fetchJSON(t, "POST", serverURL+"/organisations", users[roles.Owner].Token, firestore.OrganisationRequest{Name: "Test organisation"}, &org)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, roles.Owner, org.Role)
+
+	members := firestore.NewOrgMemberStore(clients.Firestore)
+	for _, role := range []roles.Role{roles.Viewer, roles.Annotator, roles.Reviewer, roles.Admin} {
+		users[role] = newUser(t, ctx, clients)
+		_, err := members.AddMember(ctx, org.OrgID, users[role].ID, role, users[roles.Owner].ID)
+		assert.NoError(t, err)
+	}
+	return org.OrgID, users
+}
+
+// storedProject returns the fields stored for projectID, to check which are set at all.
+func storedProject(t *testing.T, ctx context.Context, clients *gcp.Clients, projectID string) map[string]interface{} {
+	t.Helper()
+	doc, err := fs.NewGenericStore(clients.Firestore, "projects").GetDoc(ctx, projectID)
+	assert.NoError(t, err)
+	return doc.Data()
+}
+
+func TestOrganisationProjects(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	orgID, users := newOrganisation(t, ctx, clients, server.URL)
+	outsider := newUser(t, ctx, clients)
+
+	// only admins of an organisation can create projects in it, and the project belongs to the organisation alone
+	resp := postJSON(t, server.URL+"/projects", users[roles.Reviewer].Token, firestore.CreateProjectRequest{ProjectName: "Org project", OrgID: orgID})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = postJSON(t, server.URL+"/projects", outsider.Token, firestore.CreateProjectRequest{ProjectName: "Org project", OrgID: orgID})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	var created struct {
+		ProjectID string `json:"projectID"`
+	}
+	resp = fetchJSON(t, "POST", server.URL+"/projects", users[roles.Admin].Token, firestore.CreateProjectRequest{ProjectName: "Org project", OrgID: orgID}, &created)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	stored := storedProject(t, ctx, clients, created.ProjectID)
+	assert.Equal(t, orgID, stored["orgID"])
+	assert.NotContains(t, stored, "userID")
+
+	// members have the same role in the organisation's projects as in the organisation; its owners own them
+	for role, user := range users {
+		var project firestore.Project
+		resp = fetchJSON(t, "GET", server.URL+"/projects/"+created.ProjectID, user.Token, nil, &project)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, role, project.Role)
+	}
+	resp = sendJSON(t, "GET", server.URL+"/projects/"+created.ProjectID, outsider.Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendJSON(t, "PATCH", server.URL+"/projects/"+created.ProjectID, users[roles.Reviewer].Token, "not a request")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendJSON(t, "GET", server.URL+"/projects/"+created.ProjectID+"/audit", users[roles.Admin].Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendJSON(t, "GET", server.URL+"/projects/"+created.ProjectID+"/audit", users[roles.Owner].Token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// a project role above the organisation role wins
+	viewer := users[roles.Viewer]
+	_, err := firestore.NewMemberStore(clients.Firestore).AddMember(ctx, created.ProjectID, viewer.ID, roles.Admin, users[roles.Owner].ID)
+	assert.NoError(t, err)
+	var project firestore.Project
+	resp = fetchJSON(t, "GET", server.URL+"/projects/"+created.ProjectID, viewer.Token, nil, &project)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, roles.Admin, project.Role)
+
+	// the organisation's projects are listed to its members only
+	var orgProjects []firestore.Project
+	resp = fetchJSON(t, "GET", server.URL+"/organisations/"+orgID+"/projects", users[roles.Annotator].Token, nil, &orgProjects)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if assert.Len(t, orgProjects, 1) {
+		assert.Equal(t, created.ProjectID, orgProjects[0].ProjectID)
+		assert.Equal(t, roles.Annotator, orgProjects[0].Role)
+	}
+	resp = sendJSON(t, "GET", server.URL+"/organisations/"+orgID+"/projects", outsider.Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// the * wildcard lists the caller's own projects first, then the ones of their organisations and the ones
+	// shared with them, each with the caller's role
+	own, err := firestore.NewProjectStore(clients.Firestore).CreateProject(ctx, firestore.CreateProjectRequest{UserID: viewer.ID, ProjectName: "Own project"})
+	assert.NoError(t, err)
+	shared := newProject(t, ctx, clients)
+	_, err = firestore.NewMemberStore(clients.Firestore).AddMember(ctx, shared.ID, viewer.ID, roles.Annotator, shared.Users[roles.Owner].ID)
+	assert.NoError(t, err)
+	for _, query := range []string{"", "?pageSize=1"} {
+		var listed []firestore.Project
+		url := server.URL + "/projects/*" + query
+		for url != "" {
+			var page []firestore.Project
+			resp = fetchJSON(t, "GET", url, viewer.Token, nil, &page)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			listed = append(listed, page...)
+			url = ""
+			if next := resp.Header.Get(api.NextPageTokenHeader); next != "" {
+				url = server.URL + "/projects/*?pageSize=1&pageToken=" + next
+			}
+		}
+		got := map[string]roles.Role{}
+		var order []string
+		for _, p := range listed {
+			got[p.ProjectID] = p.Role
+			order = append(order, p.ProjectID)
+		}
+		assert.Equal(t, map[string]roles.Role{own: roles.Owner, created.ProjectID: roles.Admin, shared.ID: roles.Annotator}, got, "list%s", query)
+		if assert.NotEmpty(t, order) {
+			assert.Equal(t, own, order[0], "list%s", query)
+		}
+	}
+	var outsiderProjects []firestore.Project
+	resp = fetchJSON(t, "GET", server.URL+"/projects/*", outsider.Token, nil, &outsiderProjects)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, outsiderProjects)
+}
+
+func TestTransferProject(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	p := newProject(t, ctx, clients)
+	owner := p.Users[roles.Owner]
+	orgID, orgUsers := newOrganisation(t, ctx, clients, server.URL)
+	orgMembers := firestore.NewOrgMemberStore(clients.Firestore)
+	transferURL := server.URL + "/projects/" + p.ID + "/transfer"
+
+	// a write personal access token cannot give a project away or delete it
+	_, pat, err := jwt.NewPersonalTokenStore(clients.Firestore).CreateToken(ctx, owner.ID, "pipeline", []string{jwt.ScopeWrite}, time.Hour)
+	assert.NoError(t, err)
+	resp := postJSON(t, transferURL, pat, firestore.TransferProjectRequest{OrgID: orgID})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = sendJSON(t, http.MethodDelete, server.URL+"/projects/"+p.ID, pat, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = fetchJSON(t, "GET", server.URL+"/projects/"+p.ID, pat, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// a project can only be given to an organisation the owner administers, and only by its owner
+	_, err = orgMembers.AddMember(ctx, orgID, owner.ID, roles.Reviewer, orgUsers[roles.Owner].ID)
+	assert.NoError(t, err)
+	resp = postJSON(t, transferURL, owner.Token, firestore.TransferProjectRequest{OrgID: orgID})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = postJSON(t, transferURL, p.Users[roles.Admin].Token, firestore.TransferProjectRequest{OrgID: orgID})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = postJSON(t, transferURL, owner.Token, firestore.TransferProjectRequest{UserID: orgUsers[roles.Viewer].ID, OrgID: orgID})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	_, err = orgMembers.AddMember(ctx, orgID, owner.ID, roles.Admin, orgUsers[roles.Owner].ID)
+	assert.NoError(t, err)
+	resp = postJSON(t, transferURL, owner.Token, firestore.TransferProjectRequest{OrgID: orgID})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the user who owned it has no owner field left, and stays on as an admin
+	stored := storedProject(t, ctx, clients, p.ID)
+	assert.Equal(t, orgID, stored["orgID"])
+	assert.NotContains(t, stored, "userID")
+	member, err := firestore.NewMemberStore(clients.Firestore).GetMember(ctx, p.ID, owner.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, roles.Admin, member.Role)
+	var project firestore.Project
+	resp = fetchJSON(t, "GET", server.URL+"/projects/"+p.ID, orgUsers[roles.Owner].Token, nil, &project)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, roles.Owner, project.Role)
+
+	// the previous owner is no longer an owner, so cannot take it back
+	resp = postJSON(t, transferURL, owner.Token, firestore.TransferProjectRequest{UserID: owner.ID})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// the organisation's owners can give it to a user who can already reach it
+	resp = postJSON(t, transferURL, orgUsers[roles.Owner].Token, firestore.TransferProjectRequest{UserID: newUser(t, ctx, clients).ID})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	annotator := p.Users[roles.Annotator]
+	resp = postJSON(t, transferURL, orgUsers[roles.Owner].Token, firestore.TransferProjectRequest{UserID: annotator.ID})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	stored = storedProject(t, ctx, clients, p.ID)
+	assert.Equal(t, annotator.ID, stored["userID"])
+	assert.NotContains(t, stored, "orgID")
+	_, err = firestore.NewMemberStore(clients.Firestore).GetMember(ctx, p.ID, annotator.ID)
+	assert.ErrorIs(t, err, fs.ErrNotFound)
+	var listed []firestore.Project
+	resp = fetchJSON(t, "GET", server.URL+"/projects/*", annotator.Token, nil, &listed)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, roles.Owner, listed[0].Role)
+	}
+
+	// the organisation no longer reaches it
+	resp = sendJSON(t, "GET", server.URL+"/projects/"+p.ID, orgUsers[roles.Owner].Token, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	var orgProjects []firestore.Project
+	resp = fetchJSON(t, "GET", server.URL+"/organisations/"+orgID+"/projects", orgUsers[roles.Owner].Token, nil, &orgProjects)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, orgProjects)
+}
+
+func TestImagePageOrder(t *testing.T) {
+	ctx := context.Background()
+	clients, server := setupTestServer(ctx)
+	defer server.Close()
+	defer func() { _ = clients.Firestore.Close() }()
+
+	p := newProject(t, ctx, clients)
+	batchID, err := firestore.NewBatchStore(clients.Firestore).CreateBatch(ctx, firestore.CreateBatchRequest{
+		ProjectID: p.ID,
+		BatchName: "Frames",
+	})
+	assert.NoError(t, err)
+
+	// frames are listed in frame order and later uploads after earlier ones, whatever their names
+	images := firestore.NewImageStore(clients.Firestore)
+	var want []string
+	for _, names := range [][]string{
+		{batchID + "/b/clip_frame_9999.png", batchID + "/b/clip_frame_10000.png"},
+		{batchID + "/a/photo.jpg"},
+	} {
+		objects := bucket.ObjectList{}
+		for _, name := range names {
+			objects = append(objects, bucket.ObjectData{ImageName: name})
+		}
+		created, err := images.CreateImageMetadata(ctx, batchID, objects, len(names) > 1)
+		assert.NoError(t, err)
+		for _, img := range created {
+			want = append(want, img.ImageID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var got []string
+	url := server.URL + "/batch/" + batchID + "/images?pageSize=1"
+	for url != "" {
+		var page []firestore.Image
+		resp := fetchJSON(t, "GET", url, p.Users[roles.Viewer].Token, nil, &page)
+		if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+			break
+		}
+		for _, img := range page {
+			got = append(got, img.ImageID)
+		}
+		url = ""
+		if next := resp.Header.Get(api.NextPageTokenHeader); next != "" {
+			url = server.URL + "/batch/" + batchID + "/images?pageSize=1&pageToken=" + next
+		}
+	}
+	assert.Equal(t, want, got)
+}
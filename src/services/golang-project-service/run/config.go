@@ -0,0 +1,34 @@
+package run
+
+import (
+	"pkg/audit"
+	"pkg/config"
+	"pkg/gcp"
+	"pkg/gcp/bucket"
+	"pkg/gcp/secrets"
+	"pkg/jwt"
+	"pkg/operation"
+	"project-service/api"
+)
+
+// Config is everything the project service reads at startup. See pkg/config for how it is loaded.
+type Config struct {
+	Server  config.Server     `yaml:"server"`
+	Clients gcp.ClientOptions `yaml:"clients"`
+	Secrets secrets.Config    `yaml:"secrets"`
+	JWT     jwt.KeyConfig     `yaml:"jwt"`
+	// Verification says what users with unverified emails may not do
+	Verification jwt.VerificationPolicy `yaml:"verification"`
+	// Operations sets how the account deletion step run by this service is picked up and retried
+	Operations operation.Config `yaml:"operations"`
+	// Invites sets how long invites to projects and organisations last
+	Invites api.InviteConfig `yaml:"invites"`
+	// Audit sets how changes to projects and exports are recorded in the audit log
+	Audit audit.Config `yaml:"audit"`
+	// Images sets how many images are uploaded to the bucket at once and how long their URLs last
+	Images bucket.GenericBucketConfig `yaml:"images"`
+
+	// BucketJSONKeyName names the secret holding the service account key used to sign GCS URLs.
+	// It is only read when the key is not set directly with BUCKET_JSON_KEY.
+	BucketJSONKeyName string `env:"BUCKET_JSON_KEY_NAME" yaml:"bucketJSONKeyName"`
+}
@@ -8,13 +8,16 @@ import (
 	"syscall"
 	"time"
 
+	"pkg/audit"
+	"pkg/config"
 	"pkg/gcp"
+	"pkg/gcp/bucket"
+	"pkg/gcp/secrets"
 	"pkg/handler"
 	"pkg/jwt"
 	"project-service/api"
 
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -23,7 +26,7 @@ import (
 
 // load projects, create project, rename project, delete project, load batch info
 
-func setupHandlers(ctx context.Context, r *mux.Router, clients *gcp.Clients) {
+func setupHandlers(ctx context.Context, r *mux.Router, clients *gcp.Clients, cfg Config) {
 	authMw := jwt.AuthMiddleware(clients)
 
 	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -32,28 +35,35 @@ func setupHandlers(ctx context.Context, r *mux.Router, clients *gcp.Clients) {
 		}
 	}).Methods("GET")
 
-	h := handler.NewHandler(ctx, clients, authMw)
-	api.RegisterProjectRoutes(r, h)
-	api.RegisterBatchRoutes(r, h)
-	api.RegisterImageRoutes(r, h)
+	h := handler.NewHandler(ctx, clients, authMw, audit.NewLog(clients.Firestore, "project-service", cfg.Audit))
+	buckets := api.InitialiseBuckets(h, cfg.Images)
+	api.RegisterProjectRoutes(r, h, buckets)
+	api.RegisterBatchRoutes(r, h, buckets)
+	api.RegisterImageRoutes(r, h, buckets)
 	api.RegisterKeypointLabelRoutes(r, h)
 	api.RegisterKeypointRoutes(r, h)
 	api.RegisterBoundingBoxLabelRoutes(r, h)
 	api.RegisterBoundingBoxRoutes(r, h)
-	api.RegisterExportRoutes(r, h)
+	api.RegisterExportRoutes(r, h, buckets)
+	api.RegisterMemberRoutes(r, h, cfg.Invites)
+	api.RegisterOrganisationRoutes(r, h, cfg.Invites, buckets)
+	// delete the projects of users who delete their account
+	api.StartAccountDeletion(h, cfg.Operations, buckets)
+
+	// Objects in a local bucket are served by this service; access is granted by the URL signature
+	if localBucket, ok := clients.Bucket.(*bucket.LocalBucketClient); ok {
+		r.PathPrefix(bucket.LocalObjectPath).Handler(localBucket).Methods("GET")
+	}
 
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+func corsMiddleware(cfg config.CORS, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		allowedOrigin := os.Getenv("CORS_ALLOW_ORIGIN")
-		if allowedOrigin == "" {
-			allowedOrigin = "*" // fallback for dev
-		}
-		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-		w.Header().Set("Access-Control-Allow-Methods", os.Getenv("CORS_ALLOW_METHODS"))
-		w.Header().Set("Access-Control-Allow-Headers", os.Getenv("CORS_ALLOW_HEADERS"))
-		w.Header().Set("Access-Control-Allow-Credentials", os.Getenv("CORS_ALLOW_CREDENTIALS"))
+		w.Header().Set("Access-Control-Allow-Origin", cfg.AllowOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", cfg.AllowMethods)
+		w.Header().Set("Access-Control-Allow-Headers", cfg.AllowHeaders)
+		w.Header().Set("Access-Control-Allow-Credentials", cfg.AllowCredentials)
+		w.Header().Set("Access-Control-Expose-Headers", api.NextPageTokenHeader)
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -68,13 +78,15 @@ func Run() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
-	_ = godotenv.Load()
-	port := os.Getenv("PORT")
 
-	opts := gcp.ClientOptions{}
-	opts.LoadClientOptions()
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	config.Log(&cfg)
+	port := cfg.Server.Port
 
-	clients, err := gcp.InitialiseClients(ctx, opts)
+	clients, err := gcp.InitialiseClients(ctx, cfg.Clients)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize clients")
 	}
@@ -84,14 +96,16 @@ func Run() {
 		}
 	}()
 
-	if err := initialiseSecrets(ctx, clients); err != nil {
+	if err := initialiseSecrets(ctx, clients, cfg); err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize secrets")
 	}
 
+	jwt.SetVerificationPolicy(cfg.Verification)
+
 	r := mux.NewRouter()
-	setupHandlers(ctx, r, clients)
+	setupHandlers(ctx, r, clients, cfg)
 
-	corsWrapped := corsMiddleware(r)
+	corsWrapped := corsMiddleware(cfg.Server.CORS, r)
 
 	server := &http.Server{
 		Addr:    ":" + port,
@@ -116,26 +130,25 @@ func Run() {
 	log.Info().Msg("Server exited")
 }
 
-func initialiseSecrets(ctx context.Context, clients *gcp.Clients) error {
-	if clients.GSM == nil {
-		log.Fatal().Msg("GSM disabled. Set USE_GSM=true in .env")
-	}
-
-	projectID := os.Getenv("GCP_PROJECT_ID")
-	secretName := os.Getenv("JWT_SECRET_NAME")
-
-	secret, err := clients.GSM.GetSecret(ctx, projectID, secretName)
+func initialiseSecrets(ctx context.Context, clients *gcp.Clients, cfg Config) error {
+	provider, err := secrets.NewProvider(cfg.Secrets, clients.GSM)
 	if err != nil {
 		return err
 	}
-	_ = os.Setenv("JWT_SECRET", secret)
+	// JWT signing keys are refreshed in the background by the key store
+	if err := jwt.InitialiseKeys(ctx, provider, cfg.JWT); err != nil {
+		return err
+	}
 
-	// Load Bucket Signer JSON
-	bucketSignerSecretName := os.Getenv("BUCKET_JSON_KEY_NAME")
-	bucketJSONSecret, err := clients.GSM.GetSecret(ctx, projectID, bucketSignerSecretName)
+	// Load the bucket signer key from Secret Manager, unless it was configured directly (e.g. local development),
+	// in which case the bucket client was given it when it was created
+	gcsBucket, ok := clients.Bucket.(*bucket.BucketClient)
+	if !ok || cfg.Clients.BucketConfig.SignerKey != "" || cfg.BucketJSONKeyName == "" {
+		return nil
+	}
+	keyJSON, err := provider.GetSecret(ctx, cfg.BucketJSONKeyName)
 	if err != nil {
 		return err
 	}
-	_ = os.Setenv("BUCKET_JSON_KEY", bucketJSONSecret)
-	return nil
+	return gcsBucket.SetSignerKey(keyJSON)
 }
@@ -8,10 +8,14 @@ import (
 	"net/http"
 	"time"
 
+	"pkg/audit"
 	fs "pkg/gcp/firestore"
 	"pkg/handler"
 	"pkg/jwt"
+	"pkg/operation"
 	"pkg/password"
+	"pkg/roles"
+	"pkg/throttle"
 	"websocket-service/firestore"
 	wsjwt "websocket-service/jwt"
 	"websocket-service/websocket"
@@ -36,39 +40,34 @@ func newSessionHandler(h *handler.Handler, hub *websocket.WebSocketHub, stores S
 }
 
 // RegisterSessionRoutes wires both REST endpoints (token issuance) and websocket upgrade endpoints.
-func RegisterSessionRoutes(r *mux.Router, h *handler.Handler) {
+func RegisterSessionRoutes(r *mux.Router, h *handler.Handler, hubConfig websocket.HubConfig, throttleConfig throttle.Config, operationConfig operation.Config) {
 	stores := InitialiseSessionStores(h)
-	hub := websocket.NewWebSocketHub(stores.SessionStore)
+	hub := websocket.NewWebSocketHub(stores.SessionStore, hubConfig)
 	sh := newSessionHandler(h, hub, stores)
 
+	// end the sessions of users who delete their account
+	operation.NewWorker(h.Clients.Firestore, operation.DeleteAccount, operation.DeleteAccountStepSessions, sh.endUserSessions, operationConfig).Start(h.Ctx)
+	// keep the emails stored in sessions up to date when users change theirs
+	operation.NewWorker(h.Clients.Firestore, operation.ChangeEmail, operation.ChangeEmailStepSessions, sh.updateMemberEmail, operationConfig).Start(h.Ctx)
+
+	// wrong session passwords back off per user, per client address and per session
+	limiter := throttle.New(throttleConfig)
+	joinThrottle := limiter.Middleware([]int{http.StatusForbidden}, limiter.ByClientIP(), throttle.ByUser(), throttle.Key{
+		Name:   "session",
+		Shared: true,
+		From:   func(r *http.Request) string { return mux.Vars(r)["sessionID"] },
+	})
+
 	// REST: request tokens
-	r.HandleFunc("/sessions/{batchID}", sh.CreateSessionHandler).Methods("POST")
-	r.HandleFunc("/sessions/{sessionID}/join", sh.JoinSessionHandler).Methods("POST")
-	r.HandleFunc("/sessions/{sessionID}", sh.StopSessionHandler).Methods("DELETE")
-	r.HandleFunc("/sessions/{sessionID}/members/{memberID}", sh.KickMemberHandler).Methods("DELETE")
-	r.HandleFunc("/sessions/active", sh.ActiveSessionsHandler).Methods("GET")
+	// creating and joining are subject to the email verification policy
+	r.Handle("/sessions/{batchID}", h.AuthMw(jwt.RequireVerifiedEmail(jwt.ActionSessions, http.HandlerFunc(sh.CreateSessionHandler)))).Methods("POST")
+	r.Handle("/sessions/{sessionID}/join", h.AuthMw(jwt.RequireVerifiedEmail(jwt.ActionSessions, joinThrottle(http.HandlerFunc(sh.JoinSessionHandler))))).Methods("POST")
+	r.Handle("/sessions/{sessionID}", h.AuthMw(http.HandlerFunc(sh.StopSessionHandler))).Methods("DELETE")
+	r.Handle("/sessions/{sessionID}/members/{memberID}", h.AuthMw(http.HandlerFunc(sh.KickMemberHandler))).Methods("DELETE")
+	r.Handle("/sessions/active", h.AuthMw(http.HandlerFunc(sh.ActiveSessionsHandler))).Methods("GET")
 	// WebSocket: upgrade using tokens (handlers implemented in session_websocket.go)
-	r.HandleFunc("/sessions/{sessionID}/ws/create", sh.CreateSessionWebSocketHandler).Methods("GET")
-	r.HandleFunc("/sessions/{sessionID}/ws/join", sh.JoinSessionWebSocketHandler).Methods("GET")
-}
-
-// Helper function to extract email from JWT token
-func getEmailFromRequest(r *http.Request) string {
-	tokenString, err := jwt.GetAuthTokenString(r)
-	if err != nil {
-		return ""
-	}
-
-	claims, err := jwt.GetJWTClaims(tokenString)
-	if err != nil {
-		return ""
-	}
-
-	if email, ok := claims["email"].(string); ok {
-		return email
-	}
-
-	return ""
+	r.Handle("/sessions/{sessionID}/ws/create", sh.websocketAuth(sh.CreateSessionWebSocketHandler)).Methods("GET")
+	r.Handle("/sessions/{sessionID}/ws/join", sh.websocketAuth(sh.JoinSessionWebSocketHandler)).Methods("GET")
 }
 
 // Helper function to get user email by userID using UserStore
@@ -85,12 +84,10 @@ func (sh *SessionHandler) getUserEmailByID(ctx context.Context, userID string) s
 	return user.Email
 }
 
-// Helper function to get user email from JWT token or UserStore as fallback
+// Helper function to get user email from the request's principal or UserStore as fallback
 func (sh *SessionHandler) getUserEmailFromRequestOrStore(r *http.Request, userID string) string {
-	// First try to get email from JWT token
-	email := getEmailFromRequest(r)
-	if email != "" {
-		return email
+	if p, err := jwt.GetPrincipal(r); err == nil && p.UserID == userID && p.Email != "" {
+		return p.Email
 	}
 
 	// Fallback to UserStore lookup
@@ -107,14 +104,29 @@ type ActiveSessionResponse struct {
 	LastUpdated    time.Time          `json:"lastUpdated"`
 }
 
-// CreateSessionHandler validates ownership and returns a short-lived token; websocket is established later.
+// projectRole returns the higher of the roles userID has in project as a member and through the organisation that
+// owns it. It is only asked for users who do not own the project themselves.
+func (sh *SessionHandler) projectRole(ctx context.Context, project *firestore.Project, userID string) (roles.Role, error) {
+	role, err := sh.Stores.MemberStore.GetRole(ctx, project.ProjectID, userID)
+	if err != nil || project.OrgID == "" {
+		return role, err
+	}
+	orgRole, err := sh.Stores.OrgMemberStore.GetRole(ctx, project.OrgID, userID)
+	if err != nil {
+		return "", err
+	}
+	return roles.Max(role, orgRole), nil
+}
+
+// CreateSessionHandler checks the user may annotate the batch's project and returns a short-lived token;
+// websocket is established later.
 func (sh *SessionHandler) CreateSessionHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	batchID := vars["batchID"]
-	userIDParam := r.URL.Query().Get("userID")
-	if userIDParam == "" {
-		http.Error(w, "Missing userID query parameter", http.StatusBadRequest)
-		log.Error().Msg("Missing userID query parameter for create session")
+	userIDParam, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT for create session")
 		return
 	}
 
@@ -150,12 +162,19 @@ func (sh *SessionHandler) CreateSessionHandler(w http.ResponseWriter, r *http.Re
 		log.Error().Err(err).Msgf("Failed to get project ID from batch ID %s", batchID)
 		return
 	}
-	userID := project.UserID
-
-	if userID != req.UserID {
-		http.Error(w, "User is not authorized to create session from batch", http.StatusForbidden)
-		log.Warn().Msgf("User %s is not authorized to create session from batch %s", userID, batchID)
-		return
+	// the owner and members who can annotate, directly or through the project's organisation, may start sessions
+	if project.UserID != req.UserID {
+		role, err := sh.projectRole(r.Context(), project, req.UserID)
+		if err != nil {
+			http.Error(w, "Failed to check project role", http.StatusInternalServerError)
+			log.Error().Err(err).Str("projectID", projectID).Str("userID", req.UserID).Msg("Failed to get project role")
+			return
+		}
+		if !role.AtLeast(roles.Annotator) {
+			http.Error(w, "User is not authorized to create session from batch", http.StatusForbidden)
+			log.Warn().Msgf("User %s is not authorized to create session from batch %s", req.UserID, batchID)
+			return
+		}
 	}
 
 	req.ProjectID = projectID
@@ -198,10 +217,10 @@ func (sh *SessionHandler) CreateSessionHandler(w http.ResponseWriter, r *http.Re
 func (sh *SessionHandler) JoinSessionHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sessionID := vars["sessionID"]
-	userIDParam := r.URL.Query().Get("userID")
-	if userIDParam == "" {
-		http.Error(w, "Missing userID query parameter", http.StatusBadRequest)
-		log.Error().Msg("Missing userID query parameter for join session")
+	userIDParam, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Failed to get userID from JWT for join session")
 		return
 	}
 
@@ -248,6 +267,9 @@ func (sh *SessionHandler) JoinSessionHandler(w http.ResponseWriter, r *http.Requ
 			log.Warn().Str("sessionID", sessionID).Str("userID", req.UserID).Msg("Invalid session password")
 			return
 		}
+		if password.NeedsRehash(session.Password) {
+			sh.rehashSessionPassword(r.Context(), sessionID, req.Password)
+		}
 	}
 
 	if !isOwner {
@@ -307,6 +329,33 @@ func (sh *SessionHandler) JoinSessionHandler(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// rehashSessionPassword replaces the stored hash of the password of sessionID, made with an older algorithm or
+// weaker parameters, with one of pw at the current parameters. pw has already been checked, so failing to store
+// the new hash only leaves the old one in place for the next join.
+func (sh *SessionHandler) rehashSessionPassword(ctx context.Context, sessionID, pw string) {
+	hashedPassword, err := password.HashPassword(pw)
+	if err == nil {
+		err = sh.Stores.SessionStore.UpdatePassword(ctx, sessionID, hashedPassword)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("sessionID", sessionID).Msg("Failed to upgrade session password hash")
+		return
+	}
+	log.Info().Str("sessionID", sessionID).Msg("Upgraded session password hash")
+}
+
+// sessionEvent returns the audit event of action on the session of record. It is recorded against the session's
+// project, so the project's owner sees who stopped sessions and removed members from them.
+func sessionEvent(action audit.Action, record *firestore.SessionRecord, outcome audit.Outcome) audit.Event {
+	return audit.Event{
+		Action:       action,
+		ResourceType: audit.ResourceSession,
+		ResourceID:   record.ID,
+		ProjectID:    record.Session.ProjectID,
+		Outcome:      outcome,
+	}
+}
+
 // StopSessionHandler allows the session owner to terminate an active session via REST.
 func (sh *SessionHandler) StopSessionHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -315,9 +364,9 @@ func (sh *SessionHandler) StopSessionHandler(w http.ResponseWriter, r *http.Requ
 		http.Error(w, "Missing sessionID", http.StatusBadRequest)
 		return
 	}
-	userID := r.URL.Query().Get("userID")
-	if userID == "" {
-		http.Error(w, "Missing userID query parameter", http.StatusBadRequest)
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 	record, err := sh.Stores.SessionStore.GetSessionRecord(r.Context(), sessionID)
@@ -331,6 +380,7 @@ func (sh *SessionHandler) StopSessionHandler(w http.ResponseWriter, r *http.Requ
 	}
 	if record.Session.Owner.ID != userID {
 		http.Error(w, "Only the session owner can stop the session", http.StatusForbidden)
+		sh.Audit.RecordRequest(r, sessionEvent(audit.ActionStopSession, record, audit.OutcomeDenied))
 		return
 	}
 	sh.Hub.StopSession(sessionID)
@@ -339,9 +389,59 @@ func (sh *SessionHandler) StopSessionHandler(w http.ResponseWriter, r *http.Requ
 		log.Error().Err(err).Str("sessionID", sessionID).Msg("Failed to delete session during stop")
 		return
 	}
+	sh.Audit.RecordRequest(r, sessionEvent(audit.ActionStopSession, record, audit.OutcomeSuccess))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// endUserSessions is the websocket service's step of deleting an account: it stops every session the user
+// owns and removes them from the sessions of others, disconnecting their sockets.
+func (sh *SessionHandler) endUserSessions(ctx context.Context, op *operation.Operation) error {
+	userID := op.Subject
+	owned, err := sh.Stores.SessionStore.ListSessionsByOwner(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, record := range owned {
+		sh.Hub.StopSession(record.ID)
+		if err := sh.Stores.SessionStore.DeleteSession(ctx, record.ID); err != nil && err != fs.ErrNotFound {
+			return err
+		}
+		stopped := sessionEvent(audit.ActionStopSession, &record, audit.OutcomeSuccess)
+		stopped.ActorID = userID
+		stopped.Details = map[string]string{"reason": "account deleted", "operationID": op.ID}
+		sh.Audit.Record(ctx, stopped)
+	}
+
+	member := firestore.Member{ID: userID, Email: op.Params[operation.ParamEmail]}
+	joined, err := sh.Stores.SessionStore.ListSessionsWithMember(ctx, member)
+	if err != nil {
+		return err
+	}
+	for _, record := range joined {
+		if err := sh.Stores.SessionStore.RemoveMemberFromSession(ctx, record.ID, member.ID, member.Email); err != nil && err != fs.ErrNotFound {
+			return err
+		}
+		sh.Hub.KickMember(record.ID, member.ID)
+		left := sessionEvent(audit.ActionKickMember, &record, audit.OutcomeSuccess)
+		left.ActorID = userID
+		left.Details = map[string]string{"memberID": userID, "reason": "account deleted", "operationID": op.ID}
+		sh.Audit.Record(ctx, left)
+	}
+	log.Info().Str("userID", userID).Str("operationID", op.ID).Int("owned", len(owned)).Int("joined", len(joined)).Msg("Ended sessions of deleted user")
+	return nil
+}
+
+// updateMemberEmail is the websocket service's step of changing a user's email: it replaces the copies of the
+// email stored in sessions, which are used to remove the user from them.
+func (sh *SessionHandler) updateMemberEmail(ctx context.Context, op *operation.Operation) error {
+	updated, err := sh.Stores.SessionStore.UpdateMemberEmail(ctx, op.Subject, op.Params[operation.ParamPreviousEmail], op.Params[operation.ParamEmail])
+	if err != nil {
+		return err
+	}
+	log.Info().Str("userID", op.Subject).Str("operationID", op.ID).Int("sessions", updated).Msg("Updated email in sessions")
+	return nil
+}
+
 // ActiveSessionsHandler returns the active sessions for a project or specific batch.
 func (sh *SessionHandler) ActiveSessionsHandler(w http.ResponseWriter, r *http.Request) {
 	projectID := r.URL.Query().Get("projectID")
@@ -398,9 +498,9 @@ func (sh *SessionHandler) KickMemberHandler(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Missing sessionID or memberID", http.StatusBadRequest)
 		return
 	}
-	userID := r.URL.Query().Get("userID")
-	if userID == "" {
-		http.Error(w, "Missing userID query parameter", http.StatusBadRequest)
+	userID, err := jwt.GetUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 	record, err := sh.Stores.SessionStore.GetSessionRecord(r.Context(), sessionID)
@@ -414,6 +514,9 @@ func (sh *SessionHandler) KickMemberHandler(w http.ResponseWriter, r *http.Reque
 	}
 	if record.Session.Owner.ID != userID {
 		http.Error(w, "Only the session owner can remove members", http.StatusForbidden)
+		denied := sessionEvent(audit.ActionKickMember, record, audit.OutcomeDenied)
+		denied.Details = map[string]string{"memberID": memberID}
+		sh.Audit.RecordRequest(r, denied)
 		return
 	}
 	if memberID == record.Session.Owner.ID {
@@ -439,6 +542,9 @@ func (sh *SessionHandler) KickMemberHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	sh.Hub.KickMember(sessionID, memberID)
+	kicked := sessionEvent(audit.ActionKickMember, record, audit.OutcomeSuccess)
+	kicked.Details = map[string]string{"memberID": memberID, "memberEmail": memberEmail}
+	sh.Audit.RecordRequest(r, kicked)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"removed": true})
 }
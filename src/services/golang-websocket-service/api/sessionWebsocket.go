@@ -13,6 +13,24 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// websocketAuth puts upgrade requests behind AuthMw. Browsers cannot set headers on websocket requests, so the
+// access token may also be sent in the auth query parameter. Debug bypass tokens skip authentication.
+func (sh *SessionHandler) websocketAuth(next http.HandlerFunc) http.Handler {
+	authed := sh.AuthMw(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if constants.DebugBypassEnabled && r.URL.Query().Get("token") == constants.DebugBypassToken {
+			next(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") == "" {
+			if qpAuth := r.URL.Query().Get("auth"); qpAuth != "" {
+				r.Header.Set("Authorization", "Bearer "+qpAuth)
+			}
+		}
+		authed.ServeHTTP(w, r)
+	})
+}
+
 // CreateSessionWebSocketHandler upgrades for owner using provided short-lived token.
 func (sh *SessionHandler) CreateSessionWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -29,10 +47,7 @@ func (sh *SessionHandler) CreateSessionWebSocketHandler(w http.ResponseWriter, r
 		if batchID == "" {
 			batchID = constants.DebugDefaultBatchID
 		}
-		ownerID := r.URL.Query().Get("userID")
-		if ownerID == "" {
-			ownerID = constants.DebugDefaultOwnerID
-		}
+		ownerID := constants.DebugDefaultOwnerID
 		req := websocket.CreateSessionConnectionRequest{
 			OwnerID:    ownerID,
 			OwnerEmail: sh.getUserEmailFromRequestOrStore(r, ownerID),
@@ -46,18 +61,13 @@ func (sh *SessionHandler) CreateSessionWebSocketHandler(w http.ResponseWriter, r
 		return
 	}
 
-	if r.Header.Get("Authorization") == "" {
-		if qpAuth := r.URL.Query().Get("auth"); qpAuth != "" {
-			r.Header.Set("Authorization", "Bearer "+qpAuth)
-		}
-	}
-
 	claims, err := wsjwt.ValidateShortLivedSessionToken(token)
 	if err != nil || claims.SessionID != sessionID || claims.Purpose != "session-join" {
 		http.Error(w, "invalid token", http.StatusUnauthorized)
 		return
 	}
-	if err := pkgjwt.ValidateJWT(r, claims.UserID); err != nil { // ensure main auth token still present
+	// the join token must have been issued to the user whose access token is presented
+	if userID, err := pkgjwt.GetUserID(r); err != nil || userID != claims.UserID {
 		http.Error(w, "auth failed", http.StatusUnauthorized)
 		return
 	}
@@ -89,10 +99,7 @@ func (sh *SessionHandler) JoinSessionWebSocketHandler(w http.ResponseWriter, r *
 
 	// Debug bypass path: allow simple token override to skip JWT validation for local tooling (e.g., wscat)
 	if constants.DebugBypassEnabled && token == constants.DebugBypassToken {
-		memberID := r.URL.Query().Get("userID")
-		if memberID == "" {
-			memberID = constants.DebugDefaultUserID
-		}
+		memberID := constants.DebugDefaultUserID
 		req := websocket.JoinSessionConnectionRequest{
 			MemberID:    memberID,
 			MemberEmail: sh.getUserEmailFromRequestOrStore(r, memberID),
@@ -106,19 +113,13 @@ func (sh *SessionHandler) JoinSessionWebSocketHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	if r.Header.Get("Authorization") == "" {
-		if qpAuth := r.URL.Query().Get("auth"); qpAuth != "" {
-			r.Header.Set("Authorization", "Bearer "+qpAuth)
-		}
-	}
-
 	claims, err := wsjwt.ValidateShortLivedSessionToken(token)
 	if err != nil || claims.SessionID != sessionID || claims.Purpose != "session-join" {
 		http.Error(w, "invalid token", http.StatusUnauthorized)
 		return
 	}
 
-	if err := pkgjwt.ValidateJWT(r, claims.UserID); err != nil {
+	if userID, err := pkgjwt.GetUserID(r); err != nil || userID != claims.UserID {
 		http.Error(w, "auth failed", http.StatusUnauthorized)
 		return
 	}
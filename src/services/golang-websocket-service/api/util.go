@@ -7,19 +7,23 @@ import (
 
 // SessionStores groups the Firestore-backed stores required by session handlers.
 type SessionStores struct {
-	SessionStore *firestore.SessionStore
-	ProjectStore *firestore.ProjectStore
-	BatchStore   *firestore.BatchStore
-	UserStore    *firestore.UserStore
+	SessionStore   *firestore.SessionStore
+	ProjectStore   *firestore.ProjectStore
+	BatchStore     *firestore.BatchStore
+	UserStore      *firestore.UserStore
+	MemberStore    *firestore.MemberStore
+	OrgMemberStore *firestore.OrgMemberStore
 }
 
 // InitialiseSessionStores instantiates Firestore stores used across session REST and websocket handlers.
 func InitialiseSessionStores(h *handler.Handler) SessionStores {
 	client := h.Clients.Firestore
 	return SessionStores{
-		SessionStore: firestore.NewSessionStore(client),
-		ProjectStore: firestore.NewProjectStore(client),
-		BatchStore:   firestore.NewBatchStore(client),
-		UserStore:    firestore.NewUserStore(client),
+		SessionStore:   firestore.NewSessionStore(client),
+		ProjectStore:   firestore.NewProjectStore(client),
+		BatchStore:     firestore.NewBatchStore(client),
+		UserStore:      firestore.NewUserStore(client),
+		MemberStore:    firestore.NewMemberStore(client),
+		OrgMemberStore: firestore.NewOrgMemberStore(client),
 	}
 }
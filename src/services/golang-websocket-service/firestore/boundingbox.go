@@ -3,8 +3,6 @@ package firestore
 import (
 	"context"
 	pfs "pkg/gcp/firestore"
-
-	cfs "cloud.google.com/go/firestore"
 )
 
 const (
@@ -21,9 +19,9 @@ func NewBoundingBoxStore(client pfs.FirestoreClientInterface) *BoundingBoxStore
 
 // WatchByImagesID listens for realtime updates to boundingBoxes documents matching a specific imageID.
 // Returns a stop function to cancel the watch.
-func (s *BoundingBoxStore) WatchByImagesID(ctx context.Context, imageID string, onSnapshot func([]*cfs.DocumentSnapshot)) (func(), error) {
+func (s *BoundingBoxStore) WatchByImagesID(ctx context.Context, imageID string, onSnapshot func([]*pfs.DocumentSnapshot)) (func(), error) {
 	query := []pfs.QueryParameter{{Path: "imageID", Op: "==", Value: imageID}}
-	return s.generic.WatchCollection(ctx, query, func(docs []*cfs.DocumentSnapshot) {
+	return s.generic.WatchCollection(ctx, query, func(docs []*pfs.DocumentSnapshot) {
 		onSnapshot(docs)
 	})
 }
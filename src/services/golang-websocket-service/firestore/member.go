@@ -0,0 +1,82 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+
+	fs "pkg/gcp/firestore"
+	"pkg/roles"
+)
+
+const (
+	memberCollectionID    = "projectMembers"
+	orgMemberCollectionID = "organisationMembers"
+)
+
+// ProjectMember gives a user other than the owner a role in a project. The project service manages them.
+type ProjectMember struct {
+	ProjectID string     `firestore:"projectID" json:"projectID"`
+	UserID    string     `firestore:"userID" json:"userID"`
+	Role      roles.Role `firestore:"role" json:"role"`
+}
+
+// OrgMember gives a user a role in an organisation and every project it owns. The project service manages them.
+type OrgMember struct {
+	OrgID  string     `firestore:"orgID" json:"orgID"`
+	UserID string     `firestore:"userID" json:"userID"`
+	Role   roles.Role `firestore:"role" json:"role"`
+}
+
+type MemberStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewMemberStore(client fs.FirestoreClientInterface) *MemberStore {
+	return &MemberStore{genericStore: fs.NewGenericStore(client, memberCollectionID)}
+}
+
+// GetRole returns the member role of userID in projectID, or the empty role if they are not a member.
+func (s *MemberStore) GetRole(ctx context.Context, projectID, userID string) (roles.Role, error) {
+	doc, err := s.genericStore.GetDocByQuery(ctx, []fs.QueryParameter{
+		{Path: "projectID", Op: "==", Value: projectID},
+		{Path: "userID", Op: "==", Value: userID},
+	})
+	if errors.Is(err, fs.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var m ProjectMember
+	if err := doc.DataTo(&m); err != nil {
+		return "", err
+	}
+	return m.Role, nil
+}
+
+type OrgMemberStore struct {
+	genericStore *fs.GenericStore
+}
+
+func NewOrgMemberStore(client fs.FirestoreClientInterface) *OrgMemberStore {
+	return &OrgMemberStore{genericStore: fs.NewGenericStore(client, orgMemberCollectionID)}
+}
+
+// GetRole returns the role of userID in orgID, or the empty role if they are not a member.
+func (s *OrgMemberStore) GetRole(ctx context.Context, orgID, userID string) (roles.Role, error) {
+	doc, err := s.genericStore.GetDocByQuery(ctx, []fs.QueryParameter{
+		{Path: "orgID", Op: "==", Value: orgID},
+		{Path: "userID", Op: "==", Value: userID},
+	})
+	if errors.Is(err, fs.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var m OrgMember
+	if err := doc.DataTo(&m); err != nil {
+		return "", err
+	}
+	return m.Role, nil
+}
@@ -14,6 +14,7 @@ type Project struct {
 	ProjectID       string    `firestore:"projectID,omitempty" json:"projectID"`
 	ProjectName     string    `firestore:"projectName,omitempty" json:"projectName"`
 	UserID          string    `firestore:"userID,omitempty" json:"userID"`
+	OrgID           string    `firestore:"orgID,omitempty" json:"orgID,omitempty"`
 	NumberOfBatches int64     `firestore:"numberOfBatches,omitempty" json:"numberOfBatches"`
 	LastUpdated     time.Time `firestore:"lastUpdated,omitempty" json:"lastUpdated"`
 }
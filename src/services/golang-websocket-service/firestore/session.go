@@ -5,7 +5,6 @@ import (
 	fs "pkg/gcp/firestore"
 	"time"
 
-	"cloud.google.com/go/firestore"
 	"github.com/samber/lo"
 )
 
@@ -97,8 +96,8 @@ func (s *SessionStore) AddMemberToSession(ctx context.Context, req JoinSessionRe
 		ID:    req.UserID,
 		Email: req.UserEmail,
 	}
-	updateParams := []firestore.Update{
-		{Path: "members", Value: firestore.ArrayUnion(member)},
+	updateParams := []fs.Update{
+		{Path: "members", Value: fs.ArrayUnion(member)},
 		{Path: "lastUpdated", Value: time.Now()},
 	}
 	return s.genericStore.UpdateDoc(ctx, req.SessionID, updateParams)
@@ -109,20 +108,67 @@ func (s *SessionStore) RemoveMemberFromSession(ctx context.Context, sessionID st
 		ID:    memberID,
 		Email: memberEmail,
 	}
-	updateParams := []firestore.Update{
-		{Path: "members", Value: firestore.ArrayRemove(member)},
+	updateParams := []fs.Update{
+		{Path: "members", Value: fs.ArrayRemove(member)},
 		{Path: "lastUpdated", Value: time.Now()},
 	}
 	return s.genericStore.UpdateDoc(ctx, sessionID, updateParams)
 }
 
+// UpdateMemberEmail replaces the email stored for userID, as the owner or a member, in every session.
+func (s *SessionStore) UpdateMemberEmail(ctx context.Context, userID, previousEmail, email string) (int, error) {
+	owned, err := s.ListSessionsByOwner(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range owned {
+		if err := s.genericStore.UpdateDoc(ctx, record.ID, []fs.Update{{Path: "owner.email", Value: email}}); err != nil {
+			return 0, err
+		}
+	}
+	joined, err := s.ListSessionsWithMember(ctx, Member{ID: userID, Email: previousEmail})
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range joined {
+		// members is an array, so the whole of it is rewritten in a transaction to keep concurrent joins
+		err := s.genericStore.RunTransaction(ctx, func(tx fs.Transaction) error {
+			doc, err := tx.GetDoc(record.ID)
+			if err != nil {
+				return err
+			}
+			var session Session
+			if err := doc.DataTo(&session); err != nil {
+				return err
+			}
+			for i, m := range session.Members {
+				if m.ID == userID {
+					session.Members[i].Email = email
+				}
+			}
+			return tx.UpdateDoc(record.ID, []fs.Update{{Path: "members", Value: session.Members}})
+		})
+		if err != nil && err != fs.ErrNotFound {
+			return 0, err
+		}
+	}
+	return len(owned) + len(joined), nil
+}
+
 func (s *SessionStore) TouchSession(ctx context.Context, sessionID string) error {
-	updateParams := []firestore.Update{
+	updateParams := []fs.Update{
 		{Path: "lastUpdated", Value: time.Now()},
 	}
 	return s.genericStore.UpdateDoc(ctx, sessionID, updateParams)
 }
 
+// UpdatePassword replaces the password hash of sessionID.
+func (s *SessionStore) UpdatePassword(ctx context.Context, sessionID, hashedPassword string) error {
+	return s.genericStore.UpdateDoc(ctx, sessionID, []fs.Update{
+		{Path: "password", Value: hashedPassword},
+	})
+}
+
 func (s *SessionStore) IsUserInSession(ctx context.Context, req JoinSessionRequest) (bool, error) {
 	doc, err := s.genericStore.GetDoc(ctx, req.SessionID)
 	if err != nil {
@@ -177,10 +223,27 @@ func (s *SessionStore) GetSessionByBatch(ctx context.Context, batchID string) (*
 	return &SessionRecord{ID: doc.Ref.ID, Session: session}, nil
 }
 
+// ListSessionsByOwner returns the sessions started by userID.
+func (s *SessionStore) ListSessionsByOwner(ctx context.Context, userID string) ([]SessionRecord, error) {
+	return s.listSessions(ctx, []fs.QueryParameter{
+		{Path: "owner.id", Op: "==", Value: userID},
+	})
+}
+
+// ListSessionsWithMember returns the sessions member has joined.
+func (s *SessionStore) ListSessionsWithMember(ctx context.Context, member Member) ([]SessionRecord, error) {
+	return s.listSessions(ctx, []fs.QueryParameter{
+		{Path: "members", Op: "array-contains", Value: member},
+	})
+}
+
 func (s *SessionStore) ListSessionsByProject(ctx context.Context, projectID string) ([]SessionRecord, error) {
-	queryParams := []fs.QueryParameter{
+	return s.listSessions(ctx, []fs.QueryParameter{
 		{Path: "projectID", Op: "==", Value: projectID},
-	}
+	})
+}
+
+func (s *SessionStore) listSessions(ctx context.Context, queryParams []fs.QueryParameter) ([]SessionRecord, error) {
 	docs, err := s.genericStore.ReadCollection(ctx, queryParams)
 	if err != nil {
 		return nil, err
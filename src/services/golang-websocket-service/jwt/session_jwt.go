@@ -1,8 +1,9 @@
 package jwt
 
 import (
+	"crypto/rand"
 	"errors"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -23,16 +24,43 @@ type SessionJoinClaims struct {
 
 const sessionJoinPurpose = "session-join"
 
+var (
+	signingKeyMu sync.RWMutex
+	signingKey   []byte
+)
+
+// SetSigningKey sets the HMAC key for session join tokens. They are issued and checked only by this service,
+// so its key is never shared, and the service can verify user tokens with the auth service's public keys alone.
+// An empty key generates a random one, which is fine while the hub runs as a single instance.
+func SetSigningKey(key string) error {
+	k := []byte(key)
+	if len(k) == 0 {
+		k = make([]byte, 32)
+		if _, err := rand.Read(k); err != nil {
+			return err
+		}
+		log.Warn().Msg("SESSION_TOKEN_SECRET not set; using a random key for session join tokens")
+	}
+	signingKeyMu.Lock()
+	signingKey = k
+	signingKeyMu.Unlock()
+	return nil
+}
+
+func currentSigningKey() ([]byte, error) {
+	signingKeyMu.RLock()
+	defer signingKeyMu.RUnlock()
+	if len(signingKey) == 0 {
+		return nil, errors.New("session join token key not set")
+	}
+	return signingKey, nil
+}
+
 // GenerateShortLivedSessionToken creates a JWT with a very short expiry for authorizing a websocket upgrade
 func GenerateShortLivedSessionToken(userID, sessionID, batchID string, ttl time.Duration) (string, error) {
 	if ttl <= 0 {
 		ttl = 60 * time.Second
 	}
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Error().Msg("JWT_SECRET environment variable not set for session join token")
-		return "", errors.New("jwt secret not set")
-	}
 	claims := SessionJoinClaims{
 		UserID:    userID,
 		SessionID: sessionID,
@@ -43,8 +71,11 @@ func GenerateShortLivedSessionToken(userID, sessionID, batchID string, ttl time.
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(secret))
+	key, err := currentSigningKey()
+	if err != nil {
+		return "", err
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to sign session join token")
 		return "", err
@@ -54,17 +85,13 @@ func GenerateShortLivedSessionToken(userID, sessionID, batchID string, ttl time.
 
 // ValidateShortLivedSessionToken parses and validates the short-lived token and returns claims
 func ValidateShortLivedSessionToken(tokenString string) (*SessionJoinClaims, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Error().Msg("JWT_SECRET environment variable not set for session join token validation")
-		return nil, errors.New("jwt secret not set")
+	key, err := currentSigningKey()
+	if err != nil {
+		return nil, err
 	}
-	token, err := jwt.ParseWithClaims(tokenString, &SessionJoinClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &SessionJoinClaims{}, func(*jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
 		return nil, err
 	}
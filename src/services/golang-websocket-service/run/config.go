@@ -0,0 +1,31 @@
+package run
+
+import (
+	"pkg/audit"
+	"pkg/config"
+	"pkg/gcp"
+	"pkg/gcp/secrets"
+	"pkg/jwt"
+	"pkg/operation"
+	"pkg/throttle"
+	"websocket-service/websocket"
+)
+
+// Config is everything the websocket service reads at startup. See pkg/config for how it is loaded.
+type Config struct {
+	Server  config.Server       `yaml:"server"`
+	Clients gcp.ClientOptions   `yaml:"clients"`
+	Secrets secrets.Config      `yaml:"secrets"`
+	JWT     jwt.KeyConfig       `yaml:"jwt"`
+	Hub     websocket.HubConfig `yaml:"websocket"`
+	// Verification says what users with unverified emails may not do
+	Verification jwt.VerificationPolicy `yaml:"verification"`
+	// Throttle limits wrong session passwords when joining a session
+	Throttle throttle.Config `yaml:"throttle"`
+	// Audit sets how stopping sessions and removing their members are recorded in the audit log
+	Audit audit.Config `yaml:"audit"`
+	// Operations sets how the account deletion step run by this service is picked up and retried
+	Operations operation.Config `yaml:"operations"`
+	// SessionTokenSecret signs the short-lived tokens used to join a session's websocket
+	SessionTokenSecret string `env:"SESSION_TOKEN_SECRET" yaml:"sessionTokenSecret" secret:"true"`
+}
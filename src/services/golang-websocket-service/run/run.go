@@ -8,18 +8,21 @@ import (
 	"syscall"
 	"time"
 
+	"pkg/audit"
+	"pkg/config"
 	"pkg/gcp"
+	"pkg/gcp/secrets"
 	"pkg/handler"
 	"pkg/jwt"
 	"websocket-service/api"
+	wsjwt "websocket-service/jwt"
 
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-func setupHandlers(ctx context.Context, r *mux.Router, clients *gcp.Clients) {
+func setupHandlers(ctx context.Context, r *mux.Router, clients *gcp.Clients, cfg Config) {
 	authMw := jwt.AuthMiddleware(clients)
 
 	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -28,21 +31,17 @@ func setupHandlers(ctx context.Context, r *mux.Router, clients *gcp.Clients) {
 		}
 	}).Methods("GET")
 
-	h := handler.NewHandler(ctx, clients, authMw)
-	api.RegisterSessionRoutes(r, h)
+	h := handler.NewHandler(ctx, clients, authMw, audit.NewLog(clients.Firestore, "websocket-service", cfg.Audit))
+	api.RegisterSessionRoutes(r, h, cfg.Hub, cfg.Throttle, cfg.Operations)
 
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+func corsMiddleware(cfg config.CORS, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		allowedOrigin := os.Getenv("CORS_ALLOW_ORIGIN")
-		if allowedOrigin == "" {
-			allowedOrigin = "*" // fallback for dev
-		}
-		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-		w.Header().Set("Access-Control-Allow-Methods", os.Getenv("CORS_ALLOW_METHODS"))
-		w.Header().Set("Access-Control-Allow-Headers", os.Getenv("CORS_ALLOW_HEADERS"))
-		w.Header().Set("Access-Control-Allow-Credentials", os.Getenv("CORS_ALLOW_CREDENTIALS"))
+		w.Header().Set("Access-Control-Allow-Origin", cfg.AllowOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", cfg.AllowMethods)
+		w.Header().Set("Access-Control-Allow-Headers", cfg.AllowHeaders)
+		w.Header().Set("Access-Control-Allow-Credentials", cfg.AllowCredentials)
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -57,13 +56,15 @@ func Run() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
-	_ = godotenv.Load()
-	port := os.Getenv("PORT")
 
-	opts := gcp.ClientOptions{}
-	opts.LoadClientOptions()
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	config.Log(&cfg)
+	port := cfg.Server.Port
 
-	clients, err := gcp.InitialiseClients(ctx, opts)
+	clients, err := gcp.InitialiseClients(ctx, cfg.Clients)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize clients")
 	}
@@ -73,26 +74,24 @@ func Run() {
 		}
 	}()
 
-	// Ensure JWT secret is available: prefer env JWT_SECRET; otherwise fetch via GSM if available
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		if clients.GSM == nil {
-			log.Fatal().Msg("JWT_SECRET not set and GSM disabled. Set USE_GSM=true or provide JWT_SECRET in .env")
-		}
-		projectID := os.Getenv("GCP_PROJECT_ID")
-		secretName := os.Getenv("JWT_SECRET_NAME")
-		var err error
-		secret, err = clients.GSM.GetSecret(ctx, projectID, secretName)
-		if err != nil {
-			log.Fatal().Err(err).Msg("Failed to retrieve JWT Secret from GSM")
-		}
-		_ = os.Setenv("JWT_SECRET", secret)
+	// Load the JWT signing keys from the configured secrets provider; they are refreshed in the background
+	provider, err := secrets.NewProvider(cfg.Secrets, clients.GSM)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize secrets provider")
+	}
+	if err := jwt.InitialiseKeys(ctx, provider, cfg.JWT); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load JWT keys")
 	}
+	if err := wsjwt.SetSigningKey(cfg.SessionTokenSecret); err != nil {
+		log.Fatal().Err(err).Msg("Failed to set session join token key")
+	}
+
+	jwt.SetVerificationPolicy(cfg.Verification)
 
 	r := mux.NewRouter()
-	setupHandlers(ctx, r, clients)
+	setupHandlers(ctx, r, clients, cfg)
 
-	corsWrapped := corsMiddleware(r)
+	corsWrapped := corsMiddleware(cfg.Server.CORS, r)
 
 	server := &http.Server{
 		Addr:    ":" + port,
@@ -2,8 +2,6 @@ package websocket
 
 import (
 	"encoding/json"
-	"os"
-	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -27,13 +25,7 @@ type ChangeImageIDMessage struct {
 }
 
 func (h *WebSocketHub) startWebhookReader(c *Client, sessionID string) error {
-	timeoutSec := 60 // default timeout in seconds (lower for quicker disconnect detection)
-	if envTimeout := os.Getenv("WEBSOCKET_CONNECTION_TIMEOUT_SECONDS"); envTimeout != "" {
-		if t, err := strconv.Atoi(envTimeout); err == nil {
-			timeoutSec = t
-		}
-	}
-	timeout := time.Duration(timeoutSec)
+	timeout := time.Duration(h.config.ConnectionTimeoutSeconds)
 
 	c.conn.SetReadLimit(1 << 20) // 1MB
 	if err := c.conn.SetReadDeadline(time.Now().Add(timeout * time.Second)); err != nil {
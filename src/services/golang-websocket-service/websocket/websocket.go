@@ -2,6 +2,7 @@ package websocket
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"sync"
 	"time"
@@ -9,7 +10,6 @@ import (
 	fs "pkg/gcp/firestore"
 	wsfs "websocket-service/firestore"
 
-	"cloud.google.com/go/firestore"
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog/log"
 )
@@ -32,7 +32,23 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true }, // allow all origins; tighten in prod
 }
 
+// HubConfig controls how quickly dead connections are detected.
+type HubConfig struct {
+	// PingIntervalSeconds is how often clients are pinged; a missing pong reveals a disconnect.
+	PingIntervalSeconds int `env:"WEBSOCKET_PING_INTERVAL_SECONDS" yaml:"pingIntervalSeconds" default:"3"`
+	// ConnectionTimeoutSeconds is how long a connection may stay silent before it is closed.
+	ConnectionTimeoutSeconds int `env:"WEBSOCKET_CONNECTION_TIMEOUT_SECONDS" yaml:"connectionTimeoutSeconds" default:"60"`
+}
+
+func (c *HubConfig) Validate() error {
+	if c.PingIntervalSeconds <= 0 || c.ConnectionTimeoutSeconds <= 0 {
+		return errors.New("WEBSOCKET_PING_INTERVAL_SECONDS and WEBSOCKET_CONNECTION_TIMEOUT_SECONDS must be positive")
+	}
+	return nil
+}
+
 type WebSocketHub struct {
+	config   HubConfig
 	mu       sync.RWMutex
 	Sessions map[string]*Session
 	// This is needed in order to handle certain websocket events
@@ -74,8 +90,9 @@ func (c *Client) Close() {
 	}
 }
 
-func NewWebSocketHub(sessionStore *wsfs.SessionStore) *WebSocketHub {
+func NewWebSocketHub(sessionStore *wsfs.SessionStore, cfg HubConfig) *WebSocketHub {
 	return &WebSocketHub{
+		config:              cfg,
 		Sessions:            make(map[string]*Session),
 		SessionStore:        sessionStore,
 		KeyPointStore:       wsfs.NewKeypointStore(sessionStore.GenericClient()),
@@ -293,7 +310,7 @@ func (h *WebSocketHub) JoinSession(w http.ResponseWriter, r *http.Request, req J
 // startLabelsWatch starts a realtime Firestore watch for the labels of a given batchID.
 func (h *WebSocketHub) startLabelsWatch(c *Client, sessionID string) {
 	// stop any existing watch first
-	keypointStop, err := h.KeyPointStore.WatchByImagesID(context.Background(), c.imageID, func(docs []*firestore.DocumentSnapshot) {
+	keypointStop, err := h.KeyPointStore.WatchByImagesID(context.Background(), c.imageID, func(docs []*fs.DocumentSnapshot) {
 		// Send only to this client
 		notif := StandardNotification{
 			Type:      "key_points_snapshot",
@@ -308,7 +325,7 @@ func (h *WebSocketHub) startLabelsWatch(c *Client, sessionID string) {
 		return
 	}
 
-	boundingBoxStop, err := h.BoundingBoxStore.WatchByImagesID(context.Background(), c.imageID, func(docs []*firestore.DocumentSnapshot) {
+	boundingBoxStop, err := h.BoundingBoxStore.WatchByImagesID(context.Background(), c.imageID, func(docs []*fs.DocumentSnapshot) {
 		// Send only to this client
 		notif := StandardNotification{
 			Type:      "bounding_boxes_snapshot",
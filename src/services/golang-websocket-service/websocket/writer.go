@@ -1,8 +1,6 @@
 package websocket
 
 import (
-	"os"
-	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,13 +13,7 @@ func (h *WebSocketHub) startWebhookWriter(c *Client, role, sessionID string) err
 		ticker := time.NewTicker(30 * time.Second)
 
 		// Short-interval ping ticker to detect disconnects quickly via missing pong
-		pingIntervalSec := 3
-		if env := os.Getenv("WEBSOCKET_PING_INTERVAL_SECONDS"); env != "" {
-			if v, err := strconv.Atoi(env); err == nil && v > 0 {
-				pingIntervalSec = v
-			}
-		}
-		pingTicker := time.NewTicker(time.Duration(pingIntervalSec) * time.Second)
+		pingTicker := time.NewTicker(time.Duration(h.config.PingIntervalSeconds) * time.Second)
 
 		// defer occurs when a websocket connection is closed
 		defer func() {
@@ -31,3 +31,88 @@ resource "google_artifact_registry_repository" "repo" {
   format         = "DOCKER"
   description    = "Docker repository for application images"
 }
+
+# Composite indexes used by the paginated list endpoints in the project service
+resource "google_firestore_index" "projects_by_user_name" {
+  project    = var.project_id
+  database   = google_firestore_database.default.name
+  collection = "projects"
+
+  fields {
+    field_path = "userID"
+    order      = "ASCENDING"
+  }
+  fields {
+    field_path = "projectName"
+    order      = "ASCENDING"
+  }
+}
+
+resource "google_firestore_index" "batches_by_project_name" {
+  project    = var.project_id
+  database   = google_firestore_database.default.name
+  collection = "batches"
+
+  fields {
+    field_path = "projectID"
+    order      = "ASCENDING"
+  }
+  fields {
+    field_path = "batchName"
+    order      = "ASCENDING"
+  }
+}
+
+resource "google_firestore_index" "images_by_batch_upload" {
+  project    = var.project_id
+  database   = google_firestore_database.default.name
+  collection = "images"
+
+  fields {
+    field_path = "batchID"
+    order      = "ASCENDING"
+  }
+  fields {
+    field_path = "uploadedAt"
+    order      = "ASCENDING"
+  }
+  fields {
+    field_path = "position"
+    order      = "ASCENDING"
+  }
+}
+
+# Composite indexes used by the audit log query of the project service, newest events first
+resource "google_firestore_index" "audit_events_by_project_time" {
+  project    = var.project_id
+  database   = google_firestore_database.default.name
+  collection = "auditEvents"
+
+  fields {
+    field_path = "projectID"
+    order      = "ASCENDING"
+  }
+  fields {
+    field_path = "time"
+    order      = "DESCENDING"
+  }
+}
+
+resource "google_firestore_index" "audit_events_by_project_actor_time" {
+  project    = var.project_id
+  database   = google_firestore_database.default.name
+  collection = "auditEvents"
+
+  fields {
+    field_path = "projectID"
+    order      = "ASCENDING"
+  }
+  fields {
+    field_path = "actorID"
+    order      = "ASCENDING"
+  }
+  fields {
+    field_path = "time"
+    order      = "DESCENDING"
+  }
+}